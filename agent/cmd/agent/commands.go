@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/config"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/utils"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/clientip"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/pathnorm"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/positions"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/stats"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/useragent"
+)
+
+// maxLineSize matches the scanner buffer used when serving logs
+const maxLineSize = 1024 * 1024
+
+// errUsage reports invalid arguments; the usage has already been printed
+var errUsage = errors.New("invalid arguments")
+
+// command is a subcommand of the agent binary
+type command struct {
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands; everything but serve works offline
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"serve":           {"", "Run the agent's HTTP server (the default)", runServe},
+		"validate-config": {"", "Check the config file and environment, then exit", runValidateConfig},
+		"parse":           {"<file>", "Print the records parsed from a log file and the lines that fail to parse", runParse},
+		"stats":           {"<file|directory>", "Compute route and user agent metrics over a log file, archive or directory", runStats},
+		"geoip":           {"<ip>...", "Look up the location and autonomous system of addresses", runGeoIP},
+		"positions":       {"show|reset [file...]", "Show or reset the tracked read positions", runPositions},
+	}
+}
+
+// commandOrder is the order commands are listed in the usage
+var commandOrder = []string{"serve", "validate-config", "parse", "stats", "geoip", "positions"}
+
+// runCommand runs the subcommand named by the first argument and returns the exit code
+func runCommand(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	switch name {
+	case "help", "-h", "--help":
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	// Offline commands print their results on stdout, so logs go to stderr
+	if name != "serve" {
+		logger.SetOutput(os.Stderr)
+	}
+
+	if err := cmd.run(args); err != nil {
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "agent %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// printUsage lists the subcommands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: agent [command] [-config file] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range commandOrder {
+		cmd := commands[name]
+		fmt.Fprintf(tw, "  %s %s\t%s\n", name, cmd.args, cmd.summary)
+	}
+	tw.Flush()
+}
+
+// newFlagSet creates the flags of a subcommand with the shared -config flag
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	cmd := commands[name]
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: agent %s [flags] %s\n\n%s\n\nFlags:\n", name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("config", config.FilePath(), "YAML config file (defaults to TRAEFIK_LOG_DASHBOARD_CONFIG_FILE)")
+	return fs, configFile
+}
+
+// parseFlags parses the arguments of a subcommand
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// runServe starts the HTTP server
+func runServe(args []string) error {
+	fs, configFile := newFlagSet("serve")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	serve(*configFile)
+	return nil
+}
+
+// runValidateConfig loads and validates the configuration without starting the server
+func runValidateConfig(args []string) error {
+	fs, configFile := newFlagSet("validate-config")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if _, err := config.LoadFile(*configFile); err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	if *configFile != "" {
+		fmt.Printf("Configuration is valid (%s and environment)\n", *configFile)
+	} else {
+		fmt.Println("Configuration is valid (environment only)")
+	}
+	return nil
+}
+
+// runParse prints every record parsed from a log file as a JSON line and
+// reports the lines that fail to parse
+func runParse(args []string) error {
+	fs, configFile := newFlagSet("parse")
+	failuresOnly := fs.Bool("failures", false, "Only report lines that fail to parse")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	if _, err := setupParsing(*configFile); err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	encoder := json.NewEncoder(os.Stdout)
+	parsed, failed := 0, 0
+	err := readLines(path, func(number int, line string) error {
+		entry, err := parseLine(line)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s:%d: %v: %s\n", path, number, err, line)
+			return nil
+		}
+		if entry == nil {
+			return nil
+		}
+		parsed++
+		if *failuresOnly {
+			return nil
+		}
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d record(s) parsed, %d line(s) failed\n", parsed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d line(s) failed to parse", failed)
+	}
+	return nil
+}
+
+// runStats computes the metrics served by the routes and user agent endpoints
+// over a log file, compressed archive or directory of logs
+func runStats(args []string) error {
+	fs, configFile := newFlagSet("stats")
+	limit := fs.Int("limit", 10, "Number of entries in each top list")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	cfg, err := setupParsing(*configFile)
+	if err != nil {
+		return err
+	}
+
+	files, err := logFiles(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var entries []*logs.TraefikLog
+	failed := 0
+	for _, path := range files {
+		err := readLines(path, func(_ int, line string) error {
+			entry, err := parseLine(line)
+			if err != nil {
+				failed++
+			} else if entry != nil {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	rules, err := pathnorm.ParseRules(cfg.PathPatterns)
+	if err != nil {
+		return fmt.Errorf("invalid path patterns: %w", err)
+	}
+	normalizer := pathnorm.New(pathnorm.Options{Rules: rules, QueryMode: pathnorm.ParseQueryMode(cfg.PathQueryMode)})
+	for _, entry := range entries {
+		normalizer.Observe(entry.RequestPath)
+	}
+	parser, err := useragent.NewParser(cfg.UserAgentRules)
+	if err != nil {
+		return fmt.Errorf("invalid user agent rules: %w", err)
+	}
+
+	statusClasses := make(map[string]int)
+	for _, entry := range entries {
+		statusClasses[fmt.Sprintf("%dxx", entry.DownstreamStatus/100)]++
+	}
+
+	result := map[string]interface{}{
+		"files":          files,
+		"total":          len(entries),
+		"parse_failures": failed,
+		"status_classes": statusClasses,
+		"routes":         stats.TopRoutes(entries, normalizer, *limit),
+		"templates":      normalizer.Templates(),
+		"user_agents":    stats.UserAgents(entries, parser, *limit),
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// runGeoIP looks up addresses in the configured GeoIP databases
+func runGeoIP(args []string) error {
+	fs, configFile := newFlagSet("geoip")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	cfg, err := config.LoadFile(*configFile)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+
+	location.SetDatabasePaths(cfg.GeoIPCityDB, cfg.GeoIPCountryDB)
+	location.SetASNDatabasePath(cfg.GeoIPASNDB)
+	err = location.InitializeLookups()
+	defer location.Close()
+	if !location.LocationsEnabled() && !location.ASNEnabled() {
+		if err != nil {
+			return fmt.Errorf("no GeoIP databases available: %w", err)
+		}
+		return errors.New("no GeoIP databases available")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	failed := 0
+	for _, ip := range fs.Args() {
+		loc, err := location.LocationLookup(ip)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", ip, err)
+			continue
+		}
+		if err := encoder.Encode(loc); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d lookup(s) failed", failed)
+	}
+	return nil
+}
+
+// runPositions shows or resets the read positions in the position file
+func runPositions(args []string) error {
+	fs, configFile := newFlagSet("positions")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || (fs.Arg(0) != "show" && fs.Arg(0) != "reset") {
+		fs.Usage()
+		return errUsage
+	}
+	cfg, err := config.LoadFile(*configFile)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	if cfg.PositionFile == "" {
+		return errors.New("no position file is configured")
+	}
+
+	store, err := positions.Open(cfg.PositionFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", cfg.PositionFile, err)
+	}
+
+	if fs.Arg(0) == "reset" {
+		removed := store.Reset(fs.Args()[1:]...)
+		if err := store.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Reset %d position(s) in %s\n", removed, cfg.PositionFile)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tPOSITION\tSIZE\tBEHIND")
+	for _, file := range store.Files() {
+		position, _ := store.Get(file)
+		size, behind := "-", "-"
+		if info, err := os.Stat(file); err == nil {
+			size = fmt.Sprint(info.Size())
+			behind = fmt.Sprint(max(info.Size()-position, 0))
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", file, position, size, behind)
+	}
+	return tw.Flush()
+}
+
+// parseLine parses an access log line like the server does, but reports lines
+// that match neither the JSON nor the CLF format instead of skipping them
+func parseLine(line string) (*logs.TraefikLog, error) {
+	entry, err := logs.ParseTraefikLog(line)
+	if err == nil && entry == nil && strings.TrimSpace(line) != "" {
+		return nil, errors.New("line matches neither the JSON nor the CLF format")
+	}
+	return entry, err
+}
+
+// setupParsing loads the configuration and applies the settings that change how
+// lines are parsed, so offline results match the server
+func setupParsing(configFile string) (*config.Config, error) {
+	cfg, err := config.LoadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	resolver, err := clientip.New(utils.SplitList(cfg.TrustedProxies), utils.SplitList(cfg.ClientIPHeaders))
+	if err != nil {
+		return nil, err
+	}
+	if resolver.Enabled() {
+		logs.SetClientIPResolver(resolver)
+	}
+	return cfg, nil
+}
+
+// logFiles returns the log file at path, or the log files in the directory at path
+func logFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	sandbox := logfiles.New(map[string]string{logfiles.SourceAccess: path})
+	listed, err := sandbox.Files(logfiles.SourceAccess)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(listed))
+	for _, file := range listed {
+		files = append(files, filepath.Join(path, file.Name))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no access log files found in %s", path)
+	}
+	return files, nil
+}
+
+// readLines calls fn with every line of a plain or gzip-compressed file
+func readLines(path string, fn func(number int, line string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if logfiles.IsCompressed(path) {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	number := 0
+	for scanner.Scan() {
+		number++
+		if err := fn(number, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -1,78 +1,343 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/audit"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/auth"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/config"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/middleware"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/routes"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/tlsconfig"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/utils"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/blocklist"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/clientip"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/search"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/security"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/state"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/stats"
 )
 
+var log = logger.With("agent")
+
+// Version is the agent's release, set at build time with
+// -ldflags "-X main.Version=..."
+var Version = "dev"
+
 func main() {
-	// Load configuration
-	cfg := config.Load()
+	os.Exit(runCommand(os.Args[1:]))
+}
 
-	logger.Log.Printf("Starting Traefik Log Dashboard Agent...")
-	logger.Log.Printf("Access Log Path: %s", cfg.AccessPath)
-	logger.Log.Printf("Error Log Path: %s", cfg.ErrorPath)
-	logger.Log.Printf("System Monitoring: %v", cfg.SystemMonitoring)
-	logger.Log.Printf("Port: %s", cfg.Port)
+// serve runs the agent's HTTP server until it receives an interrupt signal
+func serve(configFile string) {
+	// Load configuration from the config file, if any, and the environment
+	cfg, err := config.LoadFile(configFile)
+	if err != nil {
+		log.Fatal("Invalid configuration", logger.Err(err))
+	}
+	if err := logger.Configure(os.Stdout, cfg.AgentLogLevel, cfg.AgentLogFormat); err != nil {
+		log.Fatal("Invalid logging configuration", logger.Err(err))
+	}
+
+	log.Info("Starting Traefik Log Dashboard Agent",
+		"config_file", configFile,
+		"access_path", cfg.AccessPath,
+		"error_path", cfg.ErrorPath,
+		"system_monitoring", cfg.SystemMonitoring,
+		"port", cfg.Port)
+
+	// Derive real client IPs for requests forwarded by trusted proxies
+	resolver, err := clientip.New(utils.SplitList(cfg.TrustedProxies), utils.SplitList(cfg.ClientIPHeaders))
+	if err != nil {
+		log.Fatal("Invalid trusted proxy configuration", logger.Err(err))
+	}
+	if resolver.Enabled() {
+		logs.SetClientIPResolver(resolver)
+		log.Info("Trusted proxies enabled", "proxies", cfg.TrustedProxies, "headers", strings.Join(resolver.Headers(), ", "))
+	}
 
 	// Initialize GeoIP location services if enabled
 	if cfg.GeoIPEnabled {
-		logger.Log.Printf("GeoIP: Enabled")
 		location.SetDatabasePaths(cfg.GeoIPCityDB, cfg.GeoIPCountryDB)
+		location.SetASNDatabasePath(cfg.GeoIPASNDB)
+		location.SetCacheSize(cfg.GeoIPCacheSize)
 		
 		// Initialize location lookups
 		if err := location.InitializeLookups(); err != nil {
-			logger.Log.Printf("GeoIP: Failed to initialize (lookups will be unavailable): %v", err)
+			log.Warn("GeoIP failed to initialize; lookups will be unavailable", logger.Err(err))
 		} else if location.LocationsEnabled() {
-			logger.Log.Printf("GeoIP: Successfully initialized")
+			log.Info("GeoIP enabled")
 		} else {
-			logger.Log.Printf("GeoIP: No databases available (lookups will be unavailable)")
+			log.Warn("GeoIP has no databases available; lookups will be unavailable")
 		}
 
 		// Ensure cleanup on shutdown
 		defer location.Close()
 	} else {
-		logger.Log.Printf("GeoIP: Disabled")
+		log.Info("GeoIP disabled")
 	}
 
 	// Initialize authentication
 	authenticator := auth.NewAuthenticator(cfg.AuthToken)
+	if cfg.AuthKeysFile != "" {
+		if err := authenticator.LoadKeys(cfg.AuthKeysFile); err != nil {
+			log.Fatal("Failed to load API keys", logger.KeyPath, cfg.AuthKeysFile, logger.Err(err))
+		}
+		log.Info("Loaded API keys", logger.KeyPath, cfg.AuthKeysFile, "keys", authenticator.KeyCount())
+	}
+	var jwtValidator *auth.JWTValidator
+	if cfg.JWTJWKS != "" {
+		scopeMap, err := auth.ParseScopeMap(cfg.JWTScopeMap)
+		if err != nil {
+			log.Fatal("Invalid JWT scope map", logger.Err(err))
+		}
+		jwtValidator, err = auth.NewJWTValidator(auth.JWTConfig{
+			JWKS:       cfg.JWTJWKS,
+			Issuer:     cfg.JWTIssuer,
+			Audience:   cfg.JWTAudience,
+			ScopeClaim: cfg.JWTScopeClaim,
+			ScopeMap:   scopeMap,
+			Leeway:     time.Minute,
+		})
+		if err != nil {
+			log.Fatal("Failed to load JWKS", logger.KeyPath, cfg.JWTJWKS, logger.Err(err))
+		}
+		authenticator.SetJWTValidator(jwtValidator)
+		log.Info("Accepting JWTs", logger.KeyPath, cfg.JWTJWKS)
+	}
+	if cfg.TLSClientScopes != "" {
+		certScopes, err := auth.ParseScopeMap(cfg.TLSClientScopes)
+		if err != nil {
+			log.Fatal("Invalid client certificate scope map", logger.Err(err))
+		}
+		authenticator.SetClientCertScopes(certScopes)
+	}
 	if authenticator.IsEnabled() {
-		logger.Log.Printf("Authentication: Enabled")
+		log.Info("Authentication enabled")
 	} else {
-		logger.Log.Printf("Authentication: Disabled (no token configured)")
+		log.Warn("Authentication disabled; no token or API keys configured")
 	}
 
 	// Initialize route handler
 	handler := routes.NewHandler(cfg)
 
+	// Anonymize client data before it leaves the agent
+	redaction, err := redact.LoadSet(cfg.RedactionPolicy(), cfg.RedactPolicies)
+	if err != nil {
+		log.Fatal("Invalid redaction policies", logger.Err(err))
+	}
+	if redaction.Enabled() {
+		handler.SetRedaction(redaction)
+		log.Info("Redaction enabled")
+	}
+	// The default policy also applies to the findings saved on shutdown
+	var storedPolicy atomic.Pointer[redact.Policy]
+	storedPolicy.Store(redaction.Default())
+
+	// Record who pulled which data
+	var auditLog *audit.Log
+	if cfg.AuditFile != "" {
+		auditLog, err = audit.New(cfg.AuditFile, int64(cfg.AuditMaxSize)*1024*1024, cfg.AuditBackups)
+		if err != nil {
+			log.Fatal("Failed to open audit log", logger.KeyPath, cfg.AuditFile, logger.Err(err))
+		}
+		defer auditLog.Close()
+		auditLog.SetClientIPResolver(resolver)
+		handler.SetAuditLog(auditLog)
+		log.Info("Recording API requests", logger.KeyPath, cfg.AuditFile)
+	}
+
+	// Start the ingest pipeline that follows the access logs in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Pick up rotated API keys and signing keys without a restart
+	if cfg.AuthKeysFile != "" {
+		go authenticator.Watch(ctx, 10*time.Second)
+	}
+	if jwtValidator != nil {
+		go jwtValidator.Run(ctx, 15*time.Minute)
+	}
+
+	// Pick up refreshed or newly added GeoIP databases without a restart
+	if cfg.GeoIPEnabled {
+		go location.Watch(ctx, cfg.GeoIPReload)
+	}
+
+	pipeline := ingest.New(cfg.AccessPath, time.Duration(cfg.MonitorInterval)*time.Millisecond, cfg.IngestBackfill)
+	var geo *stats.GeoAggregator
+	var detector *security.Detector
+
+	// Learn route templates once per ingested line
+	pipeline.AddSink(handler.RouteLearner())
+
+	// Enrich entries with client locations and aggregate them by country and city
+	if cfg.GeoIPEnabled {
+		pipeline.SetLocator(func(ip string) location.Location {
+			loc, _ := location.LocationLookup(ip)
+			return loc
+		})
+		geo = stats.NewGeoAggregator(cfg.GeoIPRetention)
+		pipeline.AddSink(geo)
+		handler.SetGeoAggregator(geo)
+	}
+
+	if cfg.SecurityEnabled {
+		detector = security.NewDetector(security.Config{
+			Window:               cfg.SecurityWindow,
+			NotFoundThreshold:    cfg.Security404Max,
+			AuthFailureThreshold: cfg.SecurityAuthMax,
+			RateThreshold:        cfg.SecurityRateMax,
+		})
+		pipeline.AddSink(detector)
+		handler.SetDetector(detector)
+		log.Info("Security detection enabled")
+
+		if cfg.BlocklistEnabled {
+			manager, err := blocklist.New(blocklist.Config{
+				OutputPath:     cfg.BlocklistOutput,
+				StatePath:      cfg.BlocklistState,
+				TTL:            cfg.BlocklistTTL,
+				MinSeverity:    cfg.BlocklistMinSev,
+				MiddlewareName: cfg.BlocklistName,
+				PluginName:     cfg.BlocklistPlugin,
+				// Blocking a proxy would block everyone behind it
+				Allow: append(utils.SplitList(cfg.TrustedProxies), utils.SplitList(cfg.BlocklistAllow)...),
+			})
+			if err != nil {
+				log.Error("Block list failed to initialize", logger.Err(err))
+			} else {
+				handler.SetBlocklist(manager)
+				go manager.Run(ctx, detector, 30*time.Second)
+				log.Info("Block list enabled", logger.KeyPath, cfg.BlocklistOutput)
+			}
+		}
+	} else {
+		log.Info("Security detection disabled")
+	}
+
+	// Index access and error log fields for full-text search
+	var searchIndex *search.Index
+	if cfg.SearchEnabled {
+		searchIndex, err = search.Open(search.Config{
+			Dir:       cfg.SearchDir,
+			Retention: cfg.SearchRetention,
+			ErrorPath: cfg.ErrorPath,
+			Backfill:  cfg.IngestBackfill,
+		})
+		if err == nil {
+			// Stored entries get the default policy
+			err = searchIndex.SetPolicy(redaction.Default())
+		}
+		if err != nil {
+			log.Error("Search index failed to open", logger.KeyPath, cfg.SearchDir, logger.Err(err))
+			searchIndex = nil
+		} else {
+			pipeline.AddSink(searchIndex)
+			handler.SetSearchIndex(searchIndex)
+			log.Info("Search index enabled", logger.KeyPath, cfg.SearchDir)
+		}
+	}
+
+	// Resume from the state saved by the previous run
+	if cfg.StateFile != "" {
+		snapshot, err := state.Load(cfg.StateFile)
+		if err != nil {
+			log.Warn("Starting without saved state", logger.KeyPath, cfg.StateFile, logger.Err(err))
+		} else if snapshot != nil {
+			pipeline.SetOffsets(snapshot.Offsets, snapshot.Identities)
+			if geo != nil {
+				geo.Restore(snapshot.Geo)
+			}
+			if detector != nil {
+				detector.Restore(snapshot.Findings)
+			}
+			log.Info("Resumed saved state", logger.KeyPath, cfg.StateFile, "files", len(snapshot.Offsets), "saved_at", snapshot.SavedAt)
+		}
+	}
+
+	handler.SetPipeline(pipeline)
+	handler.SetAuthenticator(authenticator)
+	handler.SetVersion(Version)
+
+	pipelineDone := make(chan struct{})
+	go func() {
+		pipeline.Run(ctx)
+		close(pipelineDone)
+	}()
+	searchDone := make(chan struct{})
+	go func() {
+		if searchIndex != nil {
+			searchIndex.Run(ctx, time.Duration(cfg.MonitorInterval)*time.Millisecond)
+		}
+		close(searchDone)
+	}()
+
+	// Persist tracked positions from a single writer
+	go handler.Positions().Run(ctx, time.Second)
+
 	// Set up HTTP routes
 	mux := http.NewServeMux()
 
+	// protect authenticates a route and records it in the audit log
+	protect := func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return authenticator.Require(scope, auditLog.Wrap(next))
+	}
+
 	// Health check endpoint (no auth required)
 	mux.HandleFunc("/api/logs/status", handler.HandleStatus)
 
 	// Log endpoints (with auth)
-	mux.HandleFunc("/api/logs/access", authenticator.Middleware(handler.HandleAccessLogs))
-	mux.HandleFunc("/api/logs/error", authenticator.Middleware(handler.HandleErrorLogs))
-	mux.HandleFunc("/api/logs/get", authenticator.Middleware(handler.HandleGetLog))
+	mux.HandleFunc("/api/logs/access", protect(auth.ScopeAccessLogs, handler.HandleAccessLogs))
+	mux.HandleFunc("/api/logs/error", protect(auth.ScopeErrorLogs, handler.HandleErrorLogs))
+	// File endpoints check the scope of the requested source themselves
+	mux.HandleFunc("/api/logs/files", protect("", handler.HandleLogFiles))
+	mux.HandleFunc("/api/logs/get", protect("", handler.HandleGetLog))
+	mux.HandleFunc("/api/logs/routes", protect(auth.ScopeAccessLogs, handler.HandleRoutes))
+	mux.HandleFunc("/api/logs/useragents", protect(auth.ScopeAccessLogs, handler.HandleUserAgents))
+	mux.HandleFunc("/api/logs/export", protect(auth.ScopeAccessLogs, handler.HandleExport))
+	// Search checks the scope of each source itself
+	mux.HandleFunc("/api/logs/search", protect("", handler.HandleSearch))
 
 	// System endpoints (with auth)
-	mux.HandleFunc("/api/system/logs", authenticator.Middleware(handler.HandleSystemLogs))
-	mux.HandleFunc("/api/system/resources", authenticator.Middleware(handler.HandleSystemResources))
+	mux.HandleFunc("/api/system/logs", protect(auth.ScopeSystem, handler.HandleSystemLogs))
+	mux.HandleFunc("/api/system/resources", protect(auth.ScopeSystem, handler.HandleSystemResources))
 
 	// Location/GeoIP endpoints (with auth)
-	mux.HandleFunc("/api/location/lookup", authenticator.Middleware(handler.HandleLocationLookup))
-	mux.HandleFunc("/api/location/status", authenticator.Middleware(handler.HandleLocationStatus))
+	mux.HandleFunc("/api/location/lookup", protect(auth.ScopeGeo, handler.HandleLocationLookup))
+	mux.HandleFunc("/api/location/status", protect(auth.ScopeGeo, handler.HandleLocationStatus))
+	mux.HandleFunc("/api/location/asn", protect(auth.ScopeGeo, handler.HandleLocationASN))
+	mux.HandleFunc("/api/location/countries", protect(auth.ScopeGeo, handler.HandleLocationCountries))
+	mux.HandleFunc("/api/location/cities", protect(auth.ScopeGeo, handler.HandleLocationCities))
+
+	// Security endpoints (with auth)
+	mux.HandleFunc("/api/security/findings", protect(auth.ScopeAccessLogs, handler.HandleSecurityFindings))
+	mux.HandleFunc("/api/security/blocklist", protect(auth.ScopeAdmin, handler.HandleBlocklist))
+	mux.HandleFunc("/api/security/blocklist/pin", protect(auth.ScopeAdmin, handler.HandleBlocklistPin))
+	mux.HandleFunc("/api/security/blocklist/unpin", protect(auth.ScopeAdmin, handler.HandleBlocklistUnpin))
+
+	// Audit endpoint (admin only)
+	mux.HandleFunc("/api/audit", protect(auth.ScopeAdmin, handler.HandleAudit))
+
+	// Agent health endpoint (with auth)
+	mux.HandleFunc("/api/agent/stats", protect(auth.ScopeSystem, handler.HandleAgentStats))
+
+	// Versioned API and its OpenAPI document
+	handler.RegisterV2(mux, protect)
 
 	// Root endpoint
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -80,33 +345,231 @@ func main() {
 			http.NotFound(w, r)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{"status":"ok","service":"traefik-log-dashboard-agent","version":"1.0.0"}`)
+		api.WriteJSON(w, http.StatusOK, api.Root{
+			Status:      "ok",
+			Service:     "traefik-log-dashboard-agent",
+			Version:     Version,
+			APIVersions: api.Versions,
+		})
 	})
 
+	// Apply the CORS policy, security headers and request logging to every endpoint
+	httpHandler, err := wrapHandler(mux, cfg, cfg.TLSCertFile != "")
+	if err != nil {
+		log.Fatal("Invalid CORS configuration", logger.Err(err))
+	}
+	swappable := middleware.NewSwappable(httpHandler)
+
 	// Create HTTP server
 	server := &http.Server{
 		Addr:    ":" + cfg.Port,
-		Handler: mux,
+		Handler: swappable,
+	}
+
+	// Apply config file changes that do not need a restart; open connections,
+	// the ingest pipeline and tracked positions are left untouched
+	var watcher *config.Watcher
+	if configFile != "" {
+		watcher = config.NewWatcher(configFile, cfg, func(old, updated *config.Config) {
+			authenticator.SetToken(updated.AuthToken)
+			if err := logger.SetLevel(updated.AgentLogLevel); err != nil {
+				log.Warn("Keeping the running log level", logger.Err(err))
+			}
+
+			set, err := redact.LoadSet(updated.RedactionPolicy(), updated.RedactPolicies)
+			if err != nil {
+				log.Warn("Keeping the running redaction policies", logger.Err(err))
+			} else {
+				if set.Enabled() {
+					handler.SetRedaction(set)
+				} else {
+					handler.SetRedaction(nil)
+				}
+				storedPolicy.Store(set.Default())
+				if searchIndex != nil {
+					if err := searchIndex.SetPolicy(set.Default()); err != nil {
+						log.Warn("Failed to apply the redaction policy to the search index", logger.Err(err))
+					}
+				}
+			}
+
+			if httpHandler, err := wrapHandler(mux, updated, cfg.TLSCertFile != ""); err != nil {
+				log.Warn("Keeping the running CORS policy", logger.Err(err))
+			} else {
+				swappable.Store(httpHandler)
+			}
+
+			for _, key := range config.RestartRequired(old, updated) {
+				log.Warn("Setting changed; restart the agent to apply it", "key", key)
+			}
+			log.Info("Reloaded config file", logger.KeyPath, configFile)
+		})
+		go watcher.Watch(ctx, 5*time.Second)
+	}
+
+	// Serve HTTPS when a certificate is configured
+	if cfg.TLSCertFile != "" {
+		reloader, err := tlsconfig.New(tlsconfig.Config{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCA,
+			ClientAuth:   cfg.TLSClientAuth,
+			MinVersion:   cfg.TLSMinVersion,
+		})
+		if err != nil {
+			log.Fatal("Failed to load TLS certificates", logger.KeyPath, cfg.TLSCertFile, logger.Err(err))
+		}
+		server.TLSConfig = reloader.TLSConfig()
+		if cfg.TLSClientCA != "" {
+			log.Info("TLS enabled with client certificate verification", "client_auth", cfg.TLSClientAuth)
+		} else {
+			log.Info("TLS enabled")
+		}
 	}
 
 	// Start server in a goroutine
 	go func() {
-		logger.Log.Printf("Server listening on port %s", cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Log.Fatalf("Server error: %v", err)
+		log.Info("Server listening", "port", cfg.Port)
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal("Server error", logger.Err(err))
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server
+	// Serve profiles on a separate listener so they are never exposed with the API
+	var adminServer *http.Server
+	if cfg.PprofAddr != "" {
+		adminServer = &http.Server{Addr: cfg.PprofAddr, Handler: pprofHandler()}
+		go func() {
+			log.Info("Profiling listener enabled", "addr", cfg.PprofAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("Profiling listener failed", logger.Err(err))
+			}
+		}()
+	}
+
+	// Reload the config file on SIGHUP and wait for an interrupt signal to
+	// gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if watcher == nil {
+			log.Warn("Ignoring SIGHUP; no config file is configured")
+			continue
+		}
+		if err := watcher.Reload(); err != nil {
+			log.Warn("Keeping the running configuration", logger.KeyPath, configFile, logger.Err(err))
+		}
+	}
 
-	logger.Log.Printf("Shutting down server...")
-	if err := server.Close(); err != nil {
-		logger.Log.Fatalf("Server forced to shutdown: %v", err)
+	// Stop accepting connections and let in-flight requests finish
+	log.Info("Shutting down server")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Warn("Server forced to shut down", "timeout", cfg.ShutdownTimeout, logger.Err(err))
+		server.Close()
 	}
 
-	logger.Log.Printf("Server exited")
-}
\ No newline at end of file
+	if adminServer != nil {
+		adminServer.Close()
+	}
+
+	// Stop the background work, then persist what it left in memory
+	cancel()
+	select {
+	case <-pipelineDone:
+	case <-shutdownCtx.Done():
+		log.Warn("Ingest still reading at the shutdown deadline; saving the last completed offsets")
+	}
+	if err := handler.Positions().Flush(); err != nil {
+		log.Error("Failed to save positions", logger.KeyPath, cfg.PositionFile, logger.Err(err))
+	}
+	if searchIndex != nil {
+		select {
+		case <-searchDone:
+		case <-shutdownCtx.Done():
+		}
+		if err := searchIndex.Flush(); err != nil {
+			log.Error("Failed to save search index", logger.KeyPath, cfg.SearchDir, logger.Err(err))
+		}
+	}
+	if cfg.StateFile != "" {
+		snapshot := &state.Snapshot{SavedAt: time.Now().UTC(), Offsets: pipeline.Offsets(), Identities: pipeline.Identities()}
+		if geo != nil {
+			snapshot.Geo = geo.Snapshot()
+		}
+		if detector != nil {
+			snapshot.Findings = storedFindings(detector.Findings(security.Query{}), storedPolicy.Load())
+		}
+		if err := state.Save(cfg.StateFile, snapshot); err != nil {
+			log.Error("Failed to save state", logger.KeyPath, cfg.StateFile, logger.Err(err))
+		} else {
+			log.Info("Saved state", logger.KeyPath, cfg.StateFile)
+		}
+	}
+
+	log.Info("Server exited")
+}
+
+// storedFindings applies the default redaction policy to findings before they
+// are saved. A finding whose client address is truncated or hashed could
+// neither be resumed nor blocked after a restart, so none are kept when the
+// policy redacts addresses.
+func storedFindings(findings []security.Finding, policy *redact.Policy) []security.Finding {
+	if policy.RedactsIPs() {
+		return nil
+	}
+	for i := range findings {
+		findings[i].Evidence.Samples = logs.RedactLines(findings[i].Evidence.Samples, policy)
+	}
+	return findings
+}
+
+// wrapHandler applies the configured CORS policy, security headers and request
+// logging to next
+func wrapHandler(next http.Handler, cfg *config.Config, tlsEnabled bool) (http.Handler, error) {
+	cors, err := middleware.NewCORS(middleware.CORSConfig{
+		AllowedOrigins:   utils.SplitList(cfg.CORSOrigins),
+		AllowedMethods:   utils.SplitList(cfg.CORSMethods),
+		AllowedHeaders:   utils.SplitList(cfg.CORSHeaders),
+		AllowCredentials: cfg.CORSCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cors.Enabled() {
+		log.Info("CORS enabled", "origins", cfg.CORSOrigins)
+	} else {
+		log.Info("CORS disabled")
+	}
+
+	handler := cors.Handler(next)
+	if cfg.SecurityHeaders {
+		handler = middleware.SecurityHeaders(handler, tlsEnabled)
+	}
+	if cfg.RequestLog {
+		handler = middleware.RequestLog(handler)
+	}
+	return handler, nil
+}
+
+// pprofHandler serves the runtime profiles under /debug/pprof/
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
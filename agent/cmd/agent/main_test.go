@@ -1,15 +1,64 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"math/big"
+	"net"
+	"strings"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/audit"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/auth"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/config"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/middleware"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/routes"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/tlsconfig"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/blocklist"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/client"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/clientip"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/export"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/pathnorm"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/positions"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/search"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/security"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/state"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/stats"
 )
 
 func TestRootEndpoint(t *testing.T) {
@@ -73,6 +122,29 @@ func TestStatusEndpoint(t *testing.T) {
 	if response["status"] != "ok" {
 		t.Errorf("Expected status 'ok', got '%v'", response["status"])
 	}
+	if response["auth_enabled"] != false {
+		t.Errorf("Expected auth_enabled false without credentials, got %v", response["auth_enabled"])
+	}
+
+	// API keys enable authentication without a token
+	keysFile := t.TempDir() + "/keys.json"
+	keys := fmt.Sprintf(`{"keys":[{"id":"viewer","hash":%q,"scopes":["logs:access"]}]}`, auth.HashKey("viewer-key"))
+	if err := os.WriteFile(keysFile, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	authenticator := auth.NewAuthenticator("")
+	if err := authenticator.LoadKeys(keysFile); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	handler.SetAuthenticator(authenticator)
+	w = httptest.NewRecorder()
+	handler.HandleStatus(w, req)
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["auth_enabled"] != true {
+		t.Errorf("Expected auth_enabled true with only a keys file, got %v", response["auth_enabled"])
+	}
 }
 
 func TestAuthenticationMiddleware(t *testing.T) {
@@ -149,13 +221,598 @@ func TestCORSHeaders(t *testing.T) {
 	}
 
 	handler := routes.NewHandler(cfg)
-	req := httptest.NewRequest(http.MethodOptions, "/api/logs/status", nil)
+	authenticator := auth.NewAuthenticator("secret-token")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/logs/status", handler.HandleStatus)
+	mux.HandleFunc("/api/system/resources", authenticator.Middleware(handler.HandleSystemResources))
+
+	cors, err := middleware.NewCORS(middleware.CORSConfig{
+		AllowedOrigins:   []string{"https://dashboard.example.com", "https://*.internal.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CORS policy: %v", err)
+	}
+	server := middleware.SecurityHeaders(cors.Handler(mux), true)
+
+	// Preflight is answered without reaching the handler or requiring auth
+	req := httptest.NewRequest(http.MethodOptions, "/api/system/resources", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "authorization")
 	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
 
-	handler.HandleStatus(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected preflight status 204, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dashboard.example.com" {
+		t.Errorf("Expected the origin to be echoed, got %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("Expected credentials to be allowed")
+	}
+	if !strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete) {
+		t.Errorf("Expected default methods, got %q", w.Header().Get("Access-Control-Allow-Methods"))
+	}
+	if w.Header().Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" {
+		t.Errorf("Unexpected allowed headers %q", w.Header().Get("Access-Control-Allow-Headers"))
+	}
+	if w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Expected max age 600, got %q", w.Header().Get("Access-Control-Max-Age"))
+	}
+
+	// Wildcard subdomain patterns match
+	req = httptest.NewRequest(http.MethodGet, "/api/logs/status", nil)
+	req.Header.Set("Origin", "https://ops.internal.example.com")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://ops.internal.example.com" {
+		t.Errorf("Expected pattern origin to be allowed, got %q", got)
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Error("Expected Vary: Origin")
+	}
+
+	// Unknown origins get no CORS headers
+	req = httptest.NewRequest(http.MethodGet, "/api/logs/status", nil)
+	req.Header.Set("Origin", "https://evil.example.net")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Expected no CORS header for a disallowed origin")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	// Security headers are set on every response
+	for header, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Strict-Transport-Security": "max-age=31536000",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	// Credentials cannot be combined with any origin
+	if _, err := middleware.NewCORS(middleware.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}); err == nil {
+		t.Error("Expected an error for credentials with a wildcard origin")
+	}
+}
+
+func TestScopedAPIKeys(t *testing.T) {
+	keysFile := t.TempDir() + "/keys.json"
+	expired := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	keys := fmt.Sprintf(`{"keys":[
+		{"id":"contractors","hash":%q,"scopes":["logs:access","geo"]},
+		{"id":"ops","hash":%q,"scopes":["admin"]},
+		{"id":"old","hash":%q,"scopes":["admin"],"expires_at":%q}
+	]}`, auth.HashKey("contractor-key"), auth.HashKey("ops-key"), auth.HashKey("old-key"), expired)
+	if err := os.WriteFile(keysFile, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+
+	authenticator := auth.NewAuthenticator("")
+	if err := authenticator.LoadKeys(keysFile); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+
+	var keyID string
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.IdentityFromContext(r.Context())
+		keyID = identity.KeyID
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := []struct {
+		name           string
+		scope          string
+		key            string
+		expectedStatus int
+	}{
+		{"Scoped key on granted scope", auth.ScopeAccessLogs, "contractor-key", http.StatusOK},
+		{"Scoped key on other scope", auth.ScopeSystem, "contractor-key", http.StatusForbidden},
+		{"Admin key on any scope", auth.ScopeSystem, "ops-key", http.StatusOK},
+		{"Expired key", auth.ScopeAccessLogs, "old-key", http.StatusUnauthorized},
+		{"Unknown key", auth.ScopeAccessLogs, "nope", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			w := httptest.NewRecorder()
+
+			authenticator.Require(tt.scope, ok).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+
+	// Rotating the key file takes effect on reload
+	rotated := fmt.Sprintf(`{"keys":[{"id":"contractors-2","hash":%q,"scopes":["logs:access"]}]}`, auth.HashKey("new-contractor-key"))
+	if err := os.WriteFile(keysFile, []byte(rotated), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	if changed, err := authenticator.Reload(); err != nil || !changed {
+		t.Fatalf("Expected keys to reload, got changed=%v err=%v", changed, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer new-contractor-key")
+	w := httptest.NewRecorder()
+	authenticator.Require(auth.ScopeAccessLogs, ok).ServeHTTP(w, req)
+	if w.Code != http.StatusOK || keyID != "contractors-2" {
+		t.Errorf("Expected rotated key to authenticate as contractors-2, got %d %q", w.Code, keyID)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer contractor-key")
+	w = httptest.NewRecorder()
+	authenticator.Require(auth.ScopeAccessLogs, ok).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected removed key to be rejected, got %d", w.Code)
+	}
+}
+
+func TestRestrictedAPIKeys(t *testing.T) {
+	keysFile := t.TempDir() + "/keys.json"
+	keys := fmt.Sprintf(`{"keys":[{"id":"acme","hash":%q,"scopes":["logs:access","logs:error"],"restrict":{"hosts":["*.acme.example"]}},`+
+		`{"id":"acme-admin","hash":%q,"scopes":["admin"],"restrict":{"hosts":["*.acme.example"]}}]}`, auth.HashKey("acme-key"), auth.HashKey("acme-admin-key"))
+	if err := os.WriteFile(keysFile, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	authenticator := auth.NewAuthenticator("")
+	if err := authenticator.LoadKeys(keysFile); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+
+	logFile := t.TempDir() + "/access.log"
+	lines := `{"ClientHost":"198.51.100.1","RequestHost":"shop.acme.example","RequestPath":"/cart"}` + "\n"
+	lines += `{"ClientHost":"198.51.100.2","RequestHost":"other.example","RequestPath":"/secret"}` + "\n"
+	for i := 0; i < 30; i++ {
+		lines += fmt.Sprintf(`{"ClientHost":"198.51.100.2","RequestHost":"other.example","RequestPath":"/customers/customer-%c"}`, 'a'+i) + "\n"
+	}
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, ErrorPath: "/tmp/test-error.log"})
+	handler.SetDetector(security.NewDetector(security.DefaultConfig()))
+
+	get := func(path string, h http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer acme-key")
+		w := httptest.NewRecorder()
+		authenticator.Require(auth.ScopeAccessLogs, h).ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/logs/access?tail=true", handler.HandleAccessLogs)
+	var response struct {
+		Logs []string `json:"logs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Logs) != 1 || !strings.Contains(response.Logs[0], "shop.acme.example") {
+		t.Errorf("Expected only the acme log line, got %v", response.Logs)
+	}
+
+	// Route templates learned from other hosts' traffic are not shown
+	for i := 0; i < 30; i++ {
+		path := fmt.Sprintf("/customers/customer-%c", 'a'+i)
+		handler.RouteLearner().Observe(ingest.Entry{Log: &logs.TraefikLog{RequestHost: "other.example", RequestPath: path}})
+	}
+	unrestricted := httptest.NewRecorder()
+	handler.HandleRoutes(unrestricted, httptest.NewRequest(http.MethodGet, "/api/logs/routes", nil))
+	if !strings.Contains(unrestricted.Body.String(), "/customers/{param}") {
+		t.Fatalf("Expected a template learned from all traffic, got %s", unrestricted.Body.String())
+	}
+	w = get("/api/logs/routes", handler.HandleRoutes)
+	if body := w.Body.String(); w.Code != http.StatusOK || strings.Contains(body, "customers") || !strings.Contains(body, "/cart") {
+		t.Errorf("Expected only the acme routes and templates, got %d: %s", w.Code, body)
+	}
+
+	// Data that can't be filtered per row is refused
+	if w := get("/api/security/findings", handler.HandleSecurityFindings); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for findings, got %d", w.Code)
+	}
+	if w := get("/api/logs/error", handler.HandleErrorLogs); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for error logs, got %d", w.Code)
+	}
+
+	// So are the audit log and the block list, even with the admin scope
+	dir := t.TempDir()
+	auditLog, err := audit.New(dir+"/audit.log", 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	manager, err := blocklist.New(blocklist.Config{OutputPath: dir + "/blocklist.yml"})
+	if err != nil {
+		t.Fatalf("Failed to create block list: %v", err)
+	}
+	if _, err := manager.Add("45.33.32.9", "exploit probe", "admin", time.Hour, false); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	handler.SetAuditLog(auditLog)
+	handler.SetBlocklist(manager)
+	mux := http.NewServeMux()
+	handler.RegisterV2(mux, authenticator.Require)
+
+	for _, tc := range []struct {
+		method, path string
+		h            http.HandlerFunc
+	}{
+		{http.MethodGet, "/api/audit", handler.HandleAudit},
+		{http.MethodGet, "/api/security/blocklist", handler.HandleBlocklist},
+		{http.MethodDelete, "/api/security/blocklist?ip=45.33.32.9", handler.HandleBlocklist},
+		{http.MethodPost, "/api/security/blocklist/unpin", handler.HandleBlocklistUnpin},
+		{http.MethodGet, "/api/v2/audit", mux.ServeHTTP},
+		{http.MethodGet, "/api/v2/security/blocklist", mux.ServeHTTP},
+		{http.MethodDelete, "/api/v2/security/blocklist?ip=45.33.32.9", mux.ServeHTTP},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"ip":"45.33.32.9"}`))
+		req.Header.Set("Authorization", "Bearer acme-admin-key")
+		w := httptest.NewRecorder()
+		authenticator.Require(auth.ScopeAdmin, tc.h).ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for %s %s, got %d: %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+	if entries := manager.Entries(); len(entries) != 1 {
+		t.Errorf("Expected the entry to be left alone, got %+v", entries)
+	}
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "RSA", "kid": "weak", "n": b64(weakKey.N.Bytes()), "e": b64(big.NewInt(int64(weakKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPublic)},
+	}}
+	jwksFile := t.TempDir() + "/jwks.json"
+	data, _ := json.Marshal(jwks)
+	if err := os.WriteFile(jwksFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+
+	scopeMap, err := auth.ParseScopeMap("dashboard-admins=admin;contractors=logs:access,geo")
+	if err != nil {
+		t.Fatalf("Failed to parse scope map: %v", err)
+	}
+	validator, err := auth.NewJWTValidator(auth.JWTConfig{
+		JWKS:       jwksFile,
+		Issuer:     "https://sso.example",
+		Audience:   "log-dashboard",
+		ScopeClaim: "groups",
+		ScopeMap:   scopeMap,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	keysFile := t.TempDir() + "/keys.json"
+	keys := fmt.Sprintf(`{"keys":[{"id":"dotted","hash":%q,"scopes":["logs:access"]}]}`, auth.HashKey("tld.key.v1"))
+	if err := os.WriteFile(keysFile, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	authenticator := auth.NewAuthenticator("")
+	if err := authenticator.LoadKeys(keysFile); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	authenticator.SetJWTValidator(validator)
+
+	sign := func(alg, kid string, claims map[string]interface{}) string {
+		header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		signed := b64(header) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(signed))
+
+		var signature []byte
+		switch alg {
+		case "RS256":
+			key := rsaKey
+			if kid == "weak" {
+				key = weakKey
+			}
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		case "ES256":
+			var r, s *big.Int
+			r, s, err = ecdsa.Sign(rand.Reader, ecKey, digest[:])
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		case "EdDSA":
+			signature = ed25519.Sign(edPrivate, []byte(signed))
+		}
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed + "." + b64(signature)
+	}
+
+	claims := func(groups interface{}, overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    "https://sso.example",
+			"aud":    []string{"log-dashboard"},
+			"sub":    "alice",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"groups": groups,
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		scope          string
+		expectedStatus int
+	}{
+		{"RS256 admin", sign("RS256", "rsa", claims([]string{"dashboard-admins"}, nil)), auth.ScopeSystem, http.StatusOK},
+		{"ES256 contractor", sign("ES256", "ec", claims([]string{"contractors"}, nil)), auth.ScopeAccessLogs, http.StatusOK},
+		{"EdDSA contractor lacks scope", sign("EdDSA", "ed", claims([]string{"contractors"}, nil)), auth.ScopeSystem, http.StatusForbidden},
+		{"Expired", sign("RS256", "rsa", claims([]string{"dashboard-admins"}, map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})), auth.ScopeAccessLogs, http.StatusUnauthorized},
+		{"Wrong audience", sign("RS256", "rsa", claims([]string{"dashboard-admins"}, map[string]interface{}{"aud": "other"})), auth.ScopeAccessLogs, http.StatusUnauthorized},
+		{"Wrong issuer", sign("RS256", "rsa", claims([]string{"dashboard-admins"}, map[string]interface{}{"iss": "https://evil.example"})), auth.ScopeAccessLogs, http.StatusUnauthorized},
+		{"Key mismatch", sign("EdDSA", "rsa", claims([]string{"dashboard-admins"}, nil)), auth.ScopeAccessLogs, http.StatusUnauthorized},
+		{"No mapped groups", sign("RS256", "rsa", claims([]string{"staff"}, nil)), auth.ScopeAccessLogs, http.StatusUnauthorized},
+		{"Unmapped scope name", sign("RS256", "rsa", claims("admin", nil)), auth.ScopeAccessLogs, http.StatusUnauthorized},
+		{"Weak RSA key", sign("RS256", "weak", claims([]string{"dashboard-admins"}, nil)), auth.ScopeAccessLogs, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+
+			authenticator.Require(tt.scope, func(w http.ResponseWriter, r *http.Request) {
+				if identity, _ := auth.IdentityFromContext(r.Context()); identity.KeyID != "jwt:alice" {
+					t.Errorf("Expected identity jwt:alice, got %q", identity.KeyID)
+				}
+				w.WriteHeader(http.StatusOK)
+			}).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+
+	// Tampering with the payload invalidates the signature
+	token := sign("RS256", "rsa", claims([]string{"contractors"}, nil))
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(claims([]string{"dashboard-admins"}, nil))
+	if authenticator.ValidateToken(parts[0] + "." + b64(forged) + "." + parts[2]) {
+		t.Error("Expected forged token to be rejected")
+	}
+
+	// API keys shaped like a JWT still authenticate as keys
+	if !authenticator.ValidateToken("tld.key.v1") {
+		t.Error("Expected an API key with two dots to be accepted")
+	}
+
+	// Issuer and audience are required
+	if _, err := auth.NewJWTValidator(auth.JWTConfig{JWKS: jwksFile, ScopeMap: scopeMap}); err == nil {
+		t.Error("Expected a validator without issuer and audience to be refused")
+	}
+}
+
+func TestJWKSRefreshLimit(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(public)},
+		}})
+	}))
+	defer server.Close()
+
+	validator, err := auth.NewJWTValidator(auth.JWTConfig{
+		JWKS:       server.URL,
+		Issuer:     "https://sso.example",
+		Audience:   "log-dashboard",
+		MinRefresh: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	authenticator := auth.NewAuthenticator("")
+	authenticator.SetJWTValidator(validator)
+
+	header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "kid": "rotated", "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	signed := b64(header) + "." + b64(payload)
+	token := signed + "." + b64(ed25519.Sign(private, []byte(signed)))
 
-	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
-		t.Error("Expected CORS header not set")
+	// Tokens with an unknown key ID share one refresh per interval, even when it fails
+	failing.Store(true)
+	time.Sleep(250 * time.Millisecond)
+	validate := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if authenticator.ValidateToken(token) {
+					t.Error("Expected a token with an unknown key ID to be rejected")
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	validate()
+	validate()
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("Expected the initial load and one refresh, got %d fetches", n)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to issue certificate: %v", err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	serverCert, serverKey := issue("agent", 2, x509.ExtKeyUsageServerAuth)
+	os.WriteFile(dir+"/server.crt", serverCert, 0644)
+	os.WriteFile(dir+"/server.key", serverKey, 0600)
+	os.WriteFile(dir+"/ca.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644)
+
+	reloader, err := tlsconfig.New(tlsconfig.Config{
+		CertFile:     dir + "/server.crt",
+		KeyFile:      dir + "/server.key",
+		ClientCAFile: dir + "/ca.crt",
+		MinVersion:   "1.3",
+	})
+	if err != nil {
+		t.Fatalf("Failed to load TLS config: %v", err)
+	}
+
+	authenticator := auth.NewAuthenticator("")
+	authenticator.SetClientCertScopes(map[string][]string{"contractor": {auth.ScopeAccessLogs}})
+
+	server := httptest.NewUnstartedServer(authenticator.Require(auth.ScopeAccessLogs, func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.IdentityFromContext(r.Context())
+		w.Write([]byte(identity.KeyID))
+	}))
+	server.TLS = reloader.TLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	client := func(certPEM, keyPEM []byte) *http.Client {
+		config := &tls.Config{RootCAs: roots}
+		if certPEM != nil {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				t.Fatalf("Failed to load client certificate: %v", err)
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+
+	// A mapped client certificate authenticates on its own
+	resp, err := client(issue("contractor", 3, x509.ExtKeyUsageClientAuth)).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request with client certificate failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "cert:contractor" {
+		t.Errorf("Expected 200 as cert:contractor, got %d %q", resp.StatusCode, body)
+	}
+
+	// An unmapped certificate passes TLS but still needs a token
+	resp, err = client(issue("stranger", 4, x509.ExtKeyUsageClientAuth)).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request with unmapped certificate failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unmapped certificate, got %d", resp.StatusCode)
+	}
+
+	// Without a certificate the handshake is rejected
+	if resp, err := client(nil, nil).Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected the handshake to fail without a client certificate")
 	}
 }
 
@@ -219,6 +876,1788 @@ func TestSystemResourcesDisabled(t *testing.T) {
 	}
 }
 
+func TestRoutesEndpoint(t *testing.T) {
+	logFile := t.TempDir() + "/access.log"
+	lines := `{"RequestMethod":"GET","RequestPath":"/api/users/123","DownstreamStatus":200,"Duration":1000000}
+{"RequestMethod":"GET","RequestPath":"/api/users/456?page=2","DownstreamStatus":404,"Duration":3000000}
+{"RequestMethod":"GET","RequestPath":"/health","DownstreamStatus":200,"Duration":1000000}
+`
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	cfg := &config.Config{
+		AccessPath: logFile,
+		ErrorPath:  "/tmp/test-error.log",
+		Port:       "5000",
+	}
+
+	handler := routes.NewHandler(cfg)
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/routes", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleRoutes(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Routes []struct {
+			Template string `json:"template"`
+			Count    int    `json:"count"`
+			Errors   int    `json:"errors"`
+		} `json:"routes"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.Routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(response.Routes))
+	}
+
+	if response.Routes[0].Template != "/api/users/{id}" || response.Routes[0].Count != 2 || response.Routes[0].Errors != 1 {
+		t.Errorf("Unexpected top route: %+v", response.Routes[0])
+	}
+
+	// Templates are learned from ingested lines, not from reading the log again
+	learn := func(prefix string) {
+		for i := 0; i < pathnorm.DefaultLearnThreshold; i++ {
+			path := fmt.Sprintf("%s/item-%d-x", prefix, i)
+			handler.RouteLearner().Observe(ingest.Entry{Log: &logs.TraefikLog{RequestPath: path}})
+		}
+	}
+	templates := func() string {
+		w := httptest.NewRecorder()
+		handler.HandleRoutes(w, httptest.NewRequest(http.MethodGet, "/api/logs/routes", nil))
+		var response struct {
+			Templates []struct {
+				Template string `json:"template"`
+			} `json:"templates"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var names []string
+		for _, template := range response.Templates {
+			names = append(names, template.Template)
+		}
+		return strings.Join(names, ",")
+	}
+	if got := templates(); got != "" {
+		t.Errorf("Expected no templates from reading the log, got %q", got)
+	}
+	learn("/catalog")
+	if got := templates(); got != "/catalog/{param}" {
+		t.Errorf("Expected the ingested template, got %q", got)
+	}
+}
+
+func TestUserAgentsEndpoint(t *testing.T) {
+	logFile := t.TempDir() + "/access.log"
+	lines := `{"RequestPath":"/","request_User-Agent":"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"}
+{"RequestPath":"/","request_User-Agent":"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"}
+{"RequestPath":"/","request_User-Agent":"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1"}
+`
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, Port: "5000"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/useragents", nil)
+	w := httptest.NewRecorder()
+	handler.HandleUserAgents(w, req)
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response["bots"] != float64(1) || response["humans"] != float64(2) {
+		t.Errorf("Expected 1 bot and 2 humans, got %v and %v", response["bots"], response["humans"])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/logs/access?exclude_bots=true", nil)
+	w = httptest.NewRecorder()
+	handler.HandleAccessLogs(w, req)
+
+	var result struct {
+		Logs []string `json:"logs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(result.Logs) != 2 {
+		t.Errorf("Expected 2 logs without bots, got %d", len(result.Logs))
+	}
+}
+
+func TestSecurityFindingsEndpoint(t *testing.T) {
+	logFile := t.TempDir() + "/access.log"
+	var lines string
+	for i := 0; i < 25; i++ {
+		lines += fmt.Sprintf(`{"ClientHost":"203.0.113.7","RequestPath":"/probe-%d","DownstreamStatus":404}`+"\n", i)
+	}
+	lines += `{"ClientHost":"198.51.100.9","RequestPath":"/static/../../etc/passwd","DownstreamStatus":400}` + "\n"
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	detector := security.NewDetector(security.DefaultConfig())
+	pipeline := ingest.New(logFile, time.Second, 1024*1024)
+	pipeline.AddSink(detector)
+	pipeline.Poll()
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, Port: "5000"})
+	handler.SetDetector(detector)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/security/findings", nil)
+	w := httptest.NewRecorder()
+	handler.HandleSecurityFindings(w, req)
+
+	var response struct {
+		Findings []security.Finding `json:"findings"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	types := map[string]string{}
+	for _, f := range response.Findings {
+		types[f.Type] = f.ClientIP
+		if len(f.Evidence.Samples) == 0 {
+			t.Errorf("Expected evidence samples for %s finding", f.Type)
+		}
+	}
+
+	if types[security.TypeScanner] != "203.0.113.7" {
+		t.Errorf("Expected scanner finding for 203.0.113.7, got %v", types)
+	}
+	if types[security.TypeExploitProbe] != "198.51.100.9" {
+		t.Errorf("Expected exploit probe finding for 198.51.100.9, got %v", types)
+	}
+}
+
+func TestBlocklistEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := blocklist.New(blocklist.Config{
+		OutputPath: dir + "/blocklist.yml",
+		StatePath:  dir + "/blocklist.json",
+		Allow:      []string{"93.184.216.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create block list: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: "/tmp/test-access.log", Port: "5000"})
+	handler.SetBlocklist(manager)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/security/blocklist/pin", strings.NewReader(`{"ip":"203.0.113.7","reason":"credential stuffing"}`))
+	w := httptest.NewRecorder()
+	handler.HandleBlocklistPin(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 when pinning, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if _, err := manager.Add("45.33.32.9", "exploit probe", "detector", time.Hour, false); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	output, err := os.ReadFile(dir + "/blocklist.yml")
+	if err != nil {
+		t.Fatalf("Failed to read generated configuration: %v", err)
+	}
+	for _, ip := range []string{`"203.0.113.7/32"`, `"45.33.32.9/32"`} {
+		if !strings.Contains(string(output), ip) {
+			t.Errorf("Expected %s in generated configuration:\n%s", ip, output)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/security/blocklist/pin", strings.NewReader(`{"ip":"93.184.216.0/23"}`))
+	w = httptest.NewRecorder()
+	handler.HandleBlocklistPin(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when pinning an allow-listed network, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/security/blocklist?ip=45.33.32.9&reason=false+positive", nil)
+	w = httptest.NewRecorder()
+	handler.HandleBlocklist(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 when removing, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/security/blocklist", nil)
+	w = httptest.NewRecorder()
+	handler.HandleBlocklist(w, req)
+
+	var response struct {
+		Entries []blocklist.Entry `json:"entries"`
+		Removed []blocklist.Entry `json:"removed"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Entries) != 1 || !response.Entries[0].Pinned || len(response.Entries[0].Audit) == 0 {
+		t.Errorf("Expected one pinned entry with an audit trail, got %+v", response.Entries)
+	}
+	if len(response.Removed) != 1 || response.Removed[0].Audit[len(response.Removed[0].Audit)-1].Reason != "false positive" {
+		t.Errorf("Expected the removed entry with its removal, got %+v", response.Removed)
+	}
+}
+
+func TestLocationStatusEndpoint(t *testing.T) {
+	location.SetDatabasePaths("/tmp/test-missing-city.mmdb", "/tmp/test-missing-country.mmdb")
+
+	cfg := &config.Config{
+		AccessPath:   "/tmp/test-access.log",
+		GeoIPEnabled: true,
+		GeoIPCityDB:  "/tmp/test-missing-city.mmdb",
+	}
+
+	handler := routes.NewHandler(cfg)
+
+	// A missing database can be polled for without failing lookups
+	location.Reload()
+	if loc, _ := location.LocationLookup("8.8.8.8"); loc.IPAddress != "8.8.8.8" || loc.Country != "" {
+		t.Errorf("Expected an empty location without databases, got %+v", loc)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/location/status", nil)
+	w := httptest.NewRecorder()
+	handler.HandleLocationStatus(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Available bool `json:"available"`
+		Databases map[string]struct {
+			Loaded bool `json:"loaded"`
+		} `json:"databases"`
+		Cache struct {
+			Capacity int    `json:"capacity"`
+			Misses   uint64 `json:"misses"`
+		} `json:"cache"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Available || response.Databases["city"].Loaded {
+		t.Errorf("Expected no databases to be loaded, got %+v", response)
+	}
+	if response.Cache.Capacity == 0 || response.Cache.Misses == 0 {
+		t.Errorf("Expected cache statistics, got %+v", response.Cache)
+	}
+}
+
+func TestLocationAggregationEndpoints(t *testing.T) {
+	logFile := t.TempDir() + "/access.log"
+	now := time.Now().UTC().Format(time.RFC3339)
+	lines := fmt.Sprintf(`{"ClientHost":"203.0.113.7","DownstreamStatus":200,"DownstreamContentSize":100,"StartUTC":"%s"}`+"\n", now)
+	lines += fmt.Sprintf(`{"ClientHost":"203.0.113.7","DownstreamStatus":500,"DownstreamContentSize":50,"StartUTC":"%s"}`+"\n", now)
+	lines += fmt.Sprintf(`{"ClientHost":"198.51.100.9","DownstreamStatus":200,"DownstreamContentSize":10,"StartUTC":"%s"}`+"\n", now)
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	geo := stats.NewGeoAggregator(time.Hour)
+	pipeline := ingest.New(logFile, time.Second, 1024*1024)
+	pipeline.SetLocator(func(ip string) location.Location {
+		if ip == "203.0.113.7" {
+			return location.Location{IPAddress: ip, Country: "DE", City: "Berlin"}
+		}
+		return location.Location{IPAddress: ip, Country: "US", City: "Boston"}
+	})
+	pipeline.AddSink(geo)
+	pipeline.Poll()
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, GeoIPEnabled: true})
+	handler.SetGeoAggregator(geo)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/location/countries?range=1h", nil)
+	w := httptest.NewRecorder()
+	handler.HandleLocationCountries(w, req)
+
+	var countries struct {
+		Countries []stats.GeoStat `json:"countries"`
+		Total     int             `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&countries); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if countries.Total != 3 || len(countries.Countries) != 2 {
+		t.Fatalf("Expected 3 requests across 2 countries, got %+v", countries)
+	}
+	if top := countries.Countries[0]; top.Country != "DE" || top.Requests != 2 || top.Errors != 1 || top.Bytes != 150 {
+		t.Errorf("Unexpected top country: %+v", top)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/location/cities?country=us", nil)
+	w = httptest.NewRecorder()
+	handler.HandleLocationCities(w, req)
+
+	var cities struct {
+		Cities []stats.GeoStat `json:"cities"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&cities); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(cities.Cities) != 1 || cities.Cities[0].City != "Boston" {
+		t.Errorf("Expected only Boston, got %+v", cities.Cities)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/location/countries?from=yesterday", nil)
+	w = httptest.NewRecorder()
+	handler.HandleLocationCountries(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid range, got %d", w.Code)
+	}
+}
+
+func TestLocationASNEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	logFile := dir + "/access.log"
+	lines := `{"ClientHost":"8.8.4.4","DownstreamStatus":200,"DownstreamContentSize":100}` + "\n"
+	lines += `{"ClientHost":"8.8.4.4","DownstreamStatus":500,"DownstreamContentSize":50}` + "\n"
+	lines += `{"ClientHost":"193.0.14.129","DownstreamStatus":200,"DownstreamContentSize":10}` + "\n"
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, GeoIPEnabled: true})
+
+	// Without the ASN database the endpoint is unavailable
+	w := httptest.NewRecorder()
+	handler.HandleLocationASN(w, httptest.NewRequest(http.MethodGet, "/api/location/asn", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without an ASN database, got %d", w.Code)
+	}
+
+	asnDB := dir + "/GeoLite2-ASN.mmdb"
+	writeASNDatabase(t, asnDB)
+	location.SetASNDatabasePath(asnDB)
+	location.Reload()
+	defer func() {
+		location.SetASNDatabasePath("")
+		location.Close()
+	}()
+
+	w = httptest.NewRecorder()
+	handler.HandleLocationASN(w, httptest.NewRequest(http.MethodGet, "/api/location/asn", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		ASNs  []stats.ASNStat `json:"asns"`
+		Total int             `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Total != 3 || len(response.ASNs) != 2 {
+		t.Fatalf("Expected 3 requests across 2 autonomous systems, got %+v", response)
+	}
+	if top := response.ASNs[0]; top.ASN != 15169 || top.Organization != "Google LLC" || top.Requests != 2 || top.Errors != 1 || top.Bytes != 150 || top.UniqueIPs != 1 {
+		t.Errorf("Unexpected top autonomous system: %+v", top)
+	}
+	if last := response.ASNs[1]; last.ASN != 3333 || last.Organization != "RIPE NCC" || last.Requests != 1 {
+		t.Errorf("Unexpected autonomous system: %+v", last)
+	}
+}
+
+// writeASNDatabase writes a GeoLite2 ASN database that maps addresses below
+// 128.0.0.0 to AS15169 and the others to AS3333
+func writeASNDatabase(t *testing.T, path string) {
+	t.Helper()
+
+	str := func(s string) []byte {
+		if len(s) < 29 {
+			return append([]byte{2<<5 | byte(len(s))}, s...)
+		}
+		// Longer sizes follow the control byte
+		return append([]byte{2<<5 | 29, byte(len(s) - 29)}, s...)
+	}
+	uint32Value := func(v uint32) []byte { return []byte{6<<5 | 4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)} }
+	mapValue := func(pairs ...[]byte) []byte {
+		data := []byte{7<<5 | byte(len(pairs)/2)}
+		for _, pair := range pairs {
+			data = append(data, pair...)
+		}
+		return data
+	}
+	asn := func(number uint32, organization string) []byte {
+		return mapValue(str("autonomous_system_number"), uint32Value(number), str("autonomous_system_organization"), str(organization))
+	}
+
+	// One search tree node whose records point into the data section, past
+	// the node count and the 16 byte separator
+	low, high := asn(15169, "Google LLC"), asn(3333, "RIPE NCC")
+	record := func(offset int) []byte {
+		v := 1 + 16 + offset
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+	data := append(record(0), record(len(low))...)
+	data = append(data, make([]byte, 16)...)
+	data = append(data, low...)
+	data = append(data, high...)
+	data = append(data, "\xAB\xCD\xEFMaxMind.com"...)
+	data = append(data, mapValue(
+		str("binary_format_major_version"), uint32Value(2),
+		str("binary_format_minor_version"), uint32Value(0),
+		str("build_epoch"), uint32Value(1700000000),
+		str("database_type"), str("GeoLite2-ASN"),
+		str("description"), mapValue(str("en"), str("Test ASN database")),
+		str("ip_version"), uint32Value(4),
+		str("languages"), append([]byte{1, 4}, str("en")...),
+		str("node_count"), uint32Value(1),
+		str("record_size"), uint32Value(24),
+	)...)
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write ASN database: %v", err)
+	}
+}
+
+func TestTrustedProxyClientIP(t *testing.T) {
+	resolver, err := clientip.New([]string{"10.0.0.0/8"}, []string{"CF-Connecting-IP", "X-Forwarded-For"})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	logs.SetClientIPResolver(resolver)
+	defer logs.SetClientIPResolver(nil)
+
+	logFile := t.TempDir() + "/access.log"
+	lines := `{"ClientHost":"10.0.0.5","RequestPath":"/a","request_X-Forwarded-For":"198.51.100.9, 10.0.0.7"}` + "\n"
+	lines += `{"ClientHost":"10.0.0.5","RequestPath":"/b","request_Cf-Connecting-Ip":"203.0.113.7"}` + "\n"
+	lines += `{"ClientHost":"192.0.2.1","RequestPath":"/c","request_X-Forwarded-For":"203.0.113.66"}` + "\n"
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile})
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/access?tail=true", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAccessLogs(w, req)
+
+	var response struct {
+		Logs []string `json:"logs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// Forwarded headers are only honoured from trusted proxies
+	expected := []string{"198.51.100.9", "203.0.113.7", "192.0.2.1"}
+	if len(response.Logs) != len(expected) {
+		t.Fatalf("Expected %d logs, got %d", len(expected), len(response.Logs))
+	}
+	for i, line := range response.Logs {
+		var entry struct {
+			ClientHost string `json:"ClientHost"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode log line: %v", err)
+		}
+		if entry.ClientHost != expected[i] {
+			t.Errorf("Expected client %s, got %s", expected[i], entry.ClientHost)
+		}
+	}
+}
+
+func TestRedactionPolicies(t *testing.T) {
+	logFile := t.TempDir() + "/access.log"
+	line := `{"ClientHost":"203.0.113.77","ClientAddr":"203.0.113.77:51234","ClientUsername":"alice",` +
+		`"RequestPath":"/login?token=abc&%74oken=def&page=2","request_Referer":"https://example.com/?email=a%40b.c",` +
+		`"request_Authorization":"Bearer secret","request_X-Forwarded-For":"198.51.100.23"}`
+	if err := os.WriteFile(logFile, []byte(line+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	set, err := redact.NewSet(redact.Policy{
+		IP:           redact.IPTruncate,
+		DropUsername: true,
+		QueryParams:  []string{"token", "e*"},
+		Headers:      []string{"authorization"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create policies: %v", err)
+	}
+
+	cfg := &config.Config{AccessPath: logFile}
+	handler := routes.NewHandler(cfg)
+	handler.SetRedaction(set)
+
+	authenticator := auth.NewAuthenticator("admin-token")
+	keysFile := t.TempDir() + "/keys.json"
+	keys := fmt.Sprintf(`{"keys":[{"id":"viewer","hash":%q,"scopes":["logs:access"]}]}`, auth.HashKey("viewer-key"))
+	if err := os.WriteFile(keysFile, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	if err := authenticator.LoadKeys(keysFile); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	endpoint := authenticator.Require(auth.ScopeAccessLogs, handler.HandleAccessLogs)
+
+	fetch := func(token string) map[string]string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/logs/access?position=0", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		endpoint(w, req)
+
+		var response struct {
+			Logs []string `json:"logs"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil || len(response.Logs) != 1 {
+			t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+		}
+		var entry map[string]string
+		if err := json.Unmarshal([]byte(response.Logs[0]), &entry); err != nil {
+			t.Fatalf("Failed to decode log line: %v", err)
+		}
+		return entry
+	}
+
+	// Keys without the admin scope get the default policy
+	redacted := fetch("viewer-key")
+	expected := map[string]string{
+		"ClientHost":              "203.0.113.0",
+		"ClientAddr":              "203.0.113.0",
+		"RequestPath":             "/login?page=2",
+		"request_Referer":         "https://example.com/",
+		"request_Authorization":   redact.Placeholder,
+		"request_X-Forwarded-For": "198.51.100.0",
+	}
+	for field, want := range expected {
+		if redacted[field] != want {
+			t.Errorf("Expected %s %q, got %q", field, want, redacted[field])
+		}
+	}
+	if _, ok := redacted["ClientUsername"]; ok {
+		t.Error("Expected ClientUsername to be dropped")
+	}
+
+	// Admins see the raw data
+	raw := fetch("admin-token")
+	if raw["ClientHost"] != "203.0.113.77" || raw["ClientUsername"] != "alice" || raw["request_Authorization"] != "Bearer secret" {
+		t.Errorf("Expected raw data for admin, got %v", raw)
+	}
+
+	// Error lines have no fixed fields, so addresses and URLs are redacted wherever they appear
+	cfg.ErrorPath = t.TempDir() + "/error.log"
+	errorLine := `2024-01-02T15:04:05Z ERR error="dial tcp 10.0.0.5:8080: connection refused" client=2001:db8::7 url="/login?%74oken=abc&page=2"`
+	if err := os.WriteFile(cfg.ErrorPath, []byte(errorLine+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write error log: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/error?position=0", nil)
+	w := httptest.NewRecorder()
+	handler.HandleErrorLogs(w, req)
+	var errorLogs struct {
+		Logs []string `json:"logs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&errorLogs); err != nil || len(errorLogs.Logs) != 1 {
+		t.Fatalf("Unexpected error log response %d", w.Code)
+	}
+	for _, want := range []string{"15:04:05Z", "tcp 10.0.0.0:8080", "client=2001:db8:: ", `url="/login?page=2"`} {
+		if !strings.Contains(errorLogs.Logs[0], want) {
+			t.Errorf("Expected %q in redacted error line %q", want, errorLogs.Logs[0])
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	logFile := dir + "/access.log"
+	lines := `{"ClientHost":"192.0.2.1","RequestHost":"a.example.com","RequestPath":"/a","DownstreamStatus":200}` + "\n"
+	lines += `{"ClientHost":"192.0.2.2","RequestHost":"b.example.com","RequestPath":"/b","DownstreamStatus":200}` + "\n"
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	auditLog, err := audit.New(dir+"/audit/audit.log", 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	keysFile := dir + "/keys.json"
+	keys := fmt.Sprintf(`{"keys":[{"id":"viewer","hash":%q,"scopes":["logs:access"]}]}`, auth.HashKey("viewer-key"))
+	if err := os.WriteFile(keysFile, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	authenticator := auth.NewAuthenticator("admin-token")
+	if err := authenticator.LoadKeys(keysFile); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile})
+	handler.SetAuditLog(auditLog)
+	accessLogs := authenticator.Require(auth.ScopeAccessLogs, auditLog.Wrap(handler.HandleAccessLogs))
+	auditEndpoint := authenticator.Require(auth.ScopeAdmin, auditLog.Wrap(handler.HandleAudit))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/access?position=0&exclude_bots=true&from=2024-01-01T00:00:00Z", nil)
+	req.Header.Set("Authorization", "Bearer viewer-key")
+	req.RemoteAddr = "198.51.100.4:5555"
+	w := httptest.NewRecorder()
+	accessLogs(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	// Non-admin keys can't read the audit log
+	req = httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+	req.Header.Set("Authorization", "Bearer viewer-key")
+	w = httptest.NewRecorder()
+	auditEndpoint(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a non-admin key, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/audit?key_id=viewer", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	auditEndpoint(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Records []audit.Record `json:"records"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Records) != 1 {
+		t.Fatalf("Expected 1 record for the viewer key, got %d", len(response.Records))
+	}
+
+	record := response.Records[0]
+	if record.Endpoint != "/api/logs/access" || record.Status != http.StatusOK || record.Rows != 2 {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if record.ClientAddr != "198.51.100.4" || record.Filters["exclude_bots"] != "true" || record.TimeRange["from"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("Unexpected record details: %+v", record)
+	}
+}
+
+func TestLogFileSandbox(t *testing.T) {
+	dir := t.TempDir()
+	lines := `{"RequestMethod":"GET","RequestPath":"/one","DownstreamStatus":200}
+{"RequestMethod":"GET","RequestPath":"/two","DownstreamStatus":200}
+{"RequestMethod":"GET","RequestPath":"/three","DownstreamStatus":200}
+`
+	if err := os.WriteFile(dir+"/access.log", []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	if err := os.WriteFile(dir+"/secret.txt", []byte("secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	rotated, err := os.Create(dir + "/access.log.1.gz")
+	if err != nil {
+		t.Fatalf("Failed to create rotated file: %v", err)
+	}
+	gz := gzip.NewWriter(rotated)
+	gz.Write([]byte(`{"RequestMethod":"GET","RequestPath":"/old","DownstreamStatus":200}` + "\n"))
+	gz.Close()
+	rotated.Close()
+
+	// A rotation-like name that points outside the log directory
+	outside := t.TempDir() + "/outside.log"
+	os.WriteFile(outside, []byte("outside\n"), 0644)
+	if err := os.Symlink(outside, dir+"/access.log.2"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	cfg := &config.Config{
+		AccessPath: dir + "/access.log",
+		ErrorPath:  "/tmp/test-error.log",
+		Port:       "5000",
+	}
+	handler := routes.NewHandler(cfg)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/logs/get?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.HandleGetLog(w, req)
+		return w
+	}
+
+	for _, name := range []string{"../../../etc/passwd", "secret.txt", "access.log.2", "/etc/passwd"} {
+		if w := get("filename=" + name); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for %s, got %d", name, w.Code)
+		}
+	}
+
+	type page struct {
+		Logs        []string `json:"logs"`
+		Start       int64    `json:"start"`
+		End         int64    `json:"end"`
+		HasPrevious bool     `json:"has_previous"`
+		HasNext     bool     `json:"has_next"`
+	}
+	decode := func(w *httptest.ResponseRecorder) page {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var p page
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return p
+	}
+
+	// Forward pagination
+	first := decode(get("filename=access.log&lines=2"))
+	if len(first.Logs) != 2 || !first.HasNext || first.HasPrevious {
+		t.Fatalf("Unexpected first page: %+v", first)
+	}
+	second := decode(get(fmt.Sprintf("filename=access.log&lines=2&position=%d", first.End)))
+	if len(second.Logs) != 1 || !strings.Contains(second.Logs[0], "/three") || second.HasNext {
+		t.Errorf("Unexpected second page: %+v", second)
+	}
+
+	// Backward pagination from the end of the file
+	last := decode(get("filename=access.log&lines=2&direction=backward"))
+	if len(last.Logs) != 2 || !strings.Contains(last.Logs[0], "/two") || !last.HasPrevious {
+		t.Fatalf("Unexpected last page: %+v", last)
+	}
+	previous := decode(get(fmt.Sprintf("filename=access.log&lines=2&direction=backward&position=%d", last.Start)))
+	if len(previous.Logs) != 1 || !strings.Contains(previous.Logs[0], "/one") || previous.HasPrevious {
+		t.Errorf("Unexpected previous page: %+v", previous)
+	}
+
+	// Rotated, compressed files are readable
+	old := decode(get("filename=access.log.1.gz"))
+	if len(old.Logs) != 1 || !strings.Contains(old.Logs[0], "/old") {
+		t.Errorf("Unexpected compressed page: %+v", old)
+	}
+
+	// The listing only includes files inside the sandbox
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/files", nil)
+	w := httptest.NewRecorder()
+	handler.HandleLogFiles(w, req)
+
+	var listing struct {
+		Files []struct {
+			Name       string `json:"name"`
+			Compressed bool   `json:"compressed"`
+			Active     bool   `json:"active"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listing); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(listing.Files) != 2 || listing.Files[0].Name != "access.log" || !listing.Files[0].Active || !listing.Files[1].Compressed {
+		t.Errorf("Unexpected file listing: %+v", listing.Files)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/agent.yml"
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+
+	write(`server:
+  port: 6000
+  cors:
+    allowed_origins:
+      - https://dash.example.com
+      - https://*.example.org
+sources:
+  access_path: /tmp/test-access.log
+system:
+  monitor_interval: 500ms
+geoip:
+  cache_size: 100
+redaction:
+  ip: truncate
+`)
+	// Environment variables take precedence over the file
+	t.Setenv("TRAEFIK_LOG_DASHBOARD_GEOIP_CACHE_SIZE", "42")
+
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+	if cfg.Port != "6000" || cfg.AccessPath != "/tmp/test-access.log" || cfg.RedactIP != "truncate" {
+		t.Errorf("File values not applied: port=%s access=%s redact=%s", cfg.Port, cfg.AccessPath, cfg.RedactIP)
+	}
+	if cfg.CORSOrigins != "https://dash.example.com, https://*.example.org" {
+		t.Errorf("Expected CORS origins joined from the list, got %q", cfg.CORSOrigins)
+	}
+	if cfg.MonitorInterval != 500 {
+		t.Errorf("Expected monitor interval of 500ms, got %d", cfg.MonitorInterval)
+	}
+	if cfg.GeoIPCacheSize != 42 {
+		t.Errorf("Expected environment override of the cache size, got %d", cfg.GeoIPCacheSize)
+	}
+
+	// Type errors and unknown keys are reported with their line numbers
+	write(`geoip:
+  reload_interval: 5x
+  cache_sise: 10
+`)
+	_, err = config.LoadFile(path)
+	if err == nil {
+		t.Fatal("Expected an invalid config file to be rejected")
+	}
+	for _, want := range []string{
+		path + ":2: geoip.reload_interval: invalid duration \"5x\"",
+		path + ":3: unknown key \"geoip.cache_sise\"",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+
+	// Values of the right type are still checked against each other
+	write("redaction:\n  ip: scramble\n")
+	if _, err := config.LoadFile(path); err == nil || !strings.Contains(err.Error(), "redaction.ip (TRAEFIK_LOG_DASHBOARD_REDACT_IP): invalid mode") {
+		t.Errorf("Expected an invalid redaction mode error, got %v", err)
+	}
+	write("sources:\n  access_path: /tmp/test-access.log\nauth:\n  jwt:\n    jwks: /etc/jwks.json\n")
+	if _, err := config.LoadFile(path); err == nil || !strings.Contains(err.Error(), "auth.jwt.audience (TRAEFIK_LOG_DASHBOARD_JWT_AUDIENCE): required") {
+		t.Errorf("Expected a JWKS without an audience to be rejected, got %v", err)
+	}
+
+	// Referenced files are checked, so a reload with a bad path is rejected
+	write("sources:\n  access_path: /tmp/test-access.log\nserver:\n  tls:\n    cert_file: " + dir + "/missing.crt\n    key_file: " + dir +
+		"\nauth:\n  keys_file: " + dir + "/keys.yml\n  jwt:\n    jwks: https://idp.example.com/jwks.json\n    issuer: https://idp.example.com\n" +
+		"    audience: agent\n    scope_map: agent:read=read\nsearch:\n  enabled: true\n  dir: " + dir + "/missing/search\n")
+	_, err = config.LoadFile(path)
+	for _, want := range []string{
+		"server.tls.cert_file (TRAEFIK_LOG_DASHBOARD_TLS_CERT_FILE): file \"" + dir + "/missing.crt\" does not exist",
+		"server.tls.key_file (TRAEFIK_LOG_DASHBOARD_TLS_KEY_FILE): \"" + dir + "\" is a directory",
+		"auth.keys_file (TRAEFIK_LOG_DASHBOARD_AUTH_KEYS_FILE): file",
+		"search.dir (TRAEFIK_LOG_DASHBOARD_SEARCH_DIR): parent directory",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "auth.jwt.jwks") {
+		t.Errorf("Expected a JWKS URL not to be checked as a file, got:\n%v", err)
+	}
+	write("sources:\n  access_path: /tmp/test-access.log\nalerting:\n  blocklist:\n    enabled: true\n    middleware: \"deny: {}\"\n")
+	if _, err := config.LoadFile(path); err == nil || !strings.Contains(err.Error(), "alerting.blocklist.middleware (TRAEFIK_LOG_DASHBOARD_BLOCKLIST_MIDDLEWARE): invalid middleware name") {
+		t.Errorf("Expected an invalid middleware name error, got %v", err)
+	}
+
+	// Reloads apply changes and report the ones that need a restart
+	write("sources:\n  access_path: /tmp/test-access.log\n")
+	cfg, err = config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+	var restart []string
+	applied := 0
+	watcher := config.NewWatcher(path, cfg, func(old, updated *config.Config) {
+		applied++
+		restart = config.RestartRequired(old, updated)
+	})
+
+	write("server:\n  port: 7000\nsources:\n  access_path: /tmp/test-access.log\nredaction:\n  ip: truncate\n")
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("Failed to reload config file: %v", err)
+	}
+	if applied != 1 || watcher.Current().RedactIP != "truncate" {
+		t.Errorf("Expected the reloaded configuration to be applied once, got %d", applied)
+	}
+	if len(restart) != 1 || restart[0] != "server.port" {
+		t.Errorf("Expected only server.port to require a restart, got %v", restart)
+	}
+
+	// An invalid file keeps the running configuration
+	write("server:\n  port: none\n")
+	if err := watcher.Reload(); err == nil {
+		t.Error("Expected reloading an invalid file to fail")
+	}
+	if applied != 1 || watcher.Current().Port != "7000" {
+		t.Errorf("Expected the running configuration to be kept, got port %s", watcher.Current().Port)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	logFile := dir + "/access.log"
+	lines := `{"RequestMethod":"GET","RequestPath":"/users/1","DownstreamStatus":200}
+not a log line
+{"RequestMethod":"GET","RequestPath":"/users/2","DownstreamStatus":404}
+`
+	if err := os.WriteFile(logFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	positionFile := dir + "/positions.json"
+	t.Setenv("POSITION_FILE", positionFile)
+
+	// Positions are shared between the server and the positions command
+	store, err := positions.Open(positionFile)
+	if err != nil {
+		t.Fatalf("Failed to open position store: %v", err)
+	}
+	store.Set(logFile, 42)
+	store.Set(dir+"/other.log", 7)
+	if err := store.Save(); err != nil {
+		t.Fatalf("Failed to save positions: %v", err)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"validate-config"}, 0},
+		{[]string{"parse", logFile}, 1},
+		{[]string{"parse"}, 2},
+		{[]string{"stats", dir}, 0},
+		{[]string{"positions", "show"}, 0},
+		{[]string{"positions", "reset", logFile}, 0},
+		{[]string{"positions", "rewind"}, 2},
+		{[]string{"no-such-command"}, 2},
+	} {
+		if code := runCommand(tc.args); code != tc.code {
+			t.Errorf("agent %s: expected exit code %d, got %d", strings.Join(tc.args, " "), tc.code, code)
+		}
+	}
+
+	store, err = positions.Open(positionFile)
+	if err != nil {
+		t.Fatalf("Failed to reopen position store: %v", err)
+	}
+	if _, ok := store.Get(logFile); ok || store.Len() != 1 {
+		t.Errorf("Expected only %s to be reset, got %v", logFile, store.Files())
+	}
+}
+
+func TestGracefulState(t *testing.T) {
+	dir := t.TempDir()
+
+	// Position changes are written by a single debounced writer
+	store, err := positions.Open(dir + "/positions.json")
+	if err != nil {
+		t.Fatalf("Failed to open position store: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	store.Set("/logs/access.log", 10)
+	store.Set("/logs/access.log", 20)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		saved, _ := positions.Open(store.Path())
+		if position, _ := saved.Get("/logs/access.log"); position == 20 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the writer to persist the latest position")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	store.Set("/logs/access.log", 30)
+	cancel()
+	<-done
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Failed to flush positions: %v", err)
+	}
+	saved, _ := positions.Open(store.Path())
+	if position, _ := saved.Get("/logs/access.log"); position != 30 {
+		t.Errorf("Expected the flushed position 30, got %d", position)
+	}
+
+	// A run that saved its state resumes where it stopped
+	logFile := dir + "/access.log"
+	line := `{"ClientHost":"203.0.113.7","DownstreamStatus":200,"DownstreamContentSize":10}` + "\n"
+	if err := os.WriteFile(logFile, []byte(line), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	locate := func(ip string) location.Location {
+		return location.Location{IPAddress: ip, Country: "DE"}
+	}
+
+	geo := stats.NewGeoAggregator(time.Hour)
+	pipeline := ingest.New(logFile, time.Second, 1024*1024)
+	pipeline.SetLocator(locate)
+	pipeline.AddSink(geo)
+	pipeline.Poll()
+
+	now := time.Now()
+	stateFile := dir + "/state.json"
+	if err := state.Save(stateFile, &state.Snapshot{
+		SavedAt:    now,
+		Offsets:    pipeline.Offsets(),
+		Identities: pipeline.Identities(),
+		Geo:        geo.Snapshot(),
+		Findings:   []security.Finding{{ID: "f1", Type: security.TypeScanner, ClientIP: "203.0.113.7", FirstSeen: now, LastSeen: now}},
+	}); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	snapshot, err := state.Load(stateFile)
+	if err != nil || snapshot == nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if missing, err := state.Load(dir + "/missing.json"); missing != nil || err != nil {
+		t.Errorf("Expected no snapshot for a missing file, got %+v, %v", missing, err)
+	}
+
+	if err := os.WriteFile(logFile, []byte(line+line), 0644); err != nil {
+		t.Fatalf("Failed to append to log file: %v", err)
+	}
+	geo = stats.NewGeoAggregator(time.Hour)
+	geo.Restore(snapshot.Geo)
+	detector := security.NewDetector(security.DefaultConfig())
+	detector.Restore(snapshot.Findings)
+	pipeline = ingest.New(logFile, time.Second, 1024*1024)
+	pipeline.SetOffsets(snapshot.Offsets, snapshot.Identities)
+	pipeline.SetLocator(locate)
+	pipeline.AddSink(geo)
+	pipeline.Poll()
+
+	countries := geo.Countries(now.Add(-time.Hour), now.Add(time.Minute), 0)
+	if len(countries) != 1 || countries[0].Requests != 2 {
+		t.Errorf("Expected 2 requests without replaying the first line, got %+v", countries)
+	}
+	if findings := detector.Findings(security.Query{}); len(findings) != 1 || findings[0].ID != "f1" {
+		t.Errorf("Expected the restored finding, got %+v", findings)
+	}
+
+	// Saved findings get the default redaction policy
+	sample := `{"ClientHost":"203.0.113.7","ClientUsername":"alice","RequestPath":"/login?token=s3cret"}`
+	stored := storedFindings([]security.Finding{{ID: "f2", ClientIP: "203.0.113.7", Evidence: security.Evidence{Samples: []string{sample}}}},
+		&redact.Policy{DropUsername: true, QueryParams: []string{"token"}})
+	if len(stored) != 1 || strings.Contains(stored[0].Evidence.Samples[0], "alice") || strings.Contains(stored[0].Evidence.Samples[0], "s3cret") {
+		t.Errorf("Expected the evidence to be redacted, got %+v", stored)
+	}
+	if stored := storedFindings([]security.Finding{{ID: "f3", ClientIP: "203.0.113.7"}}, &redact.Policy{IP: redact.IPTruncate, IPv4Prefix: 24}); len(stored) != 0 {
+		t.Errorf("Expected no findings to be saved when addresses are redacted, got %+v", stored)
+	}
+
+	// A file that replaced the one an offset was read from is read from the start,
+	// even when it has grown past that offset
+	rotated := `{"ClientHost":"198.51.100.4","DownstreamStatus":200,"DownstreamContentSize":10}` + "\n"
+	if err := os.WriteFile(logFile, []byte(rotated+rotated+rotated), 0644); err != nil {
+		t.Fatalf("Failed to replace log file: %v", err)
+	}
+	pipeline.Poll()
+	countries = geo.Countries(now.Add(-time.Hour), now.Add(time.Minute), 0)
+	if len(countries) != 1 || countries[0].Requests != 5 {
+		t.Errorf("Expected the 3 requests of the new file to be read, got %+v", countries)
+	}
+
+	// Files that are no longer followed are forgotten
+	logDir := dir + "/logs"
+	if err := os.Mkdir(logDir, 0755); err != nil {
+		t.Fatalf("Failed to create log directory: %v", err)
+	}
+	for _, name := range []string{"access.log", "access-2024-01-01.log"} {
+		if err := os.WriteFile(filepath.Join(logDir, name), []byte(line), 0644); err != nil {
+			t.Fatalf("Failed to write log file: %v", err)
+		}
+	}
+	pipeline = ingest.New(logDir, time.Second, 1024*1024)
+	pipeline.Poll()
+	if err := os.Rename(filepath.Join(logDir, "access-2024-01-01.log"), filepath.Join(logDir, "access-2024-01-01.log.1")); err != nil {
+		t.Fatalf("Failed to rotate log file: %v", err)
+	}
+	pipeline.Poll()
+	current := filepath.Join(logDir, "access.log")
+	if offsets, identities, sources := pipeline.Offsets(), pipeline.Identities(), pipeline.Stats(); len(offsets) != 1 || len(identities) != 1 ||
+		len(sources) != 1 || sources[0].Source != current || offsets[current] != int64(len(line)) {
+		t.Errorf("Expected only the current file to be tracked, got %v, %v and %+v", offsets, identities, sources)
+	}
+}
+
+func TestStructuredLogging(t *testing.T) {
+	var buf bytes.Buffer
+	if err := logger.Configure(&buf, "debug", "json"); err != nil {
+		t.Fatalf("Failed to configure logger: %v", err)
+	}
+	defer logger.Configure(os.Stdout, "info", "text")
+
+	handler := middleware.RequestLog(http.NotFoundHandler())
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/access?token=secret", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON log record, got %q: %v", buf.String(), err)
+	}
+	if record["level"] != "WARN" || record[logger.KeyComponent] != "http" || record[logger.KeyPath] != "/api/logs/access" {
+		t.Errorf("Unexpected request record: %v", record)
+	}
+	if record["status"] != float64(http.StatusNotFound) || record["duration_ms"] == nil {
+		t.Errorf("Expected status and latency, got %v", record)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("Expected the query string to be left out, got %s", buf.String())
+	}
+
+	// The level can be changed on a running agent
+	buf.Reset()
+	if err := logger.SetLevel("error"); err != nil {
+		t.Fatalf("Failed to set level: %v", err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if buf.Len() != 0 {
+		t.Errorf("Expected warnings to be dropped at error level, got %s", buf.String())
+	}
+
+	t.Setenv("TRAEFIK_LOG_DASHBOARD_AGENT_LOG_LEVEL", "verbose")
+	t.Setenv("TRAEFIK_LOG_DASHBOARD_AGENT_LOG_FORMAT", "xml")
+	_, err := config.LoadFile("")
+	if err == nil || !strings.Contains(err.Error(), "logging.level") || !strings.Contains(err.Error(), "logging.format") {
+		t.Errorf("Expected invalid logging settings to be rejected, got %v", err)
+	}
+}
+
+func TestAgentStatsEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	logFile := dir + "/access.log"
+	line := `{"ClientHost":"203.0.113.7","DownstreamStatus":200,"StartUTC":"2024-01-01T00:00:00Z"}` + "\n"
+	if err := os.WriteFile(logFile, []byte(line+"not a log line\n"+line), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	pipeline := ingest.New(logFile, time.Second, 1024*1024)
+	pipeline.Poll()
+
+	// Lines written after the last poll are reported as lag
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	file.WriteString(line)
+	file.Close()
+
+	positionFile := dir + "/positions.json"
+	os.WriteFile(positionFile, []byte(`{}`), 0644)
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, PositionFile: positionFile})
+	handler.SetPipeline(pipeline)
+
+	w := httptest.NewRecorder()
+	handler.HandleAgentStats(w, httptest.NewRequest(http.MethodGet, "/api/agent/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Ingest struct {
+			Sources     []ingest.SourceStats `json:"sources"`
+			Lines       int64                `json:"lines"`
+			ParseErrors int64                `json:"parse_errors"`
+			LagBytes    int64                `json:"lag_bytes"`
+			LagSeconds  float64              `json:"lag_seconds"`
+		} `json:"ingest"`
+		Storage struct {
+			TotalBytes int64 `json:"total_bytes"`
+		} `json:"storage"`
+		Runtime struct {
+			Goroutines int    `json:"goroutines"`
+			HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+		} `json:"runtime"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Ingest.Sources) != 1 || response.Ingest.Lines != 2 || response.Ingest.ParseErrors != 1 {
+		t.Errorf("Expected 2 lines and 1 parse error from one source, got %+v", response.Ingest)
+	}
+	if response.Ingest.LagBytes != int64(len(line)) || response.Ingest.LagSeconds <= 0 {
+		t.Errorf("Expected one line of lag, got %d bytes and %.0f seconds", response.Ingest.LagBytes, response.Ingest.LagSeconds)
+	}
+	if response.Storage.TotalBytes != 2 {
+		t.Errorf("Expected the position file to be counted, got %d bytes", response.Storage.TotalBytes)
+	}
+	if response.Runtime.Goroutines == 0 || response.Runtime.HeapAlloc == 0 {
+		t.Errorf("Expected runtime statistics, got %+v", response.Runtime)
+	}
+
+	// Profiles are served by the separate admin listener
+	w = httptest.NewRecorder()
+	pprofHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("Expected a goroutine profile, got status %d", w.Code)
+	}
+
+	t.Setenv("TRAEFIK_LOG_DASHBOARD_PPROF_ADDR", "localhost")
+	if _, err := config.LoadFile(""); err == nil || !strings.Contains(err.Error(), "server.pprof_addr") {
+		t.Errorf("Expected an invalid profiling address to be rejected, got %v", err)
+	}
+	for _, addr := range []string{":6060", "0.0.0.0:6060", "192.0.2.10:6060"} {
+		t.Setenv("TRAEFIK_LOG_DASHBOARD_PPROF_ADDR", addr)
+		if _, err := config.LoadFile(""); err == nil || !strings.Contains(err.Error(), "loopback") {
+			t.Errorf("Expected a non-loopback profiling address %s to be rejected, got %v", addr, err)
+		}
+	}
+	t.Setenv("TRAEFIK_LOG_DASHBOARD_PPROF_ADDR", "[::1]:6060")
+	if _, err := config.LoadFile(""); err != nil {
+		t.Errorf("Expected a loopback profiling address to be accepted, got %v", err)
+	}
+}
+
+func TestAPIv2(t *testing.T) {
+	dir := t.TempDir()
+	logFile := dir + "/access.log"
+	line := `{"ClientHost":"203.0.113.7","RequestPath":"/","DownstreamStatus":200}` + "\n"
+	if err := os.WriteFile(logFile, []byte(strings.Repeat(line, 3)), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	manager, err := blocklist.New(blocklist.Config{
+		OutputPath: dir + "/blocklist.yml",
+		StatePath:  dir + "/blocklist.json",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create block list: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, PositionFile: dir + "/positions.json"})
+	handler.SetBlocklist(manager)
+	handler.SetVersion("1.2.3")
+	authenticator := auth.NewAuthenticator("secret-token")
+	mux := http.NewServeMux()
+	handler.RegisterV2(mux, authenticator.Require)
+
+	request := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	expectError := func(w *httptest.ResponseRecorder, status int, code string) *api.Error {
+		t.Helper()
+		var response api.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil || response.Error == nil {
+			t.Fatalf("Expected an error envelope, got %v", err)
+		}
+		if w.Code != status || response.Error.Code != code || response.Error.Status != status {
+			t.Errorf("Expected %d %s, got %d %+v", status, code, w.Code, response.Error)
+		}
+		return response.Error
+	}
+
+	// The first page tails the file and its cursor follows new lines
+	w := request(http.MethodGet, "/api/v2/logs/access?limit=2", "secret-token", "")
+	var page api.LogPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected a log page, got status %d: %v", w.Code, err)
+	}
+	if len(page.Lines) != 2 || page.Page.Count != 2 || page.Page.NextCursor != fmt.Sprint(3*len(line)) || page.Page.PrevCursor == "" {
+		t.Errorf("Expected the last 2 lines with cursors, got %+v", page.Page)
+	}
+
+	file, _ := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(line)
+	file.Close()
+	w = request(http.MethodGet, "/api/v2/logs/access?cursor="+page.Page.NextCursor, "secret-token", "")
+	page = api.LogPage{}
+	json.NewDecoder(w.Body).Decode(&page)
+	if len(page.Lines) != 1 || page.Page.HasMore {
+		t.Errorf("Expected the appended line, got %+v", page)
+	}
+
+	// Errors carry a machine-readable code, including authentication failures
+	apiErr := expectError(request(http.MethodGet, "/api/v2/logs/access?limit=lots", "secret-token", ""), http.StatusBadRequest, api.CodeInvalidParameter)
+	if apiErr.Param != "limit" {
+		t.Errorf("Expected the limit parameter to be named, got %q", apiErr.Param)
+	}
+	expectError(request(http.MethodGet, "/api/v2/logs/access", "", ""), http.StatusUnauthorized, api.CodeUnauthorized)
+	expectError(request(http.MethodGet, "/api/v2/logs/error", "wrong", ""), http.StatusUnauthorized, api.CodeUnauthorized)
+	expectError(request(http.MethodGet, "/api/v2/unknown", "", ""), http.StatusNotFound, api.CodeNotFound)
+	w = request(http.MethodPut, "/api/v2/status", "", "")
+	if w.Header().Get("Allow") != http.MethodGet {
+		t.Errorf("Expected the allowed methods, got %q", w.Header().Get("Allow"))
+	}
+	expectError(w, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed)
+
+	// v1 keeps its plain text authentication errors
+	w = httptest.NewRecorder()
+	authenticator.Require(auth.ScopeAccessLogs, handler.HandleAccessLogs)(w, httptest.NewRequest(http.MethodGet, "/api/logs/access", nil))
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Body.String(), "Unauthorized: ") {
+		t.Errorf("Expected a plain text v1 error, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Lists are paged with offsets
+	for _, ip := range []string{"203.0.113.7", "203.0.113.8"} {
+		w = request(http.MethodPost, "/api/v2/security/blocklist", "secret-token", `{"ip":"`+ip+`","reason":"test"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 when blocking, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	w = request(http.MethodGet, "/api/v2/security/blocklist?limit=1", "secret-token", "")
+	var list api.Blocklist
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Entries) != 1 || list.Page.Total == nil || *list.Page.Total != 2 || !list.Page.HasMore || list.Page.NextOffset == nil || *list.Page.NextOffset != 1 {
+		t.Errorf("Expected the first of 2 entries, got %+v", list.Page)
+	}
+	if w = request(http.MethodDelete, "/api/v2/security/blocklist?ip=203.0.113.8", "secret-token", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 when unblocking, got %d", w.Code)
+	}
+	expectError(request(http.MethodPost, "/api/v2/security/blocklist", "secret-token", `{"ip":"203.0.113.9"}`), http.StatusBadRequest, api.CodeInvalidParameter)
+
+	var status api.Status
+	json.NewDecoder(request(http.MethodGet, "/api/v2/status", "", "").Body).Decode(&status)
+	if status.Version != "1.2.3" || !status.AccessPathExists {
+		t.Errorf("Expected the agent version and access path, got %+v", status)
+	}
+
+	// The OpenAPI document is public and describes every operation
+	w = request(http.MethodGet, "/api/v2/openapi.json", "", "")
+	var doc struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected the OpenAPI document, got status %d: %v", w.Code, err)
+	}
+	if doc.OpenAPI != api.OpenAPIVersion {
+		t.Errorf("Expected OpenAPI %s, got %q", api.OpenAPIVersion, doc.OpenAPI)
+	}
+	for _, op := range handler.V2Operations() {
+		operation, ok := doc.Paths[op.Path][strings.ToLower(op.Method)]
+		if !ok || operation["operationId"] != op.ID {
+			t.Errorf("Expected %s %s to be documented", op.Method, op.Path)
+		}
+	}
+	for _, name := range []string{"LogPage", "Page", "ErrorResponse", "BlocklistEntry", "SecurityFinding", "Location"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("Expected a %s schema", name)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	logFile := dir + "/access.log"
+	line := `{"ClientHost":"203.0.113.7","RequestPath":"/","DownstreamStatus":200}` + "\n"
+	if err := os.WriteFile(logFile, []byte(strings.Repeat(line, 3)), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	manager, err := blocklist.New(blocklist.Config{
+		OutputPath: dir + "/blocklist.yml",
+		StatePath:  dir + "/blocklist.json",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create block list: %v", err)
+	}
+
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile, PositionFile: dir + "/positions.json"})
+	handler.SetBlocklist(manager)
+	handler.SetVersion("1.2.3")
+	authenticator := auth.NewAuthenticator("secret-token")
+	mux := http.NewServeMux()
+	handler.RegisterV2(mux, authenticator.Require)
+
+	// The first status request fails as an overloaded proxy would
+	var statusRequests, unavailable atomic.Int32
+	unavailable.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/status" {
+			statusRequests.Add(1)
+			if unavailable.Add(-1) >= 0 {
+				http.Error(w, "upstream overloaded", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	if _, err := client.New(client.Config{URL: "localhost:5000"}); err == nil {
+		t.Error("Expected a URL without a scheme to be rejected")
+	}
+	agent, err := client.New(client.Config{URL: server.URL, Token: "secret-token", MinBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	status, err := agent.Status(ctx)
+	if err != nil || status.Version != "1.2.3" || statusRequests.Load() != 2 {
+		t.Errorf("Expected the status after one retry, got %+v after %d requests: %v", status, statusRequests.Load(), err)
+	}
+
+	// Errors keep the envelope's code and aren't retried
+	_, err = agent.AccessLogs(ctx, client.LogQuery{Limit: -1})
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != api.CodeInvalidParameter || apiErr.Param != "limit" {
+		t.Errorf("Expected an invalid limit error, got %v", err)
+	}
+	anonymous, _ := client.New(client.Config{URL: server.URL})
+	if _, err := anonymous.Status(ctx); err != nil {
+		t.Errorf("Expected the status to be public, got %v", err)
+	}
+	if _, err := anonymous.Findings(ctx, client.FindingQuery{}); client.StatusCode(err) != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %v", err)
+	}
+
+	if _, err := agent.Block(ctx, api.BlocklistRequest{IP: "198.51.100.9", Reason: "scanner"}); err != nil {
+		t.Errorf("Failed to block: %v", err)
+	}
+	list, err := agent.Blocklist(ctx, client.ListQuery{})
+	if err != nil || len(list.Entries) != 1 || list.Entries[0].IP != "198.51.100.9/32" {
+		t.Errorf("Expected the blocked IP to be listed, got %+v: %v", list, err)
+	}
+	if err := agent.Unblock(ctx, "198.51.100.9", "resolved"); err != nil {
+		t.Errorf("Failed to unblock: %v", err)
+	}
+
+	// Follow reads the last lines, then new ones, then the rotated file from its start
+	pages := make(chan *api.LogPage)
+	followCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- agent.Follow(followCtx, logfiles.SourceAccess, client.LogQuery{Limit: 2}, 10*time.Millisecond, func(page *api.LogPage) error {
+			pages <- page
+			return nil
+		})
+	}()
+	next := func() *api.LogPage {
+		t.Helper()
+		select {
+		case page := <-pages:
+			return page
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for lines")
+			return nil
+		}
+	}
+
+	if page := next(); len(page.Lines) != 2 {
+		t.Errorf("Expected the last 2 lines, got %d", len(page.Lines))
+	}
+	file, _ := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"ClientHost":"203.0.113.8","RequestPath":"/new","DownstreamStatus":404}` + "\n")
+	file.Close()
+	page := next()
+	entries := logs.ParseTraefikLogs(page.Lines)
+	if len(entries) != 1 || entries[0].RequestPath != "/new" || entries[0].DownstreamStatus != 404 {
+		t.Errorf("Expected the appended line, got %v", page.Lines)
+	}
+
+	if err := os.WriteFile(logFile, []byte(`{"RequestPath":"/rotated"}`+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to rotate log file: %v", err)
+	}
+	if page := next(); len(page.Lines) != 1 || !strings.Contains(page.Lines[0], "/rotated") {
+		t.Errorf("Expected the first line of the rotated file, got %v", page.Lines)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected Follow to stop with the context, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Follow did not stop when cancelled")
+	}
+
+	// Cancelling interrupts the wait between retries
+	unavailable.Store(1000)
+	slow, _ := client.New(client.Config{URL: server.URL, MinBackoff: time.Minute})
+	timeout, cancelTimeout := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelTimeout()
+	started := time.Now()
+	if _, err := slow.Status(timeout); !errors.Is(err, context.DeadlineExceeded) || time.Since(started) > 5*time.Second {
+		t.Errorf("Expected the retry to stop at the deadline, got %v after %s", err, time.Since(started))
+	}
+}
+
+func TestClientDependencies(t *testing.T) {
+	// The client and its types only use the standard library, so importing
+	// them doesn't link the agent and its dependencies
+	apiPath := "github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	for _, dir := range []string{"../../pkg/api", "../../pkg/client"} {
+		files, _ := filepath.Glob(dir + "/*.go")
+		if len(files) == 0 {
+			t.Fatalf("No sources found in %s", dir)
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, "_test.go") {
+				continue
+			}
+			parsed, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %v", file, err)
+			}
+			for _, imp := range parsed.Imports {
+				path := strings.Trim(imp.Path.Value, `"`)
+				if path != apiPath && strings.Contains(strings.Split(path, "/")[0], ".") {
+					t.Errorf("%s imports %s", file, path)
+				}
+			}
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	entry := func(ago time.Duration, host, path, agent string) string {
+		return fmt.Sprintf(`{"StartUTC":%q,"ClientHost":%q,"RequestMethod":"GET","RequestPath":%q,"DownstreamStatus":200,"RequestUserAgent":%q}`,
+			now.Add(-ago).Format(time.RFC3339Nano), host, path, agent) + "\n"
+	}
+
+	logFile := dir + "/access.log"
+	current := entry(48*time.Hour, "203.0.113.1", "/too-old", "curl/8.0") +
+		entry(time.Hour, "203.0.113.7", "/a", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0") +
+		entry(30*time.Minute, "203.0.113.8", "/b", "Googlebot/2.1 (+http://www.google.com/bot.html)")
+	if err := os.WriteFile(logFile, []byte(current), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	// A rotated, compressed file holds the oldest entry in the range
+	var rotated bytes.Buffer
+	gz := gzip.NewWriter(&rotated)
+	gz.Write([]byte(entry(2*time.Hour, "198.51.100.4", "/rotated", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")))
+	gz.Close()
+	if err := os.WriteFile(logFile+".1.gz", rotated.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write rotated log: %v", err)
+	}
+	os.Chtimes(logFile+".1.gz", now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+
+	set, err := redact.NewSet(redact.Policy{IP: redact.IPTruncate}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create policies: %v", err)
+	}
+	handler := routes.NewHandler(&config.Config{AccessPath: logFile})
+	handler.SetRedaction(set)
+
+	request := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.HandleExport(w, httptest.NewRequest(http.MethodGet, "/api/logs/export?"+query, nil))
+		return w
+	}
+
+	// CSV of the last 24 hours with the default columns, oldest file first and redacted
+	w := request("")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected a CSV export, got status %d: %v", w.Code, err)
+	}
+	if strings.Join(records[0], ",") != strings.Join(export.DefaultColumns, ",") {
+		t.Errorf("Expected the default columns, got %v", records[0])
+	}
+	if len(records) != 4 || records[1][4] != "/rotated" || records[2][4] != "/a" || records[3][4] != "/b" {
+		t.Fatalf("Expected 3 entries in order, got %v", records)
+	}
+	if records[2][1] != "203.0.113.0" {
+		t.Errorf("Expected the client IP to be truncated, got %s", records[2][1])
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") || !strings.Contains(w.Header().Get("Content-Disposition"), ".csv\"") {
+		t.Errorf("Expected a CSV attachment, got %v", w.Header())
+	}
+
+	// Gzipped NDJSON with selected columns and filters
+	w = request("format=ndjson&gzip=true&columns=RequestPath,DownstreamStatus,StartUTC&exclude_bots=true")
+	if !strings.HasSuffix(w.Header().Get("Content-Disposition"), ".ndjson.gz\"") {
+		t.Errorf("Expected a gzipped NDJSON attachment, got %s", w.Header().Get("Content-Disposition"))
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Expected gzipped output: %v", err)
+	}
+	body, _ := io.ReadAll(reader)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], `{"RequestPath":"/a","DownstreamStatus":200,"StartUTC":"`) {
+		t.Errorf("Expected the 2 non-bot entries with the selected columns, got %v", lines)
+	}
+
+	// An explicit range only reads what falls in it
+	w = request("format=ndjson&columns=RequestPath&from=" + now.Add(-3*time.Hour).Format(time.RFC3339) + "&to=" + now.Add(-90*time.Minute).Format(time.RFC3339))
+	if strings.TrimSpace(w.Body.String()) != `{"RequestPath":"/rotated"}` {
+		t.Errorf("Expected only the rotated entry, got %q", w.Body.String())
+	}
+
+	w = request("format=parquet")
+	data := w.Body.Bytes()
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Errorf("Expected a Parquet file, got %d bytes", len(data))
+	}
+
+	for _, query := range []string{"format=xml", "columns=RequestPath,Nope", "range=soon"} {
+		if w := request(query); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	entry := func(ago time.Duration, host, path, agent, requestID string) string {
+		return fmt.Sprintf(`{"StartUTC":%q,"ClientHost":"203.0.113.7","RequestHost":%q,"RequestMethod":"GET","RequestPath":%q,"DownstreamStatus":502,"request_User-Agent":%q,"request_X-Request-Id":%q}`,
+			now.Add(-ago).Format(time.RFC3339Nano), host, path, agent, requestID) + "\n"
+	}
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+	accessFile := dir + "/access.log"
+	lines := entry(time.Hour, "shop.acme.example", "/api/orders?token=s3cret", "curl/8.4.0", "4f1c2a9e-77b0-4c1d-9a3e-0d5b2f6e8c11") +
+		entry(30*time.Minute, "other.example", "/login", firefox, "") +
+		entry(10*time.Minute, "shop.acme.example", "/api/users", firefox, "")
+	if err := os.WriteFile(accessFile, []byte(lines), 0644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	errorFile := dir + "/traefik.log"
+	refused := fmt.Sprintf(`time=%q level=error msg="connection refused" providerName=docker`, now.Add(-20*time.Minute).Format(time.RFC3339)) + "\n"
+	timeout := now.Add(-5*time.Minute).Format(time.RFC3339) + ` WRN Health check failed error="dial tcp 10.0.0.5:80: i/o timeout"` + "\n"
+	if err := os.WriteFile(errorFile, []byte(refused+timeout), 0644); err != nil {
+		t.Fatalf("Failed to write error log: %v", err)
+	}
+
+	// Small segments so most entries are read back from disk
+	cfg := search.Config{Dir: dir + "/index", Retention: 24 * time.Hour, SegmentDocs: 2, ErrorPath: errorFile, Backfill: 1 << 20}
+	index, err := search.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	pipeline := ingest.New(accessFile, time.Second, 1<<20)
+	pipeline.AddSink(index)
+	pipeline.Poll()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// A single poll indexes the error log
+	index.Run(ctx, time.Hour)
+
+	handler := routes.NewHandler(&config.Config{AccessPath: accessFile, ErrorPath: errorFile})
+	handler.SetSearchIndex(index)
+	request := func(h *routes.Handler, params url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.HandleSearch(w, httptest.NewRequest(http.MethodGet, "/api/logs/search?"+params.Encode(), nil))
+		return w
+	}
+	find := func(params url.Values) api.SearchResults {
+		t.Helper()
+		w := request(handler, params)
+		var results api.SearchResults
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Expected results for %v, got status %d: %v", params, w.Code, err)
+		}
+		return results
+	}
+	paths := func(results api.SearchResults) []string {
+		var paths []string
+		for _, doc := range results.Results {
+			paths = append(paths, doc.Fields[search.FieldPath])
+		}
+		return paths
+	}
+
+	// Terms match any default field, newest first
+	results := find(url.Values{"q": {"firefox"}})
+	if got := paths(results); len(got) != 2 || got[0] != "/api/users" || got[1] != "/login" {
+		t.Errorf("Expected the two Firefox requests, newest first, got %v", got)
+	}
+	if results.IndexedFrom == nil {
+		t.Error("Expected the oldest indexed time")
+	}
+
+	// A request ID is matched as a phrase and points at its line
+	results = find(url.Values{"q": {"4f1c2a9e-77b0-4c1d-9a3e-0d5b2f6e8c11"}})
+	if len(results.Results) != 1 || results.Results[0].File != "access.log" || results.Results[0].Offset != 0 {
+		t.Fatalf("Expected the request at offset 0 of access.log, got %+v", results.Results)
+	}
+
+	// Error log entries and the source filter
+	results = find(url.Values{"q": {`"connection refused"`}})
+	if len(results.Results) != 1 || results.Results[0].Source != logfiles.SourceError || results.Results[0].Fields[search.FieldLevel] != "error" {
+		t.Errorf("Expected the refused connection error, got %+v", results.Results)
+	}
+	results = find(url.Values{"q": {"timeo*"}, "source": {"error"}})
+	if len(results.Results) != 1 || results.Results[0].Offset != int64(len(refused)) || results.Results[0].Fields[search.FieldLevel] != "warn" {
+		t.Errorf("Expected the timeout warning at its offset, got %+v", results.Results)
+	}
+
+	// Time ranges and limits
+	if got := paths(find(url.Values{"q": {"firefox"}, "range": {"15m"}})); len(got) != 1 || got[0] != "/api/users" {
+		t.Errorf("Expected only the request in range, got %v", got)
+	}
+	if results := find(url.Values{"q": {"firefox"}, "limit": {"1"}}); len(results.Results) != 1 || !results.Truncated {
+		t.Errorf("Expected one truncated result, got %+v", results)
+	}
+
+	// Redacted values are neither shown nor matched
+	set, err := redact.NewSet(redact.Policy{QueryParams: []string{"token"}}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create policies: %v", err)
+	}
+	handler.SetRedaction(set)
+	if results := find(url.Values{"q": {"s3cret"}}); len(results.Results) != 0 {
+		t.Errorf("Expected redacted text not to match, got %+v", results.Results)
+	}
+	if got := paths(find(url.Values{"q": {"orders"}})); len(got) != 1 || got[0] != "/api/orders" {
+		t.Errorf("Expected the path without its token, got %v", got)
+	}
+	handler.SetRedaction(nil)
+
+	// Restricted keys only search their own traffic and never the error log
+	keysFile := dir + "/keys.json"
+	keys := fmt.Sprintf(`{"keys":[{"id":"acme","hash":%q,"scopes":["logs:access","logs:error"],"restrict":{"hosts":["*.acme.example"]}}]}`, auth.HashKey("acme-key"))
+	if err := os.WriteFile(keysFile, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	authenticator := auth.NewAuthenticator("")
+	if err := authenticator.LoadKeys(keysFile); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	restricted := func(params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/logs/search?"+params.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer acme-key")
+		w := httptest.NewRecorder()
+		authenticator.Require("", handler.HandleSearch).ServeHTTP(w, req)
+		return w
+	}
+	w := restricted(url.Values{"q": {"firefox"}})
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := paths(results); len(got) != 1 || got[0] != "/api/users" {
+		t.Errorf("Expected only the acme request, got %v", got)
+	}
+	if w := restricted(url.Values{"q": {"refused"}}); !strings.Contains(w.Body.String(), `"count":0`) {
+		t.Errorf("Expected no error log results, got %s", w.Body.String())
+	}
+	if w := restricted(url.Values{"q": {"refused"}, "source": {"error"}}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for the error source, got %d", w.Code)
+	}
+
+	for _, params := range []url.Values{
+		{},
+		{"q": {"a*"}},
+		{"q": {`"unterminated`}},
+		{"q": {"timeout"}, "fields": {"bogus"}},
+		{"q": {"timeout"}, "source": {"system"}},
+	} {
+		if w := request(handler, params); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %v, got %d", params, w.Code)
+		}
+	}
+	if w := request(routes.NewHandler(&config.Config{AccessPath: accessFile}), url.Values{"q": {"timeout"}}); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without an index, got %d", w.Code)
+	}
+}
+
 func TestMain(m *testing.M) {
 	// Setup: Create test log files
 	os.WriteFile("/tmp/test-access.log", []byte("test log\n"), 0644)
@@ -6,6 +6,7 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/oschwald/geoip2-golang v1.11.0
 	github.com/shirou/gopsutil/v3 v3.24.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
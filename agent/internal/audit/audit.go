@@ -0,0 +1,379 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/auth"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/clientip"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+)
+
+var log = logger.With("audit")
+
+// Defaults for the rotating audit file
+const (
+	DefaultMaxSize    = 10 * 1024 * 1024
+	DefaultMaxBackups = 5
+)
+
+// timeRangeParams are query parameters recorded as the requested time range rather than as filters
+var timeRangeParams = map[string]bool{"from": true, "to": true, "range": true, "since": true}
+
+// Record describes one request served to an authenticated caller
+type Record struct {
+	Time       time.Time         `json:"time"`
+	KeyID      string            `json:"key_id"`
+	Method     string            `json:"method"`
+	Endpoint   string            `json:"endpoint"`
+	Filters    map[string]string `json:"filters,omitempty"`
+	TimeRange  map[string]string `json:"time_range,omitempty"`
+	Status     int               `json:"status"`
+	Rows       int               `json:"rows"`
+	ClientAddr string            `json:"client_addr"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// Query filters the records returned by Query
+type Query struct {
+	KeyID    string
+	Endpoint string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// Log appends records as JSON lines to a file that is rotated by size
+type Log struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	resolver   *clientip.Resolver
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// closed is set by Close; until then a file that failed to reopen after
+	// rotation is opened again by the next write
+	closed bool
+}
+
+// rowsKey stores the row counter of the request being recorded
+type rowsKey struct{}
+
+// New opens the audit file, creating it and its directory if needed
+func New(path string, maxSize int64, maxBackups int) (*Log, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxBackups < 0 {
+		maxBackups = DefaultMaxBackups
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetClientIPResolver derives caller addresses from forwarding headers sent by trusted proxies
+func (l *Log) SetClientIPResolver(resolver *clientip.Resolver) {
+	l.resolver = resolver
+}
+
+// Path returns the location of the current audit file
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Size returns the bytes used by the current audit file and its backups
+func (l *Log) Size() int64 {
+	var size int64
+	for i := 0; i <= l.maxBackups; i++ {
+		path := l.path
+		if i > 0 {
+			path = l.backupPath(i)
+		}
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// Close closes the audit file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Wrap records every request served by next. It must run inside the
+// authenticator so the caller's identity is known.
+func (l *Log) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rows := new(int)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(recorder, r.WithContext(context.WithValue(r.Context(), rowsKey{}, rows)))
+
+		record := Record{
+			Time:       start.UTC(),
+			KeyID:      "anonymous",
+			Method:     r.Method,
+			Endpoint:   r.URL.Path,
+			Status:     recorder.status,
+			Rows:       *rows,
+			ClientAddr: l.clientAddr(r),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+			record.KeyID = identity.KeyID
+		}
+		for name, values := range r.URL.Query() {
+			if len(values) == 0 {
+				continue
+			}
+			if timeRangeParams[name] {
+				if record.TimeRange == nil {
+					record.TimeRange = make(map[string]string)
+				}
+				record.TimeRange[name] = values[0]
+				continue
+			}
+			if record.Filters == nil {
+				record.Filters = make(map[string]string)
+			}
+			record.Filters[name] = strings.Join(values, ",")
+		}
+
+		if err := l.Write(record); err != nil {
+			log.Error("Failed to write record", logger.KeyPath, l.path, logger.Err(err))
+		}
+	}
+}
+
+// SetRows records how many rows a handler returned; it is a no-op outside Wrap
+func SetRows(ctx context.Context, rows int) {
+	if counter, ok := ctx.Value(rowsKey{}).(*int); ok {
+		*counter = rows
+	}
+}
+
+// Write appends a record, rotating the file first if it would grow past the size limit
+func (l *Log) Write(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return os.ErrClosed
+	}
+	if l.file != nil && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			// Keep appending to the current file rather than dropping records
+			log.Warn("Failed to rotate audit file", logger.KeyPath, l.path, logger.Err(err))
+		}
+	}
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	return err
+}
+
+// Query returns matching records from the current and rotated files, newest
+// first. Records are appended in the order they are written, so files are read
+// newest first until the limit is reached, keeping the last matches of each.
+func (l *Log) Query(query Query) ([]Record, error) {
+	if query.Limit <= 0 {
+		query.Limit = 100
+	}
+
+	l.mu.Lock()
+	files := []string{l.path}
+	for i := 1; i <= l.maxBackups; i++ {
+		files = append(files, l.backupPath(i))
+	}
+	l.mu.Unlock()
+
+	records := []Record{}
+	for _, path := range files {
+		matched, err := readRecords(path, query)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		records = append(records, matched...)
+		if len(records) >= query.Limit {
+			break
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.After(records[j].Time) })
+	if len(records) > query.Limit {
+		records = records[:query.Limit]
+	}
+	return records, nil
+}
+
+// open opens the current file for appending
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts the backups up by one and starts a new file. The current file
+// is closed first; when rotation fails, Write opens it again.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	if l.maxBackups == 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return l.open()
+	}
+
+	os.Remove(l.backupPath(l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(l.backupPath(i), l.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.backupPath(1)); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// backupPath returns the path of the nth rotated file
+func (l *Log) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// clientAddr returns the caller's address, honouring trusted proxies
+func (l *Log) clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !l.resolver.Enabled() {
+		return host
+	}
+	return l.resolver.Resolve(host, r.Header.Get)
+}
+
+// readRecords reads the last query.Limit records of a file that match the query
+func readRecords(path string, query Query) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if query.KeyID != "" && record.KeyID != query.KeyID {
+			continue
+		}
+		if query.Endpoint != "" && record.Endpoint != query.Endpoint {
+			continue
+		}
+		if !query.Since.IsZero() && record.Time.Before(query.Since) {
+			continue
+		}
+		if !query.Until.IsZero() && record.Time.After(query.Until) {
+			continue
+		}
+		records = append(records, record)
+		if len(records) >= 2*query.Limit {
+			records = append(records[:0], records[len(records)-query.Limit:]...)
+		}
+	}
+	if len(records) > query.Limit {
+		records = records[len(records)-query.Limit:]
+	}
+	return records, scanner.Err()
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
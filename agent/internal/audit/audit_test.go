@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/auth"
+)
+
+// newLog opens an audit log in a temporary directory
+func newLog(t *testing.T, maxSize int64, maxBackups int) *Log {
+	t.Helper()
+	l, err := New(t.TempDir()+"/audit/audit.log", maxSize, maxBackups)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestWrap(t *testing.T) {
+	l := newLog(t, 0, 0)
+	handler := auth.NewAuthenticator("admin-token").Require(auth.ScopeAdmin, l.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		SetRows(r.Context(), 7)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/access?exclude_bots=true&host=a&host=b&from=2024-01-01T00:00:00Z", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	req.RemoteAddr = "198.51.100.4:5555"
+	handler(httptest.NewRecorder(), req)
+
+	records, err := l.Query(Query{})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %+v", records)
+	}
+	record := records[0]
+	if record.KeyID != "token" || record.Endpoint != "/api/logs/access" || record.Status != http.StatusTeapot || record.Rows != 7 || record.ClientAddr != "198.51.100.4" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if record.Filters["exclude_bots"] != "true" || record.Filters["host"] != "a,b" || record.TimeRange["from"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("Unexpected record filters: %+v", record)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	// A tiny size limit forces rotation after every record
+	l := newLog(t, 1, 2)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, key := range []string{"a", "b", "a", "b"} {
+		if err := l.Write(Record{Time: start.Add(time.Duration(i) * time.Minute), KeyID: key, Endpoint: "/api/" + key}); err != nil {
+			t.Fatalf("Failed to write record: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(l.backupPath(2)); err != nil {
+		t.Errorf("Expected two rotated files: %v", err)
+	}
+	if _, err := os.Stat(l.backupPath(3)); !os.IsNotExist(err) {
+		t.Errorf("Expected no more than two backups, got %v", err)
+	}
+
+	records, err := l.Query(Query{})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	// The oldest record was rotated out
+	if len(records) != 3 || !records[0].Time.Equal(start.Add(3*time.Minute)) || !records[2].Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the 3 retained records newest first, got %+v", records)
+	}
+
+	for _, tc := range []struct {
+		query Query
+		want  int
+	}{
+		{Query{KeyID: "a"}, 1},
+		{Query{Endpoint: "/api/b"}, 2},
+		{Query{Since: start.Add(2 * time.Minute)}, 2},
+		{Query{Until: start.Add(2 * time.Minute)}, 2},
+		{Query{Limit: 1}, 1},
+	} {
+		if records, err := l.Query(tc.query); err != nil || len(records) != tc.want {
+			t.Errorf("Query %+v: expected %d records, got %d (%v)", tc.query, tc.want, len(records), err)
+		}
+	}
+
+	// Older files aren't read once the newer ones hold enough records
+	if err := os.Remove(l.backupPath(2)); err != nil {
+		t.Fatalf("Failed to remove backup: %v", err)
+	}
+	if err := os.Mkdir(l.backupPath(2), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if records, err := l.Query(Query{Limit: 2}); err != nil || len(records) != 2 || !records[1].Time.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Expected the 2 newest records without reading the oldest file, got %+v (%v)", records, err)
+	}
+	if _, err := l.Query(Query{Limit: 3}); err == nil {
+		t.Error("Expected an error reading the oldest file")
+	}
+	os.Remove(l.backupPath(2))
+
+	if size := l.Size(); size == 0 {
+		t.Error("Expected the audit files to be counted")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Failed to close audit log: %v", err)
+	}
+	if err := l.Write(Record{}); err != os.ErrClosed {
+		t.Errorf("Expected writes to a closed log to fail, got %v", err)
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	l := newLog(t, 1, 1)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(i int) {
+		t.Helper()
+		if err := l.Write(Record{Time: start.Add(time.Duration(i) * time.Minute), KeyID: "a"}); err != nil {
+			t.Fatalf("Failed to write record %d: %v", i, err)
+		}
+	}
+	write(0)
+
+	// A directory in place of the backup makes every rotation fail
+	if err := os.MkdirAll(l.backupPath(1)+"/blocked", 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	write(1)
+	write(2)
+	if records, err := l.Query(Query{Limit: 3}); err != nil || len(records) != 3 {
+		t.Errorf("Expected the records to be kept in the current file, got %+v (%v)", records, err)
+	}
+
+	// Rotation resumes once the backup can be replaced
+	if err := os.RemoveAll(l.backupPath(1)); err != nil {
+		t.Fatalf("Failed to remove directory: %v", err)
+	}
+	write(3)
+	if info, err := os.Stat(l.backupPath(1)); err != nil || info.IsDir() {
+		t.Errorf("Expected the current file to be rotated, got %v", err)
+	}
+	if records, err := l.Query(Query{}); err != nil || len(records) != 4 || !records[0].Time.Equal(start.Add(3*time.Minute)) {
+		t.Errorf("Expected all 4 records, got %+v (%v)", records, err)
+	}
+}
@@ -1,13 +1,157 @@
 package auth
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"path"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+)
+
+var log = logger.With("auth")
+
+// Scopes granted to API keys
+const (
+	ScopeAccessLogs = "logs:access"
+	ScopeErrorLogs  = "logs:error"
+	ScopeSystem     = "system"
+	ScopeGeo        = "geo"
+	// ScopeAdmin grants every other scope
+	ScopeAdmin = "admin"
 )
 
+// validScopes lists the scopes accepted in the keys file
+var validScopes = map[string]bool{
+	ScopeAccessLogs: true,
+	ScopeErrorLogs:  true,
+	ScopeSystem:     true,
+	ScopeGeo:        true,
+	ScopeAdmin:      true,
+}
+
+// Key is an API key as stored in the keys file; only the SHA-256 hash of the
+// secret is kept
+type Key struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Restrict limits the key to a subset of the traffic
+	Restrict Restriction `json:"restrict"`
+
+	digest []byte
+}
+
+// Restriction limits a key to log entries matching one of the listed values for
+// every non-empty field. Values are case-insensitive and may contain * wildcards.
+type Restriction struct {
+	Hosts       []string `json:"hosts,omitempty"`
+	Routers     []string `json:"routers,omitempty"`
+	Services    []string `json:"services,omitempty"`
+	EntryPoints []string `json:"entrypoints,omitempty"`
+}
+
+// IsZero reports whether the restriction allows all traffic
+func (r Restriction) IsZero() bool {
+	return len(r.Hosts) == 0 && len(r.Routers) == 0 && len(r.Services) == 0 && len(r.EntryPoints) == 0
+}
+
+// Allows reports whether a log entry is visible under the restriction
+func (r Restriction) Allows(entry *logs.TraefikLog) bool {
+	return matchAny(r.Hosts, entry.RequestHost) &&
+		matchAny(r.Routers, entry.RouterName) &&
+		matchAny(r.Services, entry.ServiceName) &&
+		matchAny(r.EntryPoints, entry.EntryPointName)
+}
+
+// matchAny reports whether value matches one of the patterns; no patterns match everything
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	value = strings.ToLower(value)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lowercases the patterns and rejects malformed ones
+func (r *Restriction) normalize() error {
+	for _, patterns := range [][]string{r.Hosts, r.Routers, r.Services, r.EntryPoints} {
+		for i, pattern := range patterns {
+			patterns[i] = strings.ToLower(strings.TrimSpace(pattern))
+			if _, err := path.Match(patterns[i], ""); err != nil {
+				return fmt.Errorf("invalid pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// keysFile is the JSON document holding the API keys
+type keysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// Identity describes the key a request was authenticated with
+type Identity struct {
+	KeyID    string
+	Scopes   []string
+	Restrict Restriction
+}
+
+// Restricted reports whether the identity only sees a subset of the traffic
+func (i Identity) Restricted() bool {
+	return !i.Restrict.IsZero()
+}
+
+// HasScope reports whether the identity was granted a scope
+func (i Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// identityKey is the request context key for the authenticated identity
+type identityKey struct{}
+
+// IdentityFromContext returns the identity attached by the middleware
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
 // Authenticator handles authentication for the agent
 type Authenticator struct {
 	token string
+
+	keysPath string
+	mu       sync.RWMutex
+	keys     []Key
+	modTime  time.Time
+	size     int64
+
+	// jwt validates bearer tokens issued by an identity provider (nil when disabled)
+	jwt *JWTValidator
+	// certScopes maps verified client certificate names to scopes
+	certScopes map[string][]string
 }
 
 // NewAuthenticator creates a new authenticator with the given token
@@ -17,51 +161,307 @@ func NewAuthenticator(token string) *Authenticator {
 	}
 }
 
+// SetToken replaces the static token, for instance when the configuration is reloaded
+func (a *Authenticator) SetToken(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = token
+}
+
+// SetJWTValidator enables JWT bearer tokens alongside the static token and API keys
+func (a *Authenticator) SetJWTValidator(validator *JWTValidator) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.jwt = validator
+}
+
+// SetClientCertScopes grants scopes to requests presenting a verified client
+// certificate whose common name or subject alternative name is in the map
+func (a *Authenticator) SetClientCertScopes(scopes map[string][]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.certScopes = scopes
+}
+
+// HashKey returns the value to store in the keys file for an API key secret
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// LoadKeys reads API keys from a JSON file; the file is re-read by Reload and
+// Watch when it changes
+func (a *Authenticator) LoadKeys(path string) error {
+	a.mu.Lock()
+	a.keysPath = path
+	a.mu.Unlock()
+
+	_, err := a.Reload()
+	return err
+}
+
+// Reload re-reads the keys file if it changed since it was last loaded. On error
+// the previously loaded keys stay in effect.
+func (a *Authenticator) Reload() (bool, error) {
+	a.mu.RLock()
+	path, modTime, size := a.keysPath, a.modTime, a.size
+	a.mu.RUnlock()
+
+	if path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	if info.ModTime().Equal(modTime) && info.Size() == size {
+		return false, nil
+	}
+
+	keys, err := readKeys(path)
+	if err != nil {
+		return false, err
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.modTime = info.ModTime()
+	a.size = info.Size()
+	a.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch reloads the keys file when it changes until the context is cancelled
+func (a *Authenticator) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := a.Reload()
+			if err != nil {
+				log.Warn("Keeping previous API keys", logger.KeyPath, a.keysPath, logger.Err(err))
+			} else if changed {
+				log.Info("Reloaded API keys", logger.KeyPath, a.keysPath, "keys", a.KeyCount())
+			}
+		}
+	}
+}
+
+// readKeys parses and validates a keys file
+func readKeys(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range file.Keys {
+		key := &file.Keys[i]
+		if key.ID == "" {
+			return nil, fmt.Errorf("API key %d has no id", i+1)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate API key id %q", key.ID)
+		}
+		seen[key.ID] = true
+
+		digest, err := hex.DecodeString(strings.TrimPrefix(key.Hash, "sha256:"))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: hash must be a hex SHA-256 digest", key.ID)
+		}
+		key.digest = digest
+
+		if len(key.Scopes) == 0 {
+			return nil, fmt.Errorf("API key %q has no scopes", key.ID)
+		}
+		for _, scope := range key.Scopes {
+			if !validScopes[scope] {
+				return nil, fmt.Errorf("API key %q: unknown scope %q", key.ID, scope)
+			}
+		}
+
+		if err := key.Restrict.normalize(); err != nil {
+			return nil, fmt.Errorf("API key %q: %w", key.ID, err)
+		}
+	}
+
+	return file.Keys, nil
+}
+
+// KeyCount returns the number of loaded API keys
+func (a *Authenticator) KeyCount() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.keys)
+}
+
 // Middleware returns an HTTP middleware that validates Bearer tokens
 func (a *Authenticator) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return a.Require("", next)
+}
+
+// Require returns an HTTP middleware that validates Bearer tokens and checks
+// the key was granted scope; an empty scope accepts any valid key
+func (a *Authenticator) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// If no token is configured, skip authentication
-		if a.token == "" {
+		// If no token or keys are configured, skip authentication
+		if !a.IsEnabled() {
 			next(w, r)
 			return
 		}
 
 		// Get Authorization header
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Unauthorized: Missing Authorization header", http.StatusUnauthorized)
+
+		// A verified client certificate stands in for a token
+		identity, ok := a.certificateIdentity(r)
+		if !ok && authHeader == "" {
+			deny(w, r, http.StatusUnauthorized, "Missing Authorization header")
 			return
 		}
 
-		// Check for Bearer token format
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Unauthorized: Invalid Authorization format", http.StatusUnauthorized)
-			return
+		if !ok {
+			// Check for Bearer token format
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				deny(w, r, http.StatusUnauthorized, "Invalid Authorization format")
+				return
+			}
+
+			// Validate token
+			identity, ok = a.authenticate(parts[1])
+			if !ok {
+				deny(w, r, http.StatusUnauthorized, "Invalid token")
+				return
+			}
 		}
 
-		// Validate token
-		token := parts[1]
-		if token != a.token {
-			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
+		if scope != "" && !identity.HasScope(scope) {
+			deny(w, r, http.StatusForbidden, "API key lacks the "+scope+" scope")
 			return
 		}
 
 		// Token is valid, proceed to next handler
-		next(w, r)
+		next(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	}
+}
+
+// deny rejects a request. The versioned API answers in its error envelope;
+// v1 keeps its plain text responses.
+func deny(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if strings.HasPrefix(r.URL.Path, api.PathPrefix) {
+		code := api.CodeUnauthorized
+		if status == http.StatusForbidden {
+			code = api.CodeForbidden
+		}
+		api.WriteError(w, &api.Error{Status: status, Code: code, Message: message})
+		return
+	}
+	http.Error(w, http.StatusText(status)+": "+message, status)
+}
+
+// certificateIdentity maps a verified client certificate to an identity when
+// no Authorization header takes precedence
+func (a *Authenticator) certificateIdentity(r *http.Request) (Identity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || r.Header.Get("Authorization") != "" {
+		return Identity{}, false
+	}
+
+	a.mu.RLock()
+	certScopes := a.certScopes
+	a.mu.RUnlock()
+
+	if len(certScopes) == 0 {
+		return Identity{}, false
 	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, name := range names {
+		for _, scope := range certScopes[name] {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	if len(scopes) == 0 {
+		return Identity{}, false
+	}
+	return Identity{KeyID: "cert:" + cert.Subject.CommonName, Scopes: scopes}, true
 }
 
-// ValidateToken checks if the provided token matches the configured token
+// authenticate matches a presented token against the static token and the API keys
+func (a *Authenticator) authenticate(token string) (Identity, bool) {
+	a.mu.RLock()
+	staticToken, validator := a.token, a.jwt
+	a.mu.RUnlock()
+
+	if staticToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(staticToken)) == 1 {
+		return Identity{KeyID: "token", Scopes: []string{ScopeAdmin}}, true
+	}
+
+	// API keys may contain dots too, so a token that fails as a JWT is still
+	// looked up as a key
+	if validator != nil && looksLikeJWT(token) {
+		if identity, err := validator.Validate(token); err == nil {
+			return identity, true
+		}
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var match *Key
+	for i := range a.keys {
+		// Compare against every key so timing does not reveal which one matched
+		if subtle.ConstantTimeCompare(digest[:], a.keys[i].digest) == 1 {
+			match = &a.keys[i]
+		}
+	}
+
+	if match == nil || (match.ExpiresAt != nil && now.After(*match.ExpiresAt)) {
+		return Identity{}, false
+	}
+
+	return Identity{KeyID: match.ID, Scopes: match.Scopes, Restrict: match.Restrict}, true
+}
+
+// ValidateToken checks if the provided token matches the configured token or an API key
 func (a *Authenticator) ValidateToken(token string) bool {
 	// If no token is configured, allow all requests
-	if a.token == "" {
+	if !a.IsEnabled() {
 		return true
 	}
-	return token == a.token
+	_, ok := a.authenticate(token)
+	return ok
 }
 
 // IsEnabled returns true if authentication is enabled
 func (a *Authenticator) IsEnabled() bool {
-	return a.token != ""
-}
\ No newline at end of file
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.token != "" || a.keysPath != "" || a.jwt != nil || len(a.certScopes) > 0
+}
@@ -0,0 +1,494 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+)
+
+// DefaultScopeClaim is the claim scopes are read from when none is configured
+const DefaultScopeClaim = "scope"
+
+// jwksMinRefresh is the default rate limit of JWKS refreshes triggered by unknown key IDs
+const jwksMinRefresh = time.Minute
+
+// minRSABits is the smallest RSA modulus accepted from a key set
+const minRSABits = 2048
+
+// ErrInvalidToken is returned for tokens that fail validation
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTConfig configures validation of JWT bearer tokens
+type JWTConfig struct {
+	// JWKS is a file path or http(s) URL of the JSON Web Key Set
+	JWKS string
+	// Issuer and Audience are required, so tokens the identity provider
+	// issues for other applications are refused
+	Issuer   string
+	Audience string
+	// ScopeClaim holds a space-separated string or an array of values
+	ScopeClaim string
+	// ScopeMap maps claim values, such as group names, to API scopes; only
+	// mapped values grant scopes
+	ScopeMap map[string][]string
+	// Leeway tolerates clock skew when checking exp and nbf
+	Leeway time.Duration
+	// MinRefresh is the least time between JWKS refreshes triggered by
+	// unknown key IDs, whether they succeed or not; defaults to a minute
+	MinRefresh time.Duration
+}
+
+// JWTValidator validates JWT bearer tokens against a JSON Web Key Set
+type JWTValidator struct {
+	config JWTConfig
+	client *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+	// lastRefresh is when the set was last loaded or a refresh was attempted
+	lastRefresh time.Time
+
+	// refreshMu collapses concurrent refreshes for unknown key IDs into one
+	refreshMu sync.Mutex
+}
+
+// jwk is a single JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// NewJWTValidator creates a validator and loads the key set
+func NewJWTValidator(config JWTConfig) (*JWTValidator, error) {
+	if config.JWKS == "" {
+		return nil, errors.New("JWKS location is required")
+	}
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("JWT issuer and audience are required")
+	}
+	if config.ScopeClaim == "" {
+		config.ScopeClaim = DefaultScopeClaim
+	}
+	if config.MinRefresh <= 0 {
+		config.MinRefresh = jwksMinRefresh
+	}
+
+	v := &JWTValidator{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := v.Refresh(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ParseScopeMap parses "value=scope,scope;value=scope" into a scope map
+func ParseScopeMap(spec string) (map[string][]string, error) {
+	scopeMap := make(map[string][]string)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		value, scopes, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid scope mapping %q: expected value=scope,scope", part)
+		}
+
+		for _, scope := range strings.Split(scopes, ",") {
+			scope = strings.TrimSpace(scope)
+			if !validScopes[scope] {
+				return nil, fmt.Errorf("invalid scope mapping %q: unknown scope %q", part, scope)
+			}
+			scopeMap[strings.TrimSpace(value)] = append(scopeMap[strings.TrimSpace(value)], scope)
+		}
+	}
+	return scopeMap, nil
+}
+
+// Refresh reloads the key set from its file or URL
+func (v *JWTValidator) Refresh() error {
+	data, err := v.fetchJWKS()
+	if err != nil {
+		return fmt.Errorf("failed to load JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := key.publicKey()
+		if err != nil {
+			log.Warn("Skipping JWKS key", "kid", key.Kid, logger.Err(err))
+			continue
+		}
+		keys[key.Kid] = publicKey
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contains no usable signing keys")
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.lastRefresh = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
+
+// Run refreshes the key set periodically until the context is cancelled
+func (v *JWTValidator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.Refresh(); err != nil {
+				log.Warn("Keeping previous JWKS", logger.KeyPath, v.config.JWKS, logger.Err(err))
+			}
+		}
+	}
+}
+
+// fetchJWKS reads the key set document
+func (v *JWTValidator) fetchJWKS() ([]byte, error) {
+	location := v.config.JWKS
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(location)
+	}
+
+	resp, err := v.client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// publicKey converts a JWK into a public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("RSA exponent too large")
+		}
+		if n.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA modulus of %d bits is below %d", n.BitLen(), minRSABits)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// decodeBigInt decodes a base64url-encoded unsigned integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// looksLikeJWT reports whether a bearer token has the three-part JWT shape
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Validate verifies a token's signature and claims and returns the identity it grants
+func (v *JWTValidator) Validate(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return Identity{}, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return Identity{}, err
+	}
+
+	scopes := v.scopes(claims[v.config.ScopeClaim])
+	if len(scopes) == 0 {
+		return Identity{}, fmt.Errorf("%w: no scopes granted", ErrInvalidToken)
+	}
+
+	subject, _ := claims["sub"].(string)
+	return Identity{KeyID: "jwt:" + subject, Scopes: scopes}, nil
+}
+
+// key returns the public key for a key ID, refreshing the set once if it is unknown
+func (v *JWTValidator) key(kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.lookupKey(kid)
+	v.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	// Signing keys may have been rotated since the set was loaded
+	v.refreshUnknown()
+	v.mu.RLock()
+	key, ok = v.lookupKey(kid)
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+}
+
+// refreshUnknown refreshes the set for an unknown key ID, at most once per
+// MinRefresh. The attempt is recorded before fetching, so a failing JWKS
+// endpoint isn't hit by every token, and callers arriving during a refresh
+// wait for it instead of starting their own.
+func (v *JWTValidator) refreshUnknown() {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	v.mu.Lock()
+	if time.Since(v.lastRefresh) < v.config.MinRefresh {
+		v.mu.Unlock()
+		return
+	}
+	v.lastRefresh = time.Now()
+	v.mu.Unlock()
+
+	if err := v.Refresh(); err != nil {
+		log.Warn("Failed to refresh JWKS", logger.KeyPath, v.config.JWKS, logger.Err(err))
+	}
+}
+
+// lookupKey finds a key by ID; a token without a key ID matches a single-key set
+func (v *JWTValidator) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := v.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// verifySignature checks the signature for the algorithms the agent accepts
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "RS256":
+		if rsaKey, ok := key.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case "ES256":
+		if ecKey, ok := key.(*ecdsa.PublicKey); ok && len(signature) == 64 {
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(ecKey, digest[:], r, s) {
+				return nil
+			}
+		}
+	case "EdDSA":
+		if edKey, ok := key.(ed25519.PublicKey); ok && ed25519.Verify(edKey, []byte(signed), signature) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+
+	return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+// checkClaims validates the registered claims
+func (v *JWTValidator) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.config.Leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+
+	if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+
+	if !containsValue(claims["aud"], v.config.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+// scopes maps the scope claim to API scopes. Claim values are never granted
+// as scopes themselves, since the identity provider may use the same names
+// for other applications.
+func (v *JWTValidator) scopes(claim interface{}) []string {
+	seen := make(map[string]bool)
+	var scopes []string
+	add := func(scope string) {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	for _, value := range claimValues(claim) {
+		for _, scope := range v.config.ScopeMap[value] {
+			add(scope)
+		}
+	}
+	return scopes
+}
+
+// claimValues flattens a space-separated string or array claim
+func claimValues(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// containsValue reports whether a string or array claim contains want
+func containsValue(claim interface{}, want string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == want
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url JSON segment
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
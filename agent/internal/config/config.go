@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/env"
 )
 
@@ -16,25 +18,177 @@ type Config struct {
 	GeoIPEnabled     bool
 	GeoIPCityDB      string
 	GeoIPCountryDB   string
+	GeoIPASNDB       string
+	GeoIPReload      time.Duration
+	GeoIPCacheSize   int
+	GeoIPRetention   time.Duration
+	TrustedProxies   string
+	AuthKeysFile     string
+	JWTJWKS          string
+	JWTIssuer        string
+	JWTAudience      string
+	JWTScopeClaim    string
+	JWTScopeMap      string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSClientCA      string
+	TLSClientAuth    string
+	TLSMinVersion    string
+	TLSClientScopes  string
+	ClientIPHeaders  string
+	CORSOrigins      string
+	CORSMethods      string
+	CORSHeaders      string
+	CORSCredentials  bool
+	CORSMaxAge       time.Duration
+	SecurityHeaders  bool
+	RedactIP         string
+	RedactHashKey    string
+	RedactIPv4Bits   int
+	RedactIPv6Bits   int
+	RedactUsername   bool
+	RedactQuery      string
+	RedactHeaders    string
+	RedactPolicies   string
+	AuditFile        string
+	AuditMaxSize     int
+	AuditBackups     int
 	PositionFile     string
+	StateFile        string
+	SearchEnabled    bool
+	SearchDir        string
+	SearchRetention  time.Duration
+	ShutdownTimeout  time.Duration
+	AgentLogLevel    string
+	AgentLogFormat   string
+	RequestLog       bool
+	PprofAddr        string
+	PathPatterns     string
+	PathQueryMode    string
+	UserAgentRules   string
+	IngestBackfill   int64
+	SecurityEnabled  bool
+	SecurityWindow   time.Duration
+	Security404Max   int
+	SecurityAuthMax  int
+	SecurityRateMax  int
+	BlocklistEnabled bool
+	BlocklistOutput  string
+	BlocklistState   string
+	BlocklistTTL     time.Duration
+	BlocklistMinSev  string
+	BlocklistName    string
+	BlocklistPlugin  string
+	BlocklistAllow   string
 }
 
 // Load reads configuration from environment variables using the env package
 func Load() *Config {
-	e := env.LoadEnv()
+	return fromEnv(env.LoadEnv())
+}
+
+// LoadFile reads the YAML config file at path, applies environment variable
+// overrides and validates the result. An empty path reads the environment only.
+func LoadFile(path string) (*Config, error) {
+	var values map[string]string
+	if path != "" {
+		var err error
+		if values, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := fromEnv(env.LoadEnvWith(values))
+	// Checked after the .env file has been loaded into the environment
+	if err := checkEnvironment(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// FilePath returns the config file path set by TRAEFIK_LOG_DASHBOARD_CONFIG_FILE
+func FilePath() string {
+	return env.ConfigFile()
+}
 
+// fromEnv builds the configuration from the values read by the env package
+func fromEnv(e env.Env) *Config {
 	cfg := &Config{
 		AccessPath:       e.AccessPath,
 		ErrorPath:        e.ErrorPath,
 		AuthToken:        e.AuthToken,
 		SystemMonitoring: e.SystemMonitoring,
-		MonitorInterval:  2000, // Keep default for now
+		MonitorInterval:  int(e.MonitorInterval.Milliseconds()),
 		Port:             e.Port,
 		LogFormat:        e.LogFormat,
 		GeoIPEnabled:     e.GeoIPEnabled,
 		GeoIPCityDB:      e.GeoIPCityDB,
 		GeoIPCountryDB:   e.GeoIPCountryDB,
+		GeoIPASNDB:       e.GeoIPASNDB,
+		GeoIPReload:      e.GeoIPReload,
+		GeoIPCacheSize:   e.GeoIPCacheSize,
+		GeoIPRetention:   e.GeoIPRetention,
+		TrustedProxies:   e.TrustedProxies,
+		AuthKeysFile:     e.AuthKeysFile,
+		JWTJWKS:          e.JWTJWKS,
+		JWTIssuer:        e.JWTIssuer,
+		JWTAudience:      e.JWTAudience,
+		JWTScopeClaim:    e.JWTScopeClaim,
+		JWTScopeMap:      e.JWTScopeMap,
+		TLSCertFile:      e.TLSCertFile,
+		TLSKeyFile:       e.TLSKeyFile,
+		TLSClientCA:      e.TLSClientCA,
+		TLSClientAuth:    e.TLSClientAuth,
+		TLSMinVersion:    e.TLSMinVersion,
+		TLSClientScopes:  e.TLSClientScopes,
+		ClientIPHeaders:  e.ClientIPHeaders,
+		CORSOrigins:      e.CORSOrigins,
+		CORSMethods:      e.CORSMethods,
+		CORSHeaders:      e.CORSHeaders,
+		CORSCredentials:  e.CORSCredentials,
+		CORSMaxAge:       e.CORSMaxAge,
+		SecurityHeaders:  e.SecurityHeaders,
+		RedactIP:         e.RedactIP,
+		RedactHashKey:    e.RedactHashKey,
+		RedactIPv4Bits:   e.RedactIPv4Bits,
+		RedactIPv6Bits:   e.RedactIPv6Bits,
+		RedactUsername:   e.RedactUsername,
+		RedactQuery:      e.RedactQuery,
+		RedactHeaders:    e.RedactHeaders,
+		RedactPolicies:   e.RedactPolicies,
+		AuditFile:        e.AuditFile,
+		AuditMaxSize:     e.AuditMaxSize,
+		AuditBackups:     e.AuditBackups,
 		PositionFile:     e.PositionFile,
+		StateFile:        e.StateFile,
+		SearchEnabled:    e.SearchEnabled,
+		SearchDir:        e.SearchDir,
+		SearchRetention:  e.SearchRetention,
+		ShutdownTimeout:  e.ShutdownTimeout,
+		AgentLogLevel:    e.AgentLogLevel,
+		AgentLogFormat:   e.AgentLogFormat,
+		RequestLog:       e.RequestLog,
+		PprofAddr:        e.PprofAddr,
+		PathPatterns:     e.PathPatterns,
+		PathQueryMode:    e.PathQueryMode,
+		UserAgentRules:   e.UserAgentRules,
+		IngestBackfill:   e.IngestBackfill,
+		SecurityEnabled:  e.SecurityEnabled,
+		SecurityWindow:   e.SecurityWindow,
+		Security404Max:   e.Security404Max,
+		SecurityAuthMax:  e.SecurityAuthMax,
+		SecurityRateMax:  e.SecurityRateMax,
+		BlocklistEnabled: e.BlocklistEnabled,
+		BlocklistOutput:  e.BlocklistOutput,
+		BlocklistState:   e.BlocklistState,
+		BlocklistTTL:     e.BlocklistTTL,
+		BlocklistMinSev:  e.BlocklistMinSev,
+		BlocklistName:    e.BlocklistName,
+		BlocklistPlugin:  e.BlocklistPlugin,
+		BlocklistAllow:   e.BlocklistAllow,
 	}
 
 	return cfg
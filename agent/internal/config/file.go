@@ -0,0 +1,279 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of values accepted for a setting
+const (
+	kindString = iota
+	kindBool
+	kindInt
+	kindDuration
+	kindList
+)
+
+// setting ties a config file key to its environment variable and Config field
+type setting struct {
+	key   string
+	env   string
+	field string
+	kind  int
+	// reload marks settings applied to a running agent without a restart
+	reload bool
+}
+
+// settings lists every key accepted in the config file
+var settings = []setting{
+	{"server.port", "PORT", "Port", kindInt, false},
+	{"server.trusted_proxies", "TRAEFIK_LOG_DASHBOARD_TRUSTED_PROXIES", "TrustedProxies", kindList, false},
+	{"server.client_ip_headers", "TRAEFIK_LOG_DASHBOARD_CLIENT_IP_HEADERS", "ClientIPHeaders", kindList, false},
+	{"server.security_headers", "TRAEFIK_LOG_DASHBOARD_SECURITY_HEADERS", "SecurityHeaders", kindBool, true},
+	{"server.pprof_addr", "TRAEFIK_LOG_DASHBOARD_PPROF_ADDR", "PprofAddr", kindString, false},
+	{"server.tls.cert_file", "TRAEFIK_LOG_DASHBOARD_TLS_CERT_FILE", "TLSCertFile", kindString, false},
+	{"server.tls.key_file", "TRAEFIK_LOG_DASHBOARD_TLS_KEY_FILE", "TLSKeyFile", kindString, false},
+	{"server.tls.client_ca_file", "TRAEFIK_LOG_DASHBOARD_TLS_CLIENT_CA_FILE", "TLSClientCA", kindString, false},
+	{"server.tls.client_auth", "TRAEFIK_LOG_DASHBOARD_TLS_CLIENT_AUTH", "TLSClientAuth", kindString, false},
+	{"server.tls.min_version", "TRAEFIK_LOG_DASHBOARD_TLS_MIN_VERSION", "TLSMinVersion", kindString, false},
+	{"server.tls.client_scope_map", "TRAEFIK_LOG_DASHBOARD_TLS_CLIENT_SCOPE_MAP", "TLSClientScopes", kindString, false},
+	{"server.cors.allowed_origins", "TRAEFIK_LOG_DASHBOARD_CORS_ALLOWED_ORIGINS", "CORSOrigins", kindList, true},
+	{"server.cors.allowed_methods", "TRAEFIK_LOG_DASHBOARD_CORS_ALLOWED_METHODS", "CORSMethods", kindList, true},
+	{"server.cors.allowed_headers", "TRAEFIK_LOG_DASHBOARD_CORS_ALLOWED_HEADERS", "CORSHeaders", kindList, true},
+	{"server.cors.allow_credentials", "TRAEFIK_LOG_DASHBOARD_CORS_ALLOW_CREDENTIALS", "CORSCredentials", kindBool, true},
+	{"server.cors.max_age", "TRAEFIK_LOG_DASHBOARD_CORS_MAX_AGE", "CORSMaxAge", kindDuration, true},
+
+	{"sources.access_path", "TRAEFIK_LOG_DASHBOARD_ACCESS_PATH", "AccessPath", kindString, false},
+	{"sources.error_path", "TRAEFIK_LOG_DASHBOARD_ERROR_PATH", "ErrorPath", kindString, false},
+	{"sources.format", "TRAEFIK_LOG_DASHBOARD_LOG_FORMAT", "LogFormat", kindString, false},
+	{"sources.position_file", "POSITION_FILE", "PositionFile", kindString, false},
+	{"sources.backfill_bytes", "TRAEFIK_LOG_DASHBOARD_INGEST_BACKFILL_BYTES", "IngestBackfill", kindInt, false},
+	{"sources.path_patterns", "TRAEFIK_LOG_DASHBOARD_PATH_PATTERNS", "PathPatterns", kindString, false},
+	{"sources.path_query_mode", "TRAEFIK_LOG_DASHBOARD_PATH_QUERY_MODE", "PathQueryMode", kindString, false},
+	{"sources.user_agent_rules", "TRAEFIK_LOG_DASHBOARD_USER_AGENT_RULES", "UserAgentRules", kindString, false},
+
+	{"system.monitoring", "TRAEFIK_LOG_DASHBOARD_SYSTEM_MONITORING", "SystemMonitoring", kindBool, false},
+	{"system.monitor_interval", "TRAEFIK_LOG_DASHBOARD_MONITOR_INTERVAL", "MonitorInterval", kindDuration, false},
+	{"system.state_file", "TRAEFIK_LOG_DASHBOARD_STATE_FILE", "StateFile", kindString, false},
+	{"system.shutdown_timeout", "TRAEFIK_LOG_DASHBOARD_SHUTDOWN_TIMEOUT", "ShutdownTimeout", kindDuration, false},
+
+	{"logging.level", "TRAEFIK_LOG_DASHBOARD_AGENT_LOG_LEVEL", "AgentLogLevel", kindString, true},
+	{"logging.format", "TRAEFIK_LOG_DASHBOARD_AGENT_LOG_FORMAT", "AgentLogFormat", kindString, false},
+	{"logging.requests", "TRAEFIK_LOG_DASHBOARD_REQUEST_LOG", "RequestLog", kindBool, true},
+
+	{"auth.token", "TRAEFIK_LOG_DASHBOARD_AUTH_TOKEN", "AuthToken", kindString, true},
+	{"auth.keys_file", "TRAEFIK_LOG_DASHBOARD_AUTH_KEYS_FILE", "AuthKeysFile", kindString, false},
+	{"auth.jwt.jwks", "TRAEFIK_LOG_DASHBOARD_JWT_JWKS", "JWTJWKS", kindString, false},
+	{"auth.jwt.issuer", "TRAEFIK_LOG_DASHBOARD_JWT_ISSUER", "JWTIssuer", kindString, false},
+	{"auth.jwt.audience", "TRAEFIK_LOG_DASHBOARD_JWT_AUDIENCE", "JWTAudience", kindString, false},
+	{"auth.jwt.scope_claim", "TRAEFIK_LOG_DASHBOARD_JWT_SCOPE_CLAIM", "JWTScopeClaim", kindString, false},
+	{"auth.jwt.scope_map", "TRAEFIK_LOG_DASHBOARD_JWT_SCOPE_MAP", "JWTScopeMap", kindString, false},
+
+	{"geoip.enabled", "TRAEFIK_LOG_DASHBOARD_GEOIP_ENABLED", "GeoIPEnabled", kindBool, false},
+	{"geoip.city_db", "TRAEFIK_LOG_DASHBOARD_GEOIP_CITY_DB", "GeoIPCityDB", kindString, false},
+	{"geoip.country_db", "TRAEFIK_LOG_DASHBOARD_GEOIP_COUNTRY_DB", "GeoIPCountryDB", kindString, false},
+	{"geoip.asn_db", "TRAEFIK_LOG_DASHBOARD_GEOIP_ASN_DB", "GeoIPASNDB", kindString, false},
+	{"geoip.reload_interval", "TRAEFIK_LOG_DASHBOARD_GEOIP_RELOAD_INTERVAL", "GeoIPReload", kindDuration, false},
+	{"geoip.cache_size", "TRAEFIK_LOG_DASHBOARD_GEOIP_CACHE_SIZE", "GeoIPCacheSize", kindInt, false},
+
+	{"retention.geoip", "TRAEFIK_LOG_DASHBOARD_GEOIP_RETENTION", "GeoIPRetention", kindDuration, false},
+	{"retention.search", "TRAEFIK_LOG_DASHBOARD_SEARCH_RETENTION", "SearchRetention", kindDuration, false},
+	{"retention.audit_max_size_mb", "TRAEFIK_LOG_DASHBOARD_AUDIT_MAX_SIZE_MB", "AuditMaxSize", kindInt, false},
+	{"retention.audit_max_backups", "TRAEFIK_LOG_DASHBOARD_AUDIT_MAX_BACKUPS", "AuditBackups", kindInt, false},
+
+	{"alerting.enabled", "TRAEFIK_LOG_DASHBOARD_SECURITY_ENABLED", "SecurityEnabled", kindBool, false},
+	{"alerting.window", "TRAEFIK_LOG_DASHBOARD_SECURITY_WINDOW", "SecurityWindow", kindDuration, false},
+	{"alerting.not_found_threshold", "TRAEFIK_LOG_DASHBOARD_SECURITY_404_THRESHOLD", "Security404Max", kindInt, false},
+	{"alerting.auth_threshold", "TRAEFIK_LOG_DASHBOARD_SECURITY_AUTH_THRESHOLD", "SecurityAuthMax", kindInt, false},
+	{"alerting.rate_threshold", "TRAEFIK_LOG_DASHBOARD_SECURITY_RATE_THRESHOLD", "SecurityRateMax", kindInt, false},
+	{"alerting.blocklist.enabled", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_ENABLED", "BlocklistEnabled", kindBool, false},
+	{"alerting.blocklist.output", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_OUTPUT", "BlocklistOutput", kindString, false},
+	{"alerting.blocklist.state", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_STATE", "BlocklistState", kindString, false},
+	{"alerting.blocklist.ttl", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_TTL", "BlocklistTTL", kindDuration, false},
+	{"alerting.blocklist.min_severity", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_MIN_SEVERITY", "BlocklistMinSev", kindString, false},
+	{"alerting.blocklist.middleware", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_MIDDLEWARE", "BlocklistName", kindString, false},
+	{"alerting.blocklist.plugin", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_PLUGIN", "BlocklistPlugin", kindString, false},
+	{"alerting.blocklist.allow", "TRAEFIK_LOG_DASHBOARD_BLOCKLIST_ALLOW", "BlocklistAllow", kindList, false},
+
+	{"redaction.ip", "TRAEFIK_LOG_DASHBOARD_REDACT_IP", "RedactIP", kindString, true},
+	{"redaction.ip_hash_key", "TRAEFIK_LOG_DASHBOARD_REDACT_IP_HASH_KEY", "RedactHashKey", kindString, true},
+	{"redaction.ipv4_prefix", "TRAEFIK_LOG_DASHBOARD_REDACT_IPV4_PREFIX", "RedactIPv4Bits", kindInt, true},
+	{"redaction.ipv6_prefix", "TRAEFIK_LOG_DASHBOARD_REDACT_IPV6_PREFIX", "RedactIPv6Bits", kindInt, true},
+	{"redaction.drop_username", "TRAEFIK_LOG_DASHBOARD_REDACT_USERNAME", "RedactUsername", kindBool, true},
+	{"redaction.query_params", "TRAEFIK_LOG_DASHBOARD_REDACT_QUERY_PARAMS", "RedactQuery", kindList, true},
+	{"redaction.headers", "TRAEFIK_LOG_DASHBOARD_REDACT_HEADERS", "RedactHeaders", kindList, true},
+	{"redaction.policy_file", "TRAEFIK_LOG_DASHBOARD_REDACT_POLICY_FILE", "RedactPolicies", kindString, true},
+
+	{"search.enabled", "TRAEFIK_LOG_DASHBOARD_SEARCH_ENABLED", "SearchEnabled", kindBool, false},
+	{"search.dir", "TRAEFIK_LOG_DASHBOARD_SEARCH_DIR", "SearchDir", kindString, false},
+
+	{"audit.file", "TRAEFIK_LOG_DASHBOARD_AUDIT_LOG", "AuditFile", kindString, false},
+}
+
+// settingFor returns the setting of a Config field
+func settingFor(field string) setting {
+	for _, s := range settings {
+		if s.field == field {
+			return s
+		}
+	}
+	return setting{key: field, field: field}
+}
+
+// readFile reads a YAML config file into values keyed by environment variable.
+// Every problem found is reported with its line number.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if len(root.Content) == 0 {
+		return values, nil
+	}
+
+	var errs []error
+	walkNode(root.Content[0], "", values, func(line int, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s:%d: %s", path, line, fmt.Sprintf(format, args...)))
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return values, nil
+}
+
+// walkNode collects the settings below a mapping node
+func walkNode(node *yaml.Node, prefix string, values map[string]string, report func(line int, format string, args ...interface{})) {
+	if node.Kind != yaml.MappingNode {
+		report(node.Line, "%s: expected a mapping", displayKey(prefix))
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+		if prefix != "" {
+			key = prefix + "." + keyNode.Value
+		}
+
+		if s, ok := lookupSetting(key); ok {
+			value, err := scalarValue(valueNode, s.kind)
+			if err != nil {
+				report(valueNode.Line, "%s: %v", key, err)
+				continue
+			}
+			values[s.env] = value
+			continue
+		}
+		if isSection(key) {
+			walkNode(valueNode, key, values, report)
+			continue
+		}
+		report(keyNode.Line, "unknown key %q", key)
+	}
+}
+
+// lookupSetting returns the setting for a config file key
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// isSection reports whether key is a section holding other settings
+func isSection(key string) bool {
+	for _, s := range settings {
+		if strings.HasPrefix(s.key, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// displayKey names the document root in error messages
+func displayKey(key string) string {
+	if key == "" {
+		return "config"
+	}
+	return key
+}
+
+// scalarValue converts a YAML value into the string form read by the env package.
+// Lists may be written as sequences; ${VAR} references are expanded.
+func scalarValue(node *yaml.Node, kind int) (string, error) {
+	if kind == kindList && node.Kind == yaml.SequenceNode {
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("expected a list of strings")
+			}
+			items = append(items, os.ExpandEnv(item.Value))
+		}
+		return strings.Join(items, ", "), nil
+	}
+	if node.Kind != yaml.ScalarNode {
+		return "", errors.New("expected a single value")
+	}
+
+	value := os.ExpandEnv(node.Value)
+	normalized, err := checkValue(value, kind)
+	if err != nil {
+		return "", err
+	}
+	return normalized, nil
+}
+
+// checkValue verifies a value has the expected kind and returns it in the form
+// the env package reads
+func checkValue(value string, kind int) (string, error) {
+	switch kind {
+	case kindBool:
+		switch strings.ToLower(value) {
+		case "true", "1", "yes":
+			return "true", nil
+		case "false", "0", "no", "":
+			return "false", nil
+		}
+		return "", fmt.Errorf("invalid boolean %q: expected true or false", value)
+	case kindInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid integer %q", value)
+		}
+	case kindDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return "", fmt.Errorf("invalid duration %q: expected a value such as 30s, 5m or 24h", value)
+		}
+	}
+	return value, nil
+}
+
+// checkEnvironment reports environment variables holding values of the wrong kind,
+// which would otherwise silently fall back to their defaults
+func checkEnvironment() error {
+	var errs []error
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if value == "" {
+			continue
+		}
+		if _, err := checkValue(value, s.kind); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", s.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
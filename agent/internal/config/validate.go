@@ -0,0 +1,293 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/utils"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+)
+
+// traefikName matches the names the block list writes unquoted into Traefik's
+// dynamic configuration
+var traefikName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Validate checks the configuration and reports every invalid setting by its
+// config file key and environment variable
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...interface{}) {
+		s := settingFor(field)
+		name := s.key
+		if s.env != "" {
+			name = fmt.Sprintf("%s (%s)", s.key, s.env)
+		}
+		errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("Port", "invalid port %q: expected 1-65535", c.Port)
+	}
+	if c.PprofAddr != "" {
+		if host, port, err := net.SplitHostPort(c.PprofAddr); err != nil || port == "" {
+			fail("PprofAddr", "invalid address %q: expected host:port", c.PprofAddr)
+		} else if !isLoopback(host) {
+			// Profiles are served without authentication
+			fail("PprofAddr", "host %q must be a loopback address such as 127.0.0.1", host)
+		} else if port == c.Port {
+			fail("PprofAddr", "must not use the API port %s", c.Port)
+		}
+	}
+	if c.AccessPath == "" {
+		fail("AccessPath", "must not be empty")
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "json", "clf", "common":
+	default:
+		fail("LogFormat", "invalid format %q: expected json or clf", c.LogFormat)
+	}
+	if c.MonitorInterval <= 0 {
+		fail("MonitorInterval", "must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		fail("ShutdownTimeout", "must be positive")
+	}
+	if _, err := logger.ParseLevel(c.AgentLogLevel); err != nil {
+		fail("AgentLogLevel", "%v", err)
+	}
+	if err := logger.CheckFormat(c.AgentLogFormat); err != nil {
+		fail("AgentLogFormat", "%v", err)
+	}
+	if c.IngestBackfill < 0 {
+		fail("IngestBackfill", "must not be negative")
+	}
+	switch strings.ToLower(c.PathQueryMode) {
+	case "", "strip", "keys":
+	default:
+		fail("PathQueryMode", "invalid mode %q: expected strip or keys", c.PathQueryMode)
+	}
+
+	if c.TLSCertFile != "" && c.TLSKeyFile == "" {
+		fail("TLSKeyFile", "required when a certificate is configured")
+	}
+	if c.TLSKeyFile != "" && c.TLSCertFile == "" {
+		fail("TLSCertFile", "required when a key is configured")
+	}
+	if c.TLSClientCA != "" && c.TLSCertFile == "" {
+		fail("TLSClientCA", "requires a server certificate")
+	}
+	switch strings.ToLower(c.TLSClientAuth) {
+	case "", "require", "optional":
+	default:
+		fail("TLSClientAuth", "invalid mode %q: expected require or optional", c.TLSClientAuth)
+	}
+	switch c.TLSMinVersion {
+	case "", "1.2", "1.3":
+	default:
+		fail("TLSMinVersion", "invalid version %q: expected 1.2 or 1.3", c.TLSMinVersion)
+	}
+
+	// Referenced files must exist, so a reloaded file with a bad path is rejected
+	// rather than only being reported as needing a restart
+	jwks := c.JWTJWKS
+	if strings.HasPrefix(jwks, "http://") || strings.HasPrefix(jwks, "https://") {
+		jwks = ""
+	}
+	for _, file := range []struct{ field, path string }{
+		{"TLSCertFile", c.TLSCertFile},
+		{"TLSKeyFile", c.TLSKeyFile},
+		{"TLSClientCA", c.TLSClientCA},
+		{"JWTJWKS", jwks},
+		{"AuthKeysFile", c.AuthKeysFile},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if problem := checkFile(file.path); problem != "" {
+			fail(file.field, "%s", problem)
+		}
+	}
+
+	if c.JWTJWKS != "" {
+		if c.JWTIssuer == "" {
+			fail("JWTIssuer", "required when a JWKS is configured")
+		}
+		if c.JWTAudience == "" {
+			fail("JWTAudience", "required when a JWKS is configured")
+		}
+		if c.JWTScopeMap == "" {
+			fail("JWTScopeMap", "required when a JWKS is configured; only mapped claim values grant scopes")
+		}
+	}
+
+	if c.CORSCredentials {
+		for _, origin := range utils.SplitList(c.CORSOrigins) {
+			if origin == "*" {
+				fail("CORSCredentials", "cannot be enabled when any origin is allowed; list the origins explicitly")
+			}
+		}
+	}
+	if c.CORSMaxAge < 0 {
+		fail("CORSMaxAge", "must not be negative")
+	}
+
+	if c.GeoIPEnabled {
+		if c.GeoIPReload <= 0 {
+			fail("GeoIPReload", "must be positive")
+		}
+		if c.GeoIPCacheSize < 0 {
+			fail("GeoIPCacheSize", "must not be negative")
+		}
+		if c.GeoIPRetention <= 0 {
+			fail("GeoIPRetention", "must be positive")
+		}
+	}
+
+	if c.SearchEnabled {
+		if c.SearchDir == "" {
+			fail("SearchDir", "must not be empty")
+		} else if problem := checkSearchDir(c.SearchDir); problem != "" {
+			fail("SearchDir", "%s", problem)
+		}
+		if c.SearchRetention <= 0 {
+			fail("SearchRetention", "must be positive")
+		}
+	}
+
+	if c.SecurityEnabled {
+		if c.SecurityWindow <= 0 {
+			fail("SecurityWindow", "must be positive")
+		}
+		if c.Security404Max <= 0 {
+			fail("Security404Max", "must be positive")
+		}
+		if c.SecurityAuthMax <= 0 {
+			fail("SecurityAuthMax", "must be positive")
+		}
+		if c.SecurityRateMax <= 0 {
+			fail("SecurityRateMax", "must be positive")
+		}
+	}
+	if c.BlocklistEnabled {
+		if c.BlocklistTTL <= 0 {
+			fail("BlocklistTTL", "must be positive")
+		}
+		switch strings.ToLower(c.BlocklistMinSev) {
+		case "", "low", "medium", "high":
+		default:
+			fail("BlocklistMinSev", "invalid severity %q: expected low, medium or high", c.BlocklistMinSev)
+		}
+		if !traefikName.MatchString(c.BlocklistName) {
+			fail("BlocklistName", "invalid middleware name %q: expected letters, digits, - or _", c.BlocklistName)
+		}
+		if !traefikName.MatchString(c.BlocklistPlugin) {
+			fail("BlocklistPlugin", "invalid plugin name %q: expected letters, digits, - or _", c.BlocklistPlugin)
+		}
+		for _, value := range utils.SplitList(c.BlocklistAllow) {
+			if _, _, err := net.ParseCIDR(value); err != nil && net.ParseIP(value) == nil {
+				fail("BlocklistAllow", "invalid IP address or CIDR %q", value)
+			}
+		}
+	}
+
+	switch strings.ToLower(c.RedactIP) {
+	case "", redact.IPNone, redact.IPTruncate:
+	case redact.IPHash:
+		if c.RedactHashKey == "" {
+			fail("RedactHashKey", "required when IPs are hashed")
+		}
+	default:
+		fail("RedactIP", "invalid mode %q: expected none, truncate or hash", c.RedactIP)
+	}
+	if c.RedactIPv4Bits < 0 || c.RedactIPv4Bits > 32 {
+		fail("RedactIPv4Bits", "must be 0-32")
+	}
+	if c.RedactIPv6Bits < 0 || c.RedactIPv6Bits > 128 {
+		fail("RedactIPv6Bits", "must be 0-128")
+	}
+	for _, pattern := range utils.SplitList(c.RedactQuery) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fail("RedactQuery", "invalid pattern %q", pattern)
+		}
+	}
+	for _, pattern := range utils.SplitList(c.RedactHeaders) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fail("RedactHeaders", "invalid pattern %q", pattern)
+		}
+	}
+
+	if c.AuditFile != "" {
+		if c.AuditMaxSize <= 0 {
+			fail("AuditMaxSize", "must be positive")
+		}
+		if c.AuditBackups < 0 {
+			fail("AuditBackups", "must not be negative")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RedactionPolicy returns the default redaction policy described by the configuration
+func (c *Config) RedactionPolicy() redact.Policy {
+	return redact.Policy{
+		IP:           c.RedactIP,
+		IPv4Prefix:   c.RedactIPv4Bits,
+		IPv6Prefix:   c.RedactIPv6Bits,
+		HashKey:      c.RedactHashKey,
+		DropUsername: c.RedactUsername,
+		QueryParams:  utils.SplitList(c.RedactQuery),
+		Headers:      utils.SplitList(c.RedactHeaders),
+	}
+}
+
+// isLoopback reports whether a listen host only accepts local connections
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkFile describes why a configured file can't be read, or returns ""
+func checkFile(name string) string {
+	info, err := os.Stat(name)
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Sprintf("file %q does not exist", name)
+	case err != nil:
+		return err.Error()
+	case info.IsDir():
+		return fmt.Sprintf("%q is a directory, not a file", name)
+	}
+	return ""
+}
+
+// checkSearchDir describes why the search index directory can't be used, or
+// returns "". A missing directory is created by the index, but its parent must exist.
+func checkSearchDir(dir string) string {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		parent := filepath.Dir(filepath.Clean(dir))
+		if info, err := os.Stat(parent); err != nil || !info.IsDir() {
+			return fmt.Sprintf("parent directory %q does not exist", parent)
+		}
+		return ""
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if !info.IsDir() {
+		return fmt.Sprintf("%q is not a directory", dir)
+	}
+	return ""
+}
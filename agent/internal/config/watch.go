@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+)
+
+var log = logger.With("config")
+
+// Watcher reloads the config file when it changes or when asked to, and hands
+// the new configuration to a callback. An invalid file keeps the running
+// configuration in place.
+type Watcher struct {
+	path  string
+	apply func(old, updated *Config)
+
+	mu      sync.Mutex
+	current *Config
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher creates a watcher for the file the current configuration was loaded from
+func NewWatcher(path string, current *Config, apply func(old, updated *Config)) *Watcher {
+	w := &Watcher{path: path, apply: apply, current: current}
+	if info, err := os.Stat(path); err == nil {
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+	return w
+}
+
+// Current returns the configuration in effect
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Reload reads and validates the config file and applies it if anything changed
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if info, err := os.Stat(w.path); err == nil {
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+
+	updated, err := LoadFile(w.path)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(updated, w.current) {
+		return nil
+	}
+
+	old := w.current
+	w.current = updated
+	w.apply(old, updated)
+	return nil
+}
+
+// Watch reloads the file whenever its modification time or size changes, until
+// the context is cancelled
+func (w *Watcher) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(w.path)
+			if err != nil {
+				continue
+			}
+			w.mu.Lock()
+			changed := !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+			w.mu.Unlock()
+			if !changed {
+				continue
+			}
+			if err := w.Reload(); err != nil {
+				log.Warn("Keeping the running configuration", logger.KeyPath, w.path, logger.Err(err))
+			}
+		}
+	}
+}
+
+// RestartRequired lists the config file keys that changed between two
+// configurations but only take effect after a restart
+func RestartRequired(old, updated *Config) []string {
+	var keys []string
+	oldValue, updatedValue := reflect.ValueOf(*old), reflect.ValueOf(*updated)
+	for i := 0; i < oldValue.NumField(); i++ {
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), updatedValue.Field(i).Interface()) {
+			continue
+		}
+		if s := settingFor(oldValue.Type().Field(i).Name); !s.reload {
+			keys = append(keys, s.key)
+		}
+	}
+	return keys
+}
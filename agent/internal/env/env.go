@@ -2,50 +2,205 @@ package env
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
 )
 
+var log = logger.With("config")
+
 // Env holds environment variables for the agent
 type Env struct {
 	Port             string
 	AccessPath       string
 	ErrorPath        string
 	SystemMonitoring bool
+	MonitorInterval  time.Duration
 	AuthToken        string
 	LogFormat        string
 	GeoIPEnabled     bool
 	GeoIPCityDB      string
 	GeoIPCountryDB   string
+	GeoIPASNDB       string
+	GeoIPReload      time.Duration
+	GeoIPCacheSize   int
+	GeoIPRetention   time.Duration
+	TrustedProxies   string
+	AuthKeysFile     string
+	JWTJWKS          string
+	JWTIssuer        string
+	JWTAudience      string
+	JWTScopeClaim    string
+	JWTScopeMap      string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSClientCA      string
+	TLSClientAuth    string
+	TLSMinVersion    string
+	TLSClientScopes  string
+	ClientIPHeaders  string
+	CORSOrigins      string
+	CORSMethods      string
+	CORSHeaders      string
+	CORSCredentials  bool
+	CORSMaxAge       time.Duration
+	SecurityHeaders  bool
+	RedactIP         string
+	RedactHashKey    string
+	RedactIPv4Bits   int
+	RedactIPv6Bits   int
+	RedactUsername   bool
+	RedactQuery      string
+	RedactHeaders    string
+	RedactPolicies   string
+	AuditFile        string
+	AuditMaxSize     int
+	AuditBackups     int
 	PositionFile     string
+	StateFile        string
+	SearchEnabled    bool
+	SearchDir        string
+	SearchRetention  time.Duration
+	ShutdownTimeout  time.Duration
+	AgentLogLevel    string
+	AgentLogFormat   string
+	RequestLog       bool
+	PprofAddr        string
+	PathPatterns     string
+	PathQueryMode    string
+	UserAgentRules   string
+	IngestBackfill   int64
+	SecurityEnabled  bool
+	SecurityWindow   time.Duration
+	Security404Max   int
+	SecurityAuthMax  int
+	SecurityRateMax  int
+	BlocklistEnabled bool
+	BlocklistOutput  string
+	BlocklistState   string
+	BlocklistTTL     time.Duration
+	BlocklistMinSev  string
+	BlocklistName    string
+	BlocklistPlugin  string
+	BlocklistAllow   string
+}
+
+// fileValues holds values from the config file, consulted for variables that
+// are not set in the environment
+var (
+	fileValues   map[string]string
+	fileValuesMu sync.Mutex
+)
+
+// ConfigFile returns the path of the YAML config file, read from the
+// environment or the .env file; empty when none is configured
+func ConfigFile() string {
+	_ = godotenv.Load()
+	return os.Getenv("TRAEFIK_LOG_DASHBOARD_CONFIG_FILE")
 }
 
 // LoadEnv loads environment variables from .env file if present
 // and returns an Env struct with all configuration
 func LoadEnv() Env {
+	return LoadEnvWith(nil)
+}
+
+// LoadEnvWith works like LoadEnv but falls back to values, keyed by variable
+// name, for variables that are not set in the environment
+func LoadEnvWith(values map[string]string) Env {
 	// Load .env file if present
 	if err := godotenv.Load(); err != nil {
-		logger.Log.Println("No .env file found, using system environment variables")
+		log.Debug("No .env file found, using system environment variables")
 	}
 
+	fileValuesMu.Lock()
+	defer fileValuesMu.Unlock()
+	fileValues = values
+	defer func() { fileValues = nil }()
+
 	return Env{
 		Port:             getEnv("PORT", "5000"),
 		AccessPath:       getEnv("TRAEFIK_LOG_DASHBOARD_ACCESS_PATH", "/var/log/traefik/access.log"),
 		ErrorPath:        getEnv("TRAEFIK_LOG_DASHBOARD_ERROR_PATH", "/var/log/traefik/traefik.log"),
 		SystemMonitoring: getEnvBool("TRAEFIK_LOG_DASHBOARD_SYSTEM_MONITORING", true),
+		MonitorInterval:  getEnvDuration("TRAEFIK_LOG_DASHBOARD_MONITOR_INTERVAL", 2*time.Second),
 		AuthToken:        getEnv("TRAEFIK_LOG_DASHBOARD_AUTH_TOKEN", ""),
 		LogFormat:        getEnv("TRAEFIK_LOG_DASHBOARD_LOG_FORMAT", "json"),
 		GeoIPEnabled:     getEnvBool("TRAEFIK_LOG_DASHBOARD_GEOIP_ENABLED", true),
 		GeoIPCityDB:      getEnv("TRAEFIK_LOG_DASHBOARD_GEOIP_CITY_DB", "GeoLite2-City.mmdb"),
 		GeoIPCountryDB:   getEnv("TRAEFIK_LOG_DASHBOARD_GEOIP_COUNTRY_DB", "GeoLite2-Country.mmdb"),
+		GeoIPASNDB:       getEnv("TRAEFIK_LOG_DASHBOARD_GEOIP_ASN_DB", ""),
+		GeoIPReload:      getEnvDuration("TRAEFIK_LOG_DASHBOARD_GEOIP_RELOAD_INTERVAL", time.Minute),
+		GeoIPCacheSize:   getEnvInt("TRAEFIK_LOG_DASHBOARD_GEOIP_CACHE_SIZE", 10000),
+		GeoIPRetention:   getEnvDuration("TRAEFIK_LOG_DASHBOARD_GEOIP_RETENTION", 24*time.Hour),
+		TrustedProxies:   getEnv("TRAEFIK_LOG_DASHBOARD_TRUSTED_PROXIES", ""),
+		AuthKeysFile:     getEnv("TRAEFIK_LOG_DASHBOARD_AUTH_KEYS_FILE", ""),
+		JWTJWKS:          getEnv("TRAEFIK_LOG_DASHBOARD_JWT_JWKS", ""),
+		JWTIssuer:        getEnv("TRAEFIK_LOG_DASHBOARD_JWT_ISSUER", ""),
+		JWTAudience:      getEnv("TRAEFIK_LOG_DASHBOARD_JWT_AUDIENCE", ""),
+		JWTScopeClaim:    getEnv("TRAEFIK_LOG_DASHBOARD_JWT_SCOPE_CLAIM", "scope"),
+		JWTScopeMap:      getEnv("TRAEFIK_LOG_DASHBOARD_JWT_SCOPE_MAP", ""),
+		TLSCertFile:      getEnv("TRAEFIK_LOG_DASHBOARD_TLS_CERT_FILE", ""),
+		TLSKeyFile:       getEnv("TRAEFIK_LOG_DASHBOARD_TLS_KEY_FILE", ""),
+		TLSClientCA:      getEnv("TRAEFIK_LOG_DASHBOARD_TLS_CLIENT_CA_FILE", ""),
+		TLSClientAuth:    getEnv("TRAEFIK_LOG_DASHBOARD_TLS_CLIENT_AUTH", "require"),
+		TLSMinVersion:    getEnv("TRAEFIK_LOG_DASHBOARD_TLS_MIN_VERSION", "1.2"),
+		TLSClientScopes:  getEnv("TRAEFIK_LOG_DASHBOARD_TLS_CLIENT_SCOPE_MAP", ""),
+		ClientIPHeaders:  getEnv("TRAEFIK_LOG_DASHBOARD_CLIENT_IP_HEADERS", "X-Forwarded-For"),
+		CORSOrigins:      getEnv("TRAEFIK_LOG_DASHBOARD_CORS_ALLOWED_ORIGINS", ""),
+		CORSMethods:      getEnv("TRAEFIK_LOG_DASHBOARD_CORS_ALLOWED_METHODS", "GET, POST, DELETE, OPTIONS"),
+		CORSHeaders:      getEnv("TRAEFIK_LOG_DASHBOARD_CORS_ALLOWED_HEADERS", "Content-Type, Authorization"),
+		CORSCredentials:  getEnvBool("TRAEFIK_LOG_DASHBOARD_CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:       getEnvDuration("TRAEFIK_LOG_DASHBOARD_CORS_MAX_AGE", 10*time.Minute),
+		SecurityHeaders:  getEnvBool("TRAEFIK_LOG_DASHBOARD_SECURITY_HEADERS", true),
+		RedactIP:         getEnv("TRAEFIK_LOG_DASHBOARD_REDACT_IP", "none"),
+		RedactHashKey:    getEnv("TRAEFIK_LOG_DASHBOARD_REDACT_IP_HASH_KEY", ""),
+		RedactIPv4Bits:   getEnvInt("TRAEFIK_LOG_DASHBOARD_REDACT_IPV4_PREFIX", 24),
+		RedactIPv6Bits:   getEnvInt("TRAEFIK_LOG_DASHBOARD_REDACT_IPV6_PREFIX", 48),
+		RedactUsername:   getEnvBool("TRAEFIK_LOG_DASHBOARD_REDACT_USERNAME", false),
+		RedactQuery:      getEnv("TRAEFIK_LOG_DASHBOARD_REDACT_QUERY_PARAMS", ""),
+		RedactHeaders:    getEnv("TRAEFIK_LOG_DASHBOARD_REDACT_HEADERS", ""),
+		RedactPolicies:   getEnv("TRAEFIK_LOG_DASHBOARD_REDACT_POLICY_FILE", ""),
+		AuditFile:        getEnv("TRAEFIK_LOG_DASHBOARD_AUDIT_LOG", ""),
+		AuditMaxSize:     getEnvInt("TRAEFIK_LOG_DASHBOARD_AUDIT_MAX_SIZE_MB", 10),
+		AuditBackups:     getEnvInt("TRAEFIK_LOG_DASHBOARD_AUDIT_MAX_BACKUPS", 5),
 		PositionFile:     getEnv("POSITION_FILE", "/data/.position"),
+		StateFile:        getEnv("TRAEFIK_LOG_DASHBOARD_STATE_FILE", "/data/state.json"),
+		SearchEnabled:    getEnvBool("TRAEFIK_LOG_DASHBOARD_SEARCH_ENABLED", false),
+		SearchDir:        getEnv("TRAEFIK_LOG_DASHBOARD_SEARCH_DIR", "/data/search"),
+		SearchRetention:  getEnvDuration("TRAEFIK_LOG_DASHBOARD_SEARCH_RETENTION", 7*24*time.Hour),
+		ShutdownTimeout:  getEnvDuration("TRAEFIK_LOG_DASHBOARD_SHUTDOWN_TIMEOUT", 15*time.Second),
+		AgentLogLevel:    getEnv("TRAEFIK_LOG_DASHBOARD_AGENT_LOG_LEVEL", "info"),
+		AgentLogFormat:   getEnv("TRAEFIK_LOG_DASHBOARD_AGENT_LOG_FORMAT", "text"),
+		RequestLog:       getEnvBool("TRAEFIK_LOG_DASHBOARD_REQUEST_LOG", true),
+		PprofAddr:        getEnv("TRAEFIK_LOG_DASHBOARD_PPROF_ADDR", ""),
+		PathPatterns:     getEnv("TRAEFIK_LOG_DASHBOARD_PATH_PATTERNS", ""),
+		PathQueryMode:    getEnv("TRAEFIK_LOG_DASHBOARD_PATH_QUERY_MODE", "strip"),
+		UserAgentRules:   getEnv("TRAEFIK_LOG_DASHBOARD_USER_AGENT_RULES", ""),
+		IngestBackfill:   int64(getEnvInt("TRAEFIK_LOG_DASHBOARD_INGEST_BACKFILL_BYTES", 10*1024*1024)),
+		SecurityEnabled:  getEnvBool("TRAEFIK_LOG_DASHBOARD_SECURITY_ENABLED", true),
+		SecurityWindow:   getEnvDuration("TRAEFIK_LOG_DASHBOARD_SECURITY_WINDOW", 5*time.Minute),
+		Security404Max:   getEnvInt("TRAEFIK_LOG_DASHBOARD_SECURITY_404_THRESHOLD", 20),
+		SecurityAuthMax:  getEnvInt("TRAEFIK_LOG_DASHBOARD_SECURITY_AUTH_THRESHOLD", 10),
+		SecurityRateMax:  getEnvInt("TRAEFIK_LOG_DASHBOARD_SECURITY_RATE_THRESHOLD", 1000),
+		BlocklistEnabled: getEnvBool("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_ENABLED", false),
+		BlocklistOutput:  getEnv("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_OUTPUT", "/data/blocklist.yml"),
+		BlocklistState:   getEnv("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_STATE", "/data/blocklist.json"),
+		BlocklistTTL:     getEnvDuration("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_TTL", 24*time.Hour),
+		BlocklistMinSev:  getEnv("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_MIN_SEVERITY", "high"),
+		BlocklistName:    getEnv("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_MIDDLEWARE", "traefik-log-dashboard-blocklist"),
+		BlocklistPlugin:  getEnv("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_PLUGIN", "denyip"),
+		BlocklistAllow:   getEnv("TRAEFIK_LOG_DASHBOARD_BLOCKLIST_ALLOW", ""),
 	}
 }
 
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookup(key); value != "" {
 		return value
 	}
 	return defaultValue
@@ -53,9 +208,46 @@ func getEnv(key, defaultValue string) string {
 
 // getEnvBool retrieves a boolean environment variable or returns a default value
 func getEnvBool(key string, defaultValue bool) bool {
-	value := os.Getenv(key)
+	value := lookup(key)
 	if value == "" {
 		return defaultValue
 	}
+	value = strings.ToLower(value)
 	return value == "true" || value == "1" || value == "yes"
-}
\ No newline at end of file
+}
+
+// getEnvInt retrieves an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value := lookup(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return intValue
+}
+
+// getEnvDuration retrieves a duration environment variable or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := lookup(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue
+	}
+	return duration
+}
+
+// lookup returns the environment value of key, or the config file value when unset
+func lookup(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileValues[key]
+}
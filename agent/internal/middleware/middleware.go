@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+)
+
+var log = logger.With("http")
+
+// DefaultCORSMethods and DefaultCORSHeaders are allowed when none are configured
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodOptions}
+	DefaultCORSHeaders = []string{"Content-Type", "Authorization"}
+)
+
+// CORSConfig describes which cross-origin requests the agent accepts
+type CORSConfig struct {
+	// AllowedOrigins are exact origins, patterns such as https://*.example.com,
+	// or "*" for any origin. Cross-origin requests are refused when empty.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORS applies a cross-origin policy and answers preflight requests
+type CORS struct {
+	origins     []string
+	anyOrigin   bool
+	methods     map[string]bool
+	allowMethod string
+	allowHeader string
+	anyHeader   bool
+	credentials bool
+	maxAge      string
+}
+
+// NewCORS validates the configuration and returns the policy
+func NewCORS(config CORSConfig) (*CORS, error) {
+	c := &CORS{
+		methods:     make(map[string]bool),
+		credentials: config.AllowCredentials,
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "":
+			continue
+		case origin == "*":
+			c.anyOrigin = true
+		default:
+			if _, err := path.Match(origin, ""); err != nil {
+				return nil, errors.New("invalid CORS origin pattern " + strconv.Quote(origin))
+			}
+			c.origins = append(c.origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	if c.anyOrigin && c.credentials {
+		return nil, errors.New("CORS credentials cannot be allowed for any origin; list the origins explicitly")
+	}
+
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	var methodNames []string
+	for _, method := range methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" || c.methods[method] {
+			continue
+		}
+		c.methods[method] = true
+		methodNames = append(methodNames, method)
+	}
+	c.allowMethod = strings.Join(methodNames, ", ")
+
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	var headerNames []string
+	for _, header := range headers {
+		header = strings.TrimSpace(header)
+		switch header {
+		case "":
+			continue
+		case "*":
+			c.anyHeader = true
+		default:
+			headerNames = append(headerNames, http.CanonicalHeaderKey(header))
+		}
+	}
+	c.allowHeader = strings.Join(headerNames, ", ")
+
+	if config.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+
+	return c, nil
+}
+
+// Enabled reports whether any cross-origin requests are allowed
+func (c *CORS) Enabled() bool {
+	return c.anyOrigin || len(c.origins) > 0
+}
+
+// Handler wraps next with the policy. Preflight requests are answered here and
+// never reach next, so handlers do not need to handle OPTIONS themselves.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := c.setOrigin(w, origin)
+
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requested := r.Header.Get("Access-Control-Request-Method")
+		if allowed && requested != "" && c.methods[strings.ToUpper(requested)] {
+			w.Header().Set("Access-Control-Allow-Methods", c.allowMethod)
+			if headers := c.requestHeaders(r); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if c.maxAge != "" {
+				w.Header().Set("Access-Control-Max-Age", c.maxAge)
+			}
+		}
+		w.Header().Set("Allow", c.allowMethod)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// setOrigin writes the origin headers and reports whether the origin is allowed
+func (c *CORS) setOrigin(w http.ResponseWriter, origin string) bool {
+	if c.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return true
+	}
+	if len(c.origins) == 0 {
+		return false
+	}
+
+	// The response depends on the Origin header, so caches must key on it
+	w.Header().Add("Vary", "Origin")
+	if origin == "" || !c.allowsOrigin(origin) {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// allowsOrigin reports whether origin matches a configured origin or pattern
+func (c *CORS) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range c.origins {
+		if pattern == origin {
+			return true
+		}
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHeaders returns the headers to allow in a preflight response
+func (c *CORS) requestHeaders(r *http.Request) string {
+	if c.anyHeader {
+		return r.Header.Get("Access-Control-Request-Headers")
+	}
+	return c.allowHeader
+}
+
+// Swappable serves requests with a handler that can be replaced while the server
+// runs, so reloaded policies apply without dropping connections
+type Swappable struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+// NewSwappable creates a swappable handler serving handler
+func NewSwappable(handler http.Handler) *Swappable {
+	s := &Swappable{}
+	s.Store(handler)
+	return s
+}
+
+// Store replaces the handler used for subsequent requests
+func (s *Swappable) Store(handler http.Handler) {
+	s.handler.Store(&handler)
+}
+
+// ServeHTTP passes the request to the current handler
+func (s *Swappable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
+
+// SecurityHeaders adds standard hardening headers to every response. The
+// Strict-Transport-Security header is only sent when hsts is set, which should
+// be the case only when the agent itself terminates TLS.
+func SecurityHeaders(next http.Handler, hsts bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		header.Set("Cache-Control", "no-store")
+		if hsts {
+			header.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestLog logs every request once it completes, with its status, response
+// size and latency. Server errors are logged at error level and client errors
+// at warn level. The query string is left out since it may carry credentials.
+func RequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		args := []any{
+			"method", r.Method,
+			logger.KeyPath, r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr", r.RemoteAddr,
+		}
+		switch {
+		case recorder.status >= http.StatusInternalServerError:
+			log.Error("Request", args...)
+		case recorder.status >= http.StatusBadRequest:
+			log.Warn("Request", args...)
+		default:
+			log.Info("Request", args...)
+		}
+	})
+}
+
+// responseRecorder captures the status code and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader records the status code
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes written
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
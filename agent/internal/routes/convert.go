@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/blocklist"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/pathnorm"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/search"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/security"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/stats"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/system"
+)
+
+// The API types mirror the agent's own types so that clients don't link the
+// agent. These functions convert between them; a nil slice stays nil, so the
+// responses encode as before.
+
+// convertAll converts every item of a slice
+func convertAll[S, T any](items []S, convert func(S) T) []T {
+	if items == nil {
+		return nil
+	}
+	result := make([]T, len(items))
+	for i, item := range items {
+		result[i] = convert(item)
+	}
+	return result
+}
+
+func apiLocation(loc location.Location) api.Location {
+	return api.Location(loc)
+}
+
+func apiLogFile(file logfiles.FileInfo) api.LogFile {
+	return api.LogFile(file)
+}
+
+func apiLogSizes(sizes logs.LogSizesResult) api.LogSizes {
+	return api.LogSizes{
+		Files:   convertAll(sizes.Files, func(f logs.LogFileSize) api.LogFileSize { return api.LogFileSize(f) }),
+		Summary: api.LogFilesSummary(sizes.Summary),
+	}
+}
+
+func apiRouteStat(stat stats.RouteStat) api.RouteStat {
+	return api.RouteStat(stat)
+}
+
+func apiRouteTemplate(template pathnorm.Template) api.RouteTemplate {
+	return api.RouteTemplate(template)
+}
+
+func apiUserAgents(ua stats.UserAgentStats) api.UserAgents {
+	counts := func(c []stats.Count) []api.NameCount {
+		return convertAll(c, func(c stats.Count) api.NameCount { return api.NameCount(c) })
+	}
+	return api.UserAgents{
+		Total:         ua.Total,
+		Humans:        ua.Humans,
+		Bots:          ua.Bots,
+		BotPercent:    ua.BotPercent,
+		Browsers:      counts(ua.Browsers),
+		OS:            counts(ua.OS),
+		Devices:       counts(ua.Devices),
+		BotNames:      counts(ua.BotNames),
+		BotCategories: counts(ua.BotCategories),
+	}
+}
+
+func apiASNStat(stat stats.ASNStat) api.ASNStat {
+	return api.ASNStat(stat)
+}
+
+func apiGeoStat(stat stats.GeoStat) api.GeoStat {
+	return api.GeoStat(stat)
+}
+
+func apiFinding(finding security.Finding) api.SecurityFinding {
+	return api.SecurityFinding{
+		ID:          finding.ID,
+		Type:        finding.Type,
+		Severity:    finding.Severity,
+		ClientIP:    finding.ClientIP,
+		Description: finding.Description,
+		Count:       finding.Count,
+		FirstSeen:   finding.FirstSeen,
+		LastSeen:    finding.LastSeen,
+		Window:      finding.Window,
+		Evidence:    api.SecurityEvidence(finding.Evidence),
+	}
+}
+
+func apiBlocklistEntry(entry blocklist.Entry) api.BlocklistEntry {
+	return api.BlocklistEntry{
+		IP:          entry.IP,
+		Reason:      entry.Reason,
+		Source:      entry.Source,
+		FindingID:   entry.FindingID,
+		AddedAt:     entry.AddedAt,
+		LastTrigger: entry.LastTrigger,
+		ExpiresAt:   entry.ExpiresAt,
+		Pinned:      entry.Pinned,
+		Audit:       convertAll(entry.Audit, func(e blocklist.AuditEvent) api.BlocklistEvent { return api.BlocklistEvent(e) }),
+	}
+}
+
+func apiSearchDoc(doc search.Doc) api.SearchDoc {
+	return api.SearchDoc(doc)
+}
+
+func apiIngestSource(source ingest.SourceStats) api.IngestSource {
+	return api.IngestSource(source)
+}
+
+func apiSystemInfo(info system.SystemInfo) api.SystemInfo {
+	return api.SystemInfo{
+		Uptime:    info.Uptime,
+		Timestamp: info.Timestamp,
+		CPU:       api.CPUStats(info.CPU),
+		Memory:    api.MemoryStats(info.Memory),
+		Disk:      api.DiskStats(info.Disk),
+	}
+}
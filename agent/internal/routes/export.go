@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/audit"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/utils"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/export"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+)
+
+// exportFlushRows is how many rows are written between flushes to the client
+const exportFlushRows = 5000
+
+// exportFileTime formats the time range in export file names
+const exportFileTime = "20060102T150405Z"
+
+// HandleExport streams the parsed access log entries of a time range as CSV,
+// NDJSON or Parquet. Rotated and compressed files are read too, oldest first,
+// and entries are written as they are read.
+func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	format := utils.GetQueryParam(r, "format", export.FormatCSV)
+	if !slices.Contains(export.Formats, format) {
+		respondError(w, api.InvalidParam("format", "format must be one of "+strings.Join(export.Formats, ", ")))
+		return
+	}
+
+	var names []string
+	if value := utils.GetQueryParam(r, "columns", ""); value != "" {
+		names = strings.Split(value, ",")
+	}
+	columns, err := export.ParseColumns(names)
+	if err != nil {
+		respondError(w, api.InvalidParam("columns", err.Error()))
+		return
+	}
+
+	from, to, apiErr := parseTimeRange(r)
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	files, err := h.exportFiles(from)
+	if err != nil {
+		respondError(w, fileError(err))
+		return
+	}
+
+	gzipped := utils.GetQueryParamBool(r, "gzip", false)
+	name := export.FileName(fmt.Sprintf("access_%s_%s", from.UTC().Format(exportFileTime), to.UTC().Format(exportFileTime)), format, gzipped)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	if gzipped && format != export.FormatParquet {
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	writer, err := export.NewWriter(w, format, export.Options{Columns: columns, Gzip: gzipped})
+	if err != nil {
+		respondError(w, api.Internal(err))
+		return
+	}
+
+	filters := h.accessFilters(r)
+	policy := h.redactionPolicy(r)
+	controller := http.NewResponseController(w)
+	rows := 0
+
+	for _, file := range files {
+		path, err := h.files.Resolve(logfiles.SourceAccess, file.Name)
+		if err != nil {
+			continue
+		}
+
+		first := true
+		err = logs.ScanFile(path, func(line string) error {
+			entry, err := logs.ParseTraefikLog(line)
+			if err != nil || entry == nil {
+				return nil
+			}
+			if entry.StartUTC.After(to) {
+				// A file that starts after the range holds nothing in it
+				if first {
+					return logs.ErrStopScan
+				}
+				return nil
+			}
+			first = false
+			if entry.StartUTC.Before(from) || !logs.Matches(entry, filters...) {
+				return nil
+			}
+
+			logs.RedactEntry(entry, policy)
+			if err := writer.Write(entry); err != nil {
+				return err
+			}
+			rows++
+			if rows%exportFlushRows == 0 {
+				controller.Flush()
+				return r.Context().Err()
+			}
+			return nil
+		})
+		if err != nil {
+			// The response has started, so the client sees a truncated file
+			log.Warn("Export stopped", "file", file.Name, "rows", rows, logger.Err(err))
+			audit.SetRows(r.Context(), rows)
+			return
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Warn("Export stopped", "rows", rows, logger.Err(err))
+	}
+	audit.SetRows(r.Context(), rows)
+}
+
+// exportFiles returns the access log files that may hold entries from since
+// on, oldest first
+func (h *Handler) exportFiles(since time.Time) ([]logfiles.FileInfo, error) {
+	files, err := h.files.Files(logfiles.SourceAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	// A file last written before the range began holds nothing in it
+	kept := files[:0]
+	for _, file := range files {
+		if !file.Modified.Before(since) {
+			kept = append(kept, file)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Modified.Before(kept[j].Modified)
+	})
+	return kept, nil
+}
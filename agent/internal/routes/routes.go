@@ -1,119 +1,163 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"os"
-	"path/filepath"
-	"sync"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
 	"encoding/json"
 
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/audit"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/auth"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/config"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/utils"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/blocklist"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/pathnorm"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/positions"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/search"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/security"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/stats"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/system"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/useragent"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger" 
 )
 
+var log = logger.With("routes")
+
+// maxPageLines caps the lines returned by a single /api/logs/get request
+const maxPageLines = 5000
+
 // Handler manages HTTP routes and dependencies
 type Handler struct {
 	config *config.Config
 	// Track file positions for incremental reading
-	positions     map[string]int64
-	positionMutex sync.RWMutex
+	positions *positions.Store
+	// Collapses request paths into route templates for aggregation
+	normalizer *pathnorm.Normalizer
+	// Classifies user agents into browser, OS, device and bot dimensions
+	uaParser *useragent.Parser
+	// Security findings raised from the ingest pipeline (nil when disabled)
+	detector *security.Detector
+	// Block list written as Traefik dynamic configuration (nil when disabled)
+	blocklist *blocklist.Manager
+	// Per-country and per-city counts from the ingest pipeline (nil when GeoIP is disabled)
+	geo *stats.GeoAggregator
+	// Confines file names requested by clients to the configured log paths
+	files *logfiles.Sandbox
+	// Redaction policies applied to log data before it is served (nil when disabled);
+	// swapped when the configuration is reloaded
+	redaction atomic.Pointer[redact.Set]
+	// Record of requests served to API callers (nil when disabled)
+	auditLog *audit.Log
+	// Authenticator guarding the API, reported by the status endpoints
+	authenticator *auth.Authenticator
+	// Background reader of the access logs, reported by the agent stats endpoint
+	pipeline *ingest.Pipeline
+	// Full-text index of the access and error logs (nil when disabled)
+	search *search.Index
+	started  time.Time
+	// Version of the agent, reported by the v2 status and OpenAPI document
+	version string
 }
 
 // NewHandler creates a new Handler with the given configuration
 func NewHandler(cfg *config.Config) *Handler {
-	h := &Handler{
-		config:    cfg,
-		positions: make(map[string]int64),
-	}
-	
-	// ADDED: Load positions from file on startup
-	if err := h.loadPositions(); err != nil {
-		logger.Log.Printf("Warning: Could not load positions from file: %v", err)
+	rules, err := pathnorm.ParseRules(cfg.PathPatterns)
+	if err != nil {
+		log.Warn("Ignoring custom path patterns", logger.Err(err))
+		rules = nil
 	}
-	
-	return h
-}
 
-// ADDED: loadPositions loads position data from the position file
-func (h *Handler) loadPositions() error {
-	if h.config.PositionFile == "" {
-		return nil
+	uaParser, err := useragent.NewParser(cfg.UserAgentRules)
+	if err != nil {
+		log.Warn("Using built-in user agent rules", logger.KeyPath, cfg.UserAgentRules, logger.Err(err))
+		uaParser = useragent.Default()
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(h.config.PositionFile); os.IsNotExist(err) {
-		logger.Log.Printf("Position file does not exist yet: %s", h.config.PositionFile)
-		return nil
+	h := &Handler{
+		config: cfg,
+		normalizer: pathnorm.New(pathnorm.Options{
+			Rules:     rules,
+			QueryMode: pathnorm.ParseQueryMode(cfg.PathQueryMode),
+		}),
+		uaParser: uaParser,
+		started:  time.Now(),
+		files: logfiles.New(map[string]string{
+			logfiles.SourceAccess: cfg.AccessPath,
+			logfiles.SourceError:  cfg.ErrorPath,
+		}),
 	}
-
-	// Read file
-	data, err := os.ReadFile(h.config.PositionFile)
+	
+	// ADDED: Load positions from file on startup
+	store, err := positions.Open(cfg.PositionFile)
 	if err != nil {
-		return err
+		log.Warn("Could not load positions", logger.KeyPath, cfg.PositionFile, logger.Err(err))
+	} else if store.Len() > 0 {
+		log.Info("Loaded positions", logger.KeyPath, cfg.PositionFile, "files", store.Len())
 	}
+	h.positions = store
 
-	// Parse JSON
-	var positions map[string]int64
-	if err := json.Unmarshal(data, &positions); err != nil {
-		return err
-	}
+	return h
+}
 
-	h.positionMutex.Lock()
-	h.positions = positions
-	h.positionMutex.Unlock()
+// SetGeoAggregator attaches the aggregator used by the country and city endpoints
+func (h *Handler) SetGeoAggregator(geo *stats.GeoAggregator) {
+	h.geo = geo
+}
 
-	logger.Log.Printf("Loaded %d position(s) from %s", len(positions), h.config.PositionFile)
-	return nil
+// SetDetector attaches the security detector used by the findings endpoint
+func (h *Handler) SetDetector(detector *security.Detector) {
+	h.detector = detector
 }
 
-// ADDED: savePositions persists position data to the position file
-func (h *Handler) savePositions() error {
-	if h.config.PositionFile == "" {
-		return nil
-	}
+// SetRedaction attaches the policies that anonymize log data in responses. It
+// may be called while serving to apply reloaded policies; nil disables redaction.
+func (h *Handler) SetRedaction(set *redact.Set) {
+	h.redaction.Store(set)
+}
 
-	h.positionMutex.RLock()
-	positions := make(map[string]int64, len(h.positions))
-	for k, v := range h.positions {
-		positions[k] = v
-	}
-	h.positionMutex.RUnlock()
+// SetAuditLog attaches the audit log queried by the audit endpoint
+func (h *Handler) SetAuditLog(log *audit.Log) {
+	h.auditLog = log
+}
 
-	// Marshal to JSON
-	data, err := json.MarshalIndent(positions, "", "  ")
-	if err != nil {
-		return err
-	}
+// SetAuthenticator attaches the authenticator whose state the status endpoints report
+func (h *Handler) SetAuthenticator(authenticator *auth.Authenticator) {
+	h.authenticator = authenticator
+}
 
-	// Ensure directory exists
-	dir := filepath.Dir(h.config.PositionFile)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
+// SetPipeline attaches the ingest pipeline reported by the agent stats endpoint
+func (h *Handler) SetPipeline(pipeline *ingest.Pipeline) {
+	h.pipeline = pipeline
+}
 
-	// Write to file atomically (write to temp file, then rename)
-	tmpFile := h.config.PositionFile + ".tmp"
-	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
-		return err
-	}
+// SetSearchIndex attaches the index queried by the search endpoint
+func (h *Handler) SetSearchIndex(index *search.Index) {
+	h.search = index
+}
 
-	if err := os.Rename(tmpFile, h.config.PositionFile); err != nil {
-		os.Remove(tmpFile) // Clean up temp file on error
-		return err
-	}
+// SetVersion sets the agent version reported by the v2 API
+func (h *Handler) SetVersion(version string) {
+	h.version = version
+}
 
-	return nil
+// SetBlocklist attaches the block list manager used by the block list endpoints
+func (h *Handler) SetBlocklist(manager *blocklist.Manager) {
+	h.blocklist = manager
 }
 
 // getFilePosition gets the tracked position for a file
 func (h *Handler) getFilePosition(path string) int64 {
-	h.positionMutex.RLock()
-	defer h.positionMutex.RUnlock()
-	if pos, exists := h.positions[path]; exists {
+	if pos, exists := h.positions.Get(path); exists {
 		return pos
 	}
 	return -1 // Return -1 to indicate first read (tail mode)
@@ -121,26 +165,17 @@ func (h *Handler) getFilePosition(path string) int64 {
 
 // setFilePosition updates the tracked position for a file
 func (h *Handler) setFilePosition(path string, position int64) {
-	h.positionMutex.Lock()
-	h.positions[path] = position
-	h.positionMutex.Unlock()
-	
-	// ADDED: Save to disk asynchronously to avoid blocking
-	go func() {
-		if err := h.savePositions(); err != nil {
-			logger.Log.Printf("Error saving positions to file: %v", err)
-		}
-	}()
+	// Persisted by the position writer started with the server
+	h.positions.Set(path, position)
+}
+
+// Positions returns the store of tracked read positions
+func (h *Handler) Positions() *positions.Store {
+	return h.positions
 }
 
 // HandleAccessLogs handles requests for access logs
 func (h *Handler) HandleAccessLogs(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Get query parameters
 	position := utils.GetQueryParamInt64(r, "position", -2) // -2 means use tracked position
 	lines := utils.GetQueryParamInt(r, "lines", 1000)
@@ -197,6 +232,9 @@ func (h *Handler) HandleAccessLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	result.Logs = logs.FilterLines(result.Logs, h.accessFilters(r)...)
+	result.Logs = logs.RewriteClientHosts(result.Logs)
+
 	// Limit the number of logs returned
 	if len(result.Logs) > lines {
 		// Keep only the most recent logs
@@ -204,14 +242,24 @@ func (h *Handler) HandleAccessLogs(w http.ResponseWriter, r *http.Request) {
 		result.Logs = result.Logs[startIdx:]
 	}
 
+	// Resolve client locations inline so clients don't need a second lookup
+	if utils.GetQueryParamBool(r, "geo", false) && h.config.GeoIPEnabled {
+		result.Locations = resolveLogLocations(result.Logs)
+	}
+
+	policy := h.redactionPolicy(r)
+	result.Logs = logs.RedactLines(result.Logs, policy)
+	result.Locations = redactLocations(result.Locations, policy)
+
+	audit.SetRows(r.Context(), len(result.Logs))
+
 	utils.RespondJSON(w, http.StatusOK, result)
 }
 
 // HandleErrorLogs handles requests for error logs
 func (h *Handler) HandleErrorLogs(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+	if err := restrictedError(r); err != nil {
+		respondError(w, err)
 		return
 	}
 
@@ -264,18 +312,134 @@ func (h *Handler) HandleErrorLogs(w http.ResponseWriter, r *http.Request) {
 		startIdx := len(result.Logs) - lines
 		result.Logs = result.Logs[startIdx:]
 	}
+	result.Logs = logs.RedactErrorLines(result.Logs, h.redactionPolicy(r))
 
+	audit.SetRows(r.Context(), len(result.Logs))
 	utils.RespondJSON(w, http.StatusOK, result)
 }
 
-// HandleSystemLogs handles requests for system logs listing
-func (h *Handler) HandleSystemLogs(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+// HandleRoutes returns the busiest route templates from the most recent access logs
+func (h *Handler) HandleRoutes(w http.ResponseWriter, r *http.Request) {
+	limit := utils.GetQueryParamInt(r, "limit", 10)
+
+	entries, err := h.readRecentAccessLogs()
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	entries = logs.FilterEntries(entries, h.accessFilters(r)...)
+
+	normalizer := h.routeNormalizer(r, entries)
+	response := api.Routes{
+		Routes:    convertAll(stats.TopRoutes(entries, normalizer, limit), apiRouteStat),
+		Templates: convertAll(normalizer.Templates(), apiRouteTemplate),
+		Total:     len(entries),
+	}
+
+	audit.SetRows(r.Context(), len(entries))
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// RouteLearner returns the sink that teaches the route templates from each
+// ingested line, so re-reading a log doesn't learn its paths again
+func (h *Handler) RouteLearner() ingest.Sink {
+	return ingest.SinkFunc(func(entry ingest.Entry) {
+		h.normalizer.Observe(entry.Log.RequestPath)
+	})
+}
+
+// routeNormalizer returns the normalizer that templates the entries of a
+// request. The shared one has learned from every host's traffic, so restricted
+// keys get one learned from the entries they may see.
+func (h *Handler) routeNormalizer(r *http.Request, entries []*logs.TraefikLog) *pathnorm.Normalizer {
+	if identity, ok := auth.IdentityFromContext(r.Context()); !ok || !identity.Restricted() {
+		return h.normalizer
+	}
+
+	normalizer := h.normalizer.Empty()
+	for _, entry := range entries {
+		normalizer.Observe(entry.RequestPath)
+	}
+	return normalizer
+}
 
+// HandleUserAgents returns request counts by browser, OS, device class and bot identity
+func (h *Handler) HandleUserAgents(w http.ResponseWriter, r *http.Request) {
+	limit := utils.GetQueryParamInt(r, "limit", 10)
+
+	entries, err := h.readRecentAccessLogs()
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entries = logs.FilterEntries(entries, h.accessFilters(r)...)
+
+	audit.SetRows(r.Context(), len(entries))
+	utils.RespondJSON(w, http.StatusOK, stats.UserAgents(entries, h.uaParser, limit))
+}
+
+// accessFilters builds access log filters from the request's query parameters
+func (h *Handler) accessFilters(r *http.Request) []logs.Filter {
+	var filters []logs.Filter
+
+	// Keys restricted to a subset of the traffic never see other rows
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok && identity.Restricted() {
+		filters = append(filters, identity.Restrict.Allows)
+	}
+
+	if utils.GetQueryParamBool(r, "exclude_bots", false) {
+		filters = append(filters, func(entry *logs.TraefikLog) bool {
+			return !h.uaParser.Parse(entry.RequestUserAgent).Bot
+		})
+	}
+
+	if utils.GetQueryParamBool(r, "bots_only", false) {
+		filters = append(filters, func(entry *logs.TraefikLog) bool {
+			return h.uaParser.Parse(entry.RequestUserAgent).Bot
+		})
+	}
+
+	dimensions := map[string]func(useragent.Info) string{
+		"browser": func(info useragent.Info) string { return info.Browser },
+		"os":      func(info useragent.Info) string { return info.OS },
+		"device":  func(info useragent.Info) string { return info.Device },
+		"bot":     func(info useragent.Info) string { return info.BotName },
+	}
+	for param, dimension := range dimensions {
+		value := utils.GetQueryParam(r, param, "")
+		if value == "" {
+			continue
+		}
+		filters = append(filters, func(entry *logs.TraefikLog) bool {
+			return strings.EqualFold(dimension(h.uaParser.Parse(entry.RequestUserAgent)), value)
+		})
+	}
+
+	return filters
+}
+
+// readRecentAccessLogs parses the tail of the access logs without moving tracked positions
+func (h *Handler) readRecentAccessLogs() ([]*logs.TraefikLog, error) {
+	fileInfo, err := os.Stat(h.config.AccessPath)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := []logs.Position{{Position: -1}}
+	if fileInfo.IsDir() {
+		// An empty position list tails the newest file in the directory
+		positions = []logs.Position{}
+	}
+
+	result, err := logs.GetLogs(h.config.AccessPath, positions, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return logs.ParseTraefikLogs(result.Logs), nil
+}
+
+// HandleSystemLogs handles requests for system logs listing
+func (h *Handler) HandleSystemLogs(w http.ResponseWriter, r *http.Request) {
 	logSizes, err := logs.GetLogSizes(h.config.AccessPath)
 	if err != nil {
 		utils.RespondError(w, http.StatusInternalServerError, err.Error())
@@ -287,12 +451,6 @@ func (h *Handler) HandleSystemLogs(w http.ResponseWriter, r *http.Request) {
 
 // HandleSystemResources handles requests for system resource statistics
 func (h *Handler) HandleSystemResources(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if !h.config.SystemMonitoring {
 		utils.RespondError(w, http.StatusForbidden, "System monitoring is disabled")
 		return
@@ -307,160 +465,852 @@ func (h *Handler) HandleSystemResources(w http.ResponseWriter, r *http.Request)
 	utils.RespondJSON(w, http.StatusOK, stats)
 }
 
-// HandleStatus handles health check requests
-func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
+// HandleAgentStats reports the agent's own health: how far ingestion is behind
+// each access log, the disk space used by its files and runtime statistics
+func (h *Handler) HandleAgentStats(w http.ResponseWriter, r *http.Request) {
+	utils.RespondJSON(w, http.StatusOK, h.agentStats())
+}
+
+// agentStats measures the agent's own health
+func (h *Handler) agentStats() api.AgentStats {
+	result := api.AgentStats{
+		StartedAt:     h.started.UTC(),
+		UptimeSeconds: int64(time.Since(h.started).Seconds()),
+		Ingest:        api.IngestStats{Enabled: h.pipeline != nil},
+		Storage:       api.StorageStats{Files: []api.StorageFile{}},
 	}
 
-	accessPathExists := false
-	if info, err := os.Stat(h.config.AccessPath); err == nil {
-		accessPathExists = true
-		if info.IsDir() {
-			entries, _ := os.ReadDir(h.config.AccessPath)
-			if len(entries) == 0 {
-				accessPathExists = false
-			}
+	if h.pipeline != nil {
+		result.Ingest.Sources = convertAll(h.pipeline.Stats(), apiIngestSource)
+		for _, source := range result.Ingest.Sources {
+			result.Ingest.LinesPerSec += source.LinesPerSec
+			result.Ingest.Lines += source.Lines
+			result.Ingest.ParseErrors += source.ParseErrors
+			result.Ingest.LagBytes += source.LagBytes
+			result.Ingest.LagSeconds = max(result.Ingest.LagSeconds, source.LagSeconds)
 		}
 	}
 
-	errorPathExists := false
-	if info, err := os.Stat(h.config.ErrorPath); err == nil {
-		errorPathExists = true
-		if info.IsDir() {
-			entries, _ := os.ReadDir(h.config.ErrorPath)
-			if len(entries) == 0 {
-				errorPathExists = false
+	// Files the agent writes, by the setting that configures them
+	addFile := func(name, path string, size int64) {
+		result.Storage.Files = append(result.Storage.Files, api.StorageFile{Name: name, Path: path, Bytes: size})
+		result.Storage.TotalBytes += size
+	}
+	for _, file := range []struct{ name, path string }{
+		{"positions", h.config.PositionFile},
+		{"state", h.config.StateFile},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if info, err := os.Stat(file.path); err == nil {
+			addFile(file.name, file.path, info.Size())
+		}
+	}
+	if h.blocklist != nil {
+		for _, file := range []struct{ name, path string }{
+			{"blocklist_state", h.config.BlocklistState},
+			{"blocklist_output", h.blocklist.OutputPath()},
+		} {
+			if info, err := os.Stat(file.path); err == nil {
+				addFile(file.name, file.path, info.Size())
 			}
 		}
 	}
+	if h.auditLog != nil {
+		addFile("audit", h.auditLog.Path(), h.auditLog.Size())
+	}
+	if h.search != nil {
+		addFile("search", h.search.Dir(), h.search.Stats().Bytes)
+	}
 
-	status := map[string]interface{}{
-		"status":              "ok",
-		"access_path":         h.config.AccessPath,
-		"access_path_exists":  accessPathExists,
-		"error_path":          h.config.ErrorPath,
-		"error_path_exists":   errorPathExists,
-		"system_monitoring":   h.config.SystemMonitoring,
-		"auth_enabled":        h.config.AuthToken != "",
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	result.Runtime = api.RuntimeStats{
+		GoVersion:      runtime.Version(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapInuseBytes: mem.HeapInuse,
+		SysBytes:       mem.Sys,
+		GCCycles:       mem.NumGC,
+		GCPauseTotalMs: float64(mem.PauseTotalNs) / 1e6,
+		GCCPUFraction:  mem.GCCPUFraction,
+		NextGCBytes:    mem.NextGC,
+	}
+	if mem.LastGC > 0 {
+		lastGC := time.Unix(0, int64(mem.LastGC)).UTC()
+		result.Runtime.LastGC = &lastGC
+		result.Runtime.LastGCPauseMs = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
 	}
 
-	utils.RespondJSON(w, http.StatusOK, status)
+	return result
 }
 
-// HandleGetLog handles requests for a specific log file
-func (h *Handler) HandleGetLog(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
+// HandleStatus handles health check requests
+func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	utils.RespondJSON(w, http.StatusOK, h.status())
+}
+
+// status reports whether the configured log paths exist and requests are authenticated
+func (h *Handler) status() api.Status {
+	authEnabled := h.config.AuthToken != ""
+	if h.authenticator != nil {
+		// API keys, JWTs and client certificates enable authentication without a token
+		authEnabled = h.authenticator.IsEnabled()
+	}
+	return api.Status{
+		Status:           "ok",
+		AccessPath:       h.config.AccessPath,
+		AccessPathExists: pathHasLogs(h.config.AccessPath),
+		ErrorPath:        h.config.ErrorPath,
+		ErrorPathExists:  pathHasLogs(h.config.ErrorPath),
+		SystemMonitoring: h.config.SystemMonitoring,
+		AuthEnabled:      authEnabled,
+	}
+}
+
+// pathHasLogs reports whether a log path is a file, or a directory that isn't empty
+func pathHasLogs(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
 	}
+	if info.IsDir() {
+		entries, _ := os.ReadDir(path)
+		return len(entries) > 0
+	}
+	return true
+}
 
+// HandleGetLog pages through a single log file, which must belong to a configured log path
+func (h *Handler) HandleGetLog(w http.ResponseWriter, r *http.Request) {
 	filename := utils.GetQueryParam(r, "filename", "")
 	if filename == "" {
 		utils.RespondError(w, http.StatusBadRequest, "filename parameter is required")
 		return
 	}
 
-	position := utils.GetQueryParamInt64(r, "position", 0)
-	lines := utils.GetQueryParamInt(r, "lines", 100)
+	source, ok := h.sourceAllowed(w, r)
+	if !ok {
+		return
+	}
 
-	fullPath := filepath.Join(h.config.AccessPath, filename)
+	backward := false
+	switch utils.GetQueryParam(r, "direction", "forward") {
+	case "forward":
+	case "backward":
+		backward = true
+	default:
+		utils.RespondError(w, http.StatusBadRequest, "direction must be forward or backward")
+		return
+	}
+
+	defaultPosition := int64(0)
+	if backward {
+		defaultPosition = -1
+	}
+	position := utils.GetQueryParamInt64(r, "position", defaultPosition)
+	lines := min(utils.GetQueryParamInt(r, "lines", 100), maxPageLines)
 
-	positions := []logs.Position{{Position: position, Filename: filename}}
-	result, err := logs.GetLogs(fullPath, positions, false, false)
+	fullPath, err := h.files.Resolve(source, filename)
+	if err != nil {
+		respondError(w, fileError(err))
+		return
+	}
+
+	page, err := logs.ReadPage(fullPath, position, lines, backward)
 	if err != nil {
 		utils.RespondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	page.File = filename
+	page.Positions[0].Filename = filename
 
-	if len(result.Logs) > lines {
-		result.Logs = result.Logs[:lines]
+	if source == logfiles.SourceAccess {
+		page.Logs = logs.FilterLines(page.Logs, h.accessFilters(r)...)
+		page.Logs = logs.RewriteClientHosts(page.Logs)
+		page.Logs = logs.RedactLines(page.Logs, h.redactionPolicy(r))
+	} else {
+		page.Logs = logs.RedactErrorLines(page.Logs, h.redactionPolicy(r))
 	}
 
-	utils.RespondJSON(w, http.StatusOK, result)
+	audit.SetRows(r.Context(), len(page.Logs))
+
+	utils.RespondJSON(w, http.StatusOK, page)
 }
 
-// HandleLocationLookup handles requests for IP geolocation lookups
-func (h *Handler) HandleLocationLookup(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+// HandleLogFiles lists the log files, including rotated and compressed ones, that can be read with /api/logs/get
+func (h *Handler) HandleLogFiles(w http.ResponseWriter, r *http.Request) {
+	source, ok := h.sourceAllowed(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := h.files.Files(source)
+	if err != nil {
+		respondError(w, fileError(err))
 		return
 	}
 
+	response := map[string]interface{}{
+		"source": source,
+		"files":  files,
+		"count":  len(files),
+	}
+
+	audit.SetRows(r.Context(), len(files))
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// HandleSecurityFindings returns suspicious activity detected in the access logs
+func (h *Handler) HandleSecurityFindings(w http.ResponseWriter, r *http.Request) {
+	findings, apiErr := h.findings(r, utils.GetQueryParamInt(r, "limit", 100))
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	response := map[string]interface{}{
+		"findings": findings,
+		"count":    len(findings),
+	}
+
+	audit.SetRows(r.Context(), len(findings))
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// findings returns up to limit findings matching the request's filters,
+// redacted for the caller; a limit of zero returns them all
+func (h *Handler) findings(r *http.Request, limit int) ([]security.Finding, *api.Error) {
+	if h.detector == nil {
+		return nil, api.Errorf(http.StatusServiceUnavailable, api.CodeDisabled, "Security detection is disabled")
+	}
+
+	// Findings aggregate clients across all hosts, so they can't be narrowed per row
+	if err := restrictedError(r); err != nil {
+		return nil, err
+	}
+
+	query := security.Query{
+		Type:     utils.GetQueryParam(r, "type", ""),
+		ClientIP: utils.GetQueryParam(r, "ip", ""),
+		Severity: utils.GetQueryParam(r, "severity", ""),
+		Limit:    limit,
+	}
+
+	if since := utils.GetQueryParam(r, "since", ""); since != "" {
+		ts, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, api.InvalidParam("since", "since must be an RFC3339 timestamp")
+		}
+		query.Since = ts
+	}
+
+	findings := h.detector.Findings(query)
+
+	if policy := h.redactionPolicy(r); !policy.IsZero() {
+		for i := range findings {
+			findings[i].ClientIP = policy.IPAddress(findings[i].ClientIP)
+			findings[i].Evidence.Samples = logs.RedactLines(findings[i].Evidence.Samples, policy)
+		}
+	}
+	return findings, nil
+}
+
+// HandleAudit returns recorded API requests, newest first
+func (h *Handler) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	records, apiErr := h.auditRecords(r, min(utils.GetQueryParamInt(r, "limit", 100), 1000))
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	response := map[string]interface{}{
+		"records": records,
+		"count":   len(records),
+	}
+
+	audit.SetRows(r.Context(), len(records))
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// auditRecords returns up to limit records matching the request's filters
+func (h *Handler) auditRecords(r *http.Request, limit int) ([]audit.Record, *api.Error) {
+	if h.auditLog == nil {
+		return nil, api.Errorf(http.StatusServiceUnavailable, api.CodeDisabled, "Audit log is disabled")
+	}
+
+	// Records cover every key's requests, so they can't be narrowed per row
+	if err := restrictedError(r); err != nil {
+		return nil, err
+	}
+
+	query := audit.Query{
+		KeyID:    utils.GetQueryParam(r, "key_id", ""),
+		Endpoint: utils.GetQueryParam(r, "endpoint", ""),
+		Limit:    limit,
+	}
+	for _, param := range []struct {
+		name   string
+		target *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		if value := utils.GetQueryParam(r, param.name, ""); value != "" {
+			ts, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, api.InvalidParam(param.name, param.name+" must be an RFC3339 timestamp")
+			}
+			*param.target = ts
+		}
+	}
+
+	records, err := h.auditLog.Query(query)
+	if err != nil {
+		return nil, api.Internal(err)
+	}
+	return records, nil
+}
+
+// HandleBlocklist lists, adds and removes blocked IPs
+func (h *Handler) HandleBlocklist(w http.ResponseWriter, r *http.Request) {
+	if err := h.blocklistAccess(r); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entries := h.blocklist.Entries()
+		response := map[string]interface{}{
+			"entries":    entries,
+			"count":      len(entries),
+			"removed":    h.blocklist.History(),
+			"output":     h.blocklist.OutputPath(),
+			"middleware": h.blocklist.MiddlewareName(),
+		}
+		audit.SetRows(r.Context(), len(entries))
+		utils.RespondJSON(w, http.StatusOK, response)
+
+	case http.MethodPost:
+		request, ok := decodeBlocklistRequest(w, r)
+		if !ok {
+			return
+		}
+
+		ttl, apiErr := parseBlocklistTTL(request.TTL)
+		if apiErr != nil {
+			respondError(w, apiErr)
+			return
+		}
+
+		entry, err := h.blocklist.Add(request.IP, request.Reason, blocklistActor(r), ttl, request.Pinned)
+		if err != nil {
+			respondError(w, blocklistError(err))
+			return
+		}
+		utils.RespondJSON(w, http.StatusOK, entry)
+
+	case http.MethodDelete:
+		ip := utils.GetQueryParam(r, "ip", "")
+		if ip == "" {
+			utils.RespondError(w, http.StatusBadRequest, "ip parameter is required")
+			return
+		}
+
+		reason := utils.GetQueryParam(r, "reason", "")
+		if err := h.blocklist.Remove(ip, reason, blocklistActor(r)); err != nil {
+			respondError(w, blocklistError(err))
+			return
+		}
+		utils.RespondJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+
+	default:
+		utils.RespondError(w, http.StatusMethodNotAllowed, "Only GET, POST and DELETE methods are allowed")
+	}
+}
+
+// HandleBlocklistPin pins an IP so it never expires
+func (h *Handler) HandleBlocklistPin(w http.ResponseWriter, r *http.Request) {
+	h.handleBlocklistPinning(w, r, true)
+}
+
+// HandleBlocklistUnpin lets a pinned IP expire after the configured TTL
+func (h *Handler) HandleBlocklistUnpin(w http.ResponseWriter, r *http.Request) {
+	h.handleBlocklistPinning(w, r, false)
+}
+
+// handleBlocklistPinning implements the pin and unpin endpoints
+func (h *Handler) handleBlocklistPinning(w http.ResponseWriter, r *http.Request, pin bool) {
+	if r.Method != http.MethodPost {
+		utils.RespondError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	if err := h.blocklistAccess(r); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	request, ok := decodeBlocklistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var entry blocklist.Entry
+	var err error
+	if pin {
+		entry, err = h.blocklist.Pin(request.IP, request.Reason, blocklistActor(r))
+	} else {
+		entry, err = h.blocklist.Unpin(request.IP, request.Reason, blocklistActor(r))
+	}
+	if err != nil {
+		respondError(w, blocklistError(err))
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, entry)
+}
+
+// errBlocklistDisabled is returned by the block list endpoints when it isn't configured
+var errBlocklistDisabled = &api.Error{
+	Status:  http.StatusServiceUnavailable,
+	Code:    api.CodeDisabled,
+	Message: "Block list is disabled",
+}
+
+// blocklistAccess rejects block list requests when it isn't configured, and
+// restricted keys, since the block list covers clients of every host
+func (h *Handler) blocklistAccess(r *http.Request) *api.Error {
+	if h.blocklist == nil {
+		return errBlocklistDisabled
+	}
+	return restrictedError(r)
+}
+
+// decodeBlocklistRequest parses and validates a block list request body,
+// writing an error response when it is invalid
+func decodeBlocklistRequest(w http.ResponseWriter, r *http.Request) (api.BlocklistRequest, bool) {
+	request, err := parseBlocklistRequest(r)
+	if err != nil {
+		respondError(w, err)
+		return request, false
+	}
+	return request, true
+}
+
+// parseBlocklistRequest parses and validates a block list request body
+func parseBlocklistRequest(r *http.Request) (api.BlocklistRequest, *api.Error) {
+	var request api.BlocklistRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, api.Errorf(http.StatusBadRequest, api.CodeInvalidBody, "Invalid request body")
+	}
+
+	if request.IP == "" {
+		return request, api.InvalidParam("ip", "ip is required")
+	}
+
+	if request.Reason == "" {
+		return request, api.InvalidParam("reason", "reason is required")
+	}
+
+	return request, nil
+}
+
+// parseBlocklistTTL parses the ttl of a block list request; empty means the configured TTL
+func parseBlocklistTTL(value string) (time.Duration, *api.Error) {
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, api.InvalidParam("ttl", "ttl must be a positive duration such as 12h")
+	}
+	return ttl, nil
+}
+
+// blocklistError maps block list errors to API errors
+func blocklistError(err error) *api.Error {
+	if errors.Is(err, blocklist.ErrNotFound) {
+		return api.Errorf(http.StatusNotFound, api.CodeNotFound, "%s", err.Error())
+	}
+	if errors.Is(err, blocklist.ErrInvalidAddress) || errors.Is(err, blocklist.ErrAllowed) {
+		return api.InvalidParam("ip", err.Error())
+	}
+	return api.Internal(err)
+}
+
+// blocklistActor identifies who changed the block list for its audit trail
+func blocklistActor(r *http.Request) string {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return "key:" + identity.KeyID
+	}
+	return "api:" + r.RemoteAddr
+}
+
+// HandleLocationLookup handles requests for IP geolocation lookups
+func (h *Handler) HandleLocationLookup(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST requests for location lookups
 	if r.Method != http.MethodPost {
 		utils.RespondError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
 		return
 	}
 
+	locations, apiErr := h.lookupLocations(r)
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	// Return results
+	response := api.LocationLookup{
+		Locations: locations,
+		Count:     len(locations),
+	}
+
+	audit.SetRows(r.Context(), len(locations))
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// lookupLocations resolves the IP addresses in a lookup request body
+func (h *Handler) lookupLocations(r *http.Request) ([]api.Location, *api.Error) {
 	// Check if GeoIP is enabled
 	if !h.config.GeoIPEnabled {
-		utils.RespondError(w, http.StatusForbidden, "GeoIP lookups are disabled")
-		return
+		return nil, errGeoIPDisabled
 	}
 
 	// Check if location services are available
 	if !location.LocationsEnabled() {
-		utils.RespondError(w, http.StatusServiceUnavailable, "GeoIP databases not available")
-		return
+		return nil, api.Errorf(http.StatusServiceUnavailable, api.CodeUnavailable, "GeoIP databases not available")
 	}
 
 	// Parse request body - expecting array of IP addresses
-	var request struct {
-		IPs []string `json:"ips"`
-	}
-
+	var request api.LocationLookupRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
-		return
+		return nil, api.Errorf(http.StatusBadRequest, api.CodeInvalidBody, "Invalid request body")
 	}
 
 	// Validate request
 	if len(request.IPs) == 0 {
-		utils.RespondError(w, http.StatusBadRequest, "No IP addresses provided")
-		return
+		return nil, api.InvalidParam("ips", "No IP addresses provided")
 	}
 
 	// Limit to 1000 IPs per request to prevent abuse
 	if len(request.IPs) > 1000 {
-		utils.RespondError(w, http.StatusBadRequest, "Too many IP addresses (max 1000)")
-		return
+		return nil, api.InvalidParam("ips", "Too many IP addresses (max 1000)")
 	}
 
 	// Perform location lookups
 	locations, err := location.ResolveLocations(request.IPs)
 	if err != nil {
-		utils.RespondError(w, http.StatusInternalServerError, err.Error())
+		return nil, api.Internal(err)
+	}
+	return convertAll(locations, apiLocation), nil
+}
+
+// errGeoIPDisabled is returned by the location endpoints when GeoIP is turned off
+var errGeoIPDisabled = &api.Error{
+	Status:  http.StatusForbidden,
+	Code:    api.CodeDisabled,
+	Message: "GeoIP lookups are disabled",
+}
+
+// HandleLocationASN returns request, error and byte counts grouped by autonomous system
+func (h *Handler) HandleLocationASN(w http.ResponseWriter, r *http.Request) {
+	response, apiErr := h.asnStats(r, utils.GetQueryParamInt(r, "limit", 20))
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	audit.SetRows(r.Context(), response.Total)
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// asnStats groups the recent access logs visible to the request by autonomous system
+func (h *Handler) asnStats(r *http.Request, limit int) (api.ASNs, *api.Error) {
+	if !h.config.GeoIPEnabled {
+		return api.ASNs{}, errGeoIPDisabled
+	}
+
+	if !location.ASNEnabled() {
+		return api.ASNs{}, api.Errorf(http.StatusServiceUnavailable, api.CodeUnavailable, "GeoIP ASN database not available")
+	}
+
+	entries, err := h.readRecentAccessLogs()
+	if err != nil {
+		return api.ASNs{}, api.Internal(err)
+	}
+	entries = logs.FilterEntries(entries, h.accessFilters(r)...)
+
+	lookup := func(ip string) location.Location {
+		loc, _ := location.LocationLookup(ip)
+		return loc
+	}
+
+	return api.ASNs{
+		ASNs:  convertAll(stats.ByASN(entries, lookup, limit), apiASNStat),
+		Total: len(entries),
+	}, nil
+}
+
+// HandleLocationCountries returns request, error and byte counts per country over a time range
+func (h *Handler) HandleLocationCountries(w http.ResponseWriter, r *http.Request) {
+	h.handleGeoStats(w, r, false)
+}
+
+// HandleLocationCities returns request, error and byte counts per city over a time range
+func (h *Handler) HandleLocationCities(w http.ResponseWriter, r *http.Request) {
+	h.handleGeoStats(w, r, true)
+}
+
+// handleGeoStats serves the country and city aggregations
+func (h *Handler) handleGeoStats(w http.ResponseWriter, r *http.Request, cities bool) {
+	result, apiErr := h.geoStats(r, cities, utils.GetQueryParamInt(r, "limit", 50))
+	if apiErr != nil {
+		respondError(w, apiErr)
 		return
 	}
 
-	// Return results
 	response := map[string]interface{}{
-		"locations": locations,
-		"count":     len(locations),
+		"total": result.Total,
+		"from":  result.From,
+		"to":    result.To,
+	}
+	if cities {
+		response["cities"] = result.Cities
+	} else {
+		response["countries"] = result.Countries
 	}
 
+	audit.SetRows(r.Context(), result.Total)
+
 	utils.RespondJSON(w, http.StatusOK, response)
 }
 
+// geoStats aggregates traffic visible to the request by country or city
+func (h *Handler) geoStats(r *http.Request, cities bool, limit int) (api.GeoStats, *api.Error) {
+	if h.geo == nil {
+		return api.GeoStats{}, api.Errorf(http.StatusServiceUnavailable, api.CodeDisabled, "GeoIP aggregation is disabled")
+	}
+
+	from, to, apiErr := parseTimeRange(r)
+	if apiErr != nil {
+		return api.GeoStats{}, apiErr
+	}
+
+	geo := h.geo
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok && identity.Restricted() {
+		// The shared aggregator covers all traffic; rebuild it from the rows this key may see
+		var err error
+		geo, err = h.restrictedGeoAggregator(r)
+		if err != nil {
+			return api.GeoStats{}, api.Internal(err)
+		}
+	}
+
+	result := api.GeoStats{From: from, To: to}
+	var results []stats.GeoStat
+	if cities {
+		results = geo.Cities(from, to, utils.GetQueryParam(r, "country", ""), limit)
+		result.Cities = convertAll(results, apiGeoStat)
+	} else {
+		results = geo.Countries(from, to, limit)
+		result.Countries = convertAll(results, apiGeoStat)
+	}
+
+	for _, stat := range results {
+		result.Total += stat.Requests
+	}
+	return result, nil
+}
+
+// restrictedGeoAggregator aggregates the recent access logs visible to the request
+func (h *Handler) restrictedGeoAggregator(r *http.Request) (*stats.GeoAggregator, error) {
+	entries, err := h.readRecentAccessLogs()
+	if err != nil {
+		return nil, err
+	}
+	entries = logs.FilterEntries(entries, h.accessFilters(r)...)
+
+	geo := stats.NewGeoAggregator(h.config.GeoIPRetention)
+	for _, entry := range entries {
+		loc, _ := location.LocationLookup(entry.ClientHost)
+		ts := entry.StartUTC
+		if ts.IsZero() {
+			ts = time.Now().UTC()
+		}
+		geo.Observe(ingest.Entry{Log: entry, Time: ts, Location: &loc})
+	}
+	return geo, nil
+}
+
+// restrictedError rejects keys restricted to a subset of the traffic, for
+// endpoints whose data can't be filtered per row
+func restrictedError(r *http.Request) *api.Error {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok && identity.Restricted() {
+		return api.Errorf(http.StatusForbidden, api.CodeRestricted, "API key is restricted to a subset of the traffic")
+	}
+	return nil
+}
+
+// respondError writes an API error in the v1 format
+func respondError(w http.ResponseWriter, err *api.Error) {
+	utils.RespondError(w, err.Status, err.Message)
+}
+
+// sourceScopes maps each log source to the scope needed to read its files
+var sourceScopes = map[string]string{
+	logfiles.SourceAccess: auth.ScopeAccessLogs,
+	logfiles.SourceError:  auth.ScopeErrorLogs,
+}
+
+// sourceAllowed reads the source query parameter and checks the caller may read it,
+// writing an error response when not
+func (h *Handler) sourceAllowed(w http.ResponseWriter, r *http.Request) (string, bool) {
+	source, err := h.source(r)
+	if err != nil {
+		respondError(w, err)
+		return "", false
+	}
+	return source, true
+}
+
+// source reads the source query parameter and checks the caller may read it
+func (h *Handler) source(r *http.Request) (string, *api.Error) {
+	source := utils.GetQueryParam(r, "source", logfiles.SourceAccess)
+	scope, ok := sourceScopes[source]
+	if !ok {
+		return "", api.InvalidParam("source", "source must be access or error")
+	}
+
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok && !identity.HasScope(scope) {
+		return "", api.Errorf(http.StatusForbidden, api.CodeForbidden, "API key lacks the %s scope", scope)
+	}
+
+	// Error log lines can't be narrowed to a restricted key's traffic
+	if source == logfiles.SourceError {
+		if err := restrictedError(r); err != nil {
+			return "", err
+		}
+	}
+	return source, nil
+}
+
+// fileError maps sandbox errors to API errors
+func fileError(err error) *api.Error {
+	switch {
+	case errors.Is(err, logfiles.ErrOutsideRoot):
+		return api.Errorf(http.StatusForbidden, api.CodeForbidden, "Access to this file is not allowed")
+	case errors.Is(err, logfiles.ErrNotFound):
+		return api.Errorf(http.StatusNotFound, api.CodeNotFound, "Log file not found")
+	}
+	return api.Internal(err)
+}
+
+// parseTimeRange reads the from/to RFC3339 query parameters, or a range duration
+// ending now such as range=1h; the range defaults to the last 24 hours
+func parseTimeRange(r *http.Request) (time.Time, time.Time, *api.Error) {
+	to := time.Now().UTC()
+	if value := utils.GetQueryParam(r, "to", ""); value != "" {
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, api.InvalidParam("to", "to must be an RFC3339 timestamp")
+		}
+		to = ts
+	}
+
+	if value := utils.GetQueryParam(r, "from", ""); value != "" {
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, api.InvalidParam("from", "from must be an RFC3339 timestamp")
+		}
+		return ts, to, nil
+	}
+
+	span := 24 * time.Hour
+	if value := utils.GetQueryParam(r, "range", ""); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return time.Time{}, time.Time{}, api.InvalidParam("range", "range must be a positive duration such as 1h")
+		}
+		span = d
+	}
+
+	return to.Add(-span), to, nil
+}
+
+// redactionPolicy returns the policy for the caller's scopes, or nil when redaction is disabled
+func (h *Handler) redactionPolicy(r *http.Request) *redact.Policy {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return h.redaction.Load().For(identity.Scopes)
+	}
+	return h.redaction.Load().Default()
+}
+
+// redactLocations re-keys looked up locations by redacted client IP
+func redactLocations(locations map[string]api.Location, policy *redact.Policy) map[string]api.Location {
+	if locations == nil || !policy.RedactsIPs() {
+		return locations
+	}
+	redacted := make(map[string]api.Location, len(locations))
+	for ip, loc := range locations {
+		loc.IPAddress = policy.IPAddress(loc.IPAddress)
+		redacted[policy.IPAddress(ip)] = loc
+	}
+	return redacted
+}
+
+// resolveLogLocations looks up the client IP of each access log line
+func resolveLogLocations(lines []string) map[string]api.Location {
+	var ips []string
+	seen := make(map[string]struct{})
+	for _, entry := range logs.ParseTraefikLogs(lines) {
+		if _, ok := seen[entry.ClientHost]; ok || entry.ClientHost == "" {
+			continue
+		}
+		seen[entry.ClientHost] = struct{}{}
+		ips = append(ips, entry.ClientHost)
+	}
+
+	resolved, _ := location.ResolveLocations(ips)
+
+	locations := make(map[string]api.Location, len(resolved))
+	for _, loc := range resolved {
+		locations[loc.IPAddress] = apiLocation(loc)
+	}
+	return locations
+}
+
 // HandleLocationStatus returns the status of the GeoIP service
 func (h *Handler) HandleLocationStatus(w http.ResponseWriter, r *http.Request) {
-	utils.EnableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
+	utils.RespondJSON(w, http.StatusOK, h.geoIPStatus())
+}
+
+// geoIPStatus reports the configured GeoIP databases and, when enabled, their state
+func (h *Handler) geoIPStatus() api.GeoIPStatus {
+	status := api.GeoIPStatus{
+		Enabled:      h.config.GeoIPEnabled,
+		Available:    location.LocationsEnabled(),
+		CityDB:       h.config.GeoIPCityDB,
+		CountryDB:    h.config.GeoIPCountryDB,
+		ASNDB:        h.config.GeoIPASNDB,
+		ASNAvailable: h.config.GeoIPEnabled && location.ASNEnabled(),
 	}
 
-	status := map[string]interface{}{
-		"enabled":   h.config.GeoIPEnabled,
-		"available": location.LocationsEnabled(),
-		"city_db":   h.config.GeoIPCityDB,
-		"country_db": h.config.GeoIPCountryDB,
+	if h.config.GeoIPEnabled {
+		geoStatus := location.GetStatus()
+		status.Databases = &api.GeoIPDatabases{
+			City:    api.GeoIPDatabase(geoStatus.City),
+			Country: api.GeoIPDatabase(geoStatus.Country),
+			ASN:     api.GeoIPDatabase(geoStatus.ASN),
+		}
+		cache := api.GeoIPCache(geoStatus.Cache)
+		status.LastReload = &geoStatus.LastReload
+		status.Cache = &cache
 	}
 
-	utils.RespondJSON(w, http.StatusOK, status)
-}
\ No newline at end of file
+	return status
+}
@@ -0,0 +1,162 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/audit"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/auth"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/utils"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/search"
+)
+
+// maxSearchResults caps the results returned by a single search
+const maxSearchResults = 1000
+
+// HandleSearch finds access and error log entries by term, phrase or prefix
+// in the indexed fields, within a time range. Callers only see the sources
+// their scopes allow, narrowed and redacted as the other log endpoints are.
+func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if h.search == nil {
+		respondError(w, api.Errorf(http.StatusServiceUnavailable, api.CodeDisabled, "Search is disabled"))
+		return
+	}
+
+	text := utils.GetQueryParam(r, "q", "")
+	if text == "" {
+		respondError(w, api.InvalidParam("q", "q parameter is required"))
+		return
+	}
+	var fields []string
+	if value := utils.GetQueryParam(r, "fields", ""); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if !search.IsField(field) {
+				respondError(w, api.InvalidParam("fields", "fields must be among "+strings.Join(search.Fields, ", ")))
+				return
+			}
+			fields = append(fields, field)
+		}
+	}
+	query, err := search.ParseQuery(text, fields)
+	if err != nil {
+		respondError(w, api.InvalidParam("q", err.Error()))
+		return
+	}
+
+	sources, apiErr := h.searchSources(r)
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	from, to, apiErr := parseTimeRange(r)
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	filters := h.accessFilters(r)
+	policy := h.redactionPolicy(r)
+	results, err := h.search.Search(query, search.Options{
+		From:    from,
+		To:      to,
+		Sources: sources,
+		Limit:   min(max(utils.GetQueryParamInt(r, "limit", 100), 1), maxSearchResults),
+		Filter: func(doc *search.Doc) bool {
+			if doc.Source != logfiles.SourceAccess {
+				if policy.IsZero() {
+					return true
+				}
+				setField(doc.Fields, search.FieldMessage, policy.Text(doc.Fields[search.FieldMessage]))
+				return query.Matches(doc.Fields)
+			}
+			entry := searchEntry(doc.Fields)
+			if !logs.Matches(entry, filters...) {
+				return false
+			}
+			if policy.IsZero() {
+				return true
+			}
+			// Match the redacted values again, so redacted text can't be probed for
+			logs.RedactEntry(entry, policy)
+			setField(doc.Fields, search.FieldPath, entry.RequestPath)
+			setField(doc.Fields, search.FieldReferer, entry.RequestReferer)
+			setField(doc.Fields, search.FieldUserAgent, entry.RequestUserAgent)
+			return query.Matches(doc.Fields)
+		},
+	})
+	if err != nil {
+		respondError(w, api.Internal(err))
+		return
+	}
+
+	response := api.SearchResults{
+		Query:     text,
+		Results:   convertAll(results.Docs, apiSearchDoc),
+		Count:     len(results.Docs),
+		Truncated: results.Truncated,
+	}
+	if response.Results == nil {
+		response.Results = []api.SearchDoc{}
+	}
+	if stats := h.search.Stats(); !stats.Oldest.IsZero() {
+		response.IndexedFrom = &stats.Oldest
+	}
+
+	audit.SetRows(r.Context(), response.Count)
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// searchSources reads the source query parameter; without one, every source
+// the caller may read is searched
+func (h *Handler) searchSources(r *http.Request) ([]string, *api.Error) {
+	if utils.GetQueryParam(r, "source", "") != "" {
+		source, err := h.source(r)
+		if err != nil {
+			return nil, err
+		}
+		return []string{source}, nil
+	}
+
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		return []string{logfiles.SourceAccess, logfiles.SourceError}, nil
+	}
+	var sources []string
+	if identity.HasScope(auth.ScopeAccessLogs) {
+		sources = append(sources, logfiles.SourceAccess)
+	}
+	// Error log lines can't be narrowed to a restricted key's traffic
+	if identity.HasScope(auth.ScopeErrorLogs) && !identity.Restricted() {
+		sources = append(sources, logfiles.SourceError)
+	}
+	if len(sources) == 0 {
+		return nil, api.Errorf(http.StatusForbidden, api.CodeForbidden, "API key lacks the %s or %s scope", auth.ScopeAccessLogs, auth.ScopeErrorLogs)
+	}
+	return sources, nil
+}
+
+// searchEntry rebuilds the parts of an access log entry that filters and
+// redaction look at from its indexed fields
+func searchEntry(fields map[string]string) *logs.TraefikLog {
+	return &logs.TraefikLog{
+		RequestPath:      fields[search.FieldPath],
+		RequestHost:      fields[search.FieldHost],
+		RequestUserAgent: fields[search.FieldUserAgent],
+		RequestReferer:   fields[search.FieldReferer],
+		RouterName:       fields[search.FieldRouter],
+		ServiceName:      fields[search.FieldService],
+		EntryPointName:   fields[search.FieldEntryPoint],
+	}
+}
+
+// setField stores a rewritten field, leaving absent fields absent
+func setField(fields map[string]string, field, value string) {
+	if _, ok := fields[field]; ok {
+		fields[field] = value
+	}
+}
@@ -0,0 +1,768 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/audit"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/auth"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/internal/utils"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/stats"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/system"
+)
+
+// openAPITitle is the title of the OpenAPI document
+const openAPITitle = "Traefik Log Dashboard Agent API"
+
+// Query parameters shared by several v2 operations
+var (
+	offsetParam = api.Param{Name: "offset", Type: "integer", Default: 0, Description: "Number of items to skip"}
+	cursorParam = api.Param{Name: "cursor", Description: "Cursor returned in the page of a previous response"}
+	sourceParam = api.Param{Name: "source", Enum: []string{logfiles.SourceAccess, logfiles.SourceError}, Default: logfiles.SourceAccess,
+		Description: "Log source; requires the logs:access or logs:error scope accordingly"}
+	sinceParam = api.Param{Name: "since", Format: "date-time", Description: "Only include items after this time"}
+
+	accessFilterParams = []api.Param{
+		{Name: "exclude_bots", Type: "boolean", Description: "Leave out requests from bots"},
+		{Name: "bots_only", Type: "boolean", Description: "Only include requests from bots"},
+		{Name: "browser", Description: "Only include requests from this browser"},
+		{Name: "os", Description: "Only include requests from this operating system"},
+		{Name: "device", Description: "Only include requests from this device class"},
+		{Name: "bot", Description: "Only include requests from this bot"},
+	}
+
+	timeRangeParams = []api.Param{
+		{Name: "from", Format: "date-time", Description: "Start of the time range"},
+		{Name: "to", Format: "date-time", Description: "End of the time range; defaults to now"},
+		{Name: "range", Format: "duration", Default: "24h", Description: "Length of the time range ending at to, when from is not set"},
+	}
+)
+
+// limitParam declares the limit parameter of an operation
+func limitParam(def, max int) api.Param {
+	return api.Param{
+		Name:        "limit",
+		Type:        "integer",
+		Default:     def,
+		Description: fmt.Sprintf("Maximum number of items to return, at most %d", max),
+	}
+}
+
+// params joins parameter lists
+func params(lists ...[]api.Param) []api.Param {
+	var result []api.Param
+	for _, list := range lists {
+		result = append(result, list...)
+	}
+	return result
+}
+
+// V2Operations returns the operations of /api/v2. The router and the OpenAPI
+// document are both built from them.
+func (h *Handler) V2Operations() []api.Operation {
+	return []api.Operation{
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "openapi.json", ID: "getOpenAPI", Tag: "meta",
+			Summary: "OpenAPI document of this API", Public: true,
+			Response: api.Document{}, Handler: h.v2OpenAPI,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "status", ID: "getStatus", Tag: "meta",
+			Summary: "Agent version and whether the configured log paths exist", Public: true,
+			Response: api.Status{}, Handler: h.v2Status,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "logs/access", ID: "getAccessLogs", Tag: "logs",
+			Summary:     "Lines of the current access log",
+			Description: "Without a cursor the last lines of the file are returned. Polling next_cursor returns the lines written since, starting over at the top of the file after it is rotated.",
+			Scope:       auth.ScopeAccessLogs,
+			Params: params([]api.Param{cursorParam, limitParam(1000, maxPageLines),
+				{Name: "geo", Type: "boolean", Description: "Resolve the location of each client IP"}}, accessFilterParams),
+			Response: api.LogPage{}, Handler: h.v2Tail(logfiles.SourceAccess),
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "logs/error", ID: "getErrorLogs", Tag: "logs",
+			Summary:     "Lines of the current error log",
+			Description: "Without a cursor the last lines of the file are returned. Polling next_cursor returns the lines written since, starting over at the top of the file after it is rotated.",
+			Scope:       auth.ScopeErrorLogs,
+			Params:      []api.Param{cursorParam, limitParam(100, maxPageLines)},
+			Response:    api.LogPage{}, Handler: h.v2Tail(logfiles.SourceError),
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "logs/files", ID: "listLogFiles", Tag: "logs",
+			Summary:  "Log files of a source, including rotated and compressed ones",
+			Params:   []api.Param{sourceParam, offsetParam, limitParam(100, 1000)},
+			Response: api.LogFiles{}, Handler: h.v2LogFiles,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "logs/get", ID: "getLogFile", Tag: "logs",
+			Summary: "Page through a log file listed by listLogFiles",
+			Params: params([]api.Param{
+				sourceParam,
+				{Name: "file", Required: true, Description: "Name of the file"},
+				{Name: "direction", Enum: []string{"forward", "backward"}, Default: "forward",
+					Description: "Read forward from the start or backward from the end of the file"},
+				cursorParam, limitParam(100, maxPageLines),
+			}, accessFilterParams),
+			Response: api.LogPage{}, Handler: h.v2GetLog,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "logs/routes", ID: "getRoutes", Tag: "logs",
+			Summary: "Busiest route templates in the recent access logs", Scope: auth.ScopeAccessLogs,
+			Params:   params([]api.Param{limitParam(10, 1000)}, accessFilterParams),
+			Response: api.Routes{}, Handler: h.v2Routes,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "logs/useragents", ID: "getUserAgents", Tag: "logs",
+			Summary: "Requests by browser, OS, device class and bot in the recent access logs", Scope: auth.ScopeAccessLogs,
+			Params:   params([]api.Param{limitParam(10, 1000)}, accessFilterParams),
+			Response: api.UserAgents{}, Handler: h.v2UserAgents,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "system/logs", ID: "getLogSizes", Tag: "system",
+			Summary: "Sizes of the access log files", Scope: auth.ScopeSystem,
+			Response: api.LogSizes{}, Handler: h.v2SystemLogs,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "system/resources", ID: "getSystemResources", Tag: "system",
+			Summary: "CPU, memory and disk usage of the host", Scope: auth.ScopeSystem,
+			Response: api.SystemInfo{}, Handler: h.v2SystemResources,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "agent/stats", ID: "getAgentStats", Tag: "system",
+			Summary: "Ingest lag, disk usage and runtime statistics of the agent", Scope: auth.ScopeSystem,
+			Response: api.AgentStats{}, Handler: h.v2AgentStats,
+		},
+		{
+			Method: http.MethodPost, Path: api.PathPrefix + "location/lookup", ID: "lookupLocations", Tag: "location",
+			Summary: "Locations of up to 1000 IP addresses", Scope: auth.ScopeGeo,
+			Body: api.LocationLookupRequest{}, Response: api.LocationLookup{}, Handler: h.v2LocationLookup,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "location/status", ID: "getGeoIPStatus", Tag: "location",
+			Summary: "State of the GeoIP databases and lookup cache", Scope: auth.ScopeGeo,
+			Response: api.GeoIPStatus{}, Handler: h.v2LocationStatus,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "location/asn", ID: "getASNs", Tag: "location",
+			Summary: "Traffic by autonomous system in the recent access logs", Scope: auth.ScopeGeo,
+			Params:   params([]api.Param{limitParam(20, 1000)}, accessFilterParams),
+			Response: api.ASNs{}, Handler: h.v2LocationASN,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "location/countries", ID: "getCountries", Tag: "location",
+			Summary: "Traffic by country over a time range", Scope: auth.ScopeGeo,
+			Params:   params([]api.Param{limitParam(50, 1000)}, timeRangeParams),
+			Response: api.GeoStats{}, Handler: h.v2GeoStats(false),
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "location/cities", ID: "getCities", Tag: "location",
+			Summary: "Traffic by city over a time range", Scope: auth.ScopeGeo,
+			Params: params([]api.Param{limitParam(50, 1000),
+				{Name: "country", Description: "Only include cities in this country"}}, timeRangeParams),
+			Response: api.GeoStats{}, Handler: h.v2GeoStats(true),
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "security/findings", ID: "listFindings", Tag: "security",
+			Summary: "Suspicious activity detected in the access logs, most recent first", Scope: auth.ScopeAccessLogs,
+			Params: []api.Param{
+				{Name: "type", Description: "Only include findings of this type"},
+				{Name: "ip", Description: "Only include findings about this client IP"},
+				{Name: "severity", Description: "Only include findings of this severity"},
+				sinceParam, offsetParam, limitParam(100, 1000),
+			},
+			Response: api.Findings{}, Handler: h.v2Findings,
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "security/blocklist", ID: "listBlocklist", Tag: "security",
+			Summary: "Blocked IP addresses", Scope: auth.ScopeAdmin,
+			Params:   []api.Param{offsetParam, limitParam(100, 1000)},
+			Response: api.Blocklist{}, Handler: h.v2Blocklist,
+		},
+		{
+			Method: http.MethodPost, Path: api.PathPrefix + "security/blocklist", ID: "addBlocklistEntry", Tag: "security",
+			Summary: "Block an IP address or network", Scope: auth.ScopeAdmin,
+			Body: api.BlocklistRequest{}, Response: api.BlocklistEntry{}, Handler: h.v2BlocklistAdd,
+		},
+		{
+			Method: http.MethodDelete, Path: api.PathPrefix + "security/blocklist", ID: "removeBlocklistEntry", Tag: "security",
+			Summary: "Unblock an IP address or network", Scope: auth.ScopeAdmin,
+			Params: []api.Param{
+				{Name: "ip", Required: true, Description: "Blocked IP address or network"},
+				{Name: "reason", Description: "Why the entry is removed"},
+			},
+			Handler: h.v2BlocklistRemove,
+		},
+		{
+			Method: http.MethodPost, Path: api.PathPrefix + "security/blocklist/pin", ID: "pinBlocklistEntry", Tag: "security",
+			Summary: "Keep a blocked IP address from expiring", Scope: auth.ScopeAdmin,
+			Body: api.BlocklistRequest{}, Response: api.BlocklistEntry{}, Handler: h.v2BlocklistPinning(true),
+		},
+		{
+			Method: http.MethodPost, Path: api.PathPrefix + "security/blocklist/unpin", ID: "unpinBlocklistEntry", Tag: "security",
+			Summary: "Let a pinned IP address expire after the configured TTL", Scope: auth.ScopeAdmin,
+			Body: api.BlocklistRequest{}, Response: api.BlocklistEntry{}, Handler: h.v2BlocklistPinning(false),
+		},
+		{
+			Method: http.MethodGet, Path: api.PathPrefix + "audit", ID: "listAuditRecords", Tag: "audit",
+			Summary: "Requests served to API callers, newest first", Scope: auth.ScopeAdmin,
+			Params: []api.Param{
+				{Name: "key_id", Description: "Only include requests made with this key"},
+				{Name: "endpoint", Description: "Only include requests to this endpoint"},
+				sinceParam,
+				{Name: "until", Format: "date-time", Description: "Only include requests before this time"},
+				offsetParam, limitParam(100, 1000),
+			},
+			Response: api.AuditRecords{}, Handler: h.v2Audit,
+		},
+	}
+}
+
+// RegisterV2 serves the v2 operations on mux. protect authenticates the
+// operations that aren't public and records them in the audit log.
+func (h *Handler) RegisterV2(mux *http.ServeMux, protect func(scope string, next http.HandlerFunc) http.HandlerFunc) {
+	var paths []string
+	methods := map[string]map[string]http.HandlerFunc{}
+	for _, op := range h.V2Operations() {
+		handler := op.Handler
+		if !op.Public {
+			handler = protect(op.Scope, handler)
+		}
+		if methods[op.Path] == nil {
+			methods[op.Path] = map[string]http.HandlerFunc{}
+			paths = append(paths, op.Path)
+		}
+		methods[op.Path][op.Method] = handler
+	}
+
+	for _, path := range paths {
+		handlers := methods[path]
+		allowed := make([]string, 0, len(handlers))
+		for method := range handlers {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		allow := strings.Join(allowed, ", ")
+
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			handler, ok := handlers[r.Method]
+			if !ok {
+				w.Header().Set("Allow", allow)
+				api.WriteError(w, api.Errorf(http.StatusMethodNotAllowed, api.CodeMethodNotAllowed,
+					"Method %s is not allowed, use %s", r.Method, allow))
+				return
+			}
+			handler(w, r)
+		})
+	}
+
+	mux.HandleFunc(api.PathPrefix, func(w http.ResponseWriter, r *http.Request) {
+		api.WriteError(w, api.Errorf(http.StatusNotFound, api.CodeNotFound, "No endpoint at %s", r.URL.Path))
+	})
+}
+
+// respondV2 writes a successful v2 response and records its rows in the audit log
+func respondV2(w http.ResponseWriter, r *http.Request, rows int, body interface{}) {
+	audit.SetRows(r.Context(), rows)
+	api.WriteJSON(w, http.StatusOK, body)
+}
+
+// queryInt reads an integer query parameter that must lie within [lo, hi]
+func queryInt(r *http.Request, name string, def, lo, hi int) (int, *api.Error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, api.InvalidParam(name, fmt.Sprintf("%s must be an integer from %d to %d", name, lo, hi))
+	}
+	return n, nil
+}
+
+// queryLimit reads the limit query parameter
+func queryLimit(r *http.Request, def, max int) (int, *api.Error) {
+	return queryInt(r, "limit", def, 1, max)
+}
+
+// queryList reads the offset and limit query parameters of a list
+func queryList(r *http.Request, def, max int) (int, int, *api.Error) {
+	offset, err := queryInt(r, "offset", 0, 0, math.MaxInt32)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err := queryLimit(r, def, max)
+	return offset, limit, err
+}
+
+// v2OpenAPI serves the OpenAPI document generated from the v2 operations
+func (h *Handler) v2OpenAPI(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, api.Spec(openAPITitle, h.version, h.V2Operations()))
+}
+
+func (h *Handler) v2Status(w http.ResponseWriter, r *http.Request) {
+	status := h.status()
+	status.Version = h.version
+	api.WriteJSON(w, http.StatusOK, status)
+}
+
+// v2Tail serves the current file of a source. Unlike v1 it keeps no read
+// position; callers poll with the cursor of the previous page.
+func (h *Handler) v2Tail(source string) http.HandlerFunc {
+	defaultLimit := 1000
+	if source == logfiles.SourceError {
+		defaultLimit = 100
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if source == logfiles.SourceError {
+			if err := restrictedError(r); err != nil {
+				api.WriteError(w, err)
+				return
+			}
+		}
+
+		limit, apiErr := queryLimit(r, defaultLimit, maxPageLines)
+		if apiErr != nil {
+			api.WriteError(w, apiErr)
+			return
+		}
+
+		files, err := h.files.Files(source)
+		if err != nil {
+			api.WriteError(w, fileError(err))
+			return
+		}
+		var current *logfiles.FileInfo
+		for i := range files {
+			if !files[i].Compressed {
+				current = &files[i]
+				break
+			}
+		}
+		if current == nil {
+			api.WriteError(w, api.Errorf(http.StatusNotFound, api.CodeNotFound, "No %s log file found", source))
+			return
+		}
+
+		// The first page is the end of the file; later pages read on from the cursor
+		cursor := r.URL.Query().Get("cursor")
+		offset, backward := int64(-1), true
+		if cursor != "" {
+			if offset, err = api.ParseCursor(cursor); err != nil {
+				api.WriteError(w, err)
+				return
+			}
+			backward = false
+			// A cursor past the end was left in a file that has since been
+			// rotated; the lines written since start at the top of the new one
+			if offset > current.Size {
+				offset = 0
+			}
+		}
+
+		result, read, apiErr := h.readLogPage(r, source, current.Name, offset, limit, backward)
+		if apiErr != nil {
+			api.WriteError(w, apiErr)
+			return
+		}
+		// Whichever way the first page was read, the next one follows the file forward
+		result.Page = logCursors(result.Page, read, cursor, false)
+		respondV2(w, r, len(result.Lines), result)
+	}
+}
+
+func (h *Handler) v2GetLog(w http.ResponseWriter, r *http.Request) {
+	source, apiErr := h.source(r)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	name := r.URL.Query().Get("file")
+	if name == "" {
+		api.WriteError(w, api.InvalidParam("file", "file is required"))
+		return
+	}
+
+	backward := false
+	switch utils.GetQueryParam(r, "direction", "forward") {
+	case "forward":
+	case "backward":
+		backward = true
+	default:
+		api.WriteError(w, api.InvalidParam("direction", "direction must be forward or backward"))
+		return
+	}
+
+	limit, apiErr := queryLimit(r, 100, maxPageLines)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	offset := int64(0)
+	if backward {
+		offset = -1
+	}
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" {
+		var err error
+		if offset, err = api.ParseCursor(cursor); err != nil {
+			api.WriteError(w, err)
+			return
+		}
+	}
+
+	result, read, apiErr := h.readLogPage(r, source, name, offset, limit, backward)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+	result.Page = logCursors(result.Page, read, cursor, backward)
+	respondV2(w, r, len(result.Lines), result)
+}
+
+// logCursors sets the cursors of a page read from a log file so that the next
+// cursor continues in the given direction
+func logCursors(page api.Page, read logs.Page, cursor string, backward bool) api.Page {
+	page.Cursor = cursor
+	if backward {
+		page.HasMore = read.HasPrevious
+		if read.HasPrevious {
+			page.NextCursor = api.Cursor(read.Start)
+		}
+		page.PrevCursor = api.Cursor(read.End)
+		return page
+	}
+
+	// Forward, the next cursor stays at the end of the file so it can be polled for new lines
+	page.HasMore = read.HasNext
+	page.NextCursor = api.Cursor(read.End)
+	if read.HasPrevious {
+		page.PrevCursor = api.Cursor(read.Start)
+	}
+	return page
+}
+
+// readLogPage reads lines of a file of a source, applying the access log
+// filters and redaction for the caller. It also returns the page as read, which
+// holds the offsets of the lines.
+func (h *Handler) readLogPage(r *http.Request, source, name string, offset int64, limit int, backward bool) (api.LogPage, logs.Page, *api.Error) {
+	fullPath, err := h.files.Resolve(source, name)
+	if err != nil {
+		return api.LogPage{}, logs.Page{}, fileError(err)
+	}
+
+	read, err := logs.ReadPage(fullPath, offset, limit, backward)
+	if err != nil {
+		return api.LogPage{}, logs.Page{}, api.Internal(err)
+	}
+
+	result := api.LogPage{
+		Source:     source,
+		File:       name,
+		Lines:      read.Logs,
+		Compressed: read.Compressed,
+	}
+
+	if source == logfiles.SourceAccess {
+		result.Lines = logs.FilterLines(result.Lines, h.accessFilters(r)...)
+		result.Lines = logs.RewriteClientHosts(result.Lines)
+		if utils.GetQueryParamBool(r, "geo", false) && h.config.GeoIPEnabled {
+			result.Locations = resolveLogLocations(result.Lines)
+		}
+		policy := h.redactionPolicy(r)
+		result.Lines = logs.RedactLines(result.Lines, policy)
+		result.Locations = redactLocations(result.Locations, policy)
+	} else {
+		result.Lines = logs.RedactErrorLines(result.Lines, h.redactionPolicy(r))
+	}
+
+	result.Page = api.Page{Limit: limit, Count: len(result.Lines)}
+	return result, read, nil
+}
+
+func (h *Handler) v2LogFiles(w http.ResponseWriter, r *http.Request) {
+	source, apiErr := h.source(r)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	offset, limit, apiErr := queryList(r, 100, 1000)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	files, err := h.files.Files(source)
+	if err != nil {
+		api.WriteError(w, fileError(err))
+		return
+	}
+
+	items, page := api.Paginate(convertAll(files, apiLogFile), offset, limit)
+	respondV2(w, r, len(items), api.LogFiles{Source: source, Files: items, Page: page})
+}
+
+func (h *Handler) v2Routes(w http.ResponseWriter, r *http.Request) {
+	limit, apiErr := queryLimit(r, 10, 1000)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	entries, err := h.readRecentAccessLogs()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	entries = logs.FilterEntries(entries, h.accessFilters(r)...)
+
+	normalizer := h.routeNormalizer(r, entries)
+	respondV2(w, r, len(entries), api.Routes{
+		Routes:    convertAll(stats.TopRoutes(entries, normalizer, limit), apiRouteStat),
+		Templates: convertAll(normalizer.Templates(), apiRouteTemplate),
+		Total:     len(entries),
+	})
+}
+
+func (h *Handler) v2UserAgents(w http.ResponseWriter, r *http.Request) {
+	limit, apiErr := queryLimit(r, 10, 1000)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	entries, err := h.readRecentAccessLogs()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	entries = logs.FilterEntries(entries, h.accessFilters(r)...)
+
+	respondV2(w, r, len(entries), apiUserAgents(stats.UserAgents(entries, h.uaParser, limit)))
+}
+
+func (h *Handler) v2SystemLogs(w http.ResponseWriter, r *http.Request) {
+	logSizes, err := logs.GetLogSizes(h.config.AccessPath)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, apiLogSizes(*logSizes))
+}
+
+func (h *Handler) v2SystemResources(w http.ResponseWriter, r *http.Request) {
+	if !h.config.SystemMonitoring {
+		api.WriteError(w, api.Errorf(http.StatusForbidden, api.CodeDisabled, "System monitoring is disabled"))
+		return
+	}
+
+	info, err := system.MeasureSystem()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, apiSystemInfo(info))
+}
+
+func (h *Handler) v2AgentStats(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, h.agentStats())
+}
+
+func (h *Handler) v2LocationLookup(w http.ResponseWriter, r *http.Request) {
+	locations, apiErr := h.lookupLocations(r)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+	respondV2(w, r, len(locations), api.LocationLookup{Locations: locations, Count: len(locations)})
+}
+
+func (h *Handler) v2LocationStatus(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, h.geoIPStatus())
+}
+
+func (h *Handler) v2LocationASN(w http.ResponseWriter, r *http.Request) {
+	limit, apiErr := queryLimit(r, 20, 1000)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	result, apiErr := h.asnStats(r, limit)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+	respondV2(w, r, result.Total, result)
+}
+
+func (h *Handler) v2GeoStats(cities bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, apiErr := queryLimit(r, 50, 1000)
+		if apiErr != nil {
+			api.WriteError(w, apiErr)
+			return
+		}
+
+		result, apiErr := h.geoStats(r, cities, limit)
+		if apiErr != nil {
+			api.WriteError(w, apiErr)
+			return
+		}
+		respondV2(w, r, result.Total, result)
+	}
+}
+
+func (h *Handler) v2Findings(w http.ResponseWriter, r *http.Request) {
+	offset, limit, apiErr := queryList(r, 100, 1000)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	findings, apiErr := h.findings(r, 0)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	items, page := api.Paginate(convertAll(findings, apiFinding), offset, limit)
+	respondV2(w, r, len(items), api.Findings{Findings: items, Page: page})
+}
+
+func (h *Handler) v2Blocklist(w http.ResponseWriter, r *http.Request) {
+	if err := h.blocklistAccess(r); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	offset, limit, apiErr := queryList(r, 100, 1000)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	entries, page := api.Paginate(convertAll(h.blocklist.Entries(), apiBlocklistEntry), offset, limit)
+	respondV2(w, r, len(entries), api.Blocklist{
+		Entries:    entries,
+		Removed:    convertAll(h.blocklist.History(), apiBlocklistEntry),
+		Output:     h.blocklist.OutputPath(),
+		Middleware: h.blocklist.MiddlewareName(),
+		Page:       page,
+	})
+}
+
+func (h *Handler) v2BlocklistAdd(w http.ResponseWriter, r *http.Request) {
+	if err := h.blocklistAccess(r); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	request, apiErr := parseBlocklistRequest(r)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+	ttl, apiErr := parseBlocklistTTL(request.TTL)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	entry, err := h.blocklist.Add(request.IP, request.Reason, blocklistActor(r), ttl, request.Pinned)
+	if err != nil {
+		api.WriteError(w, blocklistError(err))
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, apiBlocklistEntry(entry))
+}
+
+func (h *Handler) v2BlocklistRemove(w http.ResponseWriter, r *http.Request) {
+	if err := h.blocklistAccess(r); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		api.WriteError(w, api.InvalidParam("ip", "ip is required"))
+		return
+	}
+
+	if err := h.blocklist.Remove(ip, r.URL.Query().Get("reason"), blocklistActor(r)); err != nil {
+		api.WriteError(w, blocklistError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) v2BlocklistPinning(pin bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.blocklistAccess(r); err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		request, apiErr := parseBlocklistRequest(r)
+		if apiErr != nil {
+			api.WriteError(w, apiErr)
+			return
+		}
+
+		update := h.blocklist.Unpin
+		if pin {
+			update = h.blocklist.Pin
+		}
+		entry, err := update(request.IP, request.Reason, blocklistActor(r))
+		if err != nil {
+			api.WriteError(w, blocklistError(err))
+			return
+		}
+		api.WriteJSON(w, http.StatusOK, apiBlocklistEntry(entry))
+	}
+}
+
+func (h *Handler) v2Audit(w http.ResponseWriter, r *http.Request) {
+	offset, limit, apiErr := queryList(r, 100, 1000)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	// One record past the page tells whether there are more
+	records, apiErr := h.auditRecords(r, offset+limit+1)
+	if apiErr != nil {
+		api.WriteError(w, apiErr)
+		return
+	}
+
+	page := api.Page{Limit: limit, Offset: offset}
+	if offset > len(records) {
+		offset = len(records)
+	}
+	records = records[offset:]
+	if len(records) > limit {
+		records = records[:limit]
+		next := offset + limit
+		page.HasMore = true
+		page.NextOffset = &next
+	}
+	page.Count = len(records)
+
+	result := api.AuditRecords{Records: make([]api.AuditRecord, len(records)), Page: page}
+	for i, record := range records {
+		result.Records[i] = api.AuditRecord(record)
+	}
+	respondV2(w, r, len(records), result)
+}
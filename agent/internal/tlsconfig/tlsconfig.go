@@ -0,0 +1,198 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+)
+
+var log = logger.With("tls")
+
+// Client certificate modes
+const (
+	// ClientAuthRequire rejects connections without a certificate signed by the CA
+	ClientAuthRequire = "require"
+	// ClientAuthOptional verifies a certificate only when the client sends one
+	ClientAuthOptional = "optional"
+)
+
+// checkInterval rate-limits how often the files are checked for changes
+const checkInterval = 10 * time.Second
+
+// Config configures the agent's TLS listener
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables client certificate verification when set
+	ClientCAFile string
+	ClientAuth   string
+	// MinVersion is "1.2" or "1.3"
+	MinVersion string
+}
+
+// Reloader serves the certificate and client CA bundle, re-reading them when the files change
+type Reloader struct {
+	config Config
+	base   *tls.Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+// New loads the certificate, key and CA bundle and returns a reloader for them
+func New(config Config) (*Reloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("TLS requires both a certificate and a key file")
+	}
+
+	minVersion, err := parseVersion(config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if config.ClientCAFile != "" {
+		switch strings.ToLower(config.ClientAuth) {
+		case "", ClientAuthRequire:
+			base.ClientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthOptional:
+			base.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("invalid client auth mode %q: expected require or optional", config.ClientAuth)
+		}
+	}
+
+	r := &Reloader{
+		config:   config,
+		base:     base,
+		modTimes: make(map[string]time.Time),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the configuration to use for the HTTP server
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.base.MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			config := r.base.Clone()
+			config.Certificates = []tls.Certificate{*r.cert}
+			config.ClientCAs = r.clientCAs
+			return config, nil
+		},
+	}
+}
+
+// maybeReload reloads the files if they changed, at most once per check interval
+func (r *Reloader) maybeReload() {
+	r.mu.Lock()
+	if time.Since(r.lastCheck) < checkInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastCheck = time.Now()
+	changed := r.changedLocked()
+	r.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		log.Warn("Keeping previous certificates", logger.KeyPath, r.config.CertFile, logger.Err(err))
+		return
+	}
+	log.Info("Reloaded certificates", logger.KeyPath, r.config.CertFile)
+}
+
+// changedLocked reports whether any configured file has a new modification time
+func (r *Reloader) changedLocked() bool {
+	for _, path := range r.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// files lists the configured certificate files
+func (r *Reloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+// load reads the certificate, key and CA bundle
+func (r *Reloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, path := range r.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTimes[path] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		data, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in client CA bundle %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+
+	return nil
+}
+
+// parseVersion converts a "1.2" style version to its TLS constant
+func parseVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid minimum TLS version %q: expected 1.2 or 1.3", version)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // RespondJSON sends a JSON response with the given status code
@@ -77,9 +78,13 @@ func GetQueryParamBool(r *http.Request, key string, defaultValue bool) bool {
 	return boolValue
 }
 
-// EnableCORS adds CORS headers to the response
-func EnableCORS(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-}
\ No newline at end of file
+// SplitList splits a comma-separated configuration value, dropping empty items
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
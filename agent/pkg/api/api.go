@@ -0,0 +1,141 @@
+// Package api defines the agent's versioned HTTP API: the request and response
+// types of /api/v2, its error envelope and pagination metadata, and the
+// operations its OpenAPI document is generated from. The types only depend on
+// the standard library, so that clients importing the package don't link the
+// agent itself.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// PathPrefix is the path every v2 endpoint lives under
+const PathPrefix = "/api/v2/"
+
+// Versions lists the API versions served by the agent; v1 is the unversioned /api
+var Versions = []string{"v1", "v2"}
+
+// Machine-readable error codes
+const (
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidBody      = "invalid_body"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeRestricted       = "restricted_key"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeDisabled         = "feature_disabled"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal_error"
+)
+
+// Error is a failed request. It is written inside an ErrorResponse.
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Param names the query parameter or body field at fault
+	Param string `json:"param,omitempty"`
+}
+
+// Error returns the message
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorResponse is the body of every v2 error response
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
+
+// Errorf creates an error with a formatted message
+func Errorf(status int, code, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// InvalidParam reports an invalid query parameter or body field
+func InvalidParam(param, message string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidParameter, Message: message, Param: param}
+}
+
+// Internal wraps an unexpected error
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: err.Error()}
+}
+
+// AsError returns err as an *Error, treating any other error as internal
+func AsError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal(err)
+}
+
+// WriteJSON writes a JSON response
+func WriteJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// WriteError writes err in the error envelope
+func WriteError(w http.ResponseWriter, err error) {
+	apiErr := AsError(err)
+	WriteJSON(w, apiErr.Status, ErrorResponse{Error: apiErr})
+}
+
+// Page describes where a page of results sits in the full result set. Lists
+// are paged with limit and offset; log lines are paged with opaque cursors.
+type Page struct {
+	Limit int `json:"limit"`
+	Count int `json:"count"`
+	// Offset, Total and NextOffset are set for lists
+	Offset     int  `json:"offset,omitempty"`
+	Total      *int `json:"total,omitempty"`
+	NextOffset *int `json:"next_offset,omitempty"`
+	// Cursor is where the page was read from; NextCursor continues reading
+	// in the same direction and PrevCursor in the opposite one
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// Paginate returns the items of a list within offset and limit along with
+// the page describing them
+func Paginate[T any](items []T, offset, limit int) ([]T, Page) {
+	total := len(items)
+	page := Page{Limit: limit, Offset: offset, Total: &total}
+	if offset > total {
+		offset = total
+	}
+	end := min(offset+limit, total)
+	items = items[offset:end]
+	page.Count = len(items)
+	if end < total {
+		page.HasMore = true
+		page.NextOffset = &end
+	}
+	return items, page
+}
+
+// Cursor encodes a byte offset as a cursor
+func Cursor(offset int64) string {
+	return strconv.FormatInt(offset, 10)
+}
+
+// ParseCursor decodes a cursor written by Cursor
+func ParseCursor(cursor string) (int64, error) {
+	offset, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, InvalidParam("cursor", "cursor must be a value returned in a previous page")
+	}
+	return offset, nil
+}
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification documents are written in
+const OpenAPIVersion = "3.0.3"
+
+// Param is a query parameter of an operation
+type Param struct {
+	Name string
+	// Type is string, integer, number or boolean; empty means string
+	Type string
+	// Format refines the type, such as date-time or duration
+	Format      string
+	Enum        []string
+	Default     interface{}
+	Required    bool
+	Description string
+}
+
+// Operation is an endpoint of the API. The OpenAPI document is generated from
+// the operations registered with the router, so it can't drift from what is served.
+type Operation struct {
+	Method      string
+	Path        string
+	ID          string
+	Tag         string
+	Summary     string
+	Description string
+	// Scope is required of API keys; empty on authenticated operations means
+	// the scope depends on the request and is checked by the handler
+	Scope string
+	// Public operations are served without authentication
+	Public bool
+	Params []Param
+	// Body and Response are values of the request and response types; a nil
+	// Response means the operation responds without content
+	Body     interface{}
+	Response interface{}
+	// Status is the success status; zero means 200, or 204 without a Response
+	Status  int
+	Handler http.HandlerFunc
+}
+
+// SuccessStatus returns the status of a successful response
+func (op Operation) SuccessStatus() int {
+	switch {
+	case op.Status != 0:
+		return op.Status
+	case op.Response == nil:
+		return http.StatusNoContent
+	}
+	return http.StatusOK
+}
+
+// Document is an OpenAPI document
+type Document map[string]interface{}
+
+// Spec generates the OpenAPI document of operations. Schemas are derived from
+// the JSON encoding of the request and response types.
+func Spec(title, version string, operations []Operation) Document {
+	gen := &schemaGenerator{
+		components: map[string]interface{}{},
+		types:      map[string]reflect.Type{},
+	}
+	errorSchema := gen.schema(reflect.TypeOf(ErrorResponse{}))
+
+	paths := map[string]interface{}{}
+	for _, op := range operations {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = gen.operation(op, errorSchema)
+	}
+
+	var tags []string
+	seen := map[string]bool{}
+	for _, op := range operations {
+		if op.Tag != "" && !seen[op.Tag] {
+			seen[op.Tag] = true
+			tags = append(tags, op.Tag)
+		}
+	}
+	sort.Strings(tags)
+	tagList := make([]map[string]string, 0, len(tags))
+	for _, tag := range tags {
+		tagList = append(tagList, map[string]string{"name": tag})
+	}
+
+	return Document{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"tags":  tagList,
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": gen.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The agent token, an API key or a JWT",
+				},
+			},
+		},
+	}
+}
+
+// schemaGenerator collects the named schemas referenced by the operations
+type schemaGenerator struct {
+	components map[string]interface{}
+	types      map[string]reflect.Type
+}
+
+// operation builds the OpenAPI operation object of op
+func (g *schemaGenerator) operation(op Operation, errorSchema map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{
+		"operationId": op.ID,
+		"summary":     op.Summary,
+	}
+	if op.Tag != "" {
+		result["tags"] = []string{op.Tag}
+	}
+
+	description := op.Description
+	if !op.Public {
+		result["security"] = []map[string][]string{{"bearerAuth": {}}}
+		if op.Scope != "" {
+			result["x-required-scope"] = op.Scope
+			description = strings.TrimSpace(description + "\n\nRequires the `" + op.Scope + "` scope.")
+		}
+	}
+	if description != "" {
+		result["description"] = description
+	}
+
+	if len(op.Params) > 0 {
+		params := make([]map[string]interface{}, 0, len(op.Params))
+		for _, p := range op.Params {
+			params = append(params, paramObject(p))
+		}
+		result["parameters"] = params
+	}
+
+	if op.Body != nil {
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(g.schema(reflect.TypeOf(op.Body))),
+		}
+	}
+
+	status := op.SuccessStatus()
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = jsonContent(g.schema(reflect.TypeOf(op.Response)))
+	}
+	result["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     jsonContent(errorSchema),
+		},
+	}
+	return result
+}
+
+// paramObject builds the OpenAPI parameter object of a query parameter
+func paramObject(p Param) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+	if p.Type != "" {
+		schema["type"] = p.Type
+	}
+	if p.Format != "" {
+		schema["format"] = p.Format
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	if p.Default != nil {
+		schema["default"] = p.Default
+	}
+
+	param := map[string]interface{}{
+		"name":   p.Name,
+		"in":     "query",
+		"schema": schema,
+	}
+	if p.Required {
+		param["required"] = true
+	}
+	if p.Description != "" {
+		param["description"] = p.Description
+	}
+	return param
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// schema returns the schema of t, registering named structs as components
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := g.schema(t.Elem())
+		if _, ok := elem["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{elem}, "nullable": true}
+		}
+		elem["nullable"] = true
+		return elem
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := componentName(t)
+		if existing, ok := g.types[name]; ok {
+			if existing != t {
+				panic(fmt.Sprintf("api: schema name %s is used by %s and %s", name, existing, t))
+			}
+		} else {
+			g.types[name] = t
+			// Register before building so recursive types terminate
+			g.components[name] = nil
+			g.components[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	// Interfaces hold any JSON value
+	return map[string]interface{}{}
+}
+
+// object builds the schema of a struct from its JSON encoding
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	g.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the encoded fields of t, flattening embedded structs as
+// encoding/json does
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// componentName names the schema of a struct after its package, unless its
+// name already starts with it, in the singular or plural: location.Status is
+// LocationStatus but location.Location stays Location and logs.LogSizesResult
+// stays LogSizesResult. Types of this package keep their name.
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	if pkg == "api" || strings.HasPrefix(strings.ToLower(t.Name()), strings.TrimSuffix(strings.ToLower(pkg), "s")) {
+		return t.Name()
+	}
+	runes := []rune(pkg)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes) + t.Name()
+}
@@ -0,0 +1,433 @@
+package api
+
+import "time"
+
+// Log sources
+const (
+	SourceAccess = "access"
+	SourceError  = "error"
+)
+
+// Root is served at / and names the API versions the agent supports
+type Root struct {
+	Status      string   `json:"status"`
+	Service     string   `json:"service"`
+	Version     string   `json:"version"`
+	APIVersions []string `json:"api_versions"`
+}
+
+// Status reports whether the configured log paths exist
+type Status struct {
+	Status string `json:"status"`
+	// Version is the agent's version; v1 leaves it out
+	Version          string `json:"version,omitempty"`
+	AccessPath       string `json:"access_path"`
+	AccessPathExists bool   `json:"access_path_exists"`
+	ErrorPath        string `json:"error_path"`
+	ErrorPathExists  bool   `json:"error_path_exists"`
+	SystemMonitoring bool   `json:"system_monitoring"`
+	AuthEnabled      bool   `json:"auth_enabled"`
+}
+
+// LogPage is a window of lines from one log file. Page.NextCursor reads on in
+// the requested direction, so polling it on the current file follows new lines.
+type LogPage struct {
+	Source     string   `json:"source"`
+	File       string   `json:"file"`
+	Lines      []string `json:"lines"`
+	Compressed bool     `json:"compressed,omitempty"`
+	// Locations maps client IPs in Lines to their location when requested with geo=true
+	Locations map[string]Location `json:"locations,omitempty"`
+	Page      Page                `json:"page"`
+}
+
+// LogFiles lists the files of a log source, including rotated and compressed ones
+type LogFiles struct {
+	Source string    `json:"source"`
+	Files  []LogFile `json:"files"`
+	Page   Page      `json:"page"`
+}
+
+// Routes lists the busiest route templates in the recent access logs
+type Routes struct {
+	Routes    []RouteStat     `json:"routes"`
+	Templates []RouteTemplate `json:"templates"`
+	// Total is the number of entries aggregated
+	Total int `json:"total"`
+}
+
+// ASNs lists traffic by autonomous system in the recent access logs
+type ASNs struct {
+	ASNs  []ASNStat `json:"asns"`
+	Total int       `json:"total"`
+}
+
+// GeoStats lists traffic by country, or by city when Cities is set
+type GeoStats struct {
+	Countries []GeoStat `json:"countries,omitempty"`
+	Cities    []GeoStat `json:"cities,omitempty"`
+	// Total is the number of requests counted
+	Total int       `json:"total"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+}
+
+// LocationLookupRequest is the body of a location lookup
+type LocationLookupRequest struct {
+	IPs []string `json:"ips"`
+}
+
+// LocationLookup holds the locations of the requested IPs
+type LocationLookup struct {
+	Locations []Location `json:"locations"`
+	Count     int        `json:"count"`
+}
+
+// GeoIPStatus reports the GeoIP databases and lookup cache
+type GeoIPStatus struct {
+	Enabled      bool   `json:"enabled"`
+	Available    bool   `json:"available"`
+	CityDB       string `json:"city_db"`
+	CountryDB    string `json:"country_db"`
+	ASNDB        string `json:"asn_db"`
+	ASNAvailable bool   `json:"asn_available"`
+	// Databases, LastReload and Cache are set when GeoIP is enabled
+	Databases  *GeoIPDatabases `json:"databases,omitempty"`
+	LastReload *time.Time      `json:"last_reload,omitempty"`
+	Cache      *GeoIPCache     `json:"cache,omitempty"`
+}
+
+// GeoIPDatabases reports each GeoIP database
+type GeoIPDatabases struct {
+	City    GeoIPDatabase `json:"city"`
+	Country GeoIPDatabase `json:"country"`
+	ASN     GeoIPDatabase `json:"asn"`
+}
+
+// Findings lists security findings, most recent first
+type Findings struct {
+	Findings []SecurityFinding `json:"findings"`
+	Page     Page              `json:"page"`
+}
+
+// Blocklist lists the blocked IPs and where they are written. Removed holds
+// the entries removed by hand, most recently removed first, and is not paged.
+type Blocklist struct {
+	Entries    []BlocklistEntry `json:"entries"`
+	Removed    []BlocklistEntry `json:"removed"`
+	Output     string           `json:"output"`
+	Middleware string           `json:"middleware"`
+	Page       Page             `json:"page"`
+}
+
+// BlocklistRequest is the body of the block list endpoints; TTL and Pinned
+// only apply when adding
+type BlocklistRequest struct {
+	IP     string `json:"ip"`
+	Reason string `json:"reason"`
+	TTL    string `json:"ttl,omitempty"`
+	Pinned bool   `json:"pinned,omitempty"`
+}
+
+// AuditRecord describes one request served to an authenticated caller
+type AuditRecord struct {
+	Time       time.Time         `json:"time"`
+	KeyID      string            `json:"key_id"`
+	Method     string            `json:"method"`
+	Endpoint   string            `json:"endpoint"`
+	Filters    map[string]string `json:"filters,omitempty"`
+	TimeRange  map[string]string `json:"time_range,omitempty"`
+	Status     int               `json:"status"`
+	Rows       int               `json:"rows"`
+	ClientAddr string            `json:"client_addr"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// AuditRecords lists recorded requests, newest first
+type AuditRecords struct {
+	Records []AuditRecord `json:"records"`
+	Page    Page          `json:"page"`
+}
+
+// SearchResults lists the log entries matching a search, newest first. Each
+// names the file and byte offset of its line, which /api/logs/get reads on from.
+type SearchResults struct {
+	Query   string      `json:"query"`
+	Results []SearchDoc `json:"results"`
+	Count   int         `json:"count"`
+	// Truncated is set when more entries matched than the limit
+	Truncated bool `json:"truncated"`
+	// IndexedFrom is the time of the oldest entry in the index
+	IndexedFrom *time.Time `json:"indexed_from,omitempty"`
+}
+
+// AgentStats reports the agent's own health
+type AgentStats struct {
+	StartedAt     time.Time    `json:"started_at"`
+	UptimeSeconds int64        `json:"uptime_seconds"`
+	Ingest        IngestStats  `json:"ingest"`
+	Storage       StorageStats `json:"storage"`
+	Runtime       RuntimeStats `json:"runtime"`
+}
+
+// IngestStats reports how far ingestion is behind each access log; the
+// totals sum the sources, except LagSeconds which is the largest lag
+type IngestStats struct {
+	Enabled     bool           `json:"enabled"`
+	Sources     []IngestSource `json:"sources,omitempty"`
+	Lines       int64          `json:"lines"`
+	ParseErrors int64          `json:"parse_errors"`
+	LinesPerSec float64        `json:"lines_per_second"`
+	LagBytes    int64          `json:"lag_bytes"`
+	LagSeconds  float64        `json:"lag_seconds"`
+}
+
+// StorageStats reports the disk space used by the files the agent writes
+type StorageStats struct {
+	Files      []StorageFile `json:"files"`
+	TotalBytes int64         `json:"total_bytes"`
+}
+
+// StorageFile is a file written by the agent, named after the setting that configures it
+type StorageFile struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// RuntimeStats reports the Go runtime's memory and scheduler statistics
+type RuntimeStats struct {
+	GoVersion      string  `json:"go_version"`
+	Goroutines     int     `json:"goroutines"`
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64  `json:"heap_inuse_bytes"`
+	SysBytes       uint64  `json:"sys_bytes"`
+	GCCycles       uint32  `json:"gc_cycles"`
+	GCPauseTotalMs float64 `json:"gc_pause_total_ms"`
+	GCCPUFraction  float64 `json:"gc_cpu_fraction"`
+	NextGCBytes    uint64  `json:"next_gc_bytes"`
+	// LastGC and LastGCPauseMs are set once a collection has run
+	LastGC        *time.Time `json:"last_gc,omitempty"`
+	LastGCPauseMs float64    `json:"last_gc_pause_ms,omitempty"`
+}
+
+// LogFile describes a log file that may be read
+type LogFile struct {
+	Name       string    `json:"name"`
+	Source     string    `json:"source"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+	Compressed bool      `json:"compressed"`
+	// Active is false for rotated files that are no longer written to
+	Active bool `json:"active"`
+}
+
+// LogSizes reports the sizes of the access log files
+type LogSizes struct {
+	Files   []LogFileSize   `json:"files"`
+	Summary LogFilesSummary `json:"summary"`
+}
+
+// LogFileSize is the size of one log file
+type LogFileSize struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Extension string `json:"extension"`
+}
+
+// LogFilesSummary totals the sizes of the log files
+type LogFilesSummary struct {
+	TotalSize            int64 `json:"total_size"`
+	LogFilesSize         int64 `json:"log_files_size"`
+	CompressedFilesSize  int64 `json:"compressed_files_size"`
+	TotalFiles           int   `json:"total_files"`
+	LogFilesCount        int   `json:"log_files_count"`
+	CompressedFilesCount int   `json:"compressed_files_count"`
+}
+
+// RouteStat is the traffic of one route template
+type RouteStat struct {
+	Method      string  `json:"method"`
+	Template    string  `json:"template"`
+	Count       int     `json:"count"`
+	Errors      int     `json:"errors"`
+	AvgDuration float64 `json:"avg_duration_ms"`
+}
+
+// RouteTemplate is a path template learned from traffic
+type RouteTemplate struct {
+	Template string `json:"template"`
+	Distinct int    `json:"distinct"`
+}
+
+// UserAgents breaks requests down by browser, OS, device class and bot
+type UserAgents struct {
+	Total         int         `json:"total"`
+	Humans        int         `json:"humans"`
+	Bots          int         `json:"bots"`
+	BotPercent    float64     `json:"bot_percent"`
+	Browsers      []NameCount `json:"browsers"`
+	OS            []NameCount `json:"os"`
+	Devices       []NameCount `json:"devices"`
+	BotNames      []NameCount `json:"bot_names"`
+	BotCategories []NameCount `json:"bot_categories"`
+}
+
+// NameCount is the number of requests of one browser, OS, device or bot
+type NameCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Location is the geolocation of an IP address
+type Location struct {
+	IPAddress    string  `json:"ipAddress"`
+	Country      string  `json:"country,omitempty"`
+	City         string  `json:"city,omitempty"`
+	Latitude     float64 `json:"latitude,omitempty"`
+	Longitude    float64 `json:"longitude,omitempty"`
+	ASN          uint    `json:"asn,omitempty"`
+	Organization string  `json:"organization,omitempty"`
+}
+
+// ASNStat is the traffic of one autonomous system
+type ASNStat struct {
+	ASN          uint   `json:"asn"`
+	Organization string `json:"organization"`
+	Requests     int    `json:"requests"`
+	Errors       int    `json:"errors"`
+	Bytes        int64  `json:"bytes"`
+	UniqueIPs    int    `json:"unique_ips"`
+}
+
+// GeoStat is the traffic of one country or city
+type GeoStat struct {
+	Country   string  `json:"country"`
+	City      string  `json:"city,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	Bytes     int64   `json:"bytes"`
+}
+
+// GeoIPDatabase reports the state of a single MaxMind database
+type GeoIPDatabase struct {
+	Path     string     `json:"path"`
+	Loaded   bool       `json:"loaded"`
+	Modified *time.Time `json:"modified,omitempty"`
+}
+
+// GeoIPCache reports the lookup cache counters
+type GeoIPCache struct {
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+}
+
+// SecurityFinding describes suspicious activity from a single client IP
+type SecurityFinding struct {
+	ID          string           `json:"id"`
+	Type        string           `json:"type"`
+	Severity    string           `json:"severity"`
+	ClientIP    string           `json:"client_ip"`
+	Description string           `json:"description"`
+	Count       int              `json:"count"`
+	FirstSeen   time.Time        `json:"first_seen"`
+	LastSeen    time.Time        `json:"last_seen"`
+	Window      string           `json:"window"`
+	Evidence    SecurityEvidence `json:"evidence"`
+}
+
+// SecurityEvidence supports a finding with the data it was raised from
+type SecurityEvidence struct {
+	Samples     []string    `json:"samples"`
+	Paths       []string    `json:"paths,omitempty"`
+	StatusCodes map[int]int `json:"status_codes,omitempty"`
+	Rule        string      `json:"rule,omitempty"`
+}
+
+// BlocklistEntry is a blocked IP address or network
+type BlocklistEntry struct {
+	IP          string           `json:"ip"`
+	Reason      string           `json:"reason"`
+	Source      string           `json:"source"`
+	FindingID   string           `json:"finding_id,omitempty"`
+	AddedAt     time.Time        `json:"added_at"`
+	LastTrigger time.Time        `json:"last_trigger"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty"`
+	Pinned      bool             `json:"pinned"`
+	Audit       []BlocklistEvent `json:"audit"`
+}
+
+// BlocklistEvent is a change to a block list entry
+type BlocklistEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason"`
+	Actor  string    `json:"actor"`
+}
+
+// SearchDoc is an indexed log entry
+type SearchDoc struct {
+	Source string `json:"source"`
+	// File is the name of the file the entry was read from, as listed by
+	// /api/logs/files, and Offset the byte offset of its line
+	File   string            `json:"file"`
+	Offset int64             `json:"offset"`
+	Time   time.Time         `json:"time"`
+	Fields map[string]string `json:"fields"`
+}
+
+// IngestSource reports how much of a file ingestion has read and how far
+// behind its end it is
+type IngestSource struct {
+	Source      string  `json:"source"`
+	Lines       int64   `json:"lines"`
+	ParseErrors int64   `json:"parse_errors"`
+	LinesPerSec float64 `json:"lines_per_second"`
+	Offset      int64   `json:"offset"`
+	Size        int64   `json:"size"`
+	LagBytes    int64   `json:"lag_bytes"`
+	// LagSeconds is how much older the last entry read is than the last write
+	// to the file; zero when the file has been read to its end
+	LagSeconds float64   `json:"lag_seconds"`
+	LastEntry  time.Time `json:"last_entry,omitempty"`
+	LastRead   time.Time `json:"last_read,omitempty"`
+}
+
+// SystemInfo reports the CPU, memory and disk usage of the agent's host
+type SystemInfo struct {
+	Uptime    int64       `json:"uptime"`
+	Timestamp string      `json:"timestamp"`
+	CPU       CPUStats    `json:"cpu"`
+	Memory    MemoryStats `json:"memory"`
+	Disk      DiskStats   `json:"disk"`
+}
+
+// CPUStats reports CPU usage
+type CPUStats struct {
+	Model        string    `json:"model"`
+	Cores        int       `json:"cores"`
+	Speed        float64   `json:"speed"`
+	UsagePercent float64   `json:"usage_percent"`
+	CoreUsage    []float64 `json:"coreUsage"`
+}
+
+// MemoryStats reports memory usage
+type MemoryStats struct {
+	Free        uint64  `json:"free"`
+	Available   uint64  `json:"available"`
+	Used        uint64  `json:"used"`
+	Total       uint64  `json:"total"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// DiskStats reports usage of the root disk
+type DiskStats struct {
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	UsedPercent float64 `json:"used_percent"`
+}
@@ -0,0 +1,577 @@
+package blocklist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/fsutil"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/security"
+)
+
+var log = logger.With("blocklist")
+
+// Entry sources
+const (
+	SourceFinding = "finding"
+	SourceManual  = "manual"
+)
+
+// Audit actions
+const (
+	ActionAdded    = "added"
+	ActionPinned   = "pinned"
+	ActionUnpinned = "unpinned"
+	ActionRemoved  = "removed"
+)
+
+// maxAuditEvents bounds the audit trail kept per entry
+const maxAuditEvents = 50
+
+// maxRemovedEntries bounds the removed entries kept with their audit trail
+const maxRemovedEntries = 100
+
+var (
+	// ErrNotFound is returned when an IP is not on the block list
+	ErrNotFound = errors.New("ip is not on the block list")
+	// ErrInvalidAddress is returned when an IP or CIDR cannot be parsed
+	ErrInvalidAddress = errors.New("invalid IP address or CIDR")
+	// ErrAllowed is returned when an IP or CIDR overlaps the never-block allow list
+	ErrAllowed = errors.New("address is on the never-block allow list")
+)
+
+// Config configures the block list and the generated Traefik configuration
+type Config struct {
+	// OutputPath is the Traefik dynamic configuration file; .toml selects TOML, anything else YAML
+	OutputPath string
+	// StatePath persists entries and their audit trail across restarts
+	StatePath string
+	// TTL is how long automatically added entries stay blocked after their finding was last seen
+	TTL time.Duration
+	// MinSeverity is the lowest finding severity that is blocked automatically
+	MinSeverity string
+	// MiddlewareName is the name of the generated middleware
+	MiddlewareName string
+	// PluginName is the deny plugin referenced by the middleware
+	PluginName string
+	// Allow lists IPs and CIDRs that are never blocked, such as the trusted proxies
+	Allow []string
+}
+
+// AuditEvent records why an entry changed
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason"`
+	Actor  string    `json:"actor"`
+}
+
+// Entry is a blocked IP address or network
+type Entry struct {
+	IP          string       `json:"ip"`
+	Reason      string       `json:"reason"`
+	Source      string       `json:"source"`
+	FindingID   string       `json:"finding_id,omitempty"`
+	AddedAt     time.Time    `json:"added_at"`
+	LastTrigger time.Time    `json:"last_trigger"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"`
+	Pinned      bool         `json:"pinned"`
+	Audit       []AuditEvent `json:"audit"`
+}
+
+// state is the persisted form of the block list
+type state struct {
+	Entries map[string]*Entry    `json:"entries"`
+	Removed map[string]time.Time `json:"removed"`
+	History []*Entry             `json:"history,omitempty"`
+}
+
+// FindingSource provides the findings the block list is synchronised from
+type FindingSource interface {
+	Findings(q security.Query) []security.Finding
+}
+
+// Manager maintains the block list and writes it as Traefik dynamic configuration
+type Manager struct {
+	cfg Config
+	// allow holds the parsed never-block allow list
+	allow []netip.Prefix
+
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	// removed remembers manual removals so active findings do not immediately re-add them
+	removed map[string]time.Time
+	// history keeps manually removed entries and their audit trail, oldest first
+	history []*Entry
+
+	// writeMu serialises writes of the state and configuration files
+	writeMu sync.Mutex
+}
+
+// New creates a manager, loading any persisted state
+func New(cfg Config) (*Manager, error) {
+	if cfg.OutputPath == "" {
+		return nil, errors.New("block list output path is required")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.MinSeverity == "" {
+		cfg.MinSeverity = security.SeverityHigh
+	}
+	if cfg.MiddlewareName == "" {
+		cfg.MiddlewareName = "traefik-log-dashboard-blocklist"
+	}
+	if cfg.PluginName == "" {
+		cfg.PluginName = "denyip"
+	}
+
+	m := &Manager{
+		cfg:     cfg,
+		entries: make(map[string]*Entry),
+		removed: make(map[string]time.Time),
+	}
+
+	for _, value := range cfg.Allow {
+		cidr, err := normalize(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block list allow entry: %w", err)
+		}
+		m.allow = append(m.allow, netip.MustParsePrefix(cidr))
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	// Write the configuration right away so the middleware exists before anything is blocked
+	if err := m.persist(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Entries returns the current block list sorted by IP
+func (m *Manager) Entries() []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		e := *entry
+		e.Audit = append([]AuditEvent(nil), entry.Audit...)
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].IP < entries[j].IP
+	})
+
+	return entries
+}
+
+// History returns the manually removed entries with their audit trail, most
+// recently removed first
+func (m *Manager) History() []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(m.history))
+	for i := len(m.history) - 1; i >= 0; i-- {
+		e := *m.history[i]
+		e.Audit = append([]AuditEvent(nil), m.history[i].Audit...)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Add blocks an IP or CIDR manually for ttl, or until unpinned when pinned is set
+func (m *Manager) Add(ip, reason, actor string, ttl time.Duration, pinned bool) (Entry, error) {
+	cidr, err := normalize(ip)
+	if err != nil {
+		return Entry{}, err
+	}
+	if m.allowed(cidr) {
+		return Entry{}, fmt.Errorf("%w: %q", ErrAllowed, cidr)
+	}
+	if ttl <= 0 {
+		ttl = m.cfg.TTL
+	}
+
+	now := time.Now().UTC()
+
+	m.mu.Lock()
+	entry, exists := m.entries[cidr]
+	if !exists {
+		entry = &Entry{IP: cidr, Source: SourceManual, AddedAt: now}
+		m.entries[cidr] = entry
+	}
+	entry.Reason = reason
+	entry.LastTrigger = now
+	entry.Pinned = entry.Pinned || pinned
+	if entry.Pinned {
+		entry.ExpiresAt = nil
+	} else {
+		expires := now.Add(ttl)
+		entry.ExpiresAt = &expires
+	}
+	action := ActionAdded
+	if pinned {
+		action = ActionPinned
+	}
+	appendAudit(entry, AuditEvent{Time: now, Action: action, Reason: reason, Actor: actor})
+	delete(m.removed, cidr)
+	result := *entry
+	m.mu.Unlock()
+
+	return result, m.persist()
+}
+
+// Pin keeps an IP blocked until it is unpinned, adding it if needed
+func (m *Manager) Pin(ip, reason, actor string) (Entry, error) {
+	return m.Add(ip, reason, actor, 0, true)
+}
+
+// Unpin lets an entry expire again after the configured TTL
+func (m *Manager) Unpin(ip, reason, actor string) (Entry, error) {
+	cidr, err := normalize(ip)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	now := time.Now().UTC()
+
+	m.mu.Lock()
+	entry, exists := m.entries[cidr]
+	if !exists {
+		m.mu.Unlock()
+		return Entry{}, ErrNotFound
+	}
+	entry.Pinned = false
+	expires := now.Add(m.cfg.TTL)
+	entry.ExpiresAt = &expires
+	appendAudit(entry, AuditEvent{Time: now, Action: ActionUnpinned, Reason: reason, Actor: actor})
+	result := *entry
+	m.mu.Unlock()
+
+	return result, m.persist()
+}
+
+// Remove unblocks an IP immediately. The entry and its audit trail are kept
+// in the history.
+func (m *Manager) Remove(ip, reason, actor string) error {
+	cidr, err := normalize(ip)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	m.mu.Lock()
+	entry, exists := m.entries[cidr]
+	if !exists {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(m.entries, cidr)
+	m.removed[cidr] = now
+	appendAudit(entry, AuditEvent{Time: now, Action: ActionRemoved, Reason: reason, Actor: actor})
+	m.history = append(m.history, entry)
+	if len(m.history) > maxRemovedEntries {
+		m.history = m.history[len(m.history)-maxRemovedEntries:]
+	}
+	m.mu.Unlock()
+
+	log.Info("Removed block list entry", "cidr", cidr, "actor", actor, "reason", reason)
+	return m.persist()
+}
+
+// Sync blocks the IPs of findings at or above the minimum severity and expires
+// stale entries. Findings for allow-listed or special-purpose addresses, such as
+// loopback or private networks, are never blocked.
+func (m *Manager) Sync(findings []security.Finding) error {
+	now := time.Now().UTC()
+	minRank := severityRank(m.cfg.MinSeverity)
+
+	changed := false
+
+	m.mu.Lock()
+	for _, f := range findings {
+		if severityRank(f.Severity) < minRank {
+			continue
+		}
+
+		cidr, err := normalize(f.ClientIP)
+		if err != nil || m.exempt(cidr) {
+			continue
+		}
+
+		if removedAt, ok := m.removed[cidr]; ok && !f.LastSeen.After(removedAt) {
+			continue
+		}
+
+		expires := f.LastSeen.Add(m.cfg.TTL)
+		entry, exists := m.entries[cidr]
+		if !exists && !expires.After(now) {
+			// Last seen too long ago to block
+			continue
+		}
+		if !exists {
+			reason := fmt.Sprintf("%s finding (%s): %s", f.Type, f.Severity, f.Description)
+			entry = &Entry{
+				IP:        cidr,
+				Reason:    reason,
+				Source:    SourceFinding,
+				FindingID: f.ID,
+				AddedAt:   now,
+			}
+			appendAudit(entry, AuditEvent{Time: now, Action: ActionAdded, Reason: reason, Actor: "detector"})
+			m.entries[cidr] = entry
+			changed = true
+			log.Info("Added block list entry", "cidr", cidr, "reason", reason, "finding", f.ID)
+		}
+
+		if f.LastSeen.After(entry.LastTrigger) {
+			entry.LastTrigger = f.LastSeen
+			changed = true
+		}
+		if !entry.Pinned && (entry.ExpiresAt == nil || expires.After(*entry.ExpiresAt)) {
+			entry.ExpiresAt = &expires
+			changed = true
+		}
+	}
+
+	for cidr, entry := range m.entries {
+		if entry.Source == SourceFinding && !entry.Pinned && m.exempt(cidr) {
+			// Added before the address was allow-listed
+			delete(m.entries, cidr)
+			changed = true
+			log.Info("Removed allow-listed block list entry", "cidr", cidr)
+			continue
+		}
+		if entry.Pinned || entry.ExpiresAt == nil || now.Before(*entry.ExpiresAt) {
+			continue
+		}
+		delete(m.entries, cidr)
+		changed = true
+		log.Info("Expired block list entry", "cidr", cidr)
+	}
+
+	for cidr, removedAt := range m.removed {
+		if now.Sub(removedAt) > m.cfg.TTL {
+			delete(m.removed, cidr)
+		}
+	}
+	m.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return m.persist()
+}
+
+// Run synchronises the block list from the finding source until the context is cancelled
+func (m *Manager) Run(ctx context.Context, source FindingSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Sync(source.Findings(security.Query{})); err != nil {
+			log.Error("Failed to sync block list", logger.KeyPath, m.cfg.OutputPath, logger.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// OutputPath returns the path of the generated Traefik configuration
+func (m *Manager) OutputPath() string {
+	return m.cfg.OutputPath
+}
+
+// MiddlewareName returns the name of the generated middleware
+func (m *Manager) MiddlewareName() string {
+	return m.cfg.MiddlewareName
+}
+
+// load reads persisted state if present
+func (m *Manager) load() error {
+	if m.cfg.StatePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(m.cfg.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read block list state: %w", err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("failed to parse block list state: %w", err)
+	}
+
+	if st.Entries != nil {
+		m.entries = st.Entries
+	}
+	if st.Removed != nil {
+		m.removed = st.Removed
+	}
+	m.history = st.History
+
+	log.Info("Loaded block list", logger.KeyPath, m.cfg.StatePath, "entries", len(m.entries))
+	return nil
+}
+
+// persist writes the state file and the Traefik configuration
+func (m *Manager) persist() error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	m.mu.RLock()
+	stateData, err := json.MarshalIndent(state{Entries: m.entries, Removed: m.removed, History: m.history}, "", "  ")
+	ips := make([]string, 0, len(m.entries))
+	for cidr := range m.entries {
+		ips = append(ips, cidr)
+	}
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(ips)
+
+	if m.cfg.StatePath != "" {
+		if err := writeAtomic(m.cfg.StatePath, stateData); err != nil {
+			return fmt.Errorf("failed to write block list state: %w", err)
+		}
+	}
+
+	if err := writeAtomic(m.cfg.OutputPath, []byte(m.render(ips))); err != nil {
+		return fmt.Errorf("failed to write Traefik configuration: %w", err)
+	}
+
+	return nil
+}
+
+// render builds the Traefik dynamic configuration for the blocked networks
+func (m *Manager) render(ips []string) string {
+	var sb strings.Builder
+
+	quoted := make([]string, len(ips))
+	for i, ip := range ips {
+		quoted[i] = fmt.Sprintf("%q", ip)
+	}
+
+	if strings.EqualFold(filepath.Ext(m.cfg.OutputPath), ".toml") {
+		sb.WriteString("# Generated by traefik-log-dashboard agent. Do not edit; use the block list API.\n")
+		fmt.Fprintf(&sb, "[http.middlewares.%s.plugin.%s]\n", m.cfg.MiddlewareName, m.cfg.PluginName)
+		fmt.Fprintf(&sb, "  ipDenyList = [%s]\n", strings.Join(quoted, ", "))
+		return sb.String()
+	}
+
+	sb.WriteString("# Generated by traefik-log-dashboard agent. Do not edit; use the block list API.\n")
+	sb.WriteString("http:\n")
+	sb.WriteString("  middlewares:\n")
+	fmt.Fprintf(&sb, "    %s:\n", m.cfg.MiddlewareName)
+	sb.WriteString("      plugin:\n")
+	fmt.Fprintf(&sb, "        %s:\n", m.cfg.PluginName)
+	if len(quoted) == 0 {
+		sb.WriteString("          ipDenyList: []\n")
+		return sb.String()
+	}
+	sb.WriteString("          ipDenyList:\n")
+	for _, ip := range quoted {
+		fmt.Fprintf(&sb, "            - %s\n", ip)
+	}
+	return sb.String()
+}
+
+// allowed reports whether a normalized CIDR overlaps the allow list
+func (m *Manager) allowed(cidr string) bool {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return false
+	}
+	for _, allow := range m.allow {
+		if allow.Overlaps(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// exempt reports whether a normalized CIDR must not be blocked automatically:
+// it overlaps the allow list or starts in a special-purpose range
+func (m *Manager) exempt(cidr string) bool {
+	if m.allowed(cidr) {
+		return true
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	return err == nil && location.IsSpecialPurpose(prefix.Addr())
+}
+
+// normalize converts an IP or CIDR into canonical CIDR notation
+func normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q", ErrInvalidAddress, value)
+		}
+		return network.String(), nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidAddress, value)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String() + "/32", nil
+	}
+	return ip.String() + "/128", nil
+}
+
+// severityRank orders severities from low to high
+func severityRank(severity string) int {
+	switch severity {
+	case security.SeverityHigh:
+		return 3
+	case security.SeverityMedium:
+		return 2
+	case security.SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+// appendAudit records an audit event, keeping only the most recent events
+func appendAudit(entry *Entry, event AuditEvent) {
+	entry.Audit = append(entry.Audit, event)
+	if len(entry.Audit) > maxAuditEvents {
+		entry.Audit = entry.Audit[len(entry.Audit)-maxAuditEvents:]
+	}
+}
+
+// writeAtomic writes data to a temporary file, syncs it and renames it into place
+func writeAtomic(path string, data []byte) error {
+	return fsutil.WriteFileAtomic(path, data, 0644)
+}
@@ -0,0 +1,213 @@
+package blocklist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/security"
+)
+
+// newManager creates a manager writing into a temporary directory
+func newManager(t *testing.T, cfg Config) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	if cfg.OutputPath == "" {
+		cfg.OutputPath = dir + "/blocklist.yml"
+	}
+	if cfg.StatePath == "" {
+		cfg.StatePath = dir + "/blocklist.json"
+	}
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create block list: %v", err)
+	}
+	return m
+}
+
+// finding returns a high severity finding for ip last seen at lastSeen
+func finding(ip string, lastSeen time.Time) security.Finding {
+	return security.Finding{
+		ID:       security.TypeExploitProbe + "-" + ip,
+		Type:     security.TypeExploitProbe,
+		Severity: security.SeverityHigh,
+		ClientIP: ip,
+		LastSeen: lastSeen,
+	}
+}
+
+func TestSync(t *testing.T) {
+	m := newManager(t, Config{Allow: []string{"93.184.216.0/24"}})
+	now := time.Now().UTC()
+
+	low := finding("45.33.32.10", now)
+	low.Severity = security.SeverityLow
+	if err := m.Sync([]security.Finding{
+		finding("45.33.32.9", now),
+		finding("2606:4700::1111", now),
+		low,
+		// Allow-listed and special-purpose addresses are never blocked
+		finding("93.184.216.34", now),
+		finding("10.0.0.5", now),
+		finding("127.0.0.1", now),
+	}); err != nil {
+		t.Fatalf("Failed to sync findings: %v", err)
+	}
+
+	output, err := os.ReadFile(m.OutputPath())
+	if err != nil {
+		t.Fatalf("Failed to read generated configuration: %v", err)
+	}
+	for _, ip := range []string{`"45.33.32.9/32"`, `"2606:4700::1111/128"`} {
+		if !strings.Contains(string(output), ip) {
+			t.Errorf("Expected %s in generated configuration:\n%s", ip, output)
+		}
+	}
+	for _, ip := range []string{"45.33.32.10", "93.184.216.34", "10.0.0.5", "127.0.0.1"} {
+		if strings.Contains(string(output), ip) {
+			t.Errorf("Expected %s to be left out of generated configuration:\n%s", ip, output)
+		}
+	}
+
+	entries := m.Entries()
+	if len(entries) != 2 || entries[1].Source != SourceFinding || entries[1].ExpiresAt == nil || len(entries[1].Audit) != 1 {
+		t.Errorf("Expected two entries added from findings, got %+v", entries)
+	}
+
+	// A manually removed IP is not re-added until its finding is seen again
+	if err := m.Remove("45.33.32.9", "false positive", "admin"); err != nil {
+		t.Fatalf("Failed to remove entry: %v", err)
+	}
+	if err := m.Sync([]security.Finding{finding("45.33.32.9", now)}); err != nil {
+		t.Fatalf("Failed to sync findings: %v", err)
+	}
+	if entries := m.Entries(); len(entries) != 1 {
+		t.Errorf("Expected the removed entry to stay removed, got %+v", entries)
+	}
+	if err := m.Sync([]security.Finding{finding("45.33.32.9", time.Now().UTC().Add(time.Second))}); err != nil {
+		t.Fatalf("Failed to sync findings: %v", err)
+	}
+	if entries := m.Entries(); len(entries) != 2 {
+		t.Errorf("Expected a newer finding to block the IP again, got %+v", entries)
+	}
+}
+
+func TestSyncStaleFindings(t *testing.T) {
+	m := newManager(t, Config{TTL: time.Hour})
+	if err := os.Remove(m.OutputPath()); err != nil {
+		t.Fatalf("Failed to remove generated configuration: %v", err)
+	}
+
+	// A finding last seen before the TTL is neither added nor rewritten on every sync
+	stale := finding("45.33.32.9", time.Now().UTC().Add(-2*time.Hour))
+	for i := 0; i < 2; i++ {
+		if err := m.Sync([]security.Finding{stale}); err != nil {
+			t.Fatalf("Failed to sync findings: %v", err)
+		}
+		if entries := m.Entries(); len(entries) != 0 {
+			t.Errorf("Expected no entry for a stale finding, got %+v", entries)
+		}
+		if _, err := os.Stat(m.OutputPath()); !os.IsNotExist(err) {
+			t.Errorf("Expected the configuration not to be rewritten, got %v", err)
+		}
+	}
+}
+
+func TestManualEntries(t *testing.T) {
+	m := newManager(t, Config{Allow: []string{"93.184.216.0/24"}, MiddlewareName: "deny", PluginName: "denyip"})
+
+	if _, err := m.Pin("203.0.113.0/24", "credential stuffing", "admin"); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+	if _, err := m.Add("198.51.100.7", "manual", "admin", time.Hour, false); err != nil {
+		t.Fatalf("Failed to add: %v", err)
+	}
+	if _, err := m.Pin("93.184.216.0/23", "", "admin"); !errors.Is(err, ErrAllowed) {
+		t.Errorf("Expected an allow-listed network to be refused, got %v", err)
+	}
+	if _, err := m.Pin("not an ip", "", "admin"); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Expected an invalid address to be refused, got %v", err)
+	}
+	if _, err := m.Unpin("192.0.2.1", "", "admin"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected unpinning an unknown IP to fail, got %v", err)
+	}
+
+	entry, err := m.Unpin("203.0.113.0/24", "resolved", "admin")
+	if err != nil {
+		t.Fatalf("Failed to unpin: %v", err)
+	}
+	if entry.Pinned || entry.ExpiresAt == nil || len(entry.Audit) != 2 || entry.Audit[1].Action != ActionUnpinned || entry.Audit[1].Actor != "admin" {
+		t.Errorf("Expected an unpinned entry with its audit trail, got %+v", entry)
+	}
+
+	// Removed entries keep their audit trail in the history
+	if err := m.Remove("198.51.100.7", "false positive", "oncall"); err != nil {
+		t.Fatalf("Failed to remove entry: %v", err)
+	}
+	if err := m.Remove("198.51.100.7", "", "oncall"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected removing a removed IP to fail, got %v", err)
+	}
+	history := m.History()
+	if len(history) != 1 || history[0].IP != "198.51.100.7/32" || len(history[0].Audit) != 2 {
+		t.Fatalf("Expected the removed entry in the history, got %+v", history)
+	}
+	if event := history[0].Audit[1]; event.Action != ActionRemoved || event.Reason != "false positive" || event.Actor != "oncall" {
+		t.Errorf("Expected the removal to be audited, got %+v", event)
+	}
+
+	// Entries, the history and their audit trail survive a restart
+	reloaded, err := New(m.cfg)
+	if err != nil {
+		t.Fatalf("Failed to reload block list: %v", err)
+	}
+	if entries := reloaded.Entries(); len(entries) != 1 || len(entries[0].Audit) != 2 {
+		t.Errorf("Expected the persisted entries, got %+v", entries)
+	}
+	if history := reloaded.History(); len(history) != 1 || history[0].Audit[1].Action != ActionRemoved {
+		t.Errorf("Expected the persisted history, got %+v", history)
+	}
+}
+
+func TestHistoryBounds(t *testing.T) {
+	m := newManager(t, Config{})
+	for i := 0; i <= maxRemovedEntries; i++ {
+		ip := fmt.Sprintf("198.51.%d.%d", i/256, i%256)
+		if _, err := m.Add(ip, "manual", "admin", time.Hour, false); err != nil {
+			t.Fatalf("Failed to add: %v", err)
+		}
+		if err := m.Remove(ip, "", "admin"); err != nil {
+			t.Fatalf("Failed to remove entry: %v", err)
+		}
+	}
+
+	history := m.History()
+	if len(history) != maxRemovedEntries {
+		t.Fatalf("Expected %d removed entries, got %d", maxRemovedEntries, len(history))
+	}
+	if history[0].IP != "198.51.0.100/32" || history[len(history)-1].IP != "198.51.0.1/32" {
+		t.Errorf("Expected the oldest removal to be dropped, got %s to %s", history[len(history)-1].IP, history[0].IP)
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	m := newManager(t, Config{OutputPath: dir + "/blocklist.toml", MiddlewareName: "deny", PluginName: "denyip"})
+	if _, err := m.Pin("203.0.113.7", "", "admin"); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+
+	output, err := os.ReadFile(dir + "/blocklist.toml")
+	if err != nil {
+		t.Fatalf("Failed to read generated configuration: %v", err)
+	}
+	if want := "[http.middlewares.deny.plugin.denyip]\n  ipDenyList = [\"203.0.113.7/32\"]\n"; !strings.HasSuffix(string(output), want) {
+		t.Errorf("Expected TOML configuration ending in %q, got:\n%s", want, output)
+	}
+
+	if got := newManager(t, Config{MiddlewareName: "deny"}).render(nil); !strings.Contains(got, "ipDenyList: []") {
+		t.Errorf("Expected an empty YAML deny list, got:\n%s", got)
+	}
+}
@@ -0,0 +1,296 @@
+// Package client is a Go client for the agent's /api/v2. It authenticates
+// with a bearer token, retries idempotent requests that fail transiently with
+// exponential backoff, and follows log files by polling their cursors. Every
+// call takes a context that cancels it, including the waits between retries.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+)
+
+// Defaults used for zero Config fields
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 250 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+	DefaultUserAgent  = "traefik-log-dashboard-client"
+)
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// Config configures a Client
+type Config struct {
+	// URL of the agent, such as http://localhost:5000
+	URL string
+	// Token is sent as a bearer token: the agent token, an API key or a JWT
+	Token string
+	// HTTPClient sends the requests; when nil a client with Timeout is used
+	HTTPClient *http.Client
+	// Timeout bounds each attempt of a request when HTTPClient is nil
+	Timeout time.Duration
+	// MaxRetries is how many times a failed idempotent request is retried;
+	// zero means DefaultMaxRetries and a negative value disables retries
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the wait between retries, which doubles
+	// after each attempt
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	UserAgent  string
+}
+
+// Client calls the agent's API. It is safe for concurrent use.
+type Client struct {
+	base       *url.URL
+	token      string
+	http       *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	userAgent  string
+}
+
+// New creates a client for the agent at cfg.URL
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid agent URL %q: scheme must be http or https", cfg.URL)
+	}
+
+	c := &Client{
+		base:       base,
+		token:      cfg.Token,
+		http:       cfg.HTTPClient,
+		maxRetries: cfg.MaxRetries,
+		minBackoff: cfg.MinBackoff,
+		maxBackoff: cfg.MaxBackoff,
+		userAgent:  cfg.UserAgent,
+	}
+	if c.http == nil {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		c.http = &http.Client{Timeout: timeout}
+	}
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = DefaultMaxRetries
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+	if c.minBackoff <= 0 {
+		c.minBackoff = DefaultMinBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = DefaultMaxBackoff
+	}
+	c.maxBackoff = max(c.maxBackoff, c.minBackoff)
+	if c.userAgent == "" {
+		c.userAgent = DefaultUserAgent
+	}
+	return c, nil
+}
+
+// call is a request to the API
+type call struct {
+	method string
+	// path is relative to the agent URL, such as /api/v2/status
+	path  string
+	query url.Values
+	body  interface{}
+	// idempotent calls are retried; GET and DELETE always are
+	idempotent bool
+}
+
+// do sends a request, retrying transient failures, and decodes the response
+// into out unless it is nil. Failed responses are returned as *api.Error.
+func (c *Client) do(ctx context.Context, req call, out interface{}) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+	}
+	retry := req.idempotent || req.method == http.MethodGet || req.method == http.MethodDelete
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !retry || attempt >= c.maxRetries {
+				return err
+			}
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			apiErr := decodeError(resp)
+			wait, ok := c.retryAfter(resp, apiErr, attempt)
+			resp.Body.Close()
+			if !retry || !ok || attempt >= c.maxRetries {
+				return apiErr
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		if out == nil || resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding %s %s: %w", req.method, req.path, err)
+		}
+		return nil
+	}
+}
+
+// send makes one attempt of a request
+func (c *Client) send(ctx context.Context, req call, body []byte) (*http.Response, error) {
+	target := *c.base
+	target.Path = c.base.Path + req.path
+	if len(req.query) > 0 {
+		target.RawQuery = req.query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(httpReq)
+}
+
+// retryAfter reports whether a failed response is worth retrying and how long
+// to wait first. Rate limiting and gateway errors are; a disabled feature isn't.
+func (c *Client) retryAfter(resp *http.Response, apiErr *api.Error, attempt int) (time.Duration, bool) {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusGatewayTimeout:
+	case http.StatusServiceUnavailable:
+		if apiErr.Code == api.CodeDisabled {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, c.maxBackoff), true
+	}
+	return c.backoff(attempt), true
+}
+
+// backoff returns the wait before retry attempt+1: exponential with jitter
+// so that clients failing together don't retry together
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.maxBackoff
+	if attempt < 30 {
+		wait = min(c.minBackoff<<attempt, c.maxBackoff)
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// decodeError reads a failed response as an *api.Error. Responses outside
+// the v2 envelope, such as those of a proxy in front of the agent, are
+// given a code matching their status.
+func decodeError(resp *http.Response) *api.Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	var envelope api.ErrorResponse
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil && envelope.Error.Code != "" {
+		if envelope.Error.Status == 0 {
+			envelope.Error.Status = resp.StatusCode
+		}
+		return envelope.Error
+	}
+
+	message := strings.TrimSpace(string(body))
+	var v1 struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &v1) == nil && v1.Error != "" {
+		message = v1.Error
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &api.Error{Status: resp.StatusCode, Code: codeForStatus(resp.StatusCode), Message: message}
+}
+
+// codeForStatus returns the error code the agent uses for a status
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return api.CodeInvalidParameter
+	case http.StatusUnauthorized:
+		return api.CodeUnauthorized
+	case http.StatusForbidden:
+		return api.CodeForbidden
+	case http.StatusNotFound:
+		return api.CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return api.CodeMethodNotAllowed
+	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return api.CodeUnavailable
+	}
+	return api.CodeInternal
+}
+
+// StatusCode returns the HTTP status of an error returned by the client, or
+// zero when the request got no response
+func StatusCode(err error) int {
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
@@ -0,0 +1,338 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+)
+
+// AccessFilter narrows the access log lines and statistics to some clients.
+// The zero value includes everything.
+type AccessFilter struct {
+	ExcludeBots bool
+	BotsOnly    bool
+	Browser     string
+	OS          string
+	Device      string
+	Bot         string
+}
+
+func (f AccessFilter) encode(query url.Values) {
+	setBool(query, "exclude_bots", f.ExcludeBots)
+	setBool(query, "bots_only", f.BotsOnly)
+	setString(query, "browser", f.Browser)
+	setString(query, "os", f.OS)
+	setString(query, "device", f.Device)
+	setString(query, "bot", f.Bot)
+}
+
+// LogQuery selects lines of the current access or error log
+type LogQuery struct {
+	// Cursor is the NextCursor of a previous page; empty reads the last lines
+	Cursor string
+	// Limit is the most lines returned; zero means the agent's default
+	Limit int
+	// Geo resolves the location of each client IP of access log lines
+	Geo    bool
+	Filter AccessFilter
+}
+
+func (q LogQuery) encode() url.Values {
+	query := url.Values{}
+	setString(query, "cursor", q.Cursor)
+	setInt(query, "limit", q.Limit)
+	setBool(query, "geo", q.Geo)
+	q.Filter.encode(query)
+	return query
+}
+
+// FileQuery selects lines of a file listed by LogFiles
+type FileQuery struct {
+	// Source is api.SourceAccess or SourceError; empty means access
+	Source string
+	File   string
+	// Backward reads from the end of the file towards its start
+	Backward bool
+	Cursor   string
+	Limit    int
+	Filter   AccessFilter
+}
+
+// ListQuery selects a page of a list; a zero Limit means the agent's default
+type ListQuery struct {
+	Offset int
+	Limit  int
+}
+
+func (q ListQuery) encode(query url.Values) {
+	setInt(query, "offset", q.Offset)
+	setInt(query, "limit", q.Limit)
+}
+
+// TimeRange selects a time range: From to To, or the Range ending at To.
+// The zero value is the last 24 hours.
+type TimeRange struct {
+	From  time.Time
+	To    time.Time
+	Range time.Duration
+}
+
+func (t TimeRange) encode(query url.Values) {
+	setTime(query, "from", t.From)
+	setTime(query, "to", t.To)
+	if t.Range > 0 {
+		query.Set("range", t.Range.String())
+	}
+}
+
+// FindingQuery selects security findings
+type FindingQuery struct {
+	Type     string
+	IP       string
+	Severity string
+	Since    time.Time
+	ListQuery
+}
+
+// AuditQuery selects audit records
+type AuditQuery struct {
+	KeyID    string
+	Endpoint string
+	Since    time.Time
+	Until    time.Time
+	ListQuery
+}
+
+// Root returns the service name, version and API versions of the agent
+func (c *Client) Root(ctx context.Context) (*api.Root, error) {
+	return send[api.Root](ctx, c, call{method: http.MethodGet, path: "/"})
+}
+
+// Status returns the agent's version and whether its log paths exist
+func (c *Client) Status(ctx context.Context) (*api.Status, error) {
+	return get[api.Status](ctx, c, "status", nil)
+}
+
+// OpenAPI returns the OpenAPI document of the API
+func (c *Client) OpenAPI(ctx context.Context) (api.Document, error) {
+	document, err := get[api.Document](ctx, c, "openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	return *document, nil
+}
+
+// AccessLogs returns lines of the current access log
+func (c *Client) AccessLogs(ctx context.Context, q LogQuery) (*api.LogPage, error) {
+	return c.Logs(ctx, api.SourceAccess, q)
+}
+
+// ErrorLogs returns lines of the current error log
+func (c *Client) ErrorLogs(ctx context.Context, q LogQuery) (*api.LogPage, error) {
+	return c.Logs(ctx, api.SourceError, q)
+}
+
+// Logs returns lines of the current file of a source, api.SourceAccess or SourceError
+func (c *Client) Logs(ctx context.Context, source string, q LogQuery) (*api.LogPage, error) {
+	return get[api.LogPage](ctx, c, "logs/"+source, q.encode())
+}
+
+// LogFiles lists the files of a source, including rotated and compressed ones
+func (c *Client) LogFiles(ctx context.Context, source string, q ListQuery) (*api.LogFiles, error) {
+	query := url.Values{}
+	setString(query, "source", source)
+	q.encode(query)
+	return get[api.LogFiles](ctx, c, "logs/files", query)
+}
+
+// LogFile returns lines of a file listed by LogFiles
+func (c *Client) LogFile(ctx context.Context, q FileQuery) (*api.LogPage, error) {
+	query := url.Values{}
+	setString(query, "source", q.Source)
+	query.Set("file", q.File)
+	if q.Backward {
+		query.Set("direction", "backward")
+	}
+	setString(query, "cursor", q.Cursor)
+	setInt(query, "limit", q.Limit)
+	q.Filter.encode(query)
+	return get[api.LogPage](ctx, c, "logs/get", query)
+}
+
+// Routes returns the busiest route templates in the recent access logs
+func (c *Client) Routes(ctx context.Context, limit int, filter AccessFilter) (*api.Routes, error) {
+	return get[api.Routes](ctx, c, "logs/routes", limitQuery(limit, filter))
+}
+
+// UserAgents returns requests by browser, OS, device class and bot in the recent access logs
+func (c *Client) UserAgents(ctx context.Context, limit int, filter AccessFilter) (*api.UserAgents, error) {
+	return get[api.UserAgents](ctx, c, "logs/useragents", limitQuery(limit, filter))
+}
+
+// LogSizes returns the sizes of the access log files
+func (c *Client) LogSizes(ctx context.Context) (*api.LogSizes, error) {
+	return get[api.LogSizes](ctx, c, "system/logs", nil)
+}
+
+// SystemResources returns the CPU, memory and disk usage of the agent's host
+func (c *Client) SystemResources(ctx context.Context) (*api.SystemInfo, error) {
+	return get[api.SystemInfo](ctx, c, "system/resources", nil)
+}
+
+// AgentStats returns the ingest lag, disk usage and runtime statistics of the agent
+func (c *Client) AgentStats(ctx context.Context) (*api.AgentStats, error) {
+	return get[api.AgentStats](ctx, c, "agent/stats", nil)
+}
+
+// LookupLocations returns the locations of up to 1000 IP addresses
+func (c *Client) LookupLocations(ctx context.Context, ips []string) ([]api.Location, error) {
+	// The lookup changes nothing, so it is retried like a GET
+	result, err := send[api.LocationLookup](ctx, c, call{
+		method:     http.MethodPost,
+		path:       api.PathPrefix + "location/lookup",
+		body:       api.LocationLookupRequest{IPs: ips},
+		idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Locations, nil
+}
+
+// GeoIPStatus returns the state of the GeoIP databases and lookup cache
+func (c *Client) GeoIPStatus(ctx context.Context) (*api.GeoIPStatus, error) {
+	return get[api.GeoIPStatus](ctx, c, "location/status", nil)
+}
+
+// ASNs returns traffic by autonomous system in the recent access logs
+func (c *Client) ASNs(ctx context.Context, limit int, filter AccessFilter) (*api.ASNs, error) {
+	return get[api.ASNs](ctx, c, "location/asn", limitQuery(limit, filter))
+}
+
+// Countries returns traffic by country over a time range
+func (c *Client) Countries(ctx context.Context, span TimeRange, limit int) (*api.GeoStats, error) {
+	query := url.Values{}
+	span.encode(query)
+	setInt(query, "limit", limit)
+	return get[api.GeoStats](ctx, c, "location/countries", query)
+}
+
+// Cities returns traffic by city over a time range, in one country unless it is empty
+func (c *Client) Cities(ctx context.Context, country string, span TimeRange, limit int) (*api.GeoStats, error) {
+	query := url.Values{}
+	setString(query, "country", country)
+	span.encode(query)
+	setInt(query, "limit", limit)
+	return get[api.GeoStats](ctx, c, "location/cities", query)
+}
+
+// Findings returns security findings, most recent first
+func (c *Client) Findings(ctx context.Context, q FindingQuery) (*api.Findings, error) {
+	query := url.Values{}
+	setString(query, "type", q.Type)
+	setString(query, "ip", q.IP)
+	setString(query, "severity", q.Severity)
+	setTime(query, "since", q.Since)
+	q.ListQuery.encode(query)
+	return get[api.Findings](ctx, c, "security/findings", query)
+}
+
+// Blocklist returns the blocked IP addresses
+func (c *Client) Blocklist(ctx context.Context, q ListQuery) (*api.Blocklist, error) {
+	query := url.Values{}
+	q.encode(query)
+	return get[api.Blocklist](ctx, c, "security/blocklist", query)
+}
+
+// Block adds an IP address or network to the block list. It is not retried,
+// so that a failed attempt isn't recorded twice in the entry's audit trail.
+func (c *Client) Block(ctx context.Context, req api.BlocklistRequest) (*api.BlocklistEntry, error) {
+	return send[api.BlocklistEntry](ctx, c, call{method: http.MethodPost, path: api.PathPrefix + "security/blocklist", body: req})
+}
+
+// Unblock removes an IP address or network from the block list
+func (c *Client) Unblock(ctx context.Context, ip, reason string) error {
+	query := url.Values{"ip": {ip}}
+	setString(query, "reason", reason)
+	return c.do(ctx, call{method: http.MethodDelete, path: api.PathPrefix + "security/blocklist", query: query}, nil)
+}
+
+// Pin keeps a blocked IP address from expiring
+func (c *Client) Pin(ctx context.Context, ip, reason string) (*api.BlocklistEntry, error) {
+	return c.pinning(ctx, "pin", ip, reason)
+}
+
+// Unpin lets a pinned IP address expire after the agent's block list TTL
+func (c *Client) Unpin(ctx context.Context, ip, reason string) (*api.BlocklistEntry, error) {
+	return c.pinning(ctx, "unpin", ip, reason)
+}
+
+func (c *Client) pinning(ctx context.Context, action, ip, reason string) (*api.BlocklistEntry, error) {
+	return send[api.BlocklistEntry](ctx, c, call{
+		method: http.MethodPost,
+		path:   api.PathPrefix + "security/blocklist/" + action,
+		body:   api.BlocklistRequest{IP: ip, Reason: reason},
+	})
+}
+
+// AuditRecords returns requests served to API callers, newest first
+func (c *Client) AuditRecords(ctx context.Context, q AuditQuery) (*api.AuditRecords, error) {
+	query := url.Values{}
+	setString(query, "key_id", q.KeyID)
+	setString(query, "endpoint", q.Endpoint)
+	setTime(query, "since", q.Since)
+	setTime(query, "until", q.Until)
+	q.ListQuery.encode(query)
+	return get[api.AuditRecords](ctx, c, "audit", query)
+}
+
+// get calls a v2 endpoint with GET
+func get[T any](ctx context.Context, c *Client, endpoint string, query url.Values) (*T, error) {
+	return send[T](ctx, c, call{method: http.MethodGet, path: api.PathPrefix + endpoint, query: query})
+}
+
+// send makes a call and returns its decoded response
+func send[T any](ctx context.Context, c *Client, req call) (*T, error) {
+	var result T
+	if err := c.do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func limitQuery(limit int, filter AccessFilter) url.Values {
+	query := url.Values{}
+	setInt(query, "limit", limit)
+	filter.encode(query)
+	return query
+}
+
+// The setters leave zero values out so that the agent applies its defaults
+
+func setString(query url.Values, name, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
+
+func setInt(query url.Values, name string, value int) {
+	if value != 0 {
+		query.Set(name, strconv.Itoa(value))
+	}
+}
+
+func setBool(query url.Values, name string, value bool) {
+	if value {
+		query.Set(name, "true")
+	}
+}
+
+func setTime(query url.Values, name string, value time.Time) {
+	if !value.IsZero() {
+		query.Set(name, value.UTC().Format(time.RFC3339Nano))
+	}
+}
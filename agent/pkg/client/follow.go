@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+)
+
+// DefaultFollowInterval is how often Follow polls for new lines when no interval is given
+const DefaultFollowInterval = 2 * time.Second
+
+// Follow streams the lines written to the current file of a source,
+// api.SourceAccess or SourceError. The first page holds the last lines of
+// the file, up to q.Limit, unless q.Cursor continues from an earlier page. The
+// file is then polled every interval, or right away while the agent has more
+// lines, and each page with lines is passed to fn. Access log lines can be
+// parsed with logs.ParseTraefikLogs.
+//
+// Follow returns when ctx is done, with its error, or when a request or fn
+// fails. The cursor of the last page fn received lets a later call resume.
+func (c *Client) Follow(ctx context.Context, source string, q LogQuery, interval time.Duration, fn func(*api.LogPage) error) error {
+	if interval <= 0 {
+		interval = DefaultFollowInterval
+	}
+
+	for {
+		page, err := c.Logs(ctx, source, q)
+		if err != nil {
+			return err
+		}
+		if len(page.Lines) > 0 {
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+		if page.Page.NextCursor != "" {
+			q.Cursor = page.Page.NextCursor
+		}
+
+		if page.Page.HasMore {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
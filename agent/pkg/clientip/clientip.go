@@ -0,0 +1,148 @@
+package clientip
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// DefaultHeaders are consulted when no client IP headers are configured
+var DefaultHeaders = []string{"X-Forwarded-For"}
+
+// Resolver derives the real client IP for requests that arrived through trusted proxies
+type Resolver struct {
+	trusted []netip.Prefix
+	headers []string
+}
+
+// New creates a resolver trusting the given CIDRs or bare IPs. Headers are
+// consulted in order; X-Forwarded-For style lists are walked from the right.
+func New(trustedProxies []string, headers []string) (*Resolver, error) {
+	var trusted []netip.Prefix
+	for _, value := range trustedProxies {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		addr = addr.Unmap()
+		trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	var names []string
+	for _, header := range headers {
+		if header = strings.TrimSpace(header); header != "" {
+			names = append(names, header)
+		}
+	}
+	if len(names) == 0 {
+		names = DefaultHeaders
+	}
+
+	return &Resolver{trusted: trusted, headers: names}, nil
+}
+
+// Enabled reports whether any trusted proxies are configured
+func (r *Resolver) Enabled() bool {
+	return r != nil && len(r.trusted) > 0
+}
+
+// Headers returns the header names consulted, in order
+func (r *Resolver) Headers() []string {
+	return r.headers
+}
+
+// Trusted reports whether an address belongs to a trusted proxy
+func (r *Resolver) Trusted(ip string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	return r.trustedAddr(addr.Unmap())
+}
+
+// Resolve returns the client IP for a request received from remote. Headers are
+// only honoured when remote is a trusted proxy; header returns the captured value
+// of a request header, or an empty string when it was not captured.
+func (r *Resolver) Resolve(remote string, header func(name string) string) string {
+	if !r.Enabled() || !r.Trusted(remote) {
+		return remote
+	}
+
+	for _, name := range r.headers {
+		value := header(name)
+		if value == "" {
+			continue
+		}
+		if ip, ok := r.fromHeader(value); ok {
+			return ip
+		}
+	}
+
+	return remote
+}
+
+// fromHeader picks the client from a comma-separated hop list: the rightmost
+// address that is not a trusted proxy, or the leftmost if every hop is trusted
+func (r *Resolver) fromHeader(value string) (string, bool) {
+	hops := strings.Split(value, ",")
+
+	var leftmost netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			// A malformed hop breaks the chain of trust
+			return "", false
+		}
+		if !r.trustedAddr(addr) {
+			return addr.String(), true
+		}
+		leftmost = addr
+	}
+
+	if leftmost.IsValid() {
+		return leftmost.String(), true
+	}
+	return "", false
+}
+
+// trustedAddr reports whether an address is inside a trusted prefix
+func (r *Resolver) trustedAddr(addr netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHop parses a single forwarded address, which may carry a port or brackets
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if hop == "" {
+		return netip.Addr{}, false
+	}
+
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,293 @@
+// Package export writes access log entries as CSV, NDJSON or Parquet. Entries
+// are written one at a time, so exports of any size are streamed rather than
+// held in memory; Parquet buffers one row group at a time.
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+)
+
+// Formats
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Formats lists the supported formats
+var Formats = []string{FormatCSV, FormatNDJSON, FormatParquet}
+
+// DefaultColumns are exported when no columns are selected
+var DefaultColumns = []string{
+	"StartUTC", "ClientHost", "RequestMethod", "RequestHost", "RequestPath", "RequestProtocol",
+	"DownstreamStatus", "DownstreamContentSize", "Duration", "RouterName", "ServiceName",
+	"RequestReferer", "RequestUserAgent",
+}
+
+// Type is the type of a column's values
+type Type int
+
+// Column types
+const (
+	TypeString Type = iota
+	TypeInt
+	TypeTime
+)
+
+// Column is a field of the access log entries
+type Column struct {
+	// Name is the field's name in Traefik's JSON access logs
+	Name  string
+	Type  Type
+	index int
+}
+
+var (
+	entryType = reflect.TypeOf(logs.TraefikLog{})
+	timeType  = reflect.TypeOf(time.Time{})
+	columns   = entryColumns()
+)
+
+// entryColumns derives the columns from the fields of TraefikLog
+func entryColumns() []Column {
+	var result []Column
+	for i := 0; i < entryType.NumField(); i++ {
+		field := entryType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+
+		column := Column{Name: name, index: i}
+		switch {
+		case field.Type == timeType:
+			column.Type = TypeTime
+		case field.Type.Kind() == reflect.String:
+			column.Type = TypeString
+		case field.Type.Kind() == reflect.Int || field.Type.Kind() == reflect.Int64:
+			column.Type = TypeInt
+		default:
+			continue
+		}
+		result = append(result, column)
+	}
+	return result
+}
+
+// Columns returns every column, in the order of the entry's fields
+func Columns() []Column {
+	return append([]Column(nil), columns...)
+}
+
+// ParseColumns returns the columns with the given names, in that order; no
+// names selects DefaultColumns
+func ParseColumns(names []string) ([]Column, error) {
+	if len(names) == 0 {
+		names = DefaultColumns
+	}
+
+	selected := make([]Column, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		column, ok := findColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[column.Name] {
+			return nil, fmt.Errorf("column %q is selected twice", column.Name)
+		}
+		seen[column.Name] = true
+		selected = append(selected, column)
+	}
+	return selected, nil
+}
+
+// findColumn looks up a column by name, ignoring case
+func findColumn(name string) (Column, bool) {
+	for _, column := range columns {
+		if strings.EqualFold(column.Name, name) {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+func (c Column) value(entry *logs.TraefikLog) reflect.Value {
+	return reflect.ValueOf(entry).Elem().Field(c.index)
+}
+
+func (c Column) text(entry *logs.TraefikLog) string {
+	value := c.value(entry)
+	switch c.Type {
+	case TypeInt:
+		return strconv.FormatInt(value.Int(), 10)
+	case TypeTime:
+		if ts := value.Interface().(time.Time); !ts.IsZero() {
+			return ts.Format(time.RFC3339Nano)
+		}
+		return ""
+	}
+	return value.String()
+}
+
+// Options configures a Writer
+type Options struct {
+	Columns []Column
+	// Gzip compresses the output. Parquet files compress their pages instead,
+	// so they stay readable as Parquet.
+	Gzip bool
+}
+
+// Writer writes access log entries in a format
+type Writer interface {
+	Write(entry *logs.TraefikLog) error
+	// Close writes anything buffered and the format's trailer. It doesn't
+	// close the underlying writer.
+	Close() error
+}
+
+// NewWriter creates a writer of format to w
+func NewWriter(w io.Writer, format string, opts Options) (Writer, error) {
+	if len(opts.Columns) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+
+	switch format {
+	case FormatParquet:
+		return newParquetWriter(w, opts.Columns, opts.Gzip), nil
+	case FormatCSV, FormatNDJSON:
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	out := &output{}
+	if opts.Gzip {
+		out.gzip = gzip.NewWriter(w)
+		w = out.gzip
+	}
+	out.buffer = bufio.NewWriterSize(w, 64*1024)
+
+	if format == FormatNDJSON {
+		return &ndjsonWriter{output: out, columns: opts.Columns}, nil
+	}
+	writer := &csvWriter{output: out, columns: opts.Columns, csv: csv.NewWriter(out.buffer)}
+	header := make([]string, len(opts.Columns))
+	for i, column := range opts.Columns {
+		header[i] = column.Name
+	}
+	writer.record = make([]string, len(opts.Columns))
+	return writer, writer.csv.Write(header)
+}
+
+// ContentType returns the media type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/vnd.apache.parquet"
+}
+
+// FileName names an export of a format, adding .gz when the output is gzipped
+func FileName(base, format string, gzipped bool) string {
+	name := base + "." + format
+	if gzipped && format != FormatParquet {
+		name += ".gz"
+	}
+	return name
+}
+
+// output buffers text formats and optionally gzips them
+type output struct {
+	buffer *bufio.Writer
+	gzip   *gzip.Writer
+}
+
+func (o *output) close() error {
+	if err := o.buffer.Flush(); err != nil {
+		return err
+	}
+	if o.gzip != nil {
+		return o.gzip.Close()
+	}
+	return nil
+}
+
+// csvWriter writes a header row and one row per entry
+type csvWriter struct {
+	*output
+	columns []Column
+	csv     *csv.Writer
+	record  []string
+}
+
+func (w *csvWriter) Write(entry *logs.TraefikLog) error {
+	for i, column := range w.columns {
+		w.record[i] = column.text(entry)
+	}
+	return w.csv.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	return w.close()
+}
+
+// ndjsonWriter writes one JSON object per line, with the columns in order.
+// Zero times are written as null.
+type ndjsonWriter struct {
+	*output
+	columns []Column
+}
+
+func (w *ndjsonWriter) Write(entry *logs.TraefikLog) error {
+	w.buffer.WriteByte('{')
+	for i, column := range w.columns {
+		if i > 0 {
+			w.buffer.WriteByte(',')
+		}
+		name, _ := json.Marshal(column.Name)
+		w.buffer.Write(name)
+		w.buffer.WriteByte(':')
+
+		switch column.Type {
+		case TypeInt:
+			w.buffer.WriteString(column.text(entry))
+		case TypeTime:
+			if text := column.text(entry); text != "" {
+				w.buffer.WriteString(strconv.Quote(text))
+			} else {
+				w.buffer.WriteString("null")
+			}
+		default:
+			value, err := json.Marshal(column.value(entry).String())
+			if err != nil {
+				return err
+			}
+			w.buffer.Write(value)
+		}
+	}
+	w.buffer.WriteByte('}')
+	return w.buffer.WriteByte('\n')
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.close()
+}
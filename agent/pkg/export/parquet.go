@@ -0,0 +1,328 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+)
+
+// A row group is written once it holds this many rows or bytes of values,
+// which bounds the memory an export holds
+const (
+	parquetRowGroupRows  = 10000
+	parquetRowGroupBytes = 32 << 20
+)
+
+const parquetMagic = "PAR1"
+
+// Values from parquet.thrift
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMicros = 10
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetCodecUncompressed = 0
+	parquetCodecGzip         = 2
+
+	parquetDataPage = 0
+)
+
+// parquetWriter writes a Parquet file with one data page per column chunk.
+// Strings are UTF8 byte arrays, integers INT64 and times optional INT64
+// timestamps in microseconds, null when zero. Values are PLAIN encoded.
+type parquetWriter struct {
+	out       *countingWriter
+	columns   []Column
+	codec     int32
+	chunks    []parquetChunk
+	rows      int
+	bytes     int
+	started   bool
+	numRows   int64
+	rowGroups []parquetRowGroup
+}
+
+// parquetChunk buffers the values of a column in the current row group
+type parquetChunk struct {
+	values []byte
+	// levels are the definition levels of an optional column: 1 when the
+	// row has a value, 0 when it is null
+	levels []byte
+}
+
+type parquetRowGroup struct {
+	numRows   int64
+	totalSize int64
+	columns   []parquetColumnChunk
+}
+
+type parquetColumnChunk struct {
+	offset       int64
+	numValues    int64
+	uncompressed int64
+	compressed   int64
+}
+
+func newParquetWriter(w io.Writer, columns []Column, gzipped bool) *parquetWriter {
+	p := &parquetWriter{
+		out:     &countingWriter{w: w},
+		columns: columns,
+		codec:   parquetCodecUncompressed,
+		chunks:  make([]parquetChunk, len(columns)),
+	}
+	if gzipped {
+		p.codec = parquetCodecGzip
+	}
+	return p
+}
+
+func (p *parquetWriter) Write(entry *logs.TraefikLog) error {
+	if err := p.start(); err != nil {
+		return err
+	}
+
+	for i, column := range p.columns {
+		chunk := &p.chunks[i]
+		before := len(chunk.values)
+		value := column.value(entry)
+		switch column.Type {
+		case TypeString:
+			s := value.String()
+			chunk.values = binary.LittleEndian.AppendUint32(chunk.values, uint32(len(s)))
+			chunk.values = append(chunk.values, s...)
+		case TypeInt:
+			chunk.values = binary.LittleEndian.AppendUint64(chunk.values, uint64(value.Int()))
+		case TypeTime:
+			ts := value.Interface().(time.Time)
+			if ts.IsZero() {
+				chunk.levels = append(chunk.levels, 0)
+				continue
+			}
+			chunk.levels = append(chunk.levels, 1)
+			chunk.values = binary.LittleEndian.AppendUint64(chunk.values, uint64(ts.UnixMicro()))
+		}
+		p.bytes += len(chunk.values) - before
+	}
+
+	p.rows++
+	if p.rows >= parquetRowGroupRows || p.bytes >= parquetRowGroupBytes {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.start(); err != nil {
+		return err
+	}
+	if err := p.flushRowGroup(); err != nil {
+		return err
+	}
+
+	footer := p.footer()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, parquetMagic...)
+	_, err := p.out.Write(footer)
+	return err
+}
+
+// start writes the magic number that opens the file
+func (p *parquetWriter) start() error {
+	if p.started {
+		return nil
+	}
+	p.started = true
+	_, err := p.out.Write([]byte(parquetMagic))
+	return err
+}
+
+// flushRowGroup writes the buffered rows as a row group
+func (p *parquetWriter) flushRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{numRows: int64(p.rows)}
+	for i, column := range p.columns {
+		chunk := &p.chunks[i]
+
+		var payload []byte
+		if column.Type == TypeTime {
+			levels := encodeLevels(chunk.levels)
+			payload = binary.LittleEndian.AppendUint32(payload, uint32(len(levels)))
+			payload = append(payload, levels...)
+		}
+		payload = append(payload, chunk.values...)
+
+		data := payload
+		if p.codec == parquetCodecGzip {
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			gz.Write(payload)
+			if err := gz.Close(); err != nil {
+				return err
+			}
+			data = compressed.Bytes()
+		}
+
+		header := pageHeader(p.rows, len(payload), len(data))
+		offset := p.out.n
+		if _, err := p.out.Write(header); err != nil {
+			return err
+		}
+		if _, err := p.out.Write(data); err != nil {
+			return err
+		}
+
+		group.columns = append(group.columns, parquetColumnChunk{
+			offset:       offset,
+			numValues:    int64(p.rows),
+			uncompressed: int64(len(header) + len(payload)),
+			compressed:   int64(len(header) + len(data)),
+		})
+		group.totalSize += int64(len(header) + len(payload))
+
+		chunk.values = chunk.values[:0]
+		chunk.levels = chunk.levels[:0]
+	}
+
+	p.rowGroups = append(p.rowGroups, group)
+	p.numRows += int64(p.rows)
+	p.rows, p.bytes = 0, 0
+	return nil
+}
+
+// encodeLevels encodes definition levels of bit width 1 with the RLE hybrid
+// encoding, as runs of equal values
+func encodeLevels(levels []byte) []byte {
+	var out []byte
+	for start := 0; start < len(levels); {
+		end := start + 1
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		out = binary.AppendUvarint(out, uint64(end-start)<<1)
+		out = append(out, levels[start])
+		start = end
+	}
+	return out
+}
+
+// pageHeader encodes the header of a data page
+func pageHeader(numValues, uncompressed, compressed int) []byte {
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(uncompressed))
+	t.i32(3, int32(compressed))
+	t.structField(5)
+	t.i32(1, int32(numValues))
+	t.i32(2, parquetEncodingPlain)
+	t.i32(3, parquetEncodingRLE)
+	t.i32(4, parquetEncodingRLE)
+	t.endStruct()
+	t.endStruct()
+	return t.buf
+}
+
+// footer encodes the file metadata: the schema and where each row group's
+// column chunks are
+func (p *parquetWriter) footer() []byte {
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, 1)
+
+	t.structList(2, len(p.columns)+1, func(i int) {
+		if i == 0 {
+			t.string(4, "schema")
+			t.i32(5, int32(len(p.columns)))
+			return
+		}
+		column := p.columns[i-1]
+		switch column.Type {
+		case TypeString:
+			t.i32(1, parquetByteArray)
+			t.i32(3, parquetRequired)
+			t.string(4, column.Name)
+			t.i32(6, parquetConvertedUTF8)
+			// LogicalType STRING
+			t.structField(10)
+			t.structField(1)
+			t.endStruct()
+			t.endStruct()
+		case TypeInt:
+			t.i32(1, parquetInt64)
+			t.i32(3, parquetRequired)
+			t.string(4, column.Name)
+		case TypeTime:
+			t.i32(1, parquetInt64)
+			t.i32(3, parquetOptional)
+			t.string(4, column.Name)
+			t.i32(6, parquetConvertedTimestampMicros)
+			// LogicalType TIMESTAMP(isAdjustedToUTC=true, unit=MICROS)
+			t.structField(10)
+			t.structField(8)
+			t.bool(1, true)
+			t.structField(2)
+			t.structField(2)
+			t.endStruct()
+			t.endStruct()
+			t.endStruct()
+			t.endStruct()
+		}
+	})
+
+	t.i64(3, p.numRows)
+	t.structList(4, len(p.rowGroups), func(g int) {
+		group := p.rowGroups[g]
+		t.structList(1, len(group.columns), func(c int) {
+			chunk := group.columns[c]
+			column := p.columns[c]
+			physical := int32(parquetInt64)
+			if column.Type == TypeString {
+				physical = parquetByteArray
+			}
+
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, physical)
+			t.i32List(2, []int32{parquetEncodingPlain, parquetEncodingRLE})
+			t.stringList(3, []string{column.Name})
+			t.i32(4, p.codec)
+			t.i64(5, chunk.numValues)
+			t.i64(6, chunk.uncompressed)
+			t.i64(7, chunk.compressed)
+			t.i64(9, chunk.offset)
+			t.endStruct()
+		})
+		t.i64(2, group.totalSize)
+		t.i64(3, group.numRows)
+	})
+	t.string(6, "traefik-log-dashboard")
+	t.endStruct()
+	return t.buf
+}
+
+// countingWriter tracks the offset into the file being written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(data []byte) (int, error) {
+	n, err := c.w.Write(data)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,471 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+)
+
+var log = logger.With("ingest")
+
+// maxLineSize matches the scanner buffer used when serving logs
+const maxLineSize = 1024 * 1024
+
+// rateWindow is the period over which the ingest rate of a file is measured
+const rateWindow = time.Minute
+
+// identityLen caps the bytes of the first line that identify a file
+const identityLen = 4096
+
+// Entry is a parsed access log line along with where it was read from
+type Entry struct {
+	Log    *logs.TraefikLog
+	Line   string
+	File   string
+	Offset int64
+	Time   time.Time
+	// Location is set when the pipeline has a locator configured
+	Location *location.Location
+}
+
+// Sink receives parsed entries from the pipeline
+type Sink interface {
+	Observe(entry Entry)
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(entry Entry)
+
+// Observe calls f(entry)
+func (f SinkFunc) Observe(entry Entry) {
+	f(entry)
+}
+
+// Pipeline follows the access logs in the background and feeds parsed entries to sinks
+type Pipeline struct {
+	path     string
+	interval time.Duration
+	backfill int64
+
+	mu      sync.RWMutex
+	sinks   []Sink
+	locator func(ip string) location.Location
+	offsets map[string]int64
+	// identities tell apart the files that took a path in turn, such as
+	// after rotation, so an offset is only applied to the file it was read from
+	identities map[string]string
+	sources    map[string]*sourceState
+}
+
+// sourceState holds the counters of one followed file
+type sourceState struct {
+	lines       int64
+	parseErrors int64
+	lastEntry   time.Time
+	lastRead    time.Time
+	// samples of the line count taken at each read, within rateWindow
+	samples []sample
+}
+
+type sample struct {
+	at    time.Time
+	lines int64
+}
+
+// SourceStats reports how much of a file the pipeline has read and how far
+// behind its end it is
+type SourceStats struct {
+	Source      string  `json:"source"`
+	Lines       int64   `json:"lines"`
+	ParseErrors int64   `json:"parse_errors"`
+	LinesPerSec float64 `json:"lines_per_second"`
+	Offset      int64   `json:"offset"`
+	Size        int64   `json:"size"`
+	LagBytes    int64   `json:"lag_bytes"`
+	// LagSeconds is how much older the last entry read is than the last write
+	// to the file; zero when the file has been read to its end
+	LagSeconds float64   `json:"lag_seconds"`
+	LastEntry  time.Time `json:"last_entry,omitempty"`
+	LastRead   time.Time `json:"last_read,omitempty"`
+}
+
+// New creates a pipeline that polls path every interval. On first sight of a
+// file, up to backfill bytes before its end are replayed.
+func New(path string, interval time.Duration, backfill int64) *Pipeline {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	return &Pipeline{
+		path:       path,
+		interval:   interval,
+		backfill:   backfill,
+		offsets:    make(map[string]int64),
+		identities: make(map[string]string),
+		sources:    make(map[string]*sourceState),
+	}
+}
+
+// AddSink registers a sink; it must be called before Run
+func (p *Pipeline) AddSink(sink Sink) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sinks = append(p.sinks, sink)
+}
+
+// SetLocator enriches every entry with the location of its client IP before
+// it reaches the sinks; it must be called before Run
+func (p *Pipeline) SetLocator(locator func(ip string) location.Location) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.locator = locator
+}
+
+// Run polls the access logs until the context is cancelled
+func (p *Pipeline) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.Poll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Poll()
+		}
+	}
+}
+
+// Poll reads any new lines from the access logs
+func (p *Pipeline) Poll() {
+	files, err := p.files()
+	if err != nil {
+		log.Error("Failed to list access logs", logger.KeySource, p.path, logger.Err(err))
+		return
+	}
+	p.prune(files)
+
+	for _, file := range files {
+		if err := p.readFile(file); err != nil {
+			p.mu.RLock()
+			offset := p.offsets[file]
+			p.mu.RUnlock()
+			log.Error("Failed to read access log", logger.KeySource, file, logger.KeyCursor, offset, logger.Err(err))
+		}
+	}
+}
+
+// prune forgets the files that are no longer followed, such as rotated ones
+func (p *Pipeline) prune(files []string) {
+	followed := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		followed[file] = struct{}{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for file := range p.offsets {
+		if _, ok := followed[file]; !ok {
+			delete(p.offsets, file)
+			delete(p.identities, file)
+			delete(p.sources, file)
+		}
+	}
+	for file := range p.identities {
+		if _, ok := followed[file]; !ok {
+			delete(p.identities, file)
+		}
+	}
+}
+
+// Offsets returns a copy of the current read offsets per file
+func (p *Pipeline) Offsets() map[string]int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	offsets := make(map[string]int64, len(p.offsets))
+	for file, offset := range p.offsets {
+		offsets[file] = offset
+	}
+	return offsets
+}
+
+// Identities returns a copy of the identities of the files read so far
+func (p *Pipeline) Identities() map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	identities := make(map[string]string, len(p.identities))
+	for file, identity := range p.identities {
+		identities[file] = identity
+	}
+	return identities
+}
+
+// SetOffsets resumes files from offsets saved by a previous run instead of
+// replaying the backfill; it must be called before Run. A file whose identity
+// differs from the one saved with its offset has been replaced and is read
+// from the start.
+func (p *Pipeline) SetOffsets(offsets map[string]int64, identities map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for file, offset := range offsets {
+		p.offsets[file] = offset
+	}
+	for file, identity := range identities {
+		p.identities[file] = identity
+	}
+}
+
+// FileIdentity identifies a log file by a hash of its first line, which holds
+// the time of its first entry, so a file that replaced another at the same
+// path is told apart without relying on inodes. It is empty while the file
+// has no complete first line.
+func FileIdentity(file *os.File) (string, error) {
+	head := make([]byte, identityLen)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+	if end := bytes.IndexByte(head, '\n'); end >= 0 {
+		head = head[:end]
+	} else if n < identityLen {
+		return "", nil
+	}
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// Stats reports the counters and lag of every file read so far, sorted by path
+func (p *Pipeline) Stats() []SourceStats {
+	p.mu.RLock()
+	result := make([]SourceStats, 0, len(p.offsets))
+	for file, offset := range p.offsets {
+		st := SourceStats{Source: file, Offset: offset}
+		if state, ok := p.sources[file]; ok {
+			st.Lines = state.lines
+			st.ParseErrors = state.parseErrors
+			st.LinesPerSec = state.rate()
+			st.LastEntry = state.lastEntry
+			st.LastRead = state.lastRead
+		}
+		result = append(result, st)
+	}
+	p.mu.RUnlock()
+
+	for i := range result {
+		st := &result[i]
+		info, err := os.Stat(st.Source)
+		if err != nil {
+			continue
+		}
+		st.Size = info.Size()
+		if st.Offset < st.Size {
+			st.LagBytes = st.Size - st.Offset
+			if !st.LastEntry.IsZero() && info.ModTime().After(st.LastEntry) {
+				st.LagSeconds = info.ModTime().Sub(st.LastEntry).Seconds()
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Source < result[j].Source })
+	return result
+}
+
+// rate returns the lines read per second over the samples in the window
+func (s *sourceState) rate() float64 {
+	if len(s.samples) < 2 {
+		return 0
+	}
+	first, last := s.samples[0], s.samples[len(s.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.lines-first.lines) / elapsed
+}
+
+// files lists the uncompressed access log files to follow
+func (p *Pipeline) files() ([]string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{p.path}, nil
+	}
+
+	entries, err := os.ReadDir(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".log") || strings.Contains(name, "error") {
+			continue
+		}
+		files = append(files, filepath.Join(p.path, name))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// readFile reads complete lines appended to a file since the last poll
+func (p *Pipeline) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	identity, err := FileIdentity(file)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	offset, seen := p.offsets[path]
+	known := p.identities[path]
+	p.mu.RUnlock()
+
+	if !seen {
+		offset = size - p.backfill
+		if offset < 0 {
+			offset = 0
+		}
+	} else if offset > size || (known != "" && identity != known) {
+		// The file was truncated or replaced by rotation
+		if offset <= size {
+			log.Info("Access log was replaced; reading it from the start", logger.KeySource, path)
+		}
+		offset = 0
+	}
+
+	if offset == size {
+		p.record(path, identity, offset, 0, 0, time.Time{})
+		return nil
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	if !seen && offset > 0 {
+		// Skip the partial line we landed in
+		skipped, err := reader.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+		offset += int64(len(skipped))
+	}
+
+	p.mu.RLock()
+	sinks := p.sinks
+	locator := p.locator
+	p.mu.RUnlock()
+
+	var lines, parseErrors int64
+	var lastEntry time.Time
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave incomplete trailing lines for the next poll
+			break
+		}
+
+		lineOffset := offset
+		offset += int64(len(line))
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(line) > maxLineSize {
+			parseErrors++
+			continue
+		}
+
+		entry, parseErr := logs.ParseTraefikLog(line)
+		if parseErr != nil || entry == nil {
+			parseErrors++
+			continue
+		}
+		lines++
+
+		ts := entry.StartUTC
+		if ts.IsZero() {
+			ts = time.Now().UTC()
+		}
+
+		e := Entry{
+			Log:    entry,
+			Line:   strings.TrimRight(line, "\r\n"),
+			File:   path,
+			Offset: lineOffset,
+			Time:   ts,
+		}
+		if locator != nil {
+			loc := locator(entry.ClientHost)
+			e.Location = &loc
+		}
+		for _, sink := range sinks {
+			sink.Observe(e)
+		}
+		lastEntry = ts
+	}
+
+	p.record(path, identity, offset, lines, parseErrors, lastEntry)
+	return nil
+}
+
+// record stores the read offset and identity of a file along with the lines read up to it
+func (p *Pipeline) record(path, identity string, offset, lines, parseErrors int64, lastEntry time.Time) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.offsets[path] = offset
+	p.identities[path] = identity
+	state, ok := p.sources[path]
+	if !ok {
+		state = &sourceState{}
+		p.sources[path] = state
+	}
+	state.lines += lines
+	state.parseErrors += parseErrors
+	state.lastRead = now
+	if !lastEntry.IsZero() {
+		state.lastEntry = lastEntry
+	}
+
+	state.samples = append(state.samples, sample{at: now, lines: state.lines})
+	cutoff := 0
+	for cutoff < len(state.samples)-1 && now.Sub(state.samples[cutoff].at) > rateWindow {
+		cutoff++
+	}
+	state.samples = state.samples[cutoff:]
+}
@@ -0,0 +1,111 @@
+package location
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize is the number of lookups kept in the LRU cache
+const DefaultCacheSize = 10000
+
+// CacheStats represents the lookup cache counters
+type CacheStats struct {
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+}
+
+// lruCache is a fixed-size least recently used cache of lookups keyed by IP
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+	hits     uint64
+	misses   uint64
+
+	// generation is bumped on clear so lookups made against replaced databases are not stored
+	generation uint64
+}
+
+// newLRUCache creates a cache holding up to capacity lookups; 0 disables caching
+func newLRUCache(capacity int) *lruCache {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &lruCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the cached lookup for an IP and marks it as recently used
+func (c *lruCache) get(ip string) (Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[ip]
+	if !ok {
+		c.misses++
+		return Location{}, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(Location), true
+}
+
+// put stores a lookup made in the given generation, evicting the least recently used entry when full
+func (c *lruCache) put(loc Location, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity == 0 || generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.items[loc.IPAddress]; ok {
+		elem.Value = loc
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[loc.IPAddress] = c.order.PushFront(loc)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(Location).IPAddress)
+	}
+}
+
+// clear drops all cached lookups but keeps the counters
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// currentGeneration returns the generation new lookups are stored under
+func (c *lruCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// stats returns a snapshot of the cache counters
+func (c *lruCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Size:     c.order.Len(),
+		Capacity: c.capacity,
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+}
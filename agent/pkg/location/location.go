@@ -1,30 +1,71 @@
 package location
 
 import (
+	"context"
 	"net"
+	"net/netip"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/oschwald/geoip2-golang"
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
 )
 
+var log = logger.With("geoip")
+
+// maxLookupWorkers bounds the number of concurrent lookups in ResolveLocations
+const maxLookupWorkers = 16
+
 // Location represents geolocation information for an IP address
 type Location struct {
-	IPAddress string  `json:"ipAddress"`
-	Country   string  `json:"country,omitempty"`
-	City      string  `json:"city,omitempty"`
-	Latitude  float64 `json:"latitude,omitempty"`
-	Longitude float64 `json:"longitude,omitempty"`
+	IPAddress    string  `json:"ipAddress"`
+	Country      string  `json:"country,omitempty"`
+	City         string  `json:"city,omitempty"`
+	Latitude     float64 `json:"latitude,omitempty"`
+	Longitude    float64 `json:"longitude,omitempty"`
+	ASN          uint    `json:"asn,omitempty"`
+	Organization string  `json:"organization,omitempty"`
+}
+
+// DatabaseStatus represents the state of a single MaxMind database
+type DatabaseStatus struct {
+	Path     string     `json:"path"`
+	Loaded   bool       `json:"loaded"`
+	Modified *time.Time `json:"modified,omitempty"`
+}
+
+// Status represents the state of the databases and the lookup cache
+type Status struct {
+	City       DatabaseStatus `json:"city"`
+	Country    DatabaseStatus `json:"country"`
+	ASN        DatabaseStatus `json:"asn"`
+	LastReload time.Time      `json:"last_reload"`
+	Cache      CacheStats     `json:"cache"`
+}
+
+// database is a loaded MaxMind reader along with the file state it was loaded from
+type database struct {
+	reader  *geoip2.Reader
+	modTime time.Time
+	size    int64
 }
 
 var (
-	cityReader    *geoip2.Reader
-	countryReader *geoip2.Reader
-	initOnce      sync.Once
+	// dbMu guards the readers; lookups hold it for reading so a reader is
+	// never closed while in use
+	dbMu          sync.RWMutex
+	cityDB        database
+	countryDB     database
+	asnDB         database
+	lastReload    time.Time
 	initErr       error
-	initDone      = make(chan struct{})
+	initOnce      sync.Once
+	reloadMu      sync.Mutex
 	cityDBPath    string
 	countryDBPath string
+	asnDBPath     string
+	cache         = newLRUCache(DefaultCacheSize)
 )
 
 // SetDatabasePaths sets the paths for the GeoIP databases
@@ -33,60 +74,213 @@ func SetDatabasePaths(cityPath, countryPath string) {
 	countryDBPath = countryPath
 }
 
+// SetASNDatabasePath sets the path for the optional GeoLite2 ASN database
+func SetASNDatabasePath(asnPath string) {
+	asnDBPath = asnPath
+}
+
+// SetCacheSize sets the number of lookups kept in the LRU cache; it must be
+// called before the first lookup
+func SetCacheSize(size int) {
+	cache = newLRUCache(size)
+}
+
+// ASNEnabled checks if ASN lookups are available
+func ASNEnabled() bool {
+	InitializeLookups()
+
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+	return asnDB.reader != nil
+}
+
 // LocationsEnabled checks if location lookups are available
 func LocationsEnabled() bool {
-	err := InitializeLookups()
-	return err == nil && (cityReader != nil || countryReader != nil)
+	InitializeLookups()
+
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+	return cityDB.reader != nil || countryDB.reader != nil || asnDB.reader != nil
 }
 
 // InitializeLookups ensures the MaxMind databases are loaded
 func InitializeLookups() error {
 	initOnce.Do(func() {
-		// Try to open the city database first
-		if cityDBPath != "" {
-			var cityErr error
-			cityReader, cityErr = geoip2.Open(cityDBPath)
-			if cityErr != nil {
-				logger.Log.Printf("Failed to load GeoLite2 City database from %s: %v", cityDBPath, cityErr)
-			} else {
-				logger.Log.Println("GeoLite2 City database loaded successfully")
-			}
+		Reload()
+	})
+
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+	return initErr
+}
+
+// Reload opens any configured database that has appeared or changed on disk
+// since it was last loaded and swaps it in. A database that fails to open
+// keeps serving from its previous reader.
+func Reload() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	dbMu.RLock()
+	oldCity, oldCountry, oldASN := cityDB, countryDB, asnDB
+	initial := lastReload.IsZero()
+	dbMu.RUnlock()
+
+	// Try to open the city database first
+	city, cityChanged, cityErr := refresh("City", cityDBPath, oldCity, initial)
+
+	// The country database is only a fallback for when the city database is unavailable
+	country, countryChanged, countryErr := oldCountry, false, error(nil)
+	if city.reader == nil {
+		country, countryChanged, countryErr = refresh("Country", countryDBPath, oldCountry, initial)
+	}
+
+	// The ASN database is optional and independent of the location databases
+	asn, asnChanged, _ := refresh("ASN", asnDBPath, oldASN, initial)
+
+	dbMu.Lock()
+	cityDB, countryDB, asnDB = city, country, asn
+	lastReload = time.Now()
+
+	// If we have at least one database, consider it successful
+	if city.reader != nil || country.reader != nil || asn.reader != nil {
+		initErr = nil
+	} else if countryErr != nil {
+		initErr = countryErr
+	} else {
+		initErr = cityErr
+	}
+	dbMu.Unlock()
+
+	if !cityChanged && !countryChanged && !asnChanged {
+		return
+	}
+
+	// Lookups cached against the replaced readers may be stale
+	cache.clear()
+
+	// No lookup holds the old readers once the swap has completed
+	for _, old := range []struct {
+		db      database
+		changed bool
+	}{{oldCity, cityChanged}, {oldCountry, countryChanged}, {oldASN, asnChanged}} {
+		if old.changed && old.db.reader != nil {
+			old.db.reader.Close()
 		}
+	}
+}
 
-		// Try to open the country database if city failed or as fallback
-		if cityReader == nil && countryDBPath != "" {
-			var countryErr error
-			countryReader, countryErr = geoip2.Open(countryDBPath)
-			if countryErr != nil {
-				logger.Log.Printf("Failed to load GeoLite2 Country database from %s: %v", countryDBPath, countryErr)
-				initErr = countryErr
-			} else {
-				logger.Log.Println("GeoLite2 Country database loaded successfully")
-			}
+// refresh reopens a database if its file changed since it was loaded. Missing
+// files are only reported on the initial load to keep polling quiet.
+func refresh(name, path string, current database, initial bool) (database, bool, error) {
+	if path == "" {
+		return current, false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if initial {
+			log.Warn("Failed to load GeoLite2 database", "database", name, logger.KeyPath, path, logger.Err(err))
 		}
+		// Keep the loaded reader while the file is being replaced
+		return current, false, err
+	}
+
+	if current.reader != nil && info.ModTime().Equal(current.modTime) && info.Size() == current.size {
+		return current, false, nil
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		log.Warn("Failed to load GeoLite2 database", "database", name, logger.KeyPath, path, logger.Err(err))
+		return current, false, err
+	}
+
+	if current.reader != nil {
+		log.Info("GeoLite2 database reloaded", "database", name, logger.KeyPath, path)
+	} else {
+		log.Info("GeoLite2 database loaded", "database", name, logger.KeyPath, path)
+	}
 
-		// If we have at least one database, consider it successful
-		if cityReader != nil || countryReader != nil {
-			initErr = nil
+	return database{reader: reader, modTime: info.ModTime(), size: info.Size()}, true, nil
+}
+
+// Watch polls the configured database files and reloads them when they
+// change or appear, until the context is cancelled
+func Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Reload()
 		}
+	}
+}
 
-		close(initDone)
-	})
+// GetStatus returns the state of the databases and the lookup cache
+func GetStatus() Status {
+	InitializeLookups()
 
-	// Wait for initialization to complete
-	<-initDone
-	return initErr
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	return Status{
+		City:       databaseStatus(cityDBPath, cityDB),
+		Country:    databaseStatus(countryDBPath, countryDB),
+		ASN:        databaseStatus(asnDBPath, asnDB),
+		LastReload: lastReload,
+		Cache:      cache.stats(),
+	}
+}
+
+// databaseStatus describes a loaded database
+func databaseStatus(path string, db database) DatabaseStatus {
+	status := DatabaseStatus{
+		Path:   path,
+		Loaded: db.reader != nil,
+	}
+	if db.reader != nil {
+		modified := db.modTime
+		status.Modified = &modified
+	}
+	return status
 }
 
 // LocationLookup returns geolocation information for a single IP address
 func LocationLookup(ipAddress string) (Location, error) {
 	// Ensure databases are initialized
-	if err := InitializeLookups(); err != nil && cityReader == nil && countryReader == nil {
+	InitializeLookups()
+
+	if location, ok := cache.get(ipAddress); ok {
+		return location, nil
+	}
+
+	generation := cache.currentGeneration()
+	location := lookup(ipAddress)
+	cache.put(location, generation)
+
+	return location, nil
+}
+
+// lookup resolves an IP address against the loaded databases
+func lookup(ipAddress string) Location {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	if cityDB.reader == nil && countryDB.reader == nil && asnDB.reader == nil {
 		return Location{
 			IPAddress: ipAddress,
 			Country:   "",
 			City:      "",
-		}, nil
+		}
 	}
 
 	// Parse the IP address
@@ -96,7 +290,7 @@ func LocationLookup(ipAddress string) (Location, error) {
 			IPAddress: ipAddress,
 			Country:   "",
 			City:      "",
-		}, nil
+		}
 	}
 
 	// Check if it's a private IP
@@ -105,16 +299,24 @@ func LocationLookup(ipAddress string) (Location, error) {
 			IPAddress: ipAddress,
 			Country:   "Private",
 			City:      "",
-		}, nil
+		}
 	}
 
 	location := Location{
 		IPAddress: ipAddress,
 	}
 
+	// Add the autonomous system when the ASN database is available
+	if asnDB.reader != nil {
+		if asn, err := asnDB.reader.ASN(ip); err == nil {
+			location.ASN = asn.AutonomousSystemNumber
+			location.Organization = asn.AutonomousSystemOrganization
+		}
+	}
+
 	// Try city lookup first if available
-	if cityReader != nil {
-		city, err := cityReader.City(ip)
+	if cityDB.reader != nil {
+		city, err := cityDB.reader.City(ip)
 		if err == nil {
 			location.Country = city.Country.IsoCode
 			if city.City.Names != nil {
@@ -122,71 +324,103 @@ func LocationLookup(ipAddress string) (Location, error) {
 			}
 			location.Latitude = city.Location.Latitude
 			location.Longitude = city.Location.Longitude
-			return location, nil
+			return location
 		}
 	}
 
 	// Fall back to country lookup if available
-	if countryReader != nil {
-		country, err := countryReader.Country(ip)
+	if countryDB.reader != nil {
+		country, err := countryDB.reader.Country(ip)
 		if err == nil {
 			location.Country = country.Country.IsoCode
-			return location, nil
+			return location
 		}
 	}
 
 	// Return empty location if no lookup was successful
-	return location, nil
+	return location
 }
 
 // ResolveLocations performs geolocation lookups for multiple IP addresses in parallel
 func ResolveLocations(ipAddresses []string) ([]Location, error) {
-	// Ensure databases are initialized
-	if err := InitializeLookups(); err != nil && cityReader == nil && countryReader == nil {
-		// Return empty locations if neither database is available
-		locations := make([]Location, len(ipAddresses))
-		for i, ip := range ipAddresses {
-			locations[i] = Location{
-				IPAddress: ip,
-				Country:   "",
-				City:      "",
-			}
-		}
+	locations := make([]Location, len(ipAddresses))
+	if len(ipAddresses) == 0 {
 		return locations, nil
 	}
 
-	// Use a wait group to track parallel lookups
+	// Feed the lookups to a bounded pool of workers
+	jobs := make(chan int)
 	var wg sync.WaitGroup
-	locations := make([]Location, len(ipAddresses))
 
-	// Perform lookups in parallel
-	for i, ip := range ipAddresses {
+	for w := 0; w < min(maxLookupWorkers, len(ipAddresses)); w++ {
 		wg.Add(1)
-		go func(idx int, ipAddr string) {
+		go func() {
 			defer wg.Done()
-			location, _ := LocationLookup(ipAddr)
-			locations[idx] = location
-		}(i, ip)
+			for idx := range jobs {
+				locations[idx], _ = LocationLookup(ipAddresses[idx])
+			}
+		}()
 	}
 
+	for i := range ipAddresses {
+		jobs <- i
+	}
+	close(jobs)
+
 	// Wait for all lookups to complete
 	wg.Wait()
 	return locations, nil
 }
 
-// isPrivateIP checks if an IP address is private/internal
+// specialPurposeRanges are the IANA special-purpose blocks that are never
+// routed on the public internet and so have no meaningful location
+var specialPurposeRanges = []netip.Prefix{
+	// IPv4
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link local
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (TEST-NET-1)
+	netip.MustParsePrefix("192.88.99.0/24"),  // deprecated 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (TEST-NET-3)
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	// IPv6
+	netip.MustParsePrefix("::/128"),         // unspecified
+	netip.MustParsePrefix("::1/128"),        // loopback
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("100::/64"),       // discard-only
+	netip.MustParsePrefix("2001::/23"),      // IETF protocol assignments
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("fc00::/7"),       // unique local
+	netip.MustParsePrefix("fe80::/10"),      // link local
+	netip.MustParsePrefix("ff00::/8"),       // multicast
+}
+
+// isPrivateIP checks if an IP address is private/internal or otherwise special-purpose
 func isPrivateIP(ip net.IP) bool {
-	// Check for IPv4 private ranges
-	if ip4 := ip.To4(); ip4 != nil {
-		return ip4[0] == 10 ||
-			(ip4[0] == 172 && ip4[1] >= 16 && ip4[1] <= 31) ||
-			(ip4[0] == 192 && ip4[1] == 168) ||
-			ip4[0] == 127 // localhost
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
 	}
+	return IsSpecialPurpose(addr)
+}
+
+// IsSpecialPurpose reports whether an address is in one of the IANA
+// special-purpose blocks, such as loopback, RFC 1918 or carrier-grade NAT
+func IsSpecialPurpose(addr netip.Addr) bool {
+	addr = addr.Unmap()
 
-	// Check for IPv6 private ranges
-	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsPrivate() {
-		return true
+	for _, prefix := range specialPurposeRanges {
+		if prefix.Contains(addr) {
+			return true
+		}
 	}
 
 	return false
@@ -194,10 +428,16 @@ func isPrivateIP(ip net.IP) bool {
 
 // Close releases resources used by MaxMind readers
 func Close() {
-	if cityReader != nil {
-		cityReader.Close()
-	}
-	if countryReader != nil {
-		countryReader.Close()
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	for _, db := range []*database{&cityDB, &countryDB, &asnDB} {
+		if db.reader != nil {
+			db.reader.Close()
+		}
+		*db = database{}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,249 @@
+package logfiles
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source names
+const (
+	SourceAccess = "access"
+	SourceError  = "error"
+)
+
+var (
+	// ErrOutsideRoot is returned for paths that resolve outside every configured root
+	ErrOutsideRoot = errors.New("file is outside the configured log paths")
+	// ErrNotFound is returned when an allowed file does not exist
+	ErrNotFound = errors.New("file not found")
+)
+
+// FileInfo describes a log file that may be read
+type FileInfo struct {
+	Name       string    `json:"name"`
+	Source     string    `json:"source"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+	Compressed bool      `json:"compressed"`
+	// Active is false for rotated files that are no longer written to
+	Active bool `json:"active"`
+}
+
+// root is a configured log path. A directory admits the log files inside it;
+// a file admits itself and its rotations, such as access.log.1 or access.log-20240101.gz.
+type root struct {
+	source string
+	path   string
+}
+
+// Sandbox resolves file names against the configured log paths, following
+// symlinks and refusing anything that ends up outside them
+type Sandbox struct {
+	roots []root
+}
+
+// New creates a sandbox; sources maps a source name such as "access" to its configured path
+func New(sources map[string]string) *Sandbox {
+	s := &Sandbox{}
+	for source, path := range sources {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		s.roots = append(s.roots, root{source: source, path: abs})
+	}
+	sort.Slice(s.roots, func(i, j int) bool { return s.roots[i].source < s.roots[j].source })
+	return s
+}
+
+// Sources lists the configured source names
+func (s *Sandbox) Sources() []string {
+	sources := make([]string, 0, len(s.roots))
+	for _, r := range s.roots {
+		sources = append(sources, r.source)
+	}
+	return sources
+}
+
+// Files lists the readable files of a source, newest first
+func (s *Sandbox) Files(source string) ([]FileInfo, error) {
+	r, ok := s.root(source)
+	if !ok {
+		return nil, ErrOutsideRoot
+	}
+
+	dir, err := r.dir()
+	if err != nil {
+		return []FileInfo{}, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []FileInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !r.admits(name) {
+			continue
+		}
+
+		resolved, err := r.resolve(name)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(resolved)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		files = append(files, FileInfo{
+			Name:       name,
+			Source:     r.source,
+			Size:       info.Size(),
+			Modified:   info.ModTime().UTC(),
+			Compressed: IsCompressed(name),
+			Active:     r.active(name),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Active != files[j].Active {
+			return files[i].Active
+		}
+		return files[i].Modified.After(files[j].Modified)
+	})
+	return files, nil
+}
+
+// Resolve returns the real path of a file of the given source. Names are relative
+// to the source; any name that escapes it, directly or through a symlink, is
+// rejected with ErrOutsideRoot.
+func (s *Sandbox) Resolve(source, name string) (string, error) {
+	r, ok := s.root(source)
+	if !ok {
+		return "", ErrOutsideRoot
+	}
+
+	if name == "" || filepath.IsAbs(name) || strings.ContainsRune(name, 0) {
+		return "", ErrOutsideRoot
+	}
+	name = filepath.Clean(name)
+	if name != filepath.Base(name) || !r.admits(name) {
+		return "", ErrOutsideRoot
+	}
+
+	resolved, err := r.resolve(name)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", ErrNotFound
+	}
+	if !info.Mode().IsRegular() {
+		return "", ErrOutsideRoot
+	}
+	return resolved, nil
+}
+
+// IsCompressed reports whether a file name has a gzip extension
+func IsCompressed(name string) bool {
+	return strings.HasSuffix(name, ".gz")
+}
+
+// root looks up a source by name
+func (s *Sandbox) root(source string) (root, bool) {
+	for _, r := range s.roots {
+		if r.source == source {
+			return r, true
+		}
+	}
+	return root{}, false
+}
+
+// isDir reports whether the configured path is a directory
+func (r root) isDir() bool {
+	info, err := os.Stat(r.path)
+	return err == nil && info.IsDir()
+}
+
+// dir returns the real directory holding the source's files
+func (r root) dir() (string, error) {
+	if r.isDir() {
+		return filepath.EvalSymlinks(r.path)
+	}
+	return filepath.EvalSymlinks(filepath.Dir(r.path))
+}
+
+// admits reports whether a name within the directory belongs to the source
+func (r root) admits(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	if r.isDir() {
+		// Access and error logs may share a directory, told apart by name
+		if strings.Contains(name, "error") != (r.source == SourceError) {
+			return false
+		}
+		return strings.HasSuffix(name, ".log") || strings.Contains(name, ".log.") ||
+			strings.Contains(name, ".log-") || IsCompressed(name)
+	}
+
+	base := filepath.Base(r.path)
+	return name == base || strings.HasPrefix(name, base+".") || strings.HasPrefix(name, base+"-")
+}
+
+// active reports whether a file is the one currently written to
+func (r root) active(name string) bool {
+	if r.isDir() {
+		return strings.HasSuffix(name, ".log")
+	}
+	return name == filepath.Base(r.path)
+}
+
+// resolve follows symlinks and checks the result stays inside the source
+func (r root) resolve(name string) (string, error) {
+	dir, err := r.dir()
+	if err != nil {
+		return "", ErrNotFound
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNotFound
+		}
+		return "", ErrOutsideRoot
+	}
+
+	if within(dir, resolved) {
+		return resolved, nil
+	}
+
+	// A configured log file may itself be a symlink to a file elsewhere
+	if !r.isDir() && name == filepath.Base(r.path) {
+		if target, err := filepath.EvalSymlinks(r.path); err == nil && target == resolved {
+			return resolved, nil
+		}
+	}
+	return "", ErrOutsideRoot
+}
+
+// within reports whether path is inside dir
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
@@ -1,12 +1,144 @@
 package logger
 
 import (
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
 )
 
-var Log *log.Logger
+// Attribute keys shared by every package, so the agent's logs can be filtered
+// the same way wherever they come from
+const (
+	// KeyComponent names the part of the agent that logged the record
+	KeyComponent = "component"
+	// KeySource is the log file being read or served
+	KeySource = "source"
+	// KeyCursor is a read offset within a source
+	KeyCursor = "cursor"
+	// KeyPath is a request path, or the file a component reads or writes
+	KeyPath = "path"
+	// KeyError holds the error of a failed operation
+	KeyError = "error"
+)
+
+// Log is the agent's logger. It writes text records at info level to stdout
+// until Configure is called.
+var Log *slog.Logger
+
+// level is shared by every handler so it can be changed while the agent runs
+// without replacing Log
+var (
+	level  = new(slog.LevelVar)
+	format = "text"
+)
 
 func init() {
-	Log = log.New(os.Stdout, "[TRAEFIK-LOG-DASHBOARD] ", log.LstdFlags|log.Lshortfile)
-}
\ No newline at end of file
+	Log = slog.New(newHandler(os.Stdout))
+	slog.SetDefault(Log)
+}
+
+// Configure replaces the output of Log, sets its level and its format, which
+// is text or json
+func Configure(w io.Writer, levelName, outputFormat string) error {
+	lvl, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	if err := CheckFormat(outputFormat); err != nil {
+		return err
+	}
+	level.Set(lvl)
+	format = strings.ToLower(outputFormat)
+	SetOutput(w)
+	return nil
+}
+
+// SetOutput keeps the level and format of Log but writes it to w
+func SetOutput(w io.Writer) {
+	Log = slog.New(newHandler(w))
+	slog.SetDefault(Log)
+}
+
+// SetLevel changes the minimum level of records written by Log
+func SetLevel(levelName string) error {
+	lvl, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	level.Set(lvl)
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error; empty means info
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("invalid level %q: expected debug, info, warn or error", name)
+}
+
+// CheckFormat validates an output format
+func CheckFormat(outputFormat string) error {
+	switch strings.ToLower(outputFormat) {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("invalid format %q: expected text or json", outputFormat)
+}
+
+// newHandler creates a handler in the configured format at the shared level
+func newHandler(w io.Writer) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// With returns a logger for one component of the agent. The logger follows
+// later calls to Configure and SetOutput.
+func With(component string) *Component {
+	return &Component{name: component}
+}
+
+// Component logs records tagged with the name of the part of the agent that
+// wrote them
+type Component struct {
+	name string
+}
+
+func (c *Component) logger() *slog.Logger {
+	return Log.With(KeyComponent, c.name)
+}
+
+// Debug logs at debug level
+func (c *Component) Debug(msg string, args ...any) { c.logger().Debug(msg, args...) }
+
+// Info logs at info level
+func (c *Component) Info(msg string, args ...any) { c.logger().Info(msg, args...) }
+
+// Warn logs at warn level
+func (c *Component) Warn(msg string, args ...any) { c.logger().Warn(msg, args...) }
+
+// Error logs at error level
+func (c *Component) Error(msg string, args ...any) { c.logger().Error(msg, args...) }
+
+// Fatal logs at error level and exits
+func (c *Component) Fatal(msg string, args ...any) {
+	c.logger().Error(msg, args...)
+	os.Exit(1)
+}
+
+// Err returns the attribute for a failed operation
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
@@ -0,0 +1,78 @@
+package logs
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/clientip"
+)
+
+// clientIPResolver derives the real client IP for requests received through trusted proxies
+var clientIPResolver *clientip.Resolver
+
+// clientHostField matches the ClientHost field of a JSON access log line
+var clientHostField = regexp.MustCompile(`"ClientHost"\s*:\s*"[^"]*"`)
+
+// SetClientIPResolver configures how ClientHost is derived when parsing logs;
+// it must be called before logs are read
+func SetClientIPResolver(resolver *clientip.Resolver) {
+	clientIPResolver = resolver
+}
+
+// resolveClientHost replaces ClientHost with the address forwarded by a trusted
+// proxy, keeping the proxy address in ProxyHost
+func resolveClientHost(log *TraefikLog, logLine string) {
+	if !clientIPResolver.Enabled() || !clientIPResolver.Trusted(log.ClientHost) {
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(logLine), &fields); err != nil {
+		return
+	}
+
+	resolved := clientIPResolver.Resolve(log.ClientHost, func(name string) string {
+		return capturedHeader(fields, name)
+	})
+	if resolved != log.ClientHost {
+		log.ProxyHost = log.ClientHost
+		log.ClientHost = resolved
+	}
+}
+
+// capturedHeader returns a request header Traefik captured as request_<Name>
+func capturedHeader(fields map[string]json.RawMessage, name string) string {
+	key := "request_" + name
+	for field, raw := range fields {
+		if !strings.EqualFold(field, key) {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// RewriteClientHosts replaces ClientHost in raw JSON lines with the resolved
+// client IP so consumers parsing the lines see the same address as the agent
+func RewriteClientHosts(lines []string) []string {
+	if !clientIPResolver.Enabled() {
+		return lines
+	}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+			continue
+		}
+		entry, err := ParseTraefikLog(line)
+		if err != nil || entry == nil || entry.ProxyHost == "" {
+			continue
+		}
+		hostJSON, _ := json.Marshal(entry.ClientHost)
+		lines[i] = clientHostField.ReplaceAllLiteralString(line, `"ClientHost":`+string(hostJSON))
+	}
+	return lines
+}
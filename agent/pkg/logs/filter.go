@@ -0,0 +1,49 @@
+package logs
+
+// Filter reports whether a parsed log entry should be kept
+type Filter func(*TraefikLog) bool
+
+// FilterLines keeps the raw log lines whose parsed entry matches all filters.
+// Lines that cannot be parsed are dropped when any filter is active.
+func FilterLines(lines []string, filters ...Filter) []string {
+	if len(filters) == 0 {
+		return lines
+	}
+
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		entry, err := ParseTraefikLog(line)
+		if err != nil || entry == nil {
+			continue
+		}
+		if Matches(entry, filters...) {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// FilterEntries keeps the parsed entries matching all filters
+func FilterEntries(entries []*TraefikLog, filters ...Filter) []*TraefikLog {
+	if len(filters) == 0 {
+		return entries
+	}
+
+	kept := make([]*TraefikLog, 0, len(entries))
+	for _, entry := range entries {
+		if Matches(entry, filters...) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// Matches reports whether an entry satisfies all filters
+func Matches(entry *TraefikLog, filters ...Filter) bool {
+	for _, filter := range filters {
+		if !filter(entry) {
+			return false
+		}
+	}
+	return true
+}
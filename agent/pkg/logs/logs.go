@@ -13,6 +13,8 @@ import (
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
 )
 
+var log = logger.With("logs")
+
 func GetLogs(path string, positions []Position, isErrorLog bool, includeCompressed bool) (LogResult, error) {
 	fileInfo, err := os.Stat(path)
 	if err != nil {
@@ -35,7 +37,7 @@ func GetLogs(path string, positions []Position, isErrorLog bool, includeCompress
 
 func GetLog(filePath string, position int64) (LogResult, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		logger.Log.Println("File not found")
+		log.Debug("File not found", logger.KeySource, filePath)
 		return LogResult{}, fmt.Errorf("file not found: %s", filePath)
 	}
 
@@ -245,7 +247,7 @@ func GetRecentDirectoryLogs(dirPath string, since time.Time) (LogResult, error)
 			fullPath := filepath.Join(dirPath, fileName)
 			result, err := GetLog(fullPath, 0)
 			if err != nil {
-				logger.Log.Printf("Error reading log file %s: %v", fileName, err)
+				log.Error("Failed to read log file", logger.KeySource, fullPath, logger.Err(err))
 				continue
 			}
 			allLogs = append(allLogs, result.Logs...)
@@ -373,7 +375,7 @@ func GetDirectoryLogs(dirPath string, positions []Position, isErrorLog bool, inc
 
 		result, err := GetLog(fullPath, position)
 		if err != nil {
-			logger.Log.Printf("Error reading log file %s: %v", fileName, err)
+			log.Error("Failed to read log file", logger.KeySource, fullPath, logger.KeyCursor, position, logger.Err(err))
 			continue
 		}
 
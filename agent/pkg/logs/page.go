@@ -0,0 +1,307 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// pageChunkSize is how much of a file is read at a time when paging backward
+const pageChunkSize = 64 * 1024
+
+// Page is a window of lines from a single log file. Offsets are byte offsets
+// into the uncompressed content and always fall on line boundaries, so End can
+// be passed back to read forward and Start to read backward.
+type Page struct {
+	LogResult
+	File        string `json:"file"`
+	Start       int64  `json:"start"`
+	End         int64  `json:"end"`
+	HasPrevious bool   `json:"has_previous"`
+	HasNext     bool   `json:"has_next"`
+	Compressed  bool   `json:"compressed"`
+}
+
+// pageLine is a line and the offset just past it
+type pageLine struct {
+	text string
+	end  int64
+}
+
+// ReadPage reads up to limit lines from a file. Forward pages start at offset;
+// backward pages end at offset, where a negative offset means the end of the file.
+// Gzip files are decompressed and paged through by their uncompressed offsets.
+func ReadPage(filePath string, offset int64, limit int, backward bool) (Page, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Page{}, err
+	}
+	defer file.Close()
+
+	var page Page
+	if strings.HasSuffix(filePath, ".gz") {
+		page, err = readCompressedPage(file, offset, limit, backward)
+		page.Compressed = true
+	} else if backward {
+		page, err = readPageBackward(file, offset, limit)
+	} else {
+		page, err = readPageForward(file, offset, limit)
+	}
+	if err != nil {
+		return Page{}, err
+	}
+
+	if page.Logs == nil {
+		page.Logs = []string{}
+	}
+	page.Positions = []Position{{Position: page.End}}
+	return page, nil
+}
+
+// readPageForward reads complete lines starting at offset. A trailing line
+// without a newline is still being written and is left for the next read.
+func readPageForward(file *os.File, offset int64, limit int) (Page, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Page{}, err
+	}
+	size := info.Size()
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > size {
+		offset = size
+	}
+
+	// Move to the start of the next line if the offset falls inside one
+	if offset > 0 {
+		prev := make([]byte, 1)
+		if _, err := file.ReadAt(prev, offset-1); err != nil {
+			return Page{}, err
+		}
+		if prev[0] != '\n' {
+			skipped, err := skipLine(io.NewSectionReader(file, offset, size-offset))
+			if err != nil {
+				return Page{}, err
+			}
+			offset += skipped
+		}
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, size-offset))
+	page := Page{Start: offset, End: offset, HasPrevious: offset > 0}
+
+	lines := 0
+	for lines < limit {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Page{}, err
+		}
+
+		page.End += int64(len(line))
+		if text := strings.TrimRight(line, "\r\n"); text != "" {
+			page.Logs = append(page.Logs, text)
+			lines++
+		}
+	}
+
+	page.HasNext = hasMoreLines(reader, false)
+	return page, nil
+}
+
+// readPageBackward reads the complete lines that end at or before offset
+func readPageBackward(file *os.File, offset int64, limit int) (Page, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Page{}, err
+	}
+	size := info.Size()
+
+	if offset < 0 || offset > size {
+		offset = size
+	}
+
+	// Read chunks from the end until enough lines are buffered
+	pos := offset
+	var buf []byte
+	for pos > 0 && bytes.Count(buf, []byte{'\n'}) <= limit {
+		readSize := int64(pageChunkSize)
+		if readSize > pos {
+			readSize = pos
+		}
+		pos -= readSize
+
+		chunk := make([]byte, readSize)
+		if _, err := file.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return Page{}, err
+		}
+		buf = append(chunk, buf...)
+	}
+
+	// Drop a partial line at the end and, unless at the start of the file, at the beginning
+	end := offset
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		end -= int64(len(buf) - i - 1)
+		buf = buf[:i+1]
+	} else {
+		end, buf = pos, nil
+	}
+	if pos > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		pos += int64(i + 1)
+		buf = buf[i+1:]
+	}
+
+	var lines []pageLine
+	lineEnd := pos
+	for _, line := range bytes.SplitAfter(buf, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		lineEnd += int64(len(line))
+		lines = append(lines, pageLine{text: strings.TrimRight(string(line), "\r\n"), end: lineEnd})
+	}
+
+	page := collectBackward(lines, pos, limit)
+	page.End = end
+	page.HasNext = end < size
+	return page, nil
+}
+
+// readCompressedPage streams a gzip file, which can't be seeked, up to the requested window
+func readCompressedPage(file *os.File, offset int64, limit int, backward bool) (Page, error) {
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return Page{}, err
+	}
+	defer gzReader.Close()
+
+	reader := bufio.NewReader(gzReader)
+
+	if backward {
+		// Keep a sliding window of the lines that end before the offset
+		var window []pageLine
+		var pos, windowStart int64
+		more := false
+		for offset < 0 || pos < offset {
+			line, err := reader.ReadString('\n')
+			if offset >= 0 && pos+int64(len(line)) > offset {
+				// The line straddles the offset, so it belongs to the next page
+				more = true
+				break
+			}
+			if line != "" {
+				pos += int64(len(line))
+				window = append(window, pageLine{text: strings.TrimRight(line, "\r\n"), end: pos})
+				if len(window) > limit*2 {
+					windowStart = window[len(window)-limit-1].end
+					window = append([]pageLine(nil), window[len(window)-limit:]...)
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return Page{}, err
+			}
+		}
+
+		page := collectBackward(window, windowStart, limit)
+		page.End = pos
+		page.HasNext = more || (offset >= 0 && pos == offset && hasMoreLines(reader, true))
+		return page, nil
+	}
+
+	// Skip to the first line starting at or after the offset
+	var pos int64
+	for pos < offset {
+		line, err := reader.ReadString('\n')
+		pos += int64(len(line))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	page := Page{Start: pos, End: pos, HasPrevious: pos > 0}
+	lines := 0
+	for lines < limit {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			page.End += int64(len(line))
+			if text := strings.TrimRight(line, "\r\n"); text != "" {
+				page.Logs = append(page.Logs, text)
+				lines++
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	page.HasNext = hasMoreLines(reader, true)
+	return page, nil
+}
+
+// collectBackward keeps the last limit non-empty lines; start is the offset of the first line given
+func collectBackward(lines []pageLine, start int64, limit int) Page {
+	first := len(lines)
+	count := 0
+	for first > 0 && count < limit {
+		first--
+		if lines[first].text != "" {
+			count++
+		}
+	}
+
+	page := Page{Start: start}
+	if first > 0 {
+		page.Start = lines[first-1].end
+	}
+	for _, line := range lines[first:] {
+		if line.text != "" {
+			page.Logs = append(page.Logs, line.text)
+		}
+	}
+	page.HasPrevious = page.Start > 0
+	return page
+}
+
+// skipLine consumes the rest of the current line and returns the bytes skipped
+func skipLine(r io.Reader) (int64, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return int64(len(line)), nil
+}
+
+// hasMoreLines reports whether the reader holds another line. Unless final is
+// set, a trailing line without a newline is still being written and doesn't count.
+func hasMoreLines(reader *bufio.Reader, final bool) bool {
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == nil {
+			return true
+		}
+		if err != bufio.ErrBufferFull {
+			return final && len(line) > 0
+		}
+	}
+}
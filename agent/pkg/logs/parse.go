@@ -39,6 +39,10 @@ type TraefikLog struct {
 	EntryPointName      string    `json:"entryPointName"`
 	RequestReferer      string    `json:"RequestReferer"`
 	RequestUserAgent    string    `json:"RequestUserAgent"`
+	// RequestID is the captured X-Request-Id request header
+	RequestID           string    `json:"RequestID,omitempty"`
+	// ProxyHost is the original ClientHost when it was replaced by a forwarded client IP
+	ProxyHost           string    `json:"ProxyHost,omitempty"`
 }
 
 var clfRegex = regexp.MustCompile(`^(\S+) - (\S+) \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d+) (\d+) "([^"]*)" "([^"]*)" (\d+) "([^"]*)" "([^"]*)" (\d+)ms`)
@@ -57,12 +61,38 @@ func ParseTraefikLog(logLine string) (*TraefikLog, error) {
 	return parseCLFLog(logLine)
 }
 
+// capturedHeaders holds request headers Traefik writes when header capture is enabled
+type capturedHeaders struct {
+	UserAgent string `json:"request_User-Agent"`
+	Referer   string `json:"request_Referer"`
+	RequestID string `json:"request_X-Request-Id"`
+}
+
 func parseJSONLog(logLine string) (*TraefikLog, error) {
 	var log TraefikLog
 	err := json.Unmarshal([]byte(logLine), &log)
 	if err != nil {
 		return nil, err
 	}
+
+	// Traefik only emits user agent, referer and request ID as captured request headers
+	if log.RequestUserAgent == "" || log.RequestReferer == "" || log.RequestID == "" {
+		var headers capturedHeaders
+		if err := json.Unmarshal([]byte(logLine), &headers); err == nil {
+			if log.RequestUserAgent == "" {
+				log.RequestUserAgent = headers.UserAgent
+			}
+			if log.RequestReferer == "" {
+				log.RequestReferer = headers.Referer
+			}
+			if log.RequestID == "" {
+				log.RequestID = headers.RequestID
+			}
+		}
+	}
+
+	resolveClientHost(&log, logLine)
+
 	return &log, nil
 }
 
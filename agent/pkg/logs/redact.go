@@ -0,0 +1,192 @@
+package logs
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+)
+
+// forwardingHeaders carry client addresses and are redacted along with ClientHost
+var forwardingHeaders = []string{"X-Forwarded-For", "X-Real-Ip", "Cf-Connecting-Ip", "True-Client-Ip"}
+
+// capturedPrefixes are the prefixes Traefik gives captured header fields
+var capturedPrefixes = []string{"request_", "downstream_", "origin_"}
+
+// RedactLines applies a redaction policy to raw JSON or CLF access log lines
+func RedactLines(lines []string, policy *redact.Policy) []string {
+	if policy.IsZero() {
+		return lines
+	}
+
+	for i, line := range lines {
+		lines[i] = RedactLine(line, policy)
+	}
+	return lines
+}
+
+// RedactLine applies a redaction policy to a single access log line
+func RedactLine(line string, policy *redact.Policy) string {
+	if policy.IsZero() {
+		return line
+	}
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return redactJSONLine(line, policy)
+	}
+	return redactCLFLine(line, policy)
+}
+
+// RedactErrorLines applies a redaction policy to error log lines, which have
+// no fixed fields: addresses and URL query parameters are redacted wherever
+// they appear
+func RedactErrorLines(lines []string, policy *redact.Policy) []string {
+	if policy.IsZero() {
+		return lines
+	}
+
+	for i, line := range lines {
+		lines[i] = policy.Text(line)
+	}
+	return lines
+}
+
+// RedactEntry applies a redaction policy to a parsed access log entry, with
+// the same rules as RedactLine
+func RedactEntry(entry *TraefikLog, policy *redact.Policy) {
+	if policy.IsZero() {
+		return
+	}
+
+	entry.ClientHost = policy.IPAddress(entry.ClientHost)
+	entry.ProxyHost = policy.IPAddress(entry.ProxyHost)
+	entry.ClientAddr = policy.HostPort(entry.ClientAddr)
+	if policy.DropUsername {
+		entry.ClientUsername = ""
+	}
+	entry.RequestPath = policy.URL(entry.RequestPath)
+	entry.RequestReferer = policy.URL(entry.RequestReferer)
+	if policy.RedactsHeader("Referer") && entry.RequestReferer != "" {
+		entry.RequestReferer = redact.Placeholder
+	}
+	if policy.RedactsHeader("User-Agent") && entry.RequestUserAgent != "" {
+		entry.RequestUserAgent = redact.Placeholder
+	}
+}
+
+// redactJSONLine rewrites the sensitive fields of a JSON log line
+func redactJSONLine(line string, policy *redact.Policy) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return line
+	}
+
+	update := func(field string, redactValue func(string) string) {
+		raw, ok := fields[field]
+		if !ok {
+			return
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return
+		}
+		encoded, _ := json.Marshal(redactValue(value))
+		fields[field] = encoded
+	}
+
+	update("ClientHost", policy.IPAddress)
+	update("ClientAddr", policy.HostPort)
+	if policy.DropUsername {
+		delete(fields, "ClientUsername")
+	}
+	update("RequestPath", policy.URL)
+	update("RequestReferer", policy.URL)
+
+	for field := range fields {
+		name, captured := capturedHeaderName(field)
+		if !captured {
+			continue
+		}
+		// The Forwarded header mixes addresses with other parameters, so it is replaced whole
+		if policy.RedactsHeader(name) || (policy.RedactsIPs() && strings.EqualFold(name, "Forwarded")) {
+			update(field, func(string) string { return redact.Placeholder })
+			continue
+		}
+		if isForwardingHeader(name) {
+			update(field, policy.IPList)
+		} else if strings.EqualFold(name, "Referer") {
+			update(field, policy.URL)
+		}
+	}
+
+	// Traefik's top-level copies of captured headers follow the same rules
+	for field, name := range map[string]string{"RequestReferer": "Referer", "RequestUserAgent": "User-Agent"} {
+		if policy.RedactsHeader(name) {
+			update(field, func(string) string { return redact.Placeholder })
+		}
+	}
+
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return line
+	}
+	return string(redacted)
+}
+
+// redactCLFLine rewrites the client, user, request path, referer and user agent of a CLF line
+func redactCLFLine(line string, policy *redact.Policy) string {
+	match := clfRegex.FindStringSubmatchIndex(line)
+	if match == nil {
+		return line
+	}
+
+	group := func(n int) string { return line[match[2*n]:match[2*n+1]] }
+	replacements := map[int]string{
+		1: policy.IPAddress(group(1)),
+		5: policy.URL(group(5)),
+		9: policy.URL(group(9)),
+	}
+	if policy.DropUsername {
+		replacements[2] = "-"
+	}
+	if policy.RedactsHeader("Referer") {
+		replacements[9] = redact.Placeholder
+	}
+	if policy.RedactsHeader("User-Agent") {
+		replacements[10] = redact.Placeholder
+	}
+
+	// Replace from the end so earlier offsets stay valid
+	for _, n := range []int{10, 9, 5, 2, 1} {
+		if value, ok := replacements[n]; ok {
+			line = line[:match[2*n]] + value + line[match[2*n+1]:]
+		}
+	}
+	return line
+}
+
+// capturedHeaderName returns the header name of a captured header field
+func capturedHeaderName(field string) (string, bool) {
+	for _, prefix := range capturedPrefixes {
+		if strings.HasPrefix(field, prefix) {
+			return field[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// isForwardingHeader reports whether a header carries client addresses
+func isForwardingHeader(name string) bool {
+	for _, header := range forwardingHeaders {
+		if strings.EqualFold(name, header) {
+			return true
+		}
+	}
+	if clientIPResolver != nil {
+		for _, header := range clientIPResolver.Headers() {
+			if strings.EqualFold(name, header) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package logs
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+)
+
+// testPolicy truncates addresses, drops usernames and strips token parameters
+// and Authorization headers
+func testPolicy(t *testing.T) *redact.Policy {
+	t.Helper()
+	policy := &redact.Policy{
+		IP:           redact.IPTruncate,
+		DropUsername: true,
+		QueryParams:  []string{"token", "e*"},
+		Headers:      []string{"authorization"},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Failed to validate policy: %v", err)
+	}
+	return policy
+}
+
+func TestRedactJSONLine(t *testing.T) {
+	line := `{"ClientHost":"203.0.113.77","ClientAddr":"203.0.113.77:51234","ClientUsername":"alice",` +
+		`"RequestPath":"/login?token=abc&%74oken=def&page=2","request_Referer":"https://example.com/?email=a%40b.c",` +
+		`"request_Authorization":"Bearer secret","request_X-Forwarded-For":"198.51.100.23","request_Forwarded":"for=198.51.100.23"}`
+
+	var redacted map[string]string
+	if err := json.Unmarshal([]byte(RedactLine(line, testPolicy(t))), &redacted); err != nil {
+		t.Fatalf("Failed to decode redacted line: %v", err)
+	}
+	for field, want := range map[string]string{
+		"ClientHost":              "203.0.113.0",
+		"ClientAddr":              "203.0.113.0",
+		"RequestPath":             "/login?page=2",
+		"request_Referer":         "https://example.com/",
+		"request_Authorization":   redact.Placeholder,
+		"request_X-Forwarded-For": "198.51.100.0",
+		"request_Forwarded":       redact.Placeholder,
+	} {
+		if redacted[field] != want {
+			t.Errorf("Expected %s %q, got %q", field, want, redacted[field])
+		}
+	}
+	if _, ok := redacted["ClientUsername"]; ok {
+		t.Error("Expected ClientUsername to be dropped")
+	}
+
+	if got := RedactLine(line, nil); got != line {
+		t.Errorf("Expected no policy to leave the line alone, got %s", got)
+	}
+}
+
+func TestRedactCLFLine(t *testing.T) {
+	line := `203.0.113.77 - alice [10/Oct/2024:13:55:36 +0000] "GET /login?token=abc&page=2 HTTP/1.1" 200 512 "https://example.com/?email=a%40b.c" "curl/8.4.0" 1 "web@docker" "http://10.0.0.5:80" 3ms`
+	got := RedactLine(line, testPolicy(t))
+	for _, want := range []string{`203.0.113.0 - - [`, `"GET /login?page=2 HTTP/1.1"`, `"https://example.com/"`, `"curl/8.4.0"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in redacted line %q", want, got)
+		}
+	}
+}
+
+func TestRedactEntry(t *testing.T) {
+	entry := &TraefikLog{
+		ClientHost:       "203.0.113.77",
+		ClientAddr:       "203.0.113.77:51234",
+		ClientUsername:   "alice",
+		RequestPath:      "/login?token=abc&page=2",
+		RequestUserAgent: "curl/8.4.0",
+	}
+	policy := testPolicy(t)
+	policy.Headers = append(policy.Headers, "user-agent")
+	RedactEntry(entry, policy)
+
+	if entry.ClientHost != "203.0.113.0" || entry.ClientAddr != "203.0.113.0" || entry.ClientUsername != "" ||
+		entry.RequestPath != "/login?page=2" || entry.RequestUserAgent != redact.Placeholder {
+		t.Errorf("Unexpected redacted entry: %+v", entry)
+	}
+}
+
+func TestRedactErrorLines(t *testing.T) {
+	lines := []string{`2024-01-02T15:04:05Z ERR error="dial tcp 10.0.0.5:8080: connection refused" url="/login?token=abc"`}
+	got := RedactErrorLines(lines, testPolicy(t))[0]
+	if !strings.Contains(got, "tcp 10.0.0.0:8080") || !strings.Contains(got, `url="/login"`) {
+		t.Errorf("Unexpected redacted error line %q", got)
+	}
+}
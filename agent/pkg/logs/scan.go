@@ -0,0 +1,54 @@
+package logs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrStopScan is returned by a ScanFile callback to stop reading without an error
+var ErrStopScan = errors.New("stop scanning")
+
+// ScanFile calls fn with each non-empty line of a log file, decompressing gzip
+// files. Lines are read one at a time, so files of any size are scanned in
+// constant memory. The scan stops at the first error fn returns, which is
+// returned unless it is ErrStopScan.
+func ScanFile(filePath string, fn func(line string) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var source io.Reader = file
+	if strings.HasSuffix(filePath, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzReader.Close()
+		source = gzReader
+	}
+
+	reader := bufio.NewReaderSize(source, 64*1024)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); strings.TrimSpace(line) != "" {
+			if err := fn(line); err != nil {
+				if errors.Is(err, ErrStopScan) {
+					return nil
+				}
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package logs
 
+import "github.com/hhftechnology/traefik-log-dashboard/agent/pkg/api"
+
 // Position represents a file position for incremental reading
 type Position struct {
 	Position int64  `json:"position"`
@@ -10,6 +12,8 @@ type Position struct {
 type LogResult struct {
 	Logs      []string   `json:"logs"`
 	Positions []Position `json:"positions"`
+	// Locations maps client IPs in Logs to their location when requested with geo=true
+	Locations map[string]api.Location `json:"locations,omitempty"`
 }
 
 // LogFileSize represents information about a log file
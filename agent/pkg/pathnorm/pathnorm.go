@@ -0,0 +1,310 @@
+package pathnorm
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// QueryMode controls how query strings are handled during normalization
+type QueryMode string
+
+const (
+	// QueryStrip drops the query string entirely
+	QueryStrip QueryMode = "strip"
+	// QueryKeys keeps the sorted, de-duplicated parameter names without values
+	QueryKeys QueryMode = "keys"
+)
+
+// DefaultLearnThreshold is the number of distinct values a segment position
+// must see before it is collapsed into a learned placeholder
+const DefaultLearnThreshold = 25
+
+// maxLearnPositions caps the number of segment positions tracked by the learner
+const maxLearnPositions = 10000
+
+// maxLearnedTemplates caps the number of templates the learner keeps
+const maxLearnedTemplates = 1000
+
+// Rule replaces a single path segment matching Pattern with Placeholder
+type Rule struct {
+	Placeholder string
+	Pattern     *regexp.Regexp
+}
+
+// Options configures a Normalizer
+type Options struct {
+	// Rules are evaluated before the built-in rules
+	Rules []Rule
+	// QueryMode defaults to QueryStrip
+	QueryMode QueryMode
+	// LearnThreshold of 0 uses DefaultLearnThreshold, a negative value disables learning
+	LearnThreshold int
+}
+
+// Template represents a path template discovered from traffic
+type Template struct {
+	Template string `json:"template"`
+	Distinct int    `json:"distinct"`
+}
+
+// builtinRules collapse the identifiers commonly found in REST paths
+var builtinRules = []Rule{
+	{Placeholder: "{uuid}", Pattern: regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)},
+	{Placeholder: "{id}", Pattern: regexp.MustCompile(`^\d+$`)},
+	{Placeholder: "{hash}", Pattern: regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)},
+}
+
+// Normalizer collapses request paths into templates such as /api/users/{id}
+type Normalizer struct {
+	rules     []Rule
+	queryMode QueryMode
+	threshold int
+
+	mu      sync.RWMutex
+	seen    map[string]map[string]struct{}
+	learned map[string]int
+}
+
+// New creates a Normalizer with the given options
+func New(opts Options) *Normalizer {
+	rules := make([]Rule, 0, len(opts.Rules)+len(builtinRules))
+	rules = append(rules, opts.Rules...)
+	rules = append(rules, builtinRules...)
+
+	queryMode := opts.QueryMode
+	if queryMode == "" {
+		queryMode = QueryStrip
+	}
+
+	threshold := opts.LearnThreshold
+	if threshold == 0 {
+		threshold = DefaultLearnThreshold
+	}
+
+	return &Normalizer{
+		rules:     rules,
+		queryMode: queryMode,
+		threshold: threshold,
+		seen:      make(map[string]map[string]struct{}),
+		learned:   make(map[string]int),
+	}
+}
+
+// Empty returns a Normalizer with the same rules and options that has learned nothing
+func (n *Normalizer) Empty() *Normalizer {
+	return &Normalizer{
+		rules:     n.rules,
+		queryMode: n.queryMode,
+		threshold: n.threshold,
+		seen:      make(map[string]map[string]struct{}),
+		learned:   make(map[string]int),
+	}
+}
+
+// ParseRules parses rules in the form "{placeholder}:regex" separated by semicolons
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		idx := strings.Index(part, ":")
+		if idx <= 0 || idx == len(part)-1 {
+			return nil, fmt.Errorf("invalid path pattern %q: expected {placeholder}:regex", part)
+		}
+
+		placeholder := part[:idx]
+		if !strings.HasPrefix(placeholder, "{") || !strings.HasSuffix(placeholder, "}") {
+			placeholder = "{" + placeholder + "}"
+		}
+
+		pattern, err := regexp.Compile(part[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %w", part, err)
+		}
+
+		rules = append(rules, Rule{Placeholder: placeholder, Pattern: pattern})
+	}
+	return rules, nil
+}
+
+// ParseQueryMode converts a string to a QueryMode, defaulting to QueryStrip
+func ParseQueryMode(mode string) QueryMode {
+	if QueryMode(strings.ToLower(mode)) == QueryKeys {
+		return QueryKeys
+	}
+	return QueryStrip
+}
+
+// Normalize returns the template for a request path without learning from it
+func (n *Normalizer) Normalize(rawPath string) string {
+	path, query := splitQuery(rawPath)
+	segments := n.applyRules(splitSegments(path))
+	segments = n.applyLearned(segments)
+	return joinSegments(segments) + n.formatQuery(query)
+}
+
+// Observe learns from the request path and returns its template
+func (n *Normalizer) Observe(rawPath string) string {
+	path, query := splitQuery(rawPath)
+	segments := n.applyRules(splitSegments(path))
+	if n.threshold > 0 {
+		n.learn(segments)
+	}
+	segments = n.applyLearned(segments)
+	return joinSegments(segments) + n.formatQuery(query)
+}
+
+// Templates returns the templates learned from traffic so far
+func (n *Normalizer) Templates() []Template {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	templates := make([]Template, 0, len(n.learned))
+	for prefix, distinct := range n.learned {
+		templates = append(templates, Template{
+			Template: joinSegments(splitSegments(prefix)) + "/{param}",
+			Distinct: distinct,
+		})
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Template < templates[j].Template
+	})
+
+	return templates
+}
+
+// applyRules replaces segments matching a rule with its placeholder
+func (n *Normalizer) applyRules(segments []string) []string {
+	for i, segment := range segments {
+		for _, rule := range n.rules {
+			if rule.Pattern.MatchString(segment) {
+				segments[i] = rule.Placeholder
+				break
+			}
+		}
+	}
+	return segments
+}
+
+// applyLearned replaces segments whose parent prefix has been learned as variable
+func (n *Normalizer) applyLearned(segments []string) []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if len(n.learned) == 0 {
+		return segments
+	}
+
+	for i := range segments {
+		if isPlaceholder(segments[i]) {
+			continue
+		}
+		if _, ok := n.learned[prefixKey(segments[:i])]; ok {
+			segments[i] = "{param}"
+		}
+	}
+	return segments
+}
+
+// learn records literal segment values per parent prefix
+func (n *Normalizer) learn(segments []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, segment := range segments {
+		// The first segment is never learned so unrelated top-level paths stay distinct
+		if i == 0 || isPlaceholder(segment) {
+			continue
+		}
+
+		key := prefixKey(segments[:i])
+		if _, ok := n.learned[key]; ok {
+			// Later segments are keyed on the placeholder, not the literal value
+			segments[i] = "{param}"
+			continue
+		}
+
+		values, ok := n.seen[key]
+		if !ok {
+			if len(n.seen) >= maxLearnPositions {
+				continue
+			}
+			values = make(map[string]struct{})
+			n.seen[key] = values
+		}
+
+		// Once no more templates can be learned a position stops collecting values
+		if len(values) >= n.threshold && len(n.learned) >= maxLearnedTemplates {
+			continue
+		}
+
+		values[segment] = struct{}{}
+		if len(values) >= n.threshold && len(n.learned) < maxLearnedTemplates {
+			n.learned[key] = len(values)
+			delete(n.seen, key)
+			segments[i] = "{param}"
+		}
+	}
+}
+
+// formatQuery renders the query string according to the query mode
+func (n *Normalizer) formatQuery(query string) string {
+	if query == "" || n.queryMode != QueryKeys {
+		return ""
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil || len(values) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return "?" + strings.Join(keys, "&")
+}
+
+// splitQuery separates the path from its query string
+func splitQuery(rawPath string) (string, string) {
+	if idx := strings.IndexByte(rawPath, '?'); idx != -1 {
+		return rawPath[:idx], rawPath[idx+1:]
+	}
+	return rawPath, ""
+}
+
+// splitSegments splits a path into its non-empty segments
+func splitSegments(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// joinSegments joins segments back into an absolute path
+func joinSegments(segments []string) string {
+	return "/" + strings.Join(segments, "/")
+}
+
+// prefixKey builds the learner key for the segments preceding a position
+func prefixKey(segments []string) string {
+	return strings.Join(segments, "/")
+}
+
+// isPlaceholder reports whether a segment has already been templated
+func isPlaceholder(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
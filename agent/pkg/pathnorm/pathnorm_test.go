@@ -0,0 +1,93 @@
+package pathnorm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	rules, err := ParseRules(`sku:^[A-Z]{3}-\d+$`)
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	n := New(Options{Rules: rules, QueryMode: QueryKeys})
+
+	for path, want := range map[string]string{
+		"/api/users/123": "/api/users/{id}",
+		"/api/orders/0b7f6a8e-4c1d-4f2a-9a3b-6c5d4e3f2a1b": "/api/orders/{uuid}",
+		"/assets/9f86d081884c7d659a2feaa0c55ad015":         "/assets/{hash}",
+		"/products/ABC-42":               "/products/{sku}",
+		"/search?q=shoes&page=2&q=boots": "/search?page&q",
+		"//health/":                      "/health",
+	} {
+		if got := n.Normalize(path); got != want {
+			t.Errorf("Normalize(%q): expected %q, got %q", path, want, got)
+		}
+	}
+
+	if got := New(Options{}).Normalize("/search?q=shoes"); got != "/search" {
+		t.Errorf("Expected the query to be stripped by default, got %q", got)
+	}
+
+	for _, spec := range []string{"nocolon", "{x}:", "{x}:("} {
+		if _, err := ParseRules(spec); err == nil {
+			t.Errorf("Expected rule %q to be rejected", spec)
+		}
+	}
+}
+
+func TestLearning(t *testing.T) {
+	n := New(Options{LearnThreshold: 3})
+
+	// Normalize never learns
+	for i := 0; i < 5; i++ {
+		n.Normalize(fmt.Sprintf("/customers/c%d/orders", i))
+	}
+	if templates := n.Templates(); len(templates) != 0 {
+		t.Fatalf("Expected Normalize not to learn, got %+v", templates)
+	}
+
+	for i := 0; i < 3; i++ {
+		n.Observe(fmt.Sprintf("/customers/c%d/orders", i))
+	}
+	if got := n.Normalize("/customers/someone/orders"); got != "/customers/{param}/orders" {
+		t.Errorf("Expected a learned template, got %q", got)
+	}
+	if templates := n.Templates(); len(templates) != 1 || templates[0].Template != "/customers/{param}" || templates[0].Distinct != 3 {
+		t.Errorf("Unexpected templates: %+v", templates)
+	}
+
+	// The first segment stays literal
+	for i := 0; i < 5; i++ {
+		n.Observe(fmt.Sprintf("/page%d", i))
+	}
+	if got := n.Normalize("/page9"); got != "/page9" {
+		t.Errorf("Expected the first segment to stay literal, got %q", got)
+	}
+
+	// An empty copy keeps the rules but none of what was learned
+	empty := n.Empty()
+	if got := empty.Normalize("/customers/someone/orders/7"); got != "/customers/someone/orders/{id}" {
+		t.Errorf("Expected an empty copy to have learned nothing, got %q", got)
+	}
+
+	if disabled := New(Options{LearnThreshold: -1}); disabled.Observe("/a/b") != "/a/b" || len(disabled.Templates()) != 0 {
+		t.Error("Expected a negative threshold to disable learning")
+	}
+}
+
+func TestLearningBounds(t *testing.T) {
+	n := New(Options{LearnThreshold: 2})
+	for i := 0; i < maxLearnedTemplates+10; i++ {
+		n.Observe(fmt.Sprintf("/tenant-%d/a", i))
+		n.Observe(fmt.Sprintf("/tenant-%d/b", i))
+	}
+	if len(n.learned) != maxLearnedTemplates {
+		t.Errorf("Expected %d learned templates, got %d", maxLearnedTemplates, len(n.learned))
+	}
+	for key, values := range n.seen {
+		if len(values) > n.threshold {
+			t.Errorf("Expected at most %d values for %s once templates are full, got %d", n.threshold, key, len(values))
+		}
+	}
+}
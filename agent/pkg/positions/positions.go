@@ -0,0 +1,188 @@
+package positions
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/fsutil"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+)
+
+var log = logger.With("positions")
+
+// Store tracks how far each log file has been read and persists the offsets
+// as a JSON object keyed by file path. Changes are written by a single writer,
+// see Run and Flush.
+type Store struct {
+	path string
+
+	mu        sync.RWMutex
+	positions map[string]int64
+	dirty     bool
+
+	// changed wakes the writer; saveMu serialises writes of the file
+	changed chan struct{}
+	saveMu  sync.Mutex
+}
+
+// Open loads the store from path; a missing file yields an empty store and an
+// empty path keeps positions in memory only
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, positions: make(map[string]int64), changed: make(chan struct{}, 1)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s.positions); err != nil {
+		return s, err
+	}
+	if s.positions == nil {
+		s.positions = make(map[string]int64)
+	}
+	return s, nil
+}
+
+// Path returns the file the positions are persisted to
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the tracked offset of a file
+func (s *Store) Get(file string) (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	position, ok := s.positions[file]
+	return position, ok
+}
+
+// Set updates the tracked offset of a file; the change is persisted by the writer
+func (s *Store) Set(file string, position int64) {
+	s.mu.Lock()
+	if current, ok := s.positions[file]; ok && current == position {
+		s.mu.Unlock()
+		return
+	}
+	s.positions[file] = position
+	s.dirty = true
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of tracked files
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.positions)
+}
+
+// Files returns the tracked files in sorted order
+func (s *Store) Files() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := make([]string, 0, len(s.positions))
+	for file := range s.positions {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Reset forgets the given files, or every file when none are given, and
+// returns how many entries were removed
+func (s *Store) Reset(files ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(files) == 0 {
+		removed := len(s.positions)
+		s.positions = make(map[string]int64)
+		s.dirty = s.dirty || removed > 0
+		return removed
+	}
+
+	removed := 0
+	for _, file := range files {
+		if _, ok := s.positions[file]; ok {
+			delete(s.positions, file)
+			removed++
+		}
+	}
+	s.dirty = s.dirty || removed > 0
+	return removed
+}
+
+// Run writes changed positions at most once per delay until the context is
+// cancelled. Callers should Flush after it returns to persist the last changes.
+func (s *Store) Run(ctx context.Context, delay time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed:
+		}
+
+		// Let further changes accumulate before writing
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if err := s.Flush(); err != nil {
+			log.Error("Failed to save positions", logger.KeyPath, s.path, logger.Err(err))
+		}
+	}
+}
+
+// Flush writes the positions if they changed since the last write
+func (s *Store) Flush() error {
+	s.mu.RLock()
+	dirty := s.dirty
+	s.mu.RUnlock()
+	if !dirty {
+		return nil
+	}
+	return s.Save()
+}
+
+// Save writes the positions to disk atomically and syncs them
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.positions, "", "  ")
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFileAtomic(s.path, data, 0644); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IP redaction modes
+const (
+	IPNone     = "none"
+	IPTruncate = "truncate"
+	IPHash     = "hash"
+)
+
+// Placeholder replaces redacted header values
+const Placeholder = "[REDACTED]"
+
+// Default prefix lengths kept when truncating addresses
+const (
+	DefaultIPv4Prefix = 24
+	DefaultIPv6Prefix = 48
+)
+
+// Policy describes what is removed from log data before it is served
+type Policy struct {
+	// IP is none, truncate (zero the host bits) or hash (keyed HMAC-SHA256)
+	IP         string `json:"ip"`
+	IPv4Prefix int    `json:"ipv4_prefix,omitempty"`
+	IPv6Prefix int    `json:"ipv6_prefix,omitempty"`
+	HashKey    string `json:"hash_key,omitempty"`
+	// DropUsername removes ClientUsername
+	DropUsername bool `json:"drop_username,omitempty"`
+	// QueryParams are query parameter names or patterns such as *token* that are stripped
+	QueryParams []string `json:"query_params,omitempty"`
+	// Headers are header names or patterns whose captured values are replaced
+	Headers []string `json:"headers,omitempty"`
+}
+
+// Rule applies a policy to identities holding any of its scopes
+type Rule struct {
+	Scopes []string `json:"scopes"`
+	Policy
+}
+
+// Set picks the policy for a request from the scopes of its identity
+type Set struct {
+	defaultPolicy *Policy
+	rules         []Rule
+}
+
+// policyFile is the on-disk format of the scope rules
+type policyFile struct {
+	Policies []Rule `json:"policies"`
+}
+
+// IsZero reports whether the policy leaves data untouched
+func (p *Policy) IsZero() bool {
+	return p == nil || (!p.RedactsIPs() && !p.DropUsername && len(p.QueryParams) == 0 && len(p.Headers) == 0)
+}
+
+// Validate checks the policy and fills in default prefix lengths
+func (p *Policy) Validate() error {
+	p.IP = strings.ToLower(strings.TrimSpace(p.IP))
+	switch p.IP {
+	case "", IPNone, IPTruncate:
+	case IPHash:
+		if p.HashKey == "" {
+			return errors.New("IP hashing requires a hash key")
+		}
+	default:
+		return fmt.Errorf("invalid IP redaction mode %q: expected none, truncate or hash", p.IP)
+	}
+
+	if p.IPv4Prefix == 0 {
+		p.IPv4Prefix = DefaultIPv4Prefix
+	}
+	if p.IPv6Prefix == 0 {
+		p.IPv6Prefix = DefaultIPv6Prefix
+	}
+	if p.IPv4Prefix < 0 || p.IPv4Prefix > 32 || p.IPv6Prefix < 0 || p.IPv6Prefix > 128 {
+		return errors.New("IP prefix lengths must be 0-32 for IPv4 and 0-128 for IPv6")
+	}
+
+	for _, pattern := range append(append([]string{}, p.QueryParams...), p.Headers...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// NewSet creates a policy set. Without rules, identities holding the admin scope
+// see raw data and everyone else gets the default policy.
+func NewSet(defaultPolicy Policy, rules []Rule) (*Set, error) {
+	if err := defaultPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []Rule{{Scopes: []string{"admin"}}}
+	}
+	for i := range rules {
+		if rules[i].HashKey == "" {
+			rules[i].HashKey = defaultPolicy.HashKey
+		}
+		if err := rules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("policy for scopes %v: %w", rules[i].Scopes, err)
+		}
+	}
+	return &Set{defaultPolicy: &defaultPolicy, rules: rules}, nil
+}
+
+// LoadSet creates a policy set with scope rules read from a JSON file; an empty
+// path keeps the built-in admin rule
+func LoadSet(defaultPolicy Policy, file string) (*Set, error) {
+	if file == "" {
+		return NewSet(defaultPolicy, nil)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redaction policy file: %w", err)
+	}
+	var parsed policyFile
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse redaction policy file: %w", err)
+	}
+	if parsed.Policies == nil {
+		parsed.Policies = []Rule{}
+	}
+	return NewSet(defaultPolicy, parsed.Policies)
+}
+
+// Enabled reports whether any policy redacts data
+func (s *Set) Enabled() bool {
+	if s == nil {
+		return false
+	}
+	if !s.defaultPolicy.IsZero() {
+		return true
+	}
+	for i := range s.rules {
+		if !s.rules[i].IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// Default returns the policy for requests without an identity and for stored data
+func (s *Set) Default() *Policy {
+	if s == nil {
+		return nil
+	}
+	return s.defaultPolicy
+}
+
+// For returns the policy of the first rule sharing a scope with the identity,
+// or the default policy. Scopes are compared exactly, so admin only matches rules
+// that name it.
+func (s *Set) For(scopes []string) *Policy {
+	if s == nil {
+		return nil
+	}
+	for i := range s.rules {
+		for _, scope := range s.rules[i].Scopes {
+			for _, held := range scopes {
+				if scope == held {
+					return &s.rules[i].Policy
+				}
+			}
+		}
+	}
+	return s.defaultPolicy
+}
+
+// RedactsIPs reports whether client addresses are truncated or hashed
+func (p *Policy) RedactsIPs() bool {
+	return p != nil && (p.IP == IPTruncate || p.IP == IPHash)
+}
+
+// IPAddress redacts a single address; values that are not addresses are returned unchanged
+func (p *Policy) IPAddress(ip string) string {
+	if p == nil || ip == "" {
+		return ip
+	}
+
+	switch p.IP {
+	case IPTruncate:
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return ip
+		}
+		addr = addr.Unmap()
+		bits := p.IPv6Prefix
+		if addr.Is4() {
+			bits = p.IPv4Prefix
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return ip
+		}
+		return prefix.Addr().String()
+	case IPHash:
+		if _, err := netip.ParseAddr(ip); err != nil {
+			return ip
+		}
+		mac := hmac.New(sha256.New, []byte(p.HashKey))
+		mac.Write([]byte(ip))
+		return "ip-" + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+	return ip
+}
+
+// IPList redacts every address in a comma-separated list such as X-Forwarded-For
+func (p *Policy) IPList(value string) string {
+	if !p.RedactsIPs() {
+		return value
+	}
+	hops := strings.Split(value, ",")
+	for i, hop := range hops {
+		trimmed := strings.TrimSpace(hop)
+		if addrPort, err := netip.ParseAddrPort(trimmed); err == nil {
+			trimmed = addrPort.Addr().String()
+		}
+		hops[i] = p.IPAddress(strings.Trim(trimmed, "[]"))
+	}
+	return strings.Join(hops, ", ")
+}
+
+// HostPort redacts the address of a host:port pair, dropping the port
+func (p *Policy) HostPort(value string) string {
+	if !p.RedactsIPs() {
+		return value
+	}
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return p.IPAddress(addrPort.Addr().Unmap().String())
+	}
+	return p.IPAddress(value)
+}
+
+// URL strips matching query parameters from a path or URL, keeping the order of the others
+func (p *Policy) URL(value string) string {
+	if p == nil || len(p.QueryParams) == 0 {
+		return value
+	}
+
+	base, query, ok := strings.Cut(value, "?")
+	if !ok {
+		return value
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if param == "" || p.stripsParam(name) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+
+	result := base
+	if len(kept) > 0 {
+		result += "?" + strings.Join(kept, "&")
+	}
+	if hasFragment {
+		result += "#" + fragment
+	}
+	return result
+}
+
+var (
+	// textIPv6 and textIPv4 find candidate addresses in free text; candidates
+	// that don't parse, such as times, are left alone
+	textIPv6 = regexp.MustCompile(`[0-9A-Fa-f:]*:[0-9A-Fa-f]*:[0-9A-Fa-f:.]*`)
+	textIPv4 = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	// textURL finds paths and URLs with a query string
+	textURL = regexp.MustCompile(`(?:[A-Za-z][A-Za-z0-9+.-]*://[^\s"'<>?\\]*|/[^\s"'<>?\\]*)\?[^\s"'<>\\]*`)
+)
+
+// Text redacts the addresses and the query parameters of the URLs that
+// appear in free text, such as an error log line
+func (p *Policy) Text(value string) string {
+	if p.RedactsIPs() {
+		value = textIPv6.ReplaceAllStringFunc(value, p.textIP)
+		value = textIPv4.ReplaceAllStringFunc(value, p.textIP)
+	}
+	if p != nil && len(p.QueryParams) > 0 {
+		value = textURL.ReplaceAllStringFunc(value, p.URL)
+	}
+	return value
+}
+
+// textIP redacts a candidate address found in text
+func (p *Policy) textIP(candidate string) string {
+	if _, err := netip.ParseAddr(candidate); err != nil {
+		return candidate
+	}
+	return p.IPAddress(candidate)
+}
+
+// RedactsHeader reports whether the values of a header are replaced
+func (p *Policy) RedactsHeader(name string) bool {
+	if p == nil {
+		return false
+	}
+	return matchAny(p.Headers, name)
+}
+
+// stripsParam reports whether a query parameter is removed. Names are matched
+// decoded, as the application reads them, so ?%74oken= is stripped like
+// ?token=; names that can't be decoded are stripped.
+func (p *Policy) stripsParam(name string) bool {
+	decoded, err := url.QueryUnescape(name)
+	if err != nil {
+		return true
+	}
+	return matchAny(p.QueryParams, name) || matchAny(p.QueryParams, decoded)
+}
+
+// matchAny reports whether name matches a pattern, ignoring case
+func matchAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == name {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
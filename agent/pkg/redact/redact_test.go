@@ -0,0 +1,130 @@
+package redact
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIPAddress(t *testing.T) {
+	truncate := &Policy{IP: IPTruncate}
+	if err := truncate.Validate(); err != nil {
+		t.Fatalf("Failed to validate policy: %v", err)
+	}
+	for ip, want := range map[string]string{
+		"203.0.113.77":        "203.0.113.0",
+		"::ffff:203.0.113.77": "203.0.113.0",
+		"2001:db8:1:2::7":     "2001:db8:1::",
+		"not-an-ip":           "not-an-ip",
+	} {
+		if got := truncate.IPAddress(ip); got != want {
+			t.Errorf("IPAddress(%q): expected %q, got %q", ip, want, got)
+		}
+	}
+	if got := truncate.IPList("198.51.100.23, [2001:db8::1]:443"); got != "198.51.100.0, 2001:db8::" {
+		t.Errorf("Unexpected redacted list %q", got)
+	}
+	if got := truncate.HostPort("203.0.113.77:51234"); got != "203.0.113.0" {
+		t.Errorf("Expected the port to be dropped, got %q", got)
+	}
+
+	// Hashing is keyed and stable
+	hashing := &Policy{IP: IPHash, HashKey: "k1"}
+	if err := hashing.Validate(); err != nil {
+		t.Fatalf("Failed to validate policy: %v", err)
+	}
+	first, second := hashing.IPAddress("203.0.113.77"), hashing.IPAddress("203.0.113.77")
+	if first != second || first == "203.0.113.77" || !strings.HasPrefix(first, "ip-") {
+		t.Errorf("Unexpected hashed address %q", first)
+	}
+	other := &Policy{IP: IPHash, HashKey: "k2"}
+	if other.IPAddress("203.0.113.77") == first {
+		t.Error("Expected another key to hash differently")
+	}
+
+	var none *Policy
+	if none.IPAddress("203.0.113.77") != "203.0.113.77" || none.RedactsIPs() || !none.IsZero() {
+		t.Error("Expected a nil policy to leave addresses alone")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, policy := range []Policy{
+		{IP: IPHash},
+		{IP: "scramble"},
+		{IP: IPTruncate, IPv4Prefix: 33},
+		{QueryParams: []string{"["}},
+	} {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected policy %+v to be rejected", policy)
+		}
+	}
+
+	policy := Policy{IP: " Truncate "}
+	if err := policy.Validate(); err != nil || policy.IP != IPTruncate || policy.IPv4Prefix != DefaultIPv4Prefix || policy.IPv6Prefix != DefaultIPv6Prefix {
+		t.Errorf("Expected the mode to be normalized and default prefixes set, got %+v, %v", policy, err)
+	}
+}
+
+func TestURLAndText(t *testing.T) {
+	policy := &Policy{IP: IPTruncate, QueryParams: []string{"token", "e*"}}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Failed to validate policy: %v", err)
+	}
+
+	for value, want := range map[string]string{
+		"/login?token=abc&%74oken=def&page=2":  "/login?page=2",
+		"https://example.com/?email=a%40b.c#x": "https://example.com/#x",
+		"/search?TOKEN=1&q=shoes":              "/search?q=shoes",
+		"/search?%zz=1&q=shoes":                "/search?q=shoes",
+		"/no-query":                            "/no-query",
+	} {
+		if got := policy.URL(value); got != want {
+			t.Errorf("URL(%q): expected %q, got %q", value, want, got)
+		}
+	}
+
+	line := `2024-01-02T15:04:05Z ERR error="dial tcp 10.0.0.5:8080: connection refused" client=2001:db8::7 url="/login?%74oken=abc&page=2"`
+	got := policy.Text(line)
+	for _, want := range []string{"15:04:05Z", "tcp 10.0.0.0:8080", "client=2001:db8:: ", `url="/login?page=2"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in redacted text %q", want, got)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	set, err := NewSet(Policy{IP: IPTruncate}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create policies: %v", err)
+	}
+	if !set.For([]string{"admin"}).IsZero() {
+		t.Error("Expected admins to see raw data by default")
+	}
+	if policy := set.For([]string{"logs:access"}); policy != set.Default() || !set.Enabled() {
+		t.Error("Expected other scopes to get the default policy")
+	}
+
+	file := t.TempDir() + "/policies.json"
+	if err := os.WriteFile(file, []byte(`{"policies":[{"scopes":["support"],"ip":"hash","drop_username":true}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	set, err = LoadSet(Policy{HashKey: "k1"}, file)
+	if err != nil {
+		t.Fatalf("Failed to load policies: %v", err)
+	}
+	if policy := set.For([]string{"logs:access", "support"}); policy.IP != IPHash || policy.HashKey != "k1" || !policy.DropUsername {
+		t.Errorf("Expected the support policy with the default hash key, got %+v", policy)
+	}
+	if !set.For([]string{"admin"}).IsZero() {
+		t.Error("Expected a policy file without an admin rule to give admins the default policy")
+	}
+
+	if _, err := NewSet(Policy{IP: IPHash}, nil); err == nil {
+		t.Error("Expected an error for hashing without a key")
+	}
+	var disabled *Set
+	if disabled.Enabled() || disabled.For([]string{"admin"}) != nil {
+		t.Error("Expected a nil set to redact nothing")
+	}
+}
@@ -0,0 +1,245 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+)
+
+// maxLineSize matches the limit of the access log pipeline
+const maxLineSize = 1024 * 1024
+
+// Run follows the error logs, seals the in-memory segment once it is old
+// enough and prunes expired segments, every interval until the context is
+// cancelled. Call Flush afterwards to seal what is left in memory.
+func (idx *Index) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		idx.poll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (idx *Index) poll() {
+	if idx.cfg.ErrorPath != "" {
+		files, err := errorFiles(idx.cfg.ErrorPath)
+		if err != nil && !os.IsNotExist(err) {
+			log.Warn("Failed to list error logs", logger.KeyPath, idx.cfg.ErrorPath, logger.Err(err))
+		}
+		for _, file := range files {
+			if err := idx.readErrors(file); err != nil {
+				log.Warn("Failed to index error log", logger.KeyPath, file, logger.Err(err))
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	if len(idx.active.Docs) > 0 && time.Since(idx.active.created) >= idx.cfg.SegmentSpan {
+		if err := idx.sealLocked(); err != nil {
+			log.Error("Failed to seal search segment", logger.Err(err))
+		}
+	}
+	idx.mu.Unlock()
+
+	if err := idx.Prune(); err != nil {
+		log.Error("Failed to prune search index", logger.Err(err))
+	}
+}
+
+// errorFiles returns the error log files under path: the file itself, or the
+// .log files with "error" in their name when path is a directory
+func errorFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".log") && strings.Contains(name, "error") {
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// readErrors indexes the complete lines appended to an error log since the
+// last poll
+func (idx *Index) readErrors(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	identity, err := ingest.FileIdentity(file)
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	offset, seen := idx.manifest.ErrorOffsets[path]
+	known := idx.manifest.ErrorIdentities[path]
+	idx.mu.Unlock()
+
+	if !seen {
+		offset = max(size-idx.cfg.Backfill, 0)
+	} else if offset > size || (known != "" && identity != known) {
+		// The file was truncated or replaced by rotation
+		offset = 0
+	}
+	if offset == size {
+		idx.mu.Lock()
+		idx.manifest.ErrorOffsets[path] = offset
+		idx.manifest.ErrorIdentities[path] = identity
+		idx.mu.Unlock()
+		return nil
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	if !seen && offset > 0 {
+		// Skip the partial line we landed in
+		skipped, err := reader.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+		offset += int64(len(skipped))
+	}
+
+	var docs []Doc
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave incomplete trailing lines for the next poll
+			break
+		}
+		lineOffset := offset
+		offset += int64(len(line))
+
+		line = strings.TrimSpace(line)
+		if line == "" || len(line) > maxLineSize {
+			continue
+		}
+		ts, level, message := ParseErrorLine(line)
+		if ts.IsZero() {
+			ts = time.Now().UTC()
+		}
+		docs = append(docs, Doc{
+			Source: logfiles.SourceError,
+			File:   filepath.Base(path),
+			Offset: lineOffset,
+			Time:   ts,
+			Fields: map[string]string{FieldMessage: message, FieldLevel: level},
+		})
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, doc := range docs {
+		doc.Fields[FieldMessage] = idx.policy.Text(doc.Fields[FieldMessage])
+		doc.Fields = fields(doc.Fields)
+		idx.addLocked(doc)
+	}
+	idx.manifest.ErrorOffsets[path] = offset
+	idx.manifest.ErrorIdentities[path] = identity
+	return nil
+}
+
+// levelNames expands the abbreviated levels of Traefik's console log format
+var levelNames = map[string]string{
+	"TRC": "trace",
+	"DBG": "debug",
+	"INF": "info",
+	"WRN": "warn",
+	"ERR": "error",
+	"FTL": "fatal",
+	"PNC": "panic",
+}
+
+var (
+	logfmtTime  = regexp.MustCompile(`(?:^|\s)time="([^"]*)"`)
+	logfmtLevel = regexp.MustCompile(`(?:^|\s)level=(\w+)`)
+)
+
+// ParseErrorLine reads the time, level and message of a Traefik log line in
+// the JSON, logfmt (time="..." level=error msg="...") or console
+// (2024-01-02T15:04:05Z ERR ...) format. The message is the rest of the
+// line, so fields such as error="..." stay searchable; the time is zero when
+// the line has none.
+func ParseErrorLine(line string) (time.Time, string, string) {
+	if strings.HasPrefix(line, "{") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err == nil {
+			ts, _ := time.Parse(time.RFC3339, stringField(fields, "time"))
+			level := strings.ToLower(stringField(fields, "level"))
+			message := stringField(fields, "message")
+			if message == "" {
+				message = stringField(fields, "msg")
+			}
+			if errText := stringField(fields, "error"); errText != "" {
+				message = strings.TrimSpace(message + " error=" + errText)
+			}
+			return ts, level, message
+		}
+	}
+
+	if match := logfmtTime.FindStringSubmatchIndex(line); match != nil {
+		ts, _ := time.Parse(time.RFC3339, line[match[2]:match[3]])
+		var level string
+		rest := line[:match[0]] + line[match[1]:]
+		if levelMatch := logfmtLevel.FindStringSubmatchIndex(rest); levelMatch != nil {
+			level = strings.ToLower(rest[levelMatch[2]:levelMatch[3]])
+			rest = rest[:levelMatch[0]] + rest[levelMatch[1]:]
+		}
+		return ts, level, strings.TrimSpace(rest)
+	}
+
+	first, rest, _ := strings.Cut(line, " ")
+	if ts, err := time.Parse(time.RFC3339, first); err == nil {
+		code, message, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if level, ok := levelNames[code]; ok {
+			return ts, level, strings.TrimSpace(message)
+		}
+		return ts, "", strings.TrimSpace(rest)
+	}
+	return time.Time{}, "", line
+}
+
+func stringField(fields map[string]interface{}, key string) string {
+	value, _ := fields[key].(string)
+	return value
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTokenLen caps indexed tokens, in runes; longer tokens are cut, in
+// queries too, so they still match
+const maxTokenLen = 64
+
+// minPrefixLen is the shortest prefix a prefix query accepts, so one query
+// can't expand to most of the dictionary
+const minPrefixLen = 2
+
+// Clause matches a term, a phrase of consecutive terms or a prefix in one of
+// its fields
+type Clause struct {
+	// Fields are the fields searched: the one named in the query or the
+	// query's default fields
+	Fields []string `json:"fields"`
+	Tokens []string `json:"tokens"`
+	// Prefix is set when the last token is a prefix
+	Prefix bool `json:"prefix,omitempty"`
+}
+
+// Query matches the entries that match all of its clauses
+type Query struct {
+	Clauses []Clause `json:"clauses"`
+}
+
+// ParseQuery parses a query. Clauses are separated by spaces and must all
+// match: a term such as timeout, a phrase in double quotes such as
+// "connection refused", or a prefix ending with * such as curl*. A clause is
+// confined to a field with a field name and a colon, such as
+// user_agent:curl* or status:502; unqualified clauses search fields, or
+// DefaultFields when none are given. Text that tokenizes to several terms,
+// such as a request ID or a path, is matched as a phrase.
+func ParseQuery(text string, fields []string) (*Query, error) {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	for _, field := range fields {
+		if !IsField(field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	q := &Query{}
+	rest := strings.TrimSpace(text)
+	for rest != "" {
+		clause := Clause{Fields: fields}
+		if name, value, ok := strings.Cut(rest, ":"); ok && IsField(strings.ToLower(name)) && !strings.ContainsAny(name, " \"") {
+			clause.Fields = []string{strings.ToLower(name)}
+			rest = value
+		}
+
+		var word string
+		quoted := strings.HasPrefix(rest, `"`)
+		if quoted {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated phrase in %q", text)
+			}
+			word, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			word, rest = rest[:end], rest[end:]
+		}
+		rest = strings.TrimSpace(rest)
+
+		if !quoted && strings.HasSuffix(word, "*") {
+			word = strings.TrimRight(word, "*")
+			clause.Prefix = true
+		}
+		clause.Tokens = Tokenize(word)
+		if len(clause.Tokens) == 0 {
+			continue
+		}
+		if clause.Prefix && utf8.RuneCountInString(clause.Tokens[len(clause.Tokens)-1]) < minPrefixLen {
+			return nil, fmt.Errorf("prefix %q must have at least %d characters", word, minPrefixLen)
+		}
+		q.Clauses = append(q.Clauses, clause)
+	}
+
+	if len(q.Clauses) == 0 {
+		return nil, fmt.Errorf("query has no searchable terms")
+	}
+	return q, nil
+}
+
+// Matches reports whether the fields of an entry match every clause. The
+// index finds candidates with it, and callers that rewrite fields, such as
+// redaction, check the rewritten fields with it again.
+func (q *Query) Matches(fields map[string]string) bool {
+	for _, clause := range q.Clauses {
+		if !clause.matches(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Clause) matches(fields map[string]string) bool {
+	for _, field := range c.Fields {
+		if value, ok := fields[field]; ok && c.matchesTokens(Tokenize(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesTokens reports whether the clause's tokens appear consecutively in tokens
+func (c Clause) matchesTokens(tokens []string) bool {
+	n := len(c.Tokens)
+	for start := 0; start+n <= len(tokens); start++ {
+		matched := true
+		for i, token := range c.Tokens {
+			if c.Prefix && i == n-1 {
+				matched = strings.HasPrefix(tokens[start+i], token)
+			} else {
+				matched = tokens[start+i] == token
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokenize splits text into lowercase runs of letters and digits
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		word = strings.ToLower(word)
+		if utf8.RuneCountInString(word) > maxTokenLen {
+			word = string([]rune(word)[:maxTokenLen])
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
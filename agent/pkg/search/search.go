@@ -0,0 +1,759 @@
+// Package search maintains an on-disk inverted index over selected fields of
+// the access and error logs. Entries are indexed into an in-memory segment
+// that is sealed to disk once it is large or old enough; sealed segments are
+// dropped when they fall out of the retention window. Entries are redacted
+// before they are indexed. Every result names the file and byte offset its
+// line was read from.
+package search
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/fsutil"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+)
+
+var log = logger.With("search")
+
+// Fields
+const (
+	FieldPath       = "path"
+	FieldHost       = "host"
+	FieldUserAgent  = "user_agent"
+	FieldReferer    = "referer"
+	FieldRequestID  = "request_id"
+	FieldMessage    = "message"
+	FieldMethod     = "method"
+	FieldStatus     = "status"
+	FieldRouter     = "router"
+	FieldService    = "service"
+	FieldEntryPoint = "entrypoint"
+	FieldLevel      = "level"
+)
+
+// DefaultFields are searched by clauses that don't name a field
+var DefaultFields = []string{FieldPath, FieldHost, FieldUserAgent, FieldReferer, FieldRequestID, FieldMessage}
+
+// Fields lists every indexed field; the ones beyond DefaultFields are only
+// searched when a clause names them
+var Fields = append(append([]string(nil), DefaultFields...),
+	FieldMethod, FieldStatus, FieldRouter, FieldService, FieldEntryPoint, FieldLevel)
+
+// IsField reports whether name is an indexed field
+func IsField(name string) bool {
+	return slices.Contains(Fields, name)
+}
+
+// maxFieldLen caps the bytes of a field that are stored and indexed
+const maxFieldLen = 4096
+
+// cachedSegments is how many sealed segments are kept decoded for queries
+const cachedSegments = 8
+
+const manifestName = "index.json"
+
+// Config configures an index
+type Config struct {
+	// Dir holds the segments and the manifest listing them
+	Dir string
+	// Retention is how long entries stay searchable
+	Retention time.Duration
+	// SegmentDocs and SegmentSpan seal the in-memory segment once it holds
+	// that many entries or its first entry was indexed that long ago
+	SegmentDocs int
+	SegmentSpan time.Duration
+	// ErrorPath is the error log file or directory followed by Run
+	ErrorPath string
+	// Backfill is how many bytes before the end of an error log are indexed
+	// when it is first seen
+	Backfill int64
+}
+
+// Doc is an indexed log entry
+type Doc struct {
+	Source string `json:"source"`
+	// File is the name of the file the entry was read from, as listed by
+	// /api/logs/files, and Offset the byte offset of its line
+	File   string            `json:"file"`
+	Offset int64             `json:"offset"`
+	Time   time.Time         `json:"time"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Options narrows a search
+type Options struct {
+	From, To time.Time
+	// Sources limits the search to these sources; empty searches all
+	Sources []string
+	Limit   int
+	// Filter, when set, drops matching entries it returns false for; it may
+	// rewrite the entry's fields
+	Filter func(doc *Doc) bool
+}
+
+// Results are the entries that matched a search, newest first
+type Results struct {
+	Docs []Doc
+	// Truncated is set when more entries matched than the limit
+	Truncated bool
+}
+
+// Stats describes the index
+type Stats struct {
+	Docs     int       `json:"docs"`
+	Segments int       `json:"segments"`
+	Bytes    int64     `json:"bytes"`
+	Oldest   time.Time `json:"oldest,omitempty"`
+}
+
+// Index is an inverted index of log entries
+type Index struct {
+	cfg Config
+
+	mu       sync.Mutex
+	active   *segment
+	manifest manifest
+	// policy redacts entries before they are indexed
+	policy *redact.Policy
+
+	cacheMu sync.Mutex
+	cache   map[string]*segment
+	// recent lists the cached segments, most recently used last
+	recent []string
+}
+
+// manifest lists the sealed segments and how far each log file was indexed
+type manifest struct {
+	Segments []segmentInfo `json:"segments"`
+	// Marks holds the offset and time of the last access log entry indexed
+	// from each file, so entries replayed after a restart aren't indexed twice
+	Marks map[string]mark `json:"marks"`
+	// ErrorOffsets holds how far each error log file has been read
+	ErrorOffsets map[string]int64 `json:"error_offsets"`
+	// ErrorIdentities tell whether an error log is still the file its offset
+	// was read from
+	ErrorIdentities map[string]string `json:"error_identities,omitempty"`
+	// Policy fingerprints the redaction policy the segments were indexed with
+	Policy string `json:"policy,omitempty"`
+	Next   int    `json:"next"`
+}
+
+type segmentInfo struct {
+	File  string    `json:"file"`
+	Min   time.Time `json:"min"`
+	Max   time.Time `json:"max"`
+	Docs  int       `json:"docs"`
+	Bytes int64     `json:"bytes"`
+}
+
+type mark struct {
+	Offset int64     `json:"offset"`
+	Time   time.Time `json:"time"`
+}
+
+// segment is a set of entries and the postings of their terms. Terms are
+// keyed by field and token, such as "path:login", and list the ids of the
+// entries holding them in ascending order.
+type segment struct {
+	Docs    []Doc               `json:"docs"`
+	Terms   map[string][]uint32 `json:"terms"`
+	created time.Time
+	// keys are the sorted term keys, for prefix lookups
+	keys []string
+}
+
+func newSegment() *segment {
+	return &segment{Terms: make(map[string][]uint32), created: time.Now()}
+}
+
+// Open opens the index in cfg.Dir, creating it when needed. Segments the
+// manifest doesn't list, left by a crash, are removed.
+func Open(cfg Config) (*Index, error) {
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+	if cfg.SegmentDocs <= 0 {
+		cfg.SegmentDocs = 50000
+	}
+	if cfg.SegmentSpan <= 0 {
+		cfg.SegmentSpan = time.Hour
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	idx := &Index{cfg: cfg, active: newSegment(), cache: make(map[string]*segment)}
+	data, err := os.ReadFile(filepath.Join(cfg.Dir, manifestName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read index manifest: %w", err)
+	default:
+		if err := json.Unmarshal(data, &idx.manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse index manifest: %w", err)
+		}
+	}
+	if idx.manifest.Marks == nil {
+		idx.manifest.Marks = make(map[string]mark)
+	}
+	if idx.manifest.ErrorOffsets == nil {
+		idx.manifest.ErrorOffsets = make(map[string]int64)
+	}
+	if idx.manifest.ErrorIdentities == nil {
+		idx.manifest.ErrorIdentities = make(map[string]string)
+	}
+
+	listed := make(map[string]bool)
+	kept := idx.manifest.Segments[:0]
+	for _, info := range idx.manifest.Segments {
+		if _, err := os.Stat(filepath.Join(cfg.Dir, info.File)); err == nil {
+			listed[info.File] = true
+			kept = append(kept, info)
+		}
+	}
+	idx.manifest.Segments = kept
+
+	entries, _ := os.ReadDir(cfg.Dir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".seg") && !listed[entry.Name()] {
+			os.Remove(filepath.Join(cfg.Dir, entry.Name()))
+		}
+	}
+	return idx, nil
+}
+
+// Dir returns the directory holding the index
+func (idx *Index) Dir() string {
+	return idx.cfg.Dir
+}
+
+// SetPolicy sets the redaction policy applied to entries before they are
+// indexed. Entries indexed under another policy can't be redacted again, so
+// when the policy differs from the one the index was built with, the index is
+// emptied and the error logs are indexed again from their backfill.
+func (idx *Index) SetPolicy(policy *redact.Policy) error {
+	fingerprint, err := policyFingerprint(policy)
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.policy = policy
+	if fingerprint == idx.manifest.Policy {
+		return nil
+	}
+
+	for _, info := range idx.manifest.Segments {
+		os.Remove(filepath.Join(idx.cfg.Dir, info.File))
+		idx.uncache(info.File)
+	}
+	if len(idx.manifest.Segments) > 0 || len(idx.active.Docs) > 0 {
+		log.Info("Dropped search index for a new redaction policy", logger.KeyPath, idx.cfg.Dir)
+	}
+	idx.active = newSegment()
+	idx.manifest.Segments = nil
+	idx.manifest.Marks = make(map[string]mark)
+	idx.manifest.ErrorOffsets = make(map[string]int64)
+	idx.manifest.ErrorIdentities = make(map[string]string)
+	idx.manifest.Policy = fingerprint
+	return idx.saveManifestLocked()
+}
+
+// policyFingerprint identifies a redaction policy; policies that redact
+// nothing have none
+func policyFingerprint(policy *redact.Policy) (string, error) {
+	if policy.IsZero() {
+		return "", nil
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Observe indexes an access log entry; it implements ingest.Sink
+func (idx *Index) Observe(entry ingest.Entry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// Skip entries replayed from before the last one indexed from the file;
+	// an offset reused after rotation comes with a later time
+	if m, ok := idx.manifest.Marks[entry.File]; ok && entry.Offset <= m.Offset && !entry.Time.After(m.Time) {
+		return
+	}
+	idx.manifest.Marks[entry.File] = mark{Offset: entry.Offset, Time: entry.Time}
+
+	// Other sinks share the entry, so redact a copy
+	e := *entry.Log
+	logs.RedactEntry(&e, idx.policy)
+	idx.addLocked(Doc{
+		Source: logfiles.SourceAccess,
+		File:   filepath.Base(entry.File),
+		Offset: entry.Offset,
+		Time:   entry.Time,
+		Fields: fields(map[string]string{
+			FieldPath:       e.RequestPath,
+			FieldHost:       e.RequestHost,
+			FieldUserAgent:  e.RequestUserAgent,
+			FieldReferer:    e.RequestReferer,
+			FieldRequestID:  e.RequestID,
+			FieldMethod:     e.RequestMethod,
+			FieldStatus:     strconv.Itoa(e.DownstreamStatus),
+			FieldRouter:     e.RouterName,
+			FieldService:    e.ServiceName,
+			FieldEntryPoint: e.EntryPointName,
+		}),
+	})
+}
+
+// Add indexes an entry as is; callers redact its fields
+func (idx *Index) Add(doc Doc) {
+	doc.Fields = fields(doc.Fields)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.addLocked(doc)
+}
+
+// fields drops empty fields and caps long ones
+func fields(values map[string]string) map[string]string {
+	for field, value := range values {
+		if value == "" {
+			delete(values, field)
+			continue
+		}
+		if len(value) > maxFieldLen {
+			value = value[:maxFieldLen]
+			for !utf8.ValidString(value) {
+				value = value[:len(value)-1]
+			}
+			values[field] = value
+		}
+	}
+	return values
+}
+
+func (idx *Index) addLocked(doc Doc) {
+	if doc.Time.Before(time.Now().Add(-idx.cfg.Retention)) {
+		return
+	}
+
+	seg := idx.active
+	if len(seg.Docs) == 0 {
+		seg.created = time.Now()
+	}
+	id := uint32(len(seg.Docs))
+	seg.Docs = append(seg.Docs, doc)
+	for field, value := range doc.Fields {
+		for _, token := range Tokenize(value) {
+			key := field + ":" + token
+			postings := seg.Terms[key]
+			if n := len(postings); n == 0 || postings[n-1] != id {
+				seg.Terms[key] = append(postings, id)
+			}
+		}
+	}
+
+	if len(seg.Docs) >= idx.cfg.SegmentDocs {
+		if err := idx.sealLocked(); err != nil {
+			log.Error("Failed to seal search segment", logger.Err(err))
+		}
+	}
+}
+
+// Flush seals the in-memory segment to disk
+func (idx *Index) Flush() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.sealLocked()
+}
+
+// sealLocked writes the active segment and the manifest listing it
+func (idx *Index) sealLocked() error {
+	seg := idx.active
+	if len(seg.Docs) == 0 {
+		return idx.saveManifestLocked()
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(seg); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	info := segmentInfo{
+		File:  fmt.Sprintf("%08d.seg", idx.manifest.Next),
+		Min:   seg.Docs[0].Time,
+		Max:   seg.Docs[0].Time,
+		Docs:  len(seg.Docs),
+		Bytes: int64(buf.Len()),
+	}
+	for _, doc := range seg.Docs {
+		info.Min = minTime(info.Min, doc.Time)
+		info.Max = maxTime(info.Max, doc.Time)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(idx.cfg.Dir, info.File), buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write search segment: %w", err)
+	}
+
+	idx.manifest.Next++
+	idx.manifest.Segments = append(idx.manifest.Segments, info)
+	idx.active = newSegment()
+	return idx.saveManifestLocked()
+}
+
+func (idx *Index) saveManifestLocked() error {
+	data, err := json.Marshal(idx.manifest)
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(idx.cfg.Dir, manifestName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write index manifest: %w", err)
+	}
+	return nil
+}
+
+// Prune removes the segments and marks that fell out of the retention window
+func (idx *Index) Prune() error {
+	cutoff := time.Now().Add(-idx.cfg.Retention)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	changed := false
+	kept := idx.manifest.Segments[:0]
+	for _, info := range idx.manifest.Segments {
+		if info.Max.Before(cutoff) {
+			os.Remove(filepath.Join(idx.cfg.Dir, info.File))
+			idx.uncache(info.File)
+			changed = true
+			continue
+		}
+		kept = append(kept, info)
+	}
+	idx.manifest.Segments = kept
+
+	for file, m := range idx.manifest.Marks {
+		if m.Time.Before(cutoff) {
+			delete(idx.manifest.Marks, file)
+			changed = true
+		}
+	}
+	for file := range idx.manifest.ErrorOffsets {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			delete(idx.manifest.ErrorOffsets, file)
+			delete(idx.manifest.ErrorIdentities, file)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return idx.saveManifestLocked()
+}
+
+// Search returns the entries matching q, newest first
+func (idx *Index) Search(q *Query, opts Options) (Results, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 100
+	}
+	if opts.To.IsZero() {
+		opts.To = time.Now()
+	}
+
+	var results []Doc
+	collect := func(seg *segment) {
+		for _, id := range seg.candidates(q) {
+			doc := seg.Docs[id]
+			if doc.Time.Before(opts.From) || doc.Time.After(opts.To) || !q.Matches(doc.Fields) {
+				continue
+			}
+			if len(opts.Sources) > 0 && !slices.Contains(opts.Sources, doc.Source) {
+				continue
+			}
+			// Filters may rewrite fields, so they get their own copy
+			doc.Fields = maps.Clone(doc.Fields)
+			if opts.Filter != nil && !opts.Filter(&doc) {
+				continue
+			}
+			results = append(results, doc)
+		}
+		// Keep one more than the limit to tell whether results were cut
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Time.After(results[j].Time) })
+		if len(results) > opts.Limit+1 {
+			results = results[:opts.Limit+1]
+		}
+	}
+
+	idx.mu.Lock()
+	collect(idx.active)
+	infos := append([]segmentInfo(nil), idx.manifest.Segments...)
+	idx.mu.Unlock()
+
+	// Newest segments first, until the rest are all older than what was kept
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Max.After(infos[j].Max) })
+	for _, info := range infos {
+		if info.Max.Before(opts.From) || info.Min.After(opts.To) {
+			continue
+		}
+		if len(results) > opts.Limit && info.Max.Before(results[len(results)-1].Time) {
+			break
+		}
+		seg, err := idx.load(info.File)
+		if os.IsNotExist(err) {
+			// Pruned since the list was copied
+			continue
+		}
+		if err != nil {
+			return Results{}, err
+		}
+		collect(seg)
+	}
+
+	truncated := len(results) > opts.Limit
+	if truncated {
+		results = results[:opts.Limit]
+	}
+	return Results{Docs: results, Truncated: truncated}, nil
+}
+
+// Stats reports the size of the index
+func (idx *Index) Stats() Stats {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	stats := Stats{Docs: len(idx.active.Docs), Segments: len(idx.manifest.Segments)}
+	for _, doc := range idx.active.Docs {
+		if stats.Oldest.IsZero() || doc.Time.Before(stats.Oldest) {
+			stats.Oldest = doc.Time
+		}
+	}
+	for _, info := range idx.manifest.Segments {
+		stats.Docs += info.Docs
+		stats.Bytes += info.Bytes
+		if stats.Oldest.IsZero() || info.Min.Before(stats.Oldest) {
+			stats.Oldest = info.Min
+		}
+	}
+	return stats
+}
+
+// load returns a sealed segment, decoding it unless it is cached
+func (idx *Index) load(file string) (*segment, error) {
+	idx.cacheMu.Lock()
+	defer idx.cacheMu.Unlock()
+
+	if seg, ok := idx.cache[file]; ok {
+		idx.touch(file)
+		return seg, nil
+	}
+
+	f, err := os.Open(filepath.Join(idx.cfg.Dir, file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search segment %s: %w", file, err)
+	}
+	defer gz.Close()
+
+	seg := &segment{}
+	if err := json.NewDecoder(gz).Decode(seg); err != nil {
+		return nil, fmt.Errorf("failed to read search segment %s: %w", file, err)
+	}
+	seg.keys = make([]string, 0, len(seg.Terms))
+	for key := range seg.Terms {
+		seg.keys = append(seg.keys, key)
+	}
+	sort.Strings(seg.keys)
+
+	idx.cache[file] = seg
+	idx.touch(file)
+	if len(idx.recent) > cachedSegments {
+		delete(idx.cache, idx.recent[0])
+		idx.recent = idx.recent[1:]
+	}
+	return seg, nil
+}
+
+// touch marks a cached segment as the most recently used
+func (idx *Index) touch(file string) {
+	for i, name := range idx.recent {
+		if name == file {
+			idx.recent = append(idx.recent[:i], idx.recent[i+1:]...)
+			break
+		}
+	}
+	idx.recent = append(idx.recent, file)
+}
+
+func (idx *Index) uncache(file string) {
+	idx.cacheMu.Lock()
+	defer idx.cacheMu.Unlock()
+	if _, ok := idx.cache[file]; ok {
+		delete(idx.cache, file)
+		for i, name := range idx.recent {
+			if name == file {
+				idx.recent = append(idx.recent[:i], idx.recent[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// candidates returns the ids of the entries holding the terms of every
+// clause, in ascending order. Phrases still have to be checked with
+// Query.Matches, as postings don't record where terms appear.
+func (s *segment) candidates(q *Query) []uint32 {
+	var result []uint32
+	for i, clause := range q.Clauses {
+		var ids []uint32
+		for _, field := range clause.Fields {
+			ids = union(ids, s.clausePostings(field, clause))
+		}
+		if i == 0 {
+			result = ids
+		} else {
+			result = intersect(result, ids)
+		}
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// clausePostings returns the entries holding every token of a clause in field
+func (s *segment) clausePostings(field string, clause Clause) []uint32 {
+	var result []uint32
+	for i, token := range clause.Tokens {
+		var ids []uint32
+		if clause.Prefix && i == len(clause.Tokens)-1 {
+			for _, key := range s.prefixKeys(field + ":" + token) {
+				ids = union(ids, s.Terms[key])
+			}
+		} else {
+			ids = s.Terms[field+":"+token]
+		}
+		if i == 0 {
+			result = ids
+		} else {
+			result = intersect(result, ids)
+		}
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// prefixKeys returns the term keys starting with prefix
+func (s *segment) prefixKeys(prefix string) []string {
+	if s.keys == nil {
+		// The active segment changes as entries are added, so it is scanned
+		var keys []string
+		for key := range s.Terms {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+
+	start := sort.SearchStrings(s.keys, prefix)
+	end := start
+	for end < len(s.keys) && strings.HasPrefix(s.keys[end], prefix) {
+		end++
+	}
+	return s.keys[start:end]
+}
+
+// union merges two ascending id lists
+func union(a, b []uint32) []uint32 {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	result := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+// intersect returns the ids in both ascending lists
+func intersect(a, b []uint32) []uint32 {
+	var result []uint32
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,271 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logfiles"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/redact"
+)
+
+// openIndex opens an index in a temporary directory with small segments, so
+// most entries are read back from disk
+func openIndex(t *testing.T) *Index {
+	t.Helper()
+	idx, err := Open(Config{Dir: t.TempDir() + "/index", Retention: 24 * time.Hour, SegmentDocs: 2})
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	return idx
+}
+
+// search parses text and returns the paths or messages of the matches
+func search(t *testing.T, idx *Index, text string, opts Options) ([]string, Results) {
+	t.Helper()
+	q, err := ParseQuery(text, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", text, err)
+	}
+	results, err := idx.Search(q, opts)
+	if err != nil {
+		t.Fatalf("Failed to search %q: %v", text, err)
+	}
+	var got []string
+	for _, doc := range results.Docs {
+		if path := doc.Fields[FieldPath]; path != "" {
+			got = append(got, path)
+		} else {
+			got = append(got, doc.Fields[FieldMessage])
+		}
+	}
+	return got, results
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(`status:502 "Connection refused" curl* ignored-:`, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	if len(q.Clauses) != 4 {
+		t.Fatalf("Expected 4 clauses, got %+v", q.Clauses)
+	}
+	if c := q.Clauses[0]; len(c.Fields) != 1 || c.Fields[0] != FieldStatus || c.Tokens[0] != "502" {
+		t.Errorf("Expected a status clause, got %+v", c)
+	}
+	if c := q.Clauses[1]; len(c.Tokens) != 2 || c.Tokens[1] != "refused" || c.Prefix || len(c.Fields) != len(DefaultFields) {
+		t.Errorf("Expected a phrase in the default fields, got %+v", c)
+	}
+	if c := q.Clauses[2]; !c.Prefix || c.Tokens[0] != "curl" {
+		t.Errorf("Expected a prefix clause, got %+v", c)
+	}
+
+	if !q.Matches(map[string]string{FieldStatus: "502", FieldMessage: "dial: connection refused", FieldUserAgent: "curl/8.4.0", FieldPath: "/ignored"}) {
+		t.Error("Expected the fields to match every clause")
+	}
+	if q.Matches(map[string]string{FieldStatus: "502", FieldMessage: "refused connection", FieldUserAgent: "curl/8.4.0", FieldPath: "/ignored"}) {
+		t.Error("Expected words out of order not to match the phrase")
+	}
+
+	for _, text := range []string{"", "  *  ", "a*", `"unterminated`} {
+		if _, err := ParseQuery(text, nil); err == nil {
+			t.Errorf("Expected %q to be rejected", text)
+		}
+	}
+	if _, err := ParseQuery("timeout", []string{"bogus"}); err == nil {
+		t.Error("Expected an unknown field to be rejected")
+	}
+}
+
+func TestParseErrorLine(t *testing.T) {
+	for _, tc := range []struct {
+		line, level, message string
+		timed                bool
+	}{
+		{`{"level":"ERROR","time":"2024-01-02T15:04:05Z","message":"Health check failed","error":"i/o timeout"}`, "error", "Health check failed error=i/o timeout", true},
+		{`time="2024-01-02T15:04:05Z" level=warning msg="connection refused" providerName=docker`, "warning", `msg="connection refused" providerName=docker`, true},
+		{`2024-01-02T15:04:05Z WRN Health check failed error="timeout"`, "warn", `Health check failed error="timeout"`, true},
+		{`2024-01-02T15:04:05Z something else`, "", "something else", true},
+		{`plain line`, "", "plain line", false},
+	} {
+		ts, level, message := ParseErrorLine(tc.line)
+		if level != tc.level || message != tc.message || ts.IsZero() == tc.timed {
+			t.Errorf("ParseErrorLine(%q): got %v, %q, %q", tc.line, ts, level, message)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx := openIndex(t)
+	now := time.Now().UTC()
+	observe := func(offset int64, ago time.Duration, host, path, agent string) {
+		idx.Observe(ingest.Entry{
+			Log:    &logs.TraefikLog{RequestHost: host, RequestPath: path, RequestUserAgent: agent, DownstreamStatus: 502},
+			File:   "/logs/access.log",
+			Offset: offset,
+			Time:   now.Add(-ago),
+		})
+	}
+	observe(0, time.Hour, "shop.acme.example", "/api/orders?token=s3cret", "curl/8.4.0")
+	observe(100, 30*time.Minute, "other.example", "/login", "Firefox/121.0")
+	observe(200, 10*time.Minute, "shop.acme.example", "/api/users", "Firefox/121.0")
+	observe(300, 48*time.Hour, "shop.acme.example", "/expired", "Firefox/121.0")
+	idx.Add(Doc{Source: logfiles.SourceError, File: "traefik.log", Time: now.Add(-5 * time.Minute), Fields: map[string]string{FieldMessage: "dial tcp: i/o timeout", FieldLevel: "warn"}})
+
+	// Terms match any default field, newest first; old entries aren't indexed
+	if got, _ := search(t, idx, "firefox", Options{}); len(got) != 2 || got[0] != "/api/users" || got[1] != "/login" {
+		t.Errorf("Expected the two Firefox requests, newest first, got %v", got)
+	}
+	if got, results := search(t, idx, "orders", Options{}); len(got) != 1 || results.Docs[0].File != "access.log" || results.Docs[0].Offset != 0 {
+		t.Errorf("Expected the request at offset 0 of access.log, got %+v", results.Docs)
+	}
+
+	// Field clauses, prefixes, sources, time ranges and limits
+	if got, _ := search(t, idx, "status:502 host:sho* path:api", Options{}); len(got) != 2 {
+		t.Errorf("Expected the two shop API requests, got %v", got)
+	}
+	if got, _ := search(t, idx, "timeo*", Options{Sources: []string{logfiles.SourceError}}); len(got) != 1 {
+		t.Errorf("Expected the timeout warning, got %v", got)
+	}
+	if got, _ := search(t, idx, "timeo*", Options{Sources: []string{logfiles.SourceAccess}}); len(got) != 0 {
+		t.Errorf("Expected no access log match, got %v", got)
+	}
+	if got, _ := search(t, idx, "firefox", Options{From: now.Add(-15 * time.Minute)}); len(got) != 1 || got[0] != "/api/users" {
+		t.Errorf("Expected only the request in range, got %v", got)
+	}
+	if got, results := search(t, idx, "firefox", Options{Limit: 1}); len(got) != 1 || !results.Truncated {
+		t.Errorf("Expected one truncated result, got %+v", results)
+	}
+	filter := func(doc *Doc) bool {
+		doc.Fields[FieldHost] = "hidden"
+		return doc.Fields[FieldPath] != "/login"
+	}
+	if _, results := search(t, idx, "firefox", Options{Filter: filter}); len(results.Docs) != 1 || results.Docs[0].Fields[FieldHost] != "hidden" {
+		t.Errorf("Expected the filter to drop and rewrite entries, got %+v", results.Docs)
+	}
+	if _, results := search(t, idx, "firefox", Options{}); results.Docs[0].Fields[FieldHost] != "shop.acme.example" {
+		t.Error("Expected filters not to change indexed entries")
+	}
+
+	if stats := idx.Stats(); stats.Docs != 4 || stats.Segments != 2 || stats.Bytes == 0 || !stats.Oldest.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Expected 4 entries in 2 sealed segments, got %+v", stats)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir() + "/index"
+	cfg := Config{Dir: dir, Retention: 24 * time.Hour}
+	idx, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	now := time.Now().UTC()
+	replay := func(idx *Index) {
+		for i, path := range []string{"/a", "/b"} {
+			idx.Observe(ingest.Entry{
+				Log:    &logs.TraefikLog{RequestPath: path, RequestUserAgent: "curl/8.4.0", ClientHost: "10.0.0.5"},
+				File:   "/logs/access.log",
+				Offset: int64(i * 100),
+				Time:   now.Add(time.Duration(i-5) * time.Minute),
+			})
+		}
+	}
+	replay(idx)
+	if err := idx.Flush(); err != nil {
+		t.Fatalf("Failed to flush index: %v", err)
+	}
+
+	// A segment the manifest doesn't list is left by a crash
+	if err := os.WriteFile(dir+"/99999999.seg", []byte("partial"), 0600); err != nil {
+		t.Fatalf("Failed to write segment: %v", err)
+	}
+	idx, err = Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+	if _, err := os.Stat(dir + "/99999999.seg"); !os.IsNotExist(err) {
+		t.Errorf("Expected the unlisted segment to be removed, got %v", err)
+	}
+
+	// Entries replayed after a restart aren't indexed twice
+	replay(idx)
+	if got, _ := search(t, idx, "curl", Options{}); len(got) != 2 {
+		t.Errorf("Expected the reopened index to hold each entry once, got %v", got)
+	}
+
+	// A new policy empties the index, and later entries are redacted before
+	// they are indexed
+	if err := idx.SetPolicy(&redact.Policy{IP: redact.IPTruncate, IPv4Prefix: 24}); err != nil {
+		t.Fatalf("Failed to set index policy: %v", err)
+	}
+	if stats := idx.Stats(); stats.Docs != 0 || stats.Segments != 0 {
+		t.Errorf("Expected the index to be emptied, got %+v", stats)
+	}
+	idx.Add(Doc{Source: logfiles.SourceError, Time: now, Fields: map[string]string{FieldMessage: "dial tcp 10.0.0.5:80"}})
+	replay(idx)
+	if got, _ := search(t, idx, "curl", Options{}); len(got) != 2 {
+		t.Errorf("Expected the entries to be indexed again, got %v", got)
+	}
+	if err := idx.SetPolicy(&redact.Policy{IP: redact.IPTruncate, IPv4Prefix: 24}); err != nil {
+		t.Fatalf("Failed to set index policy: %v", err)
+	}
+	if stats := idx.Stats(); stats.Docs != 3 {
+		t.Errorf("Expected the same policy to keep the index, got %+v", stats)
+	}
+}
+
+func TestErrorLogs(t *testing.T) {
+	dir := t.TempDir()
+	errorFile := dir + "/traefik.log"
+	now := time.Now().UTC()
+	old := fmt.Sprintf(`time=%q level=error msg="before the backfill"`, now.Add(-time.Hour).Format(time.RFC3339)) + "\n"
+	refused := fmt.Sprintf(`time=%q level=error msg="connection refused" upstream=10.0.0.5`, now.Add(-20*time.Minute).Format(time.RFC3339)) + "\n"
+	timeout := now.Add(-5*time.Minute).Format(time.RFC3339) + ` WRN Health check failed error="i/o timeout"` + "\n"
+	if err := os.WriteFile(errorFile, []byte(old+refused+timeout+"partial"), 0644); err != nil {
+		t.Fatalf("Failed to write error log: %v", err)
+	}
+
+	cfg := Config{Dir: dir + "/index", ErrorPath: errorFile, Backfill: int64(len(refused+timeout+"partial") + 10)}
+	idx, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	if err := idx.SetPolicy(&redact.Policy{IP: redact.IPTruncate, IPv4Prefix: 24}); err != nil {
+		t.Fatalf("Failed to set index policy: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// A single poll indexes the error log
+	idx.Run(ctx, time.Hour)
+
+	// The backfill starts at the next complete line and leaves the partial one
+	if stats := idx.Stats(); stats.Docs != 2 {
+		t.Errorf("Expected the 2 complete lines in the backfill, got %+v", stats)
+	}
+	_, results := search(t, idx, `"connection refused"`, Options{})
+	if len(results.Docs) != 1 || results.Docs[0].Offset != int64(len(old)) || results.Docs[0].Fields[FieldLevel] != "error" {
+		t.Errorf("Expected the refused connection error at its offset, got %+v", results.Docs)
+	}
+	if got, _ := search(t, idx, `"10.0.0.0"`, Options{}); len(got) != 1 {
+		t.Errorf("Expected the upstream address to be redacted before indexing, got %v", got)
+	}
+
+	// Lines are indexed once, and the completed line on the next poll
+	file, err := os.OpenFile(errorFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open error log: %v", err)
+	}
+	file.WriteString(" line\n")
+	file.Close()
+	idx.Run(ctx, time.Hour)
+	if _, results := search(t, idx, "partial", Options{}); len(results.Docs) != 1 || results.Docs[0].Fields[FieldMessage] != "partial line" {
+		t.Errorf("Expected the completed line once, got %+v", results.Docs)
+	}
+	if stats := idx.Stats(); stats.Docs != 3 {
+		t.Errorf("Expected 3 indexed lines, got %+v", stats)
+	}
+}
@@ -0,0 +1,491 @@
+package security
+
+import (
+	"container/list"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+)
+
+// Finding types
+const (
+	TypeScanner      = "scanner"
+	TypeBruteForce   = "brute_force"
+	TypeExploitProbe = "exploit_probe"
+	TypeRateAnomaly  = "rate_anomaly"
+)
+
+// Severities
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// maxSamples bounds the evidence lines kept per finding
+const maxSamples = 5
+
+// maxTrackedIPs bounds the per-IP state kept for the current windows
+const maxTrackedIPs = 50000
+
+// maxFindings bounds the findings kept; the least recently seen are evicted first
+const maxFindings = 10000
+
+// expireInterval is how often Observe drops findings past the retention period
+const expireInterval = time.Minute
+
+// highSeverityFactor is how many times its threshold a count reaches to be
+// high severity; counters stop growing there
+const highSeverityFactor = 5
+
+// Config holds detection thresholds
+type Config struct {
+	// Window is the tumbling window used for per-IP counters
+	Window time.Duration
+	// NotFoundThreshold is the number of distinct paths returning 404 from one IP
+	NotFoundThreshold int
+	// AuthFailureThreshold is the number of 401/403 responses on login routes from one IP
+	AuthFailureThreshold int
+	// RateThreshold is the number of requests from one IP
+	RateThreshold int
+	// Retention is how long findings are kept after they were last seen
+	Retention time.Duration
+	// LoginPattern matches request paths treated as login routes
+	LoginPattern *regexp.Regexp
+}
+
+// DefaultConfig returns the default detection thresholds
+func DefaultConfig() Config {
+	return Config{
+		Window:               5 * time.Minute,
+		NotFoundThreshold:    20,
+		AuthFailureThreshold: 10,
+		RateThreshold:        1000,
+		Retention:            24 * time.Hour,
+		LoginPattern:         regexp.MustCompile(`(?i)login|signin|sign-in|auth|session|token|wp-login\.php|xmlrpc\.php`),
+	}
+}
+
+// Evidence supports a finding with the data it was raised from
+type Evidence struct {
+	Samples     []string    `json:"samples"`
+	Paths       []string    `json:"paths,omitempty"`
+	StatusCodes map[int]int `json:"status_codes,omitempty"`
+	Rule        string      `json:"rule,omitempty"`
+}
+
+// Finding describes suspicious activity from a single client IP
+type Finding struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Severity    string    `json:"severity"`
+	ClientIP    string    `json:"client_ip"`
+	Description string    `json:"description"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Window      string    `json:"window"`
+	Evidence    Evidence  `json:"evidence"`
+}
+
+// Query filters the findings returned by Findings
+type Query struct {
+	Type     string
+	ClientIP string
+	Severity string
+	Since    time.Time
+	Limit    int
+}
+
+// probeRule flags a request path matching a known attack signature
+type probeRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var probeRules = []probeRule{
+	{name: "path_traversal", pattern: regexp.MustCompile(`(?i)(\.\./|\.\.\\|/etc/passwd|/etc/shadow|/proc/self/|win\.ini|boot\.ini)`)},
+	{name: "sql_injection", pattern: regexp.MustCompile(`(?i)(union(\s|\+|/\*.*\*/)+(all(\s|\+)+)?select|'\s*or\s*'?\d*'?\s*=\s*'?\d|\bor\s+1\s*=\s*1\b|sleep\(\s*\d+\s*\)|benchmark\(|information_schema|waitfor\s+delay)`)},
+	{name: "command_injection", pattern: regexp.MustCompile(`(?i)(;|\||&&|\$\()\s*(cat|wget|curl|nc|bash|sh|id|uname)\b`)},
+	{name: "log4shell", pattern: regexp.MustCompile(`(?i)\$\{\s*(jndi|lower|upper|env|sys)\s*:`)},
+	{name: "xss", pattern: regexp.MustCompile(`(?i)(<script|javascript:|onerror\s*=|onload\s*=)`)},
+	{name: "sensitive_file", pattern: regexp.MustCompile(`(?i)(/\.env(\.|$|/)|/\.git/|/\.svn/|/\.aws/|/\.ssh/|/id_rsa|/\.htpasswd|/\.DS_Store|/wp-config\.php|/config\.php\.bak)`)},
+	{name: "known_exploit", pattern: regexp.MustCompile(`(?i)(/vendor/phpunit/|/cgi-bin/|/HNAP1|/boaform/|/phpmyadmin|/pma/|/actuator/|/solr/admin|/owa/auth|/autodiscover/|/shell\?|/setup\.cgi|/GponForm/)`)},
+}
+
+// ipState tracks per-IP counters for the current window
+type ipState struct {
+	ip            string
+	windowStart   time.Time
+	requests      int
+	notFoundPaths map[string]struct{}
+	authFailures  int
+	samples       []string
+	statusCodes   map[int]int
+	// element is the state's place in Detector.order
+	element *list.Element
+}
+
+// Detector watches parsed access logs for scanners, brute force and probes
+type Detector struct {
+	cfg Config
+
+	mu  sync.RWMutex
+	ips map[string]*ipState
+	// order lists the per-IP states, oldest window first
+	order *list.List
+	// findings holds each finding's place in seen, which lists the findings
+	// least recently seen first
+	findings map[string]*list.Element
+	seen     *list.List
+	// expired is when findings past the retention period were last dropped
+	expired time.Time
+}
+
+// NewDetector creates a detector with the given thresholds
+func NewDetector(cfg Config) *Detector {
+	defaults := DefaultConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaults.Retention
+	}
+	if cfg.LoginPattern == nil {
+		cfg.LoginPattern = defaults.LoginPattern
+	}
+
+	return &Detector{
+		cfg:      cfg,
+		ips:      make(map[string]*ipState),
+		order:    list.New(),
+		findings: make(map[string]*list.Element),
+		seen:     list.New(),
+	}
+}
+
+// Observe implements ingest.Sink
+func (d *Detector) Observe(entry ingest.Entry) {
+	ip := entry.Log.ClientHost
+	if ip == "" {
+		return
+	}
+
+	path := entry.Log.RequestPath
+	status := entry.Log.DownstreamStatus
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Findings expire even when nobody reads them
+	now := time.Now().UTC()
+	if now.Sub(d.expired) >= expireInterval {
+		d.expire(now)
+	}
+	// Lines backfilled from before the retention period would only raise
+	// findings that are already expired
+	if now.Sub(entry.Time) > d.cfg.Retention {
+		return
+	}
+
+	state := d.state(ip, entry.Time)
+	state.requests++
+	state.statusCodes[status]++
+	if status >= 400 && len(state.samples) < maxSamples {
+		state.samples = append(state.samples, entry.Line)
+	}
+
+	if status == 404 {
+		if len(state.notFoundPaths) < d.cfg.NotFoundThreshold*highSeverityFactor {
+			state.notFoundPaths[stripQuery(path)] = struct{}{}
+		}
+		if d.cfg.NotFoundThreshold > 0 && len(state.notFoundPaths) >= d.cfg.NotFoundThreshold {
+			f := d.upsert(TypeScanner, ip, entry, state)
+			f.Severity = severityFor(len(state.notFoundPaths), d.cfg.NotFoundThreshold)
+			f.Count = len(state.notFoundPaths)
+			f.Description = "Many 404 responses across distinct paths"
+			f.Evidence.Paths = samplePaths(state.notFoundPaths)
+		}
+	}
+
+	if (status == 401 || status == 403) && d.cfg.LoginPattern.MatchString(path) {
+		state.authFailures++
+		if d.cfg.AuthFailureThreshold > 0 && state.authFailures >= d.cfg.AuthFailureThreshold {
+			f := d.upsert(TypeBruteForce, ip, entry, state)
+			f.Severity = severityFor(state.authFailures, d.cfg.AuthFailureThreshold)
+			f.Count = state.authFailures
+			f.Description = "Repeated authentication failures on login routes"
+			f.Evidence.Paths = appendUnique(f.Evidence.Paths, stripQuery(path))
+		}
+	}
+
+	if d.cfg.RateThreshold > 0 && state.requests >= d.cfg.RateThreshold {
+		f := d.upsert(TypeRateAnomaly, ip, entry, state)
+		f.Severity = severityFor(state.requests, d.cfg.RateThreshold)
+		f.Count = state.requests
+		f.Description = "Abnormal request rate from a single client"
+	}
+
+	if rule, ok := matchProbe(path); ok {
+		f := d.upsert(TypeExploitProbe, ip, entry, nil)
+		f.Severity = SeverityHigh
+		f.Count++
+		f.Description = "Request path matches known exploit or probe signatures"
+		f.Evidence.Rule = rule
+		f.Evidence.Paths = appendUnique(f.Evidence.Paths, path)
+		if len(f.Evidence.Samples) < maxSamples {
+			f.Evidence.Samples = append(f.Evidence.Samples, entry.Line)
+		}
+	}
+}
+
+// Findings returns the current findings matching the query, most recent first
+func (d *Detector) Findings(q Query) []Finding {
+	d.mu.Lock()
+	d.expire(time.Now().UTC())
+	d.mu.Unlock()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	result := make([]Finding, 0, len(d.findings))
+	for e := d.seen.Front(); e != nil; e = e.Next() {
+		f := e.Value.(*Finding)
+		if q.Type != "" && f.Type != q.Type {
+			continue
+		}
+		if q.ClientIP != "" && f.ClientIP != q.ClientIP {
+			continue
+		}
+		if q.Severity != "" && f.Severity != q.Severity {
+			continue
+		}
+		if !q.Since.IsZero() && f.LastSeen.Before(q.Since) {
+			continue
+		}
+		result = append(result, copyFinding(f))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+
+	return result
+}
+
+// Restore adds findings saved from a previous run, keeping any already raised
+func (d *Detector) Restore(findings []Finding) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	restored := make([]Finding, len(findings))
+	copy(restored, findings)
+	sort.Slice(restored, func(i, j int) bool { return restored[i].LastSeen.Before(restored[j].LastSeen) })
+
+	for i := range restored {
+		key := findingKey(restored[i].Type, restored[i].ClientIP)
+		if _, ok := d.findings[key]; ok {
+			continue
+		}
+		if len(d.findings) >= maxFindings {
+			d.evictOldest()
+		}
+		f := copyFinding(&restored[i])
+		// Restored findings are usually older than the ones already raised
+		mark := d.seen.Back()
+		for mark != nil && mark.Value.(*Finding).LastSeen.After(f.LastSeen) {
+			mark = mark.Prev()
+		}
+		if mark == nil {
+			d.findings[key] = d.seen.PushFront(&f)
+		} else {
+			d.findings[key] = d.seen.InsertAfter(&f, mark)
+		}
+	}
+}
+
+// state returns the per-IP state, starting a new window when the current one has elapsed
+func (d *Detector) state(ip string, ts time.Time) *ipState {
+	state, ok := d.ips[ip]
+	if ok && ts.Sub(state.windowStart) < d.cfg.Window {
+		return state
+	}
+
+	if ok {
+		// The new window is the newest
+		d.order.Remove(state.element)
+		delete(d.ips, ip)
+	} else if len(d.ips) >= maxTrackedIPs {
+		d.pruneStates(ts)
+	}
+
+	state = &ipState{
+		ip:            ip,
+		windowStart:   ts,
+		notFoundPaths: make(map[string]struct{}),
+		statusCodes:   make(map[int]int),
+	}
+	state.element = d.order.PushBack(state)
+	d.ips[ip] = state
+	return state
+}
+
+// pruneStates drops per-IP state whose window has elapsed, oldest first, and
+// evicts the oldest windows while the state is still at capacity
+func (d *Detector) pruneStates(now time.Time) {
+	for front := d.order.Front(); front != nil; front = d.order.Front() {
+		state := front.Value.(*ipState)
+		if now.Sub(state.windowStart) < d.cfg.Window && len(d.ips) < maxTrackedIPs {
+			return
+		}
+		d.order.Remove(front)
+		delete(d.ips, state.ip)
+	}
+}
+
+// upsert returns the finding for the type and IP, creating it if needed
+func (d *Detector) upsert(findingType, ip string, entry ingest.Entry, state *ipState) *Finding {
+	key := findingKey(findingType, ip)
+	var f *Finding
+	if e, ok := d.findings[key]; ok {
+		f = e.Value.(*Finding)
+		d.seen.MoveToBack(e)
+	} else {
+		f = &Finding{
+			ID:        findingType + "-" + ip,
+			Type:      findingType,
+			ClientIP:  ip,
+			FirstSeen: entry.Time,
+			Window:    d.cfg.Window.String(),
+		}
+		if state != nil {
+			f.FirstSeen = state.windowStart
+		}
+		if len(d.findings) >= maxFindings {
+			d.evictOldest()
+		}
+		d.findings[key] = d.seen.PushBack(f)
+	}
+
+	f.LastSeen = entry.Time
+	if state != nil {
+		f.Evidence.Samples = append([]string(nil), state.samples...)
+		if len(f.Evidence.Samples) == 0 {
+			f.Evidence.Samples = []string{entry.Line}
+		}
+		f.Evidence.StatusCodes = make(map[int]int, len(state.statusCodes))
+		for code, count := range state.statusCodes {
+			f.Evidence.StatusCodes[code] = count
+		}
+	}
+	return f
+}
+
+// expire removes findings that have not been seen within the retention period
+func (d *Detector) expire(now time.Time) {
+	d.expired = now
+	for front := d.seen.Front(); front != nil && now.Sub(front.Value.(*Finding).LastSeen) > d.cfg.Retention; front = d.seen.Front() {
+		d.evictOldest()
+	}
+}
+
+// evictOldest removes the least recently seen finding
+func (d *Detector) evictOldest() {
+	front := d.seen.Front()
+	if front == nil {
+		return
+	}
+	f := d.seen.Remove(front).(*Finding)
+	delete(d.findings, findingKey(f.Type, f.ClientIP))
+}
+
+// findingKey identifies the finding of a type for a client
+func findingKey(findingType, ip string) string {
+	return findingType + "|" + ip
+}
+
+// matchProbe checks a request path against the probe signatures
+func matchProbe(path string) (string, bool) {
+	candidates := []string{path}
+	if decoded, err := url.PathUnescape(path); err == nil && decoded != path {
+		candidates = append(candidates, decoded)
+	}
+
+	for _, candidate := range candidates {
+		for _, rule := range probeRules {
+			if rule.pattern.MatchString(candidate) {
+				return rule.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// severityFor grades a count against its threshold
+func severityFor(count, threshold int) string {
+	switch {
+	case count >= threshold*highSeverityFactor:
+		return SeverityHigh
+	case count >= threshold*2:
+		return SeverityMedium
+	default:
+		return SeverityLow
+	}
+}
+
+// samplePaths returns up to maxSamples paths in sorted order
+func samplePaths(paths map[string]struct{}) []string {
+	result := make([]string, 0, len(paths))
+	for path := range paths {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	if len(result) > maxSamples {
+		result = result[:maxSamples]
+	}
+	return result
+}
+
+// appendUnique appends a value if it is not present, up to maxSamples values
+func appendUnique(values []string, value string) []string {
+	if len(values) >= maxSamples {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// stripQuery removes the query string from a request path
+func stripQuery(path string) string {
+	if idx := strings.IndexByte(path, '?'); idx != -1 {
+		return path[:idx]
+	}
+	return path
+}
+
+// copyFinding returns a deep copy safe to hand out after the lock is released
+func copyFinding(f *Finding) Finding {
+	c := *f
+	c.Evidence.Samples = append([]string(nil), f.Evidence.Samples...)
+	c.Evidence.Paths = append([]string(nil), f.Evidence.Paths...)
+	if f.Evidence.StatusCodes != nil {
+		c.Evidence.StatusCodes = make(map[int]int, len(f.Evidence.StatusCodes))
+		for code, count := range f.Evidence.StatusCodes {
+			c.Evidence.StatusCodes[code] = count
+		}
+	}
+	return c
+}
@@ -0,0 +1,179 @@
+package security
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+)
+
+// observer feeds entries from one point in time to a detector
+func observer(d *Detector, now time.Time) func(ip, path string, status int) {
+	return func(ip, path string, status int) {
+		d.Observe(ingest.Entry{
+			Log:  &logs.TraefikLog{ClientHost: ip, RequestPath: path, DownstreamStatus: status},
+			Line: path,
+			Time: now,
+		})
+	}
+}
+
+func TestDetector(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RateThreshold = 50
+	d := NewDetector(cfg)
+	observe := observer(d, time.Now().UTC())
+
+	for i := 0; i < 20; i++ {
+		observe("203.0.113.7", fmt.Sprintf("/missing-%d?x=%d", i, i), 404)
+	}
+	for i := 0; i < 10; i++ {
+		observe("203.0.113.8", "/wp-login.php", 401)
+	}
+	for i := 0; i < 50; i++ {
+		observe("203.0.113.9", "/", 200)
+	}
+	observe("203.0.113.10", "/static/%2e%2e/%2e%2e/etc/passwd", 400)
+	observe("", "/.env", 200)
+
+	for _, tc := range []struct {
+		findingType, ip, severity string
+		count                     int
+	}{
+		{TypeScanner, "203.0.113.7", SeverityLow, 20},
+		{TypeBruteForce, "203.0.113.8", SeverityLow, 10},
+		{TypeRateAnomaly, "203.0.113.9", SeverityLow, 50},
+		{TypeExploitProbe, "203.0.113.10", SeverityHigh, 1},
+	} {
+		findings := d.Findings(Query{Type: tc.findingType, ClientIP: tc.ip})
+		if len(findings) != 1 {
+			t.Errorf("Expected one %s finding for %s, got %+v", tc.findingType, tc.ip, findings)
+			continue
+		}
+		if f := findings[0]; f.Severity != tc.severity || f.Count != tc.count || len(f.Evidence.Samples) == 0 {
+			t.Errorf("Unexpected %s finding: %+v", tc.findingType, f)
+		}
+	}
+
+	if f := d.Findings(Query{Type: TypeExploitProbe}); len(f) != 1 || f[0].Evidence.Rule != "path_traversal" {
+		t.Errorf("Expected an encoded path traversal to be detected, got %+v", f)
+	}
+	if f := d.Findings(Query{Type: TypeScanner}); len(f) == 1 && f[0].Evidence.Paths[0] != "/missing-0" {
+		t.Errorf("Expected scanner paths without their query, got %v", f[0].Evidence.Paths)
+	}
+	if f := d.Findings(Query{Severity: SeverityHigh}); len(f) != 1 {
+		t.Errorf("Expected one high severity finding, got %+v", f)
+	}
+	if f := d.Findings(Query{Limit: 2}); len(f) != 2 {
+		t.Errorf("Expected the limit to apply, got %d findings", len(f))
+	}
+
+	// Restored findings don't replace the ones already raised
+	d.Restore([]Finding{
+		{ID: "restored", Type: TypeScanner, ClientIP: "203.0.113.7", LastSeen: time.Now().UTC()},
+		{ID: "old", Type: TypeScanner, ClientIP: "192.0.2.1", LastSeen: time.Now().UTC()},
+	})
+	if f := d.Findings(Query{Type: TypeScanner, ClientIP: "203.0.113.7"}); len(f) != 1 || f[0].ID == "restored" {
+		t.Errorf("Expected the raised finding to be kept, got %+v", f)
+	}
+	if f := d.Findings(Query{ClientIP: "192.0.2.1"}); len(f) != 1 {
+		t.Errorf("Expected the restored finding, got %+v", f)
+	}
+}
+
+func TestStateBounds(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	observe := observer(d, time.Now().UTC())
+	scanner := func(ip string) *Finding {
+		for _, f := range d.Findings(Query{Type: TypeScanner, ClientIP: ip}) {
+			return &f
+		}
+		return nil
+	}
+
+	// Distinct 404 paths stop being counted once they reach high severity
+	for i := 0; i < 500; i++ {
+		observe("203.0.113.7", fmt.Sprintf("/probe-%d", i), 404)
+	}
+	if f := scanner("203.0.113.7"); f == nil || f.Count != 100 || f.Severity != SeverityHigh {
+		t.Errorf("Expected a high severity scanner finding counting 100 paths, got %+v", f)
+	}
+
+	// At capacity, the oldest live window is evicted for a new client
+	for i := 0; i < 19; i++ {
+		observe("198.51.100.9", fmt.Sprintf("/missing-%d", i), 404)
+	}
+	for i := 0; i < maxTrackedIPs; i++ {
+		observe(fmt.Sprintf("10.%d.%d.%d", i>>16, (i>>8)&255, i&255), "/", 200)
+	}
+	observe("198.51.100.9", "/missing-19", 404)
+	if f := scanner("198.51.100.9"); f != nil {
+		t.Errorf("Expected the evicted client to start a new window, got %+v", f)
+	}
+	if len(d.ips) > maxTrackedIPs {
+		t.Errorf("Expected at most %d tracked clients, got %d", maxTrackedIPs, len(d.ips))
+	}
+}
+
+func TestFindingBounds(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	now := time.Now().UTC()
+
+	// Findings are capped, evicting the least recently seen
+	for i := 0; i <= maxFindings; i++ {
+		d.Observe(ingest.Entry{
+			Log:  &logs.TraefikLog{ClientHost: fmt.Sprintf("2001:db8::%x", i), RequestPath: "/.env"},
+			Line: "/.env",
+			Time: now.Add(time.Duration(i) * time.Millisecond),
+		})
+	}
+	findings := d.Findings(Query{})
+	if len(findings) != maxFindings {
+		t.Fatalf("Expected %d findings, got %d", maxFindings, len(findings))
+	}
+	if last := findings[len(findings)-1]; last.ClientIP != "2001:db8::1" {
+		t.Errorf("Expected the least recently seen finding to be evicted, got oldest %s", last.ClientIP)
+	}
+
+	// Seeing a finding again makes it the most recently seen
+	observe := observer(d, now.Add(time.Hour))
+	observe("2001:db8::1", "/.env", 200)
+	observe("198.51.100.1", "/.env", 200)
+	findings = d.Findings(Query{})
+	if len(findings) != maxFindings || findings[len(findings)-1].ClientIP != "2001:db8::3" || findings[1].ClientIP != "2001:db8::1" {
+		t.Errorf("Expected 2001:db8::2 to be evicted, got newest %s and oldest %s", findings[1].ClientIP, findings[len(findings)-1].ClientIP)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Retention = time.Hour
+	d := NewDetector(cfg)
+
+	// Lines read back from before the retention period raise nothing
+	observer(d, time.Now().UTC().Add(-2*time.Hour))("203.0.113.10", "/.env", 200)
+	if f := d.Findings(Query{}); len(f) != 0 {
+		t.Errorf("Expected no findings from old lines, got %+v", f)
+	}
+	observer(d, time.Now().UTC().Add(-30*time.Minute))("203.0.113.10", "/.env", 200)
+	if f := d.Findings(Query{}); len(f) != 1 {
+		t.Errorf("Expected a finding from lines within the retention period, got %+v", f)
+	}
+
+	// Restored findings expire in order of when they were last seen
+	now := time.Now().UTC()
+	d.Restore([]Finding{
+		{ID: "newer", Type: TypeScanner, ClientIP: "192.0.2.2", LastSeen: now.Add(-10 * time.Minute)},
+		{ID: "expired", Type: TypeScanner, ClientIP: "192.0.2.1", LastSeen: now.Add(-2 * time.Hour)},
+		{ID: "older", Type: TypeScanner, ClientIP: "192.0.2.3", LastSeen: now.Add(-50 * time.Minute)},
+	})
+	findings := d.Findings(Query{})
+	if len(findings) != 3 || findings[0].ID != "newer" || findings[2].ID != "older" {
+		t.Errorf("Expected the findings within the retention period, got %+v", findings)
+	}
+	if d.seen.Front().Value.(*Finding).ID != "older" || d.seen.Back().Value.(*Finding).ID != "newer" {
+		t.Error("Expected restored findings to be ordered by when they were last seen")
+	}
+}
@@ -0,0 +1,53 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/fsutil"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/security"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/stats"
+)
+
+// Snapshot is the in-memory state of the ingest pipeline and the aggregates
+// built from it. It is saved on shutdown so the next run resumes reading
+// where this one stopped instead of replaying or losing entries.
+type Snapshot struct {
+	SavedAt  time.Time          `json:"saved_at"`
+	Offsets  map[string]int64   `json:"offsets"`
+	Geo      []stats.GeoBucket  `json:"geo,omitempty"`
+	Findings []security.Finding `json:"findings,omitempty"`
+	// Identities tell whether a file is still the one its offset was read from
+	Identities map[string]string `json:"identities,omitempty"`
+}
+
+// Load reads a snapshot; it returns nil without an error when none was saved
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// Save writes a snapshot atomically and syncs it to disk
+func Save(path string, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
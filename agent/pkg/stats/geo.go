@@ -0,0 +1,246 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/ingest"
+)
+
+// DefaultGeoRetention is how long per-minute geo counts are kept
+const DefaultGeoRetention = 24 * time.Hour
+
+// geoBucketSize is the resolution of the time range queries
+const geoBucketSize = time.Minute
+
+// GeoStat represents traffic aggregated by country or city
+type GeoStat struct {
+	Country   string  `json:"country"`
+	City      string  `json:"city,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	Bytes     int64   `json:"bytes"`
+}
+
+// geoKey identifies a city within a country
+type geoKey struct {
+	country string
+	city    string
+}
+
+// GeoAggregator keeps per-minute request counts by country and city from
+// entries enriched by the ingest pipeline
+type GeoAggregator struct {
+	retention time.Duration
+
+	mu      sync.RWMutex
+	buckets map[int64]map[geoKey]*GeoStat
+	latest  int64
+}
+
+// NewGeoAggregator creates an aggregator keeping counts for the retention period
+func NewGeoAggregator(retention time.Duration) *GeoAggregator {
+	if retention <= 0 {
+		retention = DefaultGeoRetention
+	}
+	return &GeoAggregator{
+		retention: retention,
+		buckets:   make(map[int64]map[geoKey]*GeoStat),
+	}
+}
+
+// Observe counts an enriched entry; entries without a location are ignored
+func (a *GeoAggregator) Observe(entry ingest.Entry) {
+	if entry.Location == nil {
+		return
+	}
+	loc := entry.Location
+
+	key := geoKey{country: loc.Country, city: loc.City}
+	if key.country == "" {
+		key.country = "Unknown"
+	}
+	minute := entry.Time.Truncate(geoBucketSize).Unix()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if minute <= a.latest-int64(a.retention/time.Second) {
+		return
+	}
+
+	bucket, ok := a.buckets[minute]
+	if !ok {
+		bucket = make(map[geoKey]*GeoStat)
+		a.buckets[minute] = bucket
+	}
+
+	stat, ok := bucket[key]
+	if !ok {
+		stat = &GeoStat{
+			Country:   key.country,
+			City:      key.city,
+			Latitude:  loc.Latitude,
+			Longitude: loc.Longitude,
+		}
+		bucket[key] = stat
+	}
+
+	stat.Requests++
+	stat.Bytes += entry.Log.DownstreamContentSize
+	if entry.Log.DownstreamStatus >= 400 {
+		stat.Errors++
+	}
+
+	if minute > a.latest {
+		a.latest = minute
+		a.prune()
+	}
+}
+
+// GeoBucket holds the counts of one minute, as saved between runs
+type GeoBucket struct {
+	Minute int64     `json:"minute"`
+	Stats  []GeoStat `json:"stats"`
+}
+
+// Snapshot returns the buckets within the retention period, oldest first
+func (a *GeoAggregator) Snapshot() []GeoBucket {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	buckets := make([]GeoBucket, 0, len(a.buckets))
+	for minute, bucket := range a.buckets {
+		saved := GeoBucket{Minute: minute, Stats: make([]GeoStat, 0, len(bucket))}
+		for _, stat := range bucket {
+			saved.Stats = append(saved.Stats, *stat)
+		}
+		buckets = append(buckets, saved)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Minute < buckets[j].Minute })
+	return buckets
+}
+
+// Restore adds counts saved from a previous run
+func (a *GeoAggregator) Restore(buckets []GeoBucket) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, saved := range buckets {
+		bucket, ok := a.buckets[saved.Minute]
+		if !ok {
+			bucket = make(map[geoKey]*GeoStat)
+			a.buckets[saved.Minute] = bucket
+		}
+		for _, stat := range saved.Stats {
+			key := geoKey{country: stat.Country, city: stat.City}
+			if existing, ok := bucket[key]; ok {
+				existing.Requests += stat.Requests
+				existing.Errors += stat.Errors
+				existing.Bytes += stat.Bytes
+				continue
+			}
+			restored := stat
+			bucket[key] = &restored
+		}
+		if saved.Minute > a.latest {
+			a.latest = saved.Minute
+		}
+	}
+	a.prune()
+}
+
+// prune drops buckets older than the retention period
+func (a *GeoAggregator) prune() {
+	cutoff := a.latest - int64(a.retention/time.Second)
+	for minute := range a.buckets {
+		if minute <= cutoff {
+			delete(a.buckets, minute)
+		}
+	}
+}
+
+// Countries returns per-country counts for requests between from and to;
+// a zero time leaves that end of the range open
+func (a *GeoAggregator) Countries(from, to time.Time, limit int) []GeoStat {
+	return a.aggregate(from, to, limit, func(key geoKey) (geoKey, bool) {
+		return geoKey{country: key.country}, true
+	})
+}
+
+// Cities returns per-city counts for requests between from and to, optionally
+// restricted to a single country
+func (a *GeoAggregator) Cities(from, to time.Time, country string, limit int) []GeoStat {
+	return a.aggregate(from, to, limit, func(key geoKey) (geoKey, bool) {
+		if country != "" && !strings.EqualFold(key.country, country) {
+			return key, false
+		}
+		if key.city == "" {
+			key.city = "Unknown"
+		}
+		return key, true
+	})
+}
+
+// aggregate merges the buckets in range under the keys returned by group
+func (a *GeoAggregator) aggregate(from, to time.Time, limit int, group func(geoKey) (geoKey, bool)) []GeoStat {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	merged := make(map[geoKey]*GeoStat)
+	for minute, bucket := range a.buckets {
+		ts := time.Unix(minute, 0)
+		if !from.IsZero() && ts.Before(from.Truncate(geoBucketSize)) {
+			continue
+		}
+		if !to.IsZero() && ts.After(to) {
+			continue
+		}
+
+		for key, stat := range bucket {
+			groupKey, ok := group(key)
+			if !ok {
+				continue
+			}
+
+			total, exists := merged[groupKey]
+			if !exists {
+				total = &GeoStat{Country: groupKey.country, City: groupKey.city}
+				if groupKey.city != "" {
+					total.Latitude = stat.Latitude
+					total.Longitude = stat.Longitude
+				}
+				merged[groupKey] = total
+			}
+
+			total.Requests += stat.Requests
+			total.Errors += stat.Errors
+			total.Bytes += stat.Bytes
+		}
+	}
+
+	result := make([]GeoStat, 0, len(merged))
+	for _, stat := range merged {
+		result = append(result, *stat)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Requests != result[j].Requests {
+			return result[i].Requests > result[j].Requests
+		}
+		if result[i].Country != result[j].Country {
+			return result[i].Country < result[j].Country
+		}
+		return result[i].City < result[j].City
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
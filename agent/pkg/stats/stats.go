@@ -0,0 +1,205 @@
+package stats
+
+import (
+	"sort"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/location"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logs"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/pathnorm"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/useragent"
+)
+
+// RouteStat represents aggregated metrics for a route template
+type RouteStat struct {
+	Method      string  `json:"method"`
+	Template    string  `json:"template"`
+	Count       int     `json:"count"`
+	Errors      int     `json:"errors"`
+	AvgDuration float64 `json:"avg_duration_ms"`
+}
+
+// TopRoutes groups entries by method and path template and returns the busiest
+// routes. It doesn't learn from the entries; the normalizer learns as lines are ingested.
+func TopRoutes(entries []*logs.TraefikLog, normalizer *pathnorm.Normalizer, limit int) []RouteStat {
+	routeMap := make(map[string]*RouteStat)
+	for _, entry := range entries {
+		template := normalizer.Normalize(entry.RequestPath)
+		key := entry.RequestMethod + " " + template
+		durationMs := float64(entry.Duration) / 1000000
+
+		rs, exists := routeMap[key]
+		if !exists {
+			rs = &RouteStat{
+				Method:   entry.RequestMethod,
+				Template: template,
+			}
+			routeMap[key] = rs
+		}
+
+		rs.Count++
+		rs.AvgDuration += (durationMs - rs.AvgDuration) / float64(rs.Count)
+		if entry.DownstreamStatus >= 400 {
+			rs.Errors++
+		}
+	}
+
+	routes := make([]RouteStat, 0, len(routeMap))
+	for _, rs := range routeMap {
+		routes = append(routes, *rs)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Count != routes[j].Count {
+			return routes[i].Count > routes[j].Count
+		}
+		return routes[i].Template < routes[j].Template
+	})
+
+	if limit > 0 && len(routes) > limit {
+		routes = routes[:limit]
+	}
+
+	return routes
+}
+
+// Count represents the number of requests for a single dimension value
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// UserAgentStats represents request counts broken down by user agent dimensions
+type UserAgentStats struct {
+	Total         int     `json:"total"`
+	Humans        int     `json:"humans"`
+	Bots          int     `json:"bots"`
+	BotPercent    float64 `json:"bot_percent"`
+	Browsers      []Count `json:"browsers"`
+	OS            []Count `json:"os"`
+	Devices       []Count `json:"devices"`
+	BotNames      []Count `json:"bot_names"`
+	BotCategories []Count `json:"bot_categories"`
+}
+
+// UserAgents aggregates entries by browser, OS, device class and bot identity
+func UserAgents(entries []*logs.TraefikLog, parser *useragent.Parser, limit int) UserAgentStats {
+	browsers := make(map[string]int)
+	systems := make(map[string]int)
+	devices := make(map[string]int)
+	botNames := make(map[string]int)
+	botCategories := make(map[string]int)
+
+	result := UserAgentStats{Total: len(entries)}
+
+	for _, entry := range entries {
+		info := parser.Parse(entry.RequestUserAgent)
+		devices[info.Device]++
+
+		if info.Bot {
+			result.Bots++
+			botNames[info.BotName]++
+			botCategories[info.BotCategory]++
+			continue
+		}
+
+		result.Humans++
+		browsers[info.Browser]++
+		systems[info.OS]++
+	}
+
+	if result.Total > 0 {
+		result.BotPercent = float64(result.Bots) / float64(result.Total) * 100
+	}
+
+	result.Browsers = topCounts(browsers, limit)
+	result.OS = topCounts(systems, limit)
+	result.Devices = topCounts(devices, limit)
+	result.BotNames = topCounts(botNames, limit)
+	result.BotCategories = topCounts(botCategories, limit)
+
+	return result
+}
+
+// topCounts converts a count map into a slice sorted by descending count
+func topCounts(counts map[string]int, limit int) []Count {
+	result := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, Count{Name: name, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+// ASNStat represents traffic aggregated by autonomous system
+type ASNStat struct {
+	ASN          uint   `json:"asn"`
+	Organization string `json:"organization"`
+	Requests     int    `json:"requests"`
+	Errors       int    `json:"errors"`
+	Bytes        int64  `json:"bytes"`
+	UniqueIPs    int    `json:"unique_ips"`
+}
+
+// ByASN groups entries by the autonomous system of their client IP.
+// Clients without ASN data are grouped under ASN 0.
+func ByASN(entries []*logs.TraefikLog, lookup func(string) location.Location, limit int) []ASNStat {
+	resolved := make(map[string]location.Location)
+	asnMap := make(map[uint]*ASNStat)
+	ipSets := make(map[uint]map[string]struct{})
+
+	for _, entry := range entries {
+		ip := entry.ClientHost
+		loc, ok := resolved[ip]
+		if !ok {
+			loc = lookup(ip)
+			resolved[ip] = loc
+		}
+
+		as, exists := asnMap[loc.ASN]
+		if !exists {
+			as = &ASNStat{ASN: loc.ASN, Organization: loc.Organization}
+			if loc.ASN == 0 {
+				as.Organization = "Unknown"
+			}
+			asnMap[loc.ASN] = as
+			ipSets[loc.ASN] = make(map[string]struct{})
+		}
+
+		as.Requests++
+		as.Bytes += entry.DownstreamContentSize
+		if entry.DownstreamStatus >= 400 {
+			as.Errors++
+		}
+		ipSets[loc.ASN][ip] = struct{}{}
+	}
+
+	result := make([]ASNStat, 0, len(asnMap))
+	for asn, as := range asnMap {
+		as.UniqueIPs = len(ipSets[asn])
+		result = append(result, *as)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Requests != result[j].Requests {
+			return result[i].Requests > result[j].Requests
+		}
+		return result[i].ASN < result[j].ASN
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
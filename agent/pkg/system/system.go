@@ -16,6 +16,8 @@ import (
 	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/logger"
 )
 
+var log = logger.With("system")
+
 const commandTimeout = 5 * time.Second
 
 // SystemInfo represents system information for the API response
@@ -56,7 +58,7 @@ type DiskStats struct {
 func MeasureSystem() (SystemInfo, error) {
 	uptime, err := getUptime()
 	if err != nil {
-		logger.Log.Printf("Warning: Could not get uptime: %v", err)
+		log.Warn("Could not get uptime", logger.Err(err))
 		uptime = 0
 	}
 
@@ -88,19 +90,19 @@ func getCPUStats() (CPUStats, error) {
 	// Try gopsutil first
 	cpuInfo, err := cpu.Info()
 	if err != nil {
-		logger.Log.Printf("gopsutil cpu.Info() failed: %v, trying OS-specific fallback", err)
+		log.Debug("gopsutil cpu.Info() failed, trying OS-specific fallback", logger.Err(err))
 		return getCPUStatsFallback()
 	}
 
 	if len(cpuInfo) == 0 {
-		logger.Log.Printf("gopsutil returned empty CPU info, trying OS-specific fallback")
+		log.Debug("gopsutil returned empty CPU info, trying OS-specific fallback")
 		return getCPUStatsFallback()
 	}
 
 	// Get per-CPU usage (set percpu=true)
 	cpuUsage, err := cpu.Percent(time.Second, true)
 	if err != nil {
-		logger.Log.Printf("Warning: Could not get CPU usage: %v", err)
+		log.Warn("Could not get CPU usage", logger.Err(err))
 		cpuUsage = make([]float64, runtime.NumCPU())
 	}
 
@@ -335,7 +337,7 @@ func getMemoryStats() (MemoryStats, error) {
 func getDiskStats() (DiskStats, error) {
 	usage, err := disk.Usage("/")
 	if err != nil {
-		logger.Log.Printf("Error getting root disk usage: %v", err)
+		log.Error("Failed to get root disk usage", logger.Err(err))
 		return DiskStats{}, fmt.Errorf("failed to get root disk usage: %w", err)
 	}
 
@@ -345,11 +347,11 @@ func getDiskStats() (DiskStats, error) {
 		usedPercent = (float64(usage.Used) / float64(usage.Total)) * 100.0
 	}
 
-	logger.Log.Printf("Root disk stats: total=%.2f GB, used=%.2f GB, free=%.2f GB, percent=%.1f%%",
-		float64(usage.Total)/1024/1024/1024,
-		float64(usage.Used)/1024/1024/1024,
-		float64(usage.Free)/1024/1024/1024,
-		usedPercent)
+	log.Debug("Root disk stats",
+		"total_gb", parseFloat(float64(usage.Total)/1024/1024/1024, 2),
+		"used_gb", parseFloat(float64(usage.Used)/1024/1024/1024, 2),
+		"free_gb", parseFloat(float64(usage.Free)/1024/1024/1024, 2),
+		"used_percent", parseFloat(usedPercent, 1))
 
 	return DiskStats{
 		Total:       usage.Total,
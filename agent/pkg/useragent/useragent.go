@@ -0,0 +1,180 @@
+package useragent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Device classes reported by the parser
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// maxCacheEntries bounds the number of parsed user agents kept in memory
+const maxCacheEntries = 4096
+
+//go:embed rules.json
+var defaultRules []byte
+
+// Info represents the parsed dimensions of a user agent string
+type Info struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Device         string `json:"device"`
+	Bot            bool   `json:"bot"`
+	BotName        string `json:"bot_name,omitempty"`
+	BotCategory    string `json:"bot_category,omitempty"`
+}
+
+// RuleSet is the JSON document describing bots, browsers, operating systems and devices
+type RuleSet struct {
+	Bots     []Rule `json:"bots"`
+	Browsers []Rule `json:"browsers"`
+	OS       []Rule `json:"os"`
+	Devices  []Rule `json:"devices"`
+}
+
+// Rule matches a user agent against Pattern; the first capture group is used as the version
+type Rule struct {
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Pattern  string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// Parser classifies user agent strings using a rule set
+type Parser struct {
+	rules RuleSet
+
+	mu    sync.RWMutex
+	cache map[string]Info
+}
+
+// NewParser creates a parser from the embedded rule set, or from rulesPath if set
+func NewParser(rulesPath string) (*Parser, error) {
+	data := defaultRules
+	if rulesPath != "" {
+		var err error
+		data, err = os.ReadFile(rulesPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read user agent rules: %w", err)
+		}
+	}
+
+	var rules RuleSet
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse user agent rules: %w", err)
+	}
+
+	for _, group := range [][]Rule{rules.Bots, rules.Browsers, rules.OS, rules.Devices} {
+		for i := range group {
+			re, err := regexp.Compile(group[i].Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user agent rule %q: %w", group[i].Name, err)
+			}
+			group[i].re = re
+		}
+	}
+
+	return &Parser{
+		rules: rules,
+		cache: make(map[string]Info),
+	}, nil
+}
+
+// Default returns a parser using the embedded rule set
+func Default() *Parser {
+	p, err := NewParser("")
+	if err != nil {
+		// The embedded rules ship with the binary, so this is a programming error
+		panic(err)
+	}
+	return p
+}
+
+// Parse classifies a user agent string
+func (p *Parser) Parse(ua string) Info {
+	ua = strings.TrimSpace(ua)
+	if ua == "" || ua == "-" {
+		return Info{Browser: "Unknown", OS: "Unknown", Device: DeviceUnknown}
+	}
+
+	p.mu.RLock()
+	info, ok := p.cache[ua]
+	p.mu.RUnlock()
+	if ok {
+		return info
+	}
+
+	info = p.parse(ua)
+
+	p.mu.Lock()
+	if len(p.cache) >= maxCacheEntries {
+		p.cache = make(map[string]Info)
+	}
+	p.cache[ua] = info
+	p.mu.Unlock()
+
+	return info
+}
+
+// parse evaluates the rule set against a user agent string
+func (p *Parser) parse(ua string) Info {
+	info := Info{Browser: "Other", OS: "Other", Device: DeviceDesktop}
+
+	if rule, _, ok := match(p.rules.Bots, ua); ok {
+		info.Bot = true
+		info.BotName = rule.Name
+		info.BotCategory = rule.Category
+		info.Device = DeviceBot
+	}
+
+	if rule, version, ok := match(p.rules.Browsers, ua); ok {
+		info.Browser = rule.Name
+		info.BrowserVersion = version
+	}
+
+	if rule, version, ok := match(p.rules.OS, ua); ok {
+		info.OS = rule.Name
+		info.OSVersion = strings.ReplaceAll(version, "_", ".")
+	}
+
+	if !info.Bot {
+		if rule, _, ok := match(p.rules.Devices, ua); ok {
+			info.Device = rule.Name
+		} else if info.OS == "Android" {
+			// Android tablets omit the "Mobile" token that phones send
+			info.Device = DeviceTablet
+		}
+	}
+
+	return info
+}
+
+// match returns the first rule matching the user agent along with its captured version
+func match(rules []Rule, ua string) (Rule, string, bool) {
+	for _, rule := range rules {
+		matches := rule.re.FindStringSubmatch(ua)
+		if matches == nil {
+			continue
+		}
+		version := ""
+		if len(matches) > 1 {
+			version = matches[1]
+		}
+		return rule, version, true
+	}
+	return Rule{}, "", false
+}
@@ -0,0 +1,70 @@
+package useragent
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	p := Default()
+
+	for _, tc := range []struct {
+		ua   string
+		want Info
+	}{
+		{
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{Browser: "Other", OS: "Other", Device: DeviceBot, Bot: true, BotName: "Googlebot", BotCategory: "search"},
+		},
+		{
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: Info{Browser: "Firefox", BrowserVersion: "121.0", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari", BrowserVersion: "17.1", OS: "iOS", OSVersion: "17.1", Device: DeviceMobile},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: Info{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", OSVersion: "13", Device: DeviceTablet},
+		},
+		{
+			ua:   "-",
+			want: Info{Browser: "Unknown", OS: "Unknown", Device: DeviceUnknown},
+		},
+	} {
+		if got := p.Parse(tc.ua); got != tc.want {
+			t.Errorf("Parse(%q):\nexpected %+v\ngot      %+v", tc.ua, tc.want, got)
+		}
+	}
+
+	if got := p.Parse("curl/8.4.0"); !got.Bot || got.BotName != "curl" {
+		t.Errorf("Expected curl to be classified as a bot, got %+v", got)
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	dir := t.TempDir()
+	rules := dir + "/rules.json"
+	if err := os.WriteFile(rules, []byte(`{"bots":[{"name":"Internal","category":"monitoring","pattern":"acme-probe"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write rules: %v", err)
+	}
+	p, err := NewParser(rules)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+	if got := p.Parse("acme-probe/1.0"); got.BotName != "Internal" || got.BotCategory != "monitoring" {
+		t.Errorf("Expected the custom bot rule to match, got %+v", got)
+	}
+
+	if err := os.WriteFile(rules, []byte(`{"bots":[{"name":"Broken","pattern":"("}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write rules: %v", err)
+	}
+	if _, err := NewParser(rules); err == nil || !strings.Contains(err.Error(), "Broken") {
+		t.Errorf("Expected an invalid pattern to be rejected, got %v", err)
+	}
+	if _, err := NewParser(dir + "/missing.json"); err == nil {
+		t.Error("Expected a missing rules file to be rejected")
+	}
+}
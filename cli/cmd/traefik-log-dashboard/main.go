@@ -6,6 +6,7 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/hhftechnology/traefik-log-dashboard/cli/internal/config"
+	"github.com/hhftechnology/traefik-log-dashboard/cli/internal/logs"
 	"github.com/hhftechnology/traefik-log-dashboard/cli/internal/model"
 	"github.com/joho/godotenv"
 )
@@ -21,8 +22,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Configure route templating for the top routes card
+	if err := logs.ConfigureRouteTemplates(cfg.PathPatterns, cfg.PathQueryMode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading path patterns: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Create initial model
-	m := model.NewModel(cfg)
+	m, err := model.NewModel(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating agent client: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Create program
 	p := tea.NewProgram(
@@ -5,6 +5,7 @@ go 1.23
 require (
 	github.com/charmbracelet/bubbletea v0.25.0
 	github.com/charmbracelet/lipgloss v0.10.0
+	github.com/hhftechnology/traefik-log-dashboard/agent v0.0.0
 	github.com/joho/godotenv v1.5.1
 )
 
@@ -21,7 +22,10 @@ require (
 	github.com/muesli/termenv v0.15.2 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/sync v0.6.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 	golang.org/x/term v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
+
+// The CLI builds against the agent in the same checkout
+replace github.com/hhftechnology/traefik-log-dashboard/agent => ../agent
@@ -22,6 +22,10 @@ type Config struct {
 	RefreshInterval time.Duration
 	MaxLogs         int
 	
+	// Route templating
+	PathPatterns  string
+	PathQueryMode string
+	
 	// Feature flags
 	DemoMode          bool
 	SystemMonitoring  bool
@@ -36,6 +40,8 @@ func Load() (*Config, error) {
 		ErrorLogPath:     env.GetEnv("ERROR_LOG_PATH", "/var/log/traefik/traefik.log"),
 		RefreshInterval:  parseDuration(env.GetEnv("REFRESH_INTERVAL", "2s")),
 		MaxLogs:          parseInt(env.GetEnv("MAX_LOGS", "1000")),
+		PathPatterns:     env.GetEnv("PATH_PATTERNS", ""),
+		PathQueryMode:    env.GetEnv("PATH_QUERY_MODE", "strip"),
 		DemoMode:         parseBool(env.GetEnv("DEMO_MODE", "false")),
 		SystemMonitoring: parseBool(env.GetEnv("SYSTEM_MONITORING", "true")),
 	}
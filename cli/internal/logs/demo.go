@@ -37,7 +37,7 @@ func generateDemoLog() TraefikLog {
 	duration := randomDuration()
 	originDuration := int64(float64(duration) * 0.8)
 	overhead := duration - originDuration
-	size := rand.Intn(10000)
+	size := rand.Int63n(10000)
 	router := routers[rand.Intn(len(routers))]
 	service := services[rand.Intn(len(services))]
 	serviceURL := serviceURLs[rand.Intn(len(serviceURLs))]
@@ -70,7 +70,7 @@ func generateDemoLog() TraefikLog {
 		ServiceAddr:           serviceURL,
 		ServiceName:           service,
 		ServiceURL:            serviceURL,
-		StartLocal:            timestamp,
+		StartLocal:            timestamp.Local(),
 		StartUTC:              timestamp,
 		EntryPointName:        entryPoint,
 		RequestReferer:        "",
@@ -116,16 +116,9 @@ func randomDuration() int64 {
 }
 
 // randomTimestamp generates a random timestamp within the last N minutes
-func randomTimestamp(minutesAgo int) string {
+func randomTimestamp(minutesAgo int) time.Time {
 	now := time.Now()
 	past := now.Add(-time.Duration(minutesAgo) * time.Minute)
 	randomTime := past.Add(time.Duration(rand.Int63n(int64(time.Duration(minutesAgo) * time.Minute))))
-	return randomTime.Format(time.RFC3339)
+	return randomTime.UTC().Truncate(time.Second)
 }
-
-// ParseTraefikLog is a wrapper that calls the traefik package parser
-func ParseTraefikLog(logLine string) (*TraefikLog, error) {
-	// This will be imported from traefik package
-	// For now, return a stub
-	return nil, fmt.Errorf("not implemented - use traefik.ParseLog")
-}
\ No newline at end of file
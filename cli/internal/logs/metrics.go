@@ -3,8 +3,28 @@ package logs
 import (
 	"math"
 	"sort"
+
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/pathnorm"
 )
 
+// routeNormalizer holds the path rules and query handling shared with the agent;
+// each batch learns templates in an empty copy of it
+var routeNormalizer = pathnorm.New(pathnorm.Options{})
+
+// ConfigureRouteTemplates replaces the route normalizer with custom patterns and query handling
+func ConfigureRouteTemplates(patterns, queryMode string) error {
+	rules, err := pathnorm.ParseRules(patterns)
+	if err != nil {
+		return err
+	}
+
+	routeNormalizer = pathnorm.New(pathnorm.Options{
+		Rules:     rules,
+		QueryMode: pathnorm.ParseQueryMode(queryMode),
+	})
+	return nil
+}
+
 // Metrics represents calculated metrics from logs
 type Metrics struct {
 	TotalRequests    int
@@ -95,18 +115,26 @@ func CalculateMetrics(logs []TraefikLog) *Metrics {
 	return metrics
 }
 
-// calculateTopRoutes calculates top routes by request count
+// calculateTopRoutes calculates top route templates by request count
 func calculateTopRoutes(logs []TraefikLog, limit int) []RouteMetric {
+	// Refreshes pass the same lines again, so learn from this batch alone, and
+	// from all of it first so every entry is grouped under the same template
+	normalizer := routeNormalizer.Empty()
+	for _, log := range logs {
+		normalizer.Observe(log.RequestPath)
+	}
+
 	routeMap := make(map[string]*RouteMetric)
 
 	for _, log := range logs {
-		key := log.RequestMethod + " " + log.RequestPath
+		path := normalizer.Normalize(log.RequestPath)
+		key := log.RequestMethod + " " + path
 		if rm, exists := routeMap[key]; exists {
 			rm.Count++
 			rm.AvgDuration = (rm.AvgDuration*float64(rm.Count-1) + float64(log.Duration)/1000000) / float64(rm.Count)
 		} else {
 			routeMap[key] = &RouteMetric{
-				Path:        log.RequestPath,
+				Path:        path,
 				Method:      log.RequestMethod,
 				Count:       1,
 				AvgDuration: float64(log.Duration) / 1000000,
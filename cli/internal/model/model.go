@@ -1,9 +1,11 @@
 package model
 
 import (
+	"context"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/client"
 	"github.com/hhftechnology/traefik-log-dashboard/cli/internal/config"
 	"github.com/hhftechnology/traefik-log-dashboard/cli/internal/logs"
 )
@@ -15,11 +17,13 @@ const (
 	DashboardView ViewMode = iota
 	AccessLogsView
 	ErrorLogsView
+	SecurityView
 )
 
 // Model represents the application state
 type Model struct {
 	cfg             *config.Config
+	agent           *client.Client
 	currentView     ViewMode
 	width           int
 	height          int
@@ -29,6 +33,7 @@ type Model struct {
 	errorLogs       []string
 	metrics         *logs.Metrics
 	systemStats     *logs.SystemStats
+	findings        []logs.SecurityFinding
 	
 	// State
 	loading         bool
@@ -43,15 +48,24 @@ type Model struct {
 	quitting        bool
 }
 
+// fetchTimeout bounds one refresh, including retries of failed requests
+const fetchTimeout = 30 * time.Second
+
 // NewModel creates a new Model
-func NewModel(cfg *config.Config) Model {
+func NewModel(cfg *config.Config) (Model, error) {
+	agent, err := client.New(client.Config{URL: cfg.AgentURL, Token: cfg.AuthToken})
+	if err != nil {
+		return Model{}, err
+	}
+
 	return Model{
 		cfg:         cfg,
+		agent:       agent,
 		currentView: DashboardView,
 		loading:     true,
 		lastUpdate:  time.Now(),
 		activeTab:   0,
-	}
+	}, nil
 }
 
 // Init initializes the model
@@ -72,14 +86,18 @@ func (m Model) tick() tea.Cmd {
 // fetchData fetches all data from the agent
 func (m Model) fetchData() tea.Cmd {
 	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		defer cancel()
+
 		// Fetch access logs
-		accessLogs, err := logs.FetchAccessLogs(m.cfg.AgentURL, m.cfg.AuthToken, m.cfg.MaxLogs)
+		accessPage, err := m.agent.AccessLogs(ctx, client.LogQuery{Limit: m.cfg.MaxLogs})
 		if err != nil {
 			return errMsg{err}
 		}
+		accessLogs := logs.ParseAccessLogs(accessPage.Lines)
 
 		// Fetch error logs
-		errorLogs, err := logs.FetchErrorLogs(m.cfg.AgentURL, m.cfg.AuthToken, 100)
+		errorPage, err := m.agent.ErrorLogs(ctx, client.LogQuery{Limit: 100})
 		if err != nil {
 			return errMsg{err}
 		}
@@ -90,14 +108,21 @@ func (m Model) fetchData() tea.Cmd {
 		// Fetch system stats if enabled
 		var systemStats *logs.SystemStats
 		if m.cfg.SystemMonitoring {
-			systemStats, _ = logs.FetchSystemStats(m.cfg.AgentURL, m.cfg.AuthToken)
+			systemStats, _ = m.agent.SystemResources(ctx)
+		}
+
+		// Fetch security findings; disabled detection returns none
+		var findings []logs.SecurityFinding
+		if result, err := m.agent.Findings(ctx, client.FindingQuery{}); err == nil {
+			findings = result.Findings
 		}
 
 		return dataMsg{
 			accessLogs:  accessLogs,
-			errorLogs:   errorLogs,
+			errorLogs:   errorPage.Lines,
 			metrics:     metrics,
 			systemStats: systemStats,
+			findings:    findings,
 		}
 	}
 }
\ No newline at end of file
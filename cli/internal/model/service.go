@@ -1,62 +1,62 @@
 package model
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/hhftechnology/traefik-log-dashboard/agent/pkg/client"
 	"github.com/hhftechnology/traefik-log-dashboard/cli/internal/logs"
 )
 
 // LogService handles log fetching and processing
 type LogService struct {
-	agentURL  string
-	authToken string
-	demoMode  bool
+	agent    *client.Client
+	demoMode bool
 }
 
 // NewLogService creates a new LogService
-func NewLogService(agentURL, authToken string, demoMode bool) *LogService {
+func NewLogService(agent *client.Client, demoMode bool) *LogService {
 	return &LogService{
-		agentURL:  agentURL,
-		authToken: authToken,
-		demoMode:  demoMode,
+		agent:    agent,
+		demoMode: demoMode,
 	}
 }
 
 // FetchAccessLogs fetches access logs from agent or generates demo data
-func (s *LogService) FetchAccessLogs(maxLogs int) ([]logs.TraefikLog, error) {
+func (s *LogService) FetchAccessLogs(ctx context.Context, maxLogs int) ([]logs.TraefikLog, error) {
 	if s.demoMode {
 		return logs.GenerateDemoLogs(maxLogs), nil
 	}
 
-	accessLogs, err := logs.FetchAccessLogs(s.agentURL, s.authToken, maxLogs)
+	page, err := s.agent.AccessLogs(ctx, client.LogQuery{Limit: maxLogs})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch access logs: %w", err)
 	}
 
-	return accessLogs, nil
+	return logs.ParseAccessLogs(page.Lines), nil
 }
 
 // FetchErrorLogs fetches error logs from agent or generates demo data
-func (s *LogService) FetchErrorLogs(maxLogs int) ([]string, error) {
+func (s *LogService) FetchErrorLogs(ctx context.Context, maxLogs int) ([]string, error) {
 	if s.demoMode {
 		return generateDemoErrorLogs(maxLogs), nil
 	}
 
-	errorLogs, err := logs.FetchErrorLogs(s.agentURL, s.authToken, maxLogs)
+	page, err := s.agent.ErrorLogs(ctx, client.LogQuery{Limit: maxLogs})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch error logs: %w", err)
 	}
 
-	return errorLogs, nil
+	return page.Lines, nil
 }
 
 // FetchSystemStats fetches system statistics from agent
-func (s *LogService) FetchSystemStats() (*logs.SystemStats, error) {
+func (s *LogService) FetchSystemStats(ctx context.Context) (*logs.SystemStats, error) {
 	if s.demoMode {
 		return generateDemoSystemStats(), nil
 	}
 
-	stats, err := logs.FetchSystemStats(s.agentURL, s.authToken)
+	stats, err := s.agent.SystemResources(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch system stats: %w", err)
 	}
@@ -65,20 +65,20 @@ func (s *LogService) FetchSystemStats() (*logs.SystemStats, error) {
 }
 
 // FetchAllData fetches all data (access logs, error logs, system stats)
-func (s *LogService) FetchAllData(maxAccessLogs, maxErrorLogs int) (*AllData, error) {
-	accessLogs, err := s.FetchAccessLogs(maxAccessLogs)
+func (s *LogService) FetchAllData(ctx context.Context, maxAccessLogs, maxErrorLogs int) (*AllData, error) {
+	accessLogs, err := s.FetchAccessLogs(ctx, maxAccessLogs)
 	if err != nil {
 		return nil, err
 	}
 
-	errorLogs, err := s.FetchErrorLogs(maxErrorLogs)
+	errorLogs, err := s.FetchErrorLogs(ctx, maxErrorLogs)
 	if err != nil {
 		// Don't fail if error logs can't be fetched
 		errorLogs = []string{}
 	}
 
 	var systemStats *logs.SystemStats
-	systemStats, err = s.FetchSystemStats()
+	systemStats, err = s.FetchSystemStats(ctx)
 	if err != nil {
 		// Don't fail if system stats can't be fetched
 		systemStats = nil
@@ -16,6 +16,7 @@ type dataMsg struct {
 	errorLogs   []string
 	metrics     *logs.Metrics
 	systemStats *logs.SystemStats
+	findings    []logs.SecurityFinding
 }
 
 type errMsg struct {
@@ -45,6 +46,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.errorLogs = msg.errorLogs
 		m.metrics = msg.metrics
 		m.systemStats = msg.systemStats
+		m.findings = msg.findings
 		m.loading = false
 		m.err = nil
 		m.lastUpdate = time.Now()
@@ -73,7 +75,7 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case "tab":
 		// Cycle through tabs
-		m.activeTab = (m.activeTab + 1) % 3
+		m.activeTab = (m.activeTab + 1) % 4
 		return m, nil
 
 	case "1":
@@ -90,6 +92,11 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.selectedIndex = 0
 		return m, nil
 
+	case "4":
+		m.currentView = SecurityView
+		m.selectedIndex = 0
+		return m, nil
+
 	case "up", "k":
 		if m.selectedIndex > 0 {
 			m.selectedIndex--
@@ -103,6 +110,8 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			maxIndex = len(m.accessLogs) - 1
 		case ErrorLogsView:
 			maxIndex = len(m.errorLogs) - 1
+		case SecurityView:
+			maxIndex = len(m.findings) - 1
 		}
 		if m.selectedIndex < maxIndex {
 			m.selectedIndex++
@@ -119,6 +128,8 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.selectedIndex = len(m.accessLogs) - 1
 		case ErrorLogsView:
 			m.selectedIndex = len(m.errorLogs) - 1
+		case SecurityView:
+			m.selectedIndex = len(m.findings) - 1
 		}
 		return m, nil
 
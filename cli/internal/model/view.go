@@ -28,6 +28,8 @@ func (m Model) View() string {
 		content = m.renderAccessLogs()
 	case ErrorLogsView:
 		content = m.renderErrorLogs()
+	case SecurityView:
+		content = m.renderSecurity()
 	}
 
 	// Render footer
@@ -182,12 +184,88 @@ func (m Model) renderErrorLogs() string {
 	return sb.String()
 }
 
+// renderSecurity renders the security findings view
+func (m Model) renderSecurity() string {
+	if len(m.findings) == 0 {
+		return styles.MutedStyle.Render("No security findings")
+	}
+	
+	var sb strings.Builder
+	sb.WriteString(styles.SubtitleStyle.Render(fmt.Sprintf("Security Findings (%d)", len(m.findings))))
+	sb.WriteString("\n\n")
+	
+	// Reserve space below the list for the selected finding's evidence
+	maxVisible := min(max(1, (m.height-12)/2), len(m.findings))
+	start := max(0, m.selectedIndex-maxVisible+1)
+	end := min(len(m.findings), start+maxVisible)
+	
+	for i := start; i < end; i++ {
+		finding := m.findings[i]
+		
+		style := severityStyle(finding.Severity)
+		if i == m.selectedIndex {
+			style = styles.SelectedStyle
+		}
+		
+		line := fmt.Sprintf(
+			"%-6s %-13s %-39s %5d  %s",
+			strings.ToUpper(finding.Severity),
+			finding.Type,
+			finding.ClientIP,
+			finding.Count,
+			finding.LastSeen.Local().Format("15:04:05"),
+		)
+		
+		sb.WriteString(style.Render(line))
+		sb.WriteString("\n")
+	}
+	
+	if m.selectedIndex >= 0 && m.selectedIndex < len(m.findings) {
+		finding := m.findings[m.selectedIndex]
+		
+		sb.WriteString("\n")
+		sb.WriteString(styles.SubtitleStyle.Render(finding.Description))
+		sb.WriteString("\n")
+		sb.WriteString(styles.MutedStyle.Render(fmt.Sprintf(
+			"Window %s • first seen %s",
+			finding.Window,
+			finding.FirstSeen.Local().Format("2006-01-02 15:04:05"),
+		)))
+		sb.WriteString("\n")
+		
+		if finding.Evidence.Rule != "" {
+			sb.WriteString(fmt.Sprintf("Rule: %s\n", finding.Evidence.Rule))
+		}
+		for _, path := range finding.Evidence.Paths {
+			sb.WriteString(fmt.Sprintf("  %s\n", truncate(path, m.width-6)))
+		}
+		for _, sample := range finding.Evidence.Samples {
+			sb.WriteString(styles.MutedStyle.Render(truncate(sample, m.width-4)))
+			sb.WriteString("\n")
+		}
+	}
+	
+	return sb.String()
+}
+
+// severityStyle returns the row style for a finding severity
+func severityStyle(severity string) lipgloss.Style {
+	switch severity {
+	case "high":
+		return styles.ErrorStyle
+	case "medium":
+		return styles.WarningStyle
+	}
+	return styles.DefaultStyle
+}
+
 // renderFooter renders the application footer with keybindings
 func (m Model) renderFooter() string {
 	keybindings := []string{
 		"1: Dashboard",
 		"2: Access Logs",
 		"3: Error Logs",
+		"4: Security",
 		"r: Refresh",
 		"d: Demo",
 		"q: Quit",
@@ -3,7 +3,6 @@ package cards
 import (
 	"fmt"
 	"strings"
-	"time" // Import the 'time' package
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/hhftechnology/traefik-log-dashboard/cli/internal/logs"
@@ -43,14 +42,9 @@ func RenderErrors(errorLogs []logs.TraefikLog, width int) string {
 	for i := 0; i < displayCount; i++ {
 		log := errorLogs[i]
 
-		// FIX: Parse the timestamp string into a time.Time object before formatting
-		var timestamp string
-		parsedTime, err := time.Parse(time.RFC3339Nano, log.StartUTC)
-		if err != nil {
-			// If parsing fails, use a fallback or the raw string
-			timestamp = "??:??:??"
-		} else {
-			timestamp = parsedTime.Format("15:04:05")
+		timestamp := "??:??:??"
+		if !log.StartUTC.IsZero() {
+			timestamp = log.StartUTC.Format("15:04:05")
 		}
 
 		// Status code with color
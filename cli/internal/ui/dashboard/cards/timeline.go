@@ -113,15 +113,13 @@ func groupByTimeBucket(logs []logs.TraefikLog, interval time.Duration) []TimeBuc
 	var minTime, maxTime time.Time
 
 	// Find the time range of the logs
-	for i, log := range logs {
-		// Assuming StartUTC is a string, parse it.
-		// If it's already a time.Time, this check can be simplified.
-		parsedTime, err := time.Parse(time.RFC3339Nano, log.StartUTC)
-		if err != nil {
-			continue // Skip logs with unparseable timestamps
+	for _, log := range logs {
+		parsedTime := log.StartUTC
+		if parsedTime.IsZero() {
+			continue // Skip logs without a timestamp
 		}
 
-		if i == 0 {
+		if minTime.IsZero() {
 			minTime = parsedTime
 			maxTime = parsedTime
 		} else {